@@ -0,0 +1,248 @@
+package core
+
+import (
+	"fmt"
+	"github.com/SoulPancake/HFT/types"
+	"os"
+	"strings"
+)
+
+// Emit timing constraints in Synopsys SDC format to out.sdc
+func EmitSDC(mod *hdl.Module) {
+	emitConstraints(mod, "out.sdc", "sdc")
+}
+
+// Emit timing constraints in Xilinx XDC format to out.xdc
+func EmitXDC(mod *hdl.Module) {
+	emitConstraints(mod, "out.xdc", "xdc")
+}
+
+func emitConstraints(mod *hdl.Module, path, format string) {
+	if err := os.WriteFile(path, []byte(Constraints(mod, format)), 0644); err != nil {
+		panic(err)
+	}
+}
+
+// Timing constraints for the module's clock domains and synchronizers.
+// Every domain with a frequency gets a clock. The first flop of a
+// single-bit synchronizer is a false path; multi-bit stages (Gray-coded
+// pointers) and registers capturing data held stable by a handshake get a
+// max delay of the faster clock's period so the bits stay within one
+// destination cycle of each other. Synchronizers of instances built in Go
+// are constrained with hierarchical cell names, and the first flop of a
+// reset synchronizer is a false path. Format is "sdc" or "xdc".
+func Constraints(mod *hdl.Module, format string) string {
+	if format != "sdc" && format != "xdc" {
+		panic(fmt.Sprintf("unknown constraint format %q", format))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Timing constraints for %s\n\n", mod.Name)
+	
+	// Clocks
+	for _, cd := range mod.ClockDomains {
+		switch cd.Derivation {
+		case "mux":
+			// One clock per input on the mux output; only one is ever active
+			var groups []string
+			for _, src := range cd.Sources {
+				clock := cd.Name + "_" + src.Name
+				fmt.Fprintf(&b, "create_generated_clock -name %s -source %s -divide_by 1 -add -master_clock %s [get_nets {%s}]\n",
+					clock, clockSource(src), src.Name, cd.Clock.Name)
+				groups = append(groups, fmt.Sprintf("-group [get_clocks %s]", clock))
+			}
+			fmt.Fprintf(&b, "set_clock_groups -physically_exclusive %s\n", strings.Join(groups, " "))
+			continue
+		case "divider", "generated", "gated":
+			fmt.Fprintf(&b, "create_generated_clock -name %s -source %s", cd.Name, clockSource(cd.Parent))
+			if cd.Multiply > 1 {
+				fmt.Fprintf(&b, " -multiply_by %d", cd.Multiply)
+			}
+			fmt.Fprintf(&b, " -divide_by %d %s\n", cd.Divide, clockSource(cd))
+			continue
+		case "enable":
+			// Shares the parent clock; its registers get multicycle paths below
+			continue
+		}
+		if cd.Frequency <= 0 {
+			fmt.Fprintf(&b, "# %s: no frequency set, clock %s not constrained\n", cd.Name, cd.Clock.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "create_clock -name %s -period %.3f [get_ports %s]\n", cd.Name, cd.Period(), cd.Clock.Name)
+	}
+	
+	// Clock-enable domains advance once every Divide parent cycles
+	scopes := hierarchy(mod)
+	for _, sc := range scopes {
+		for _, cd := range sc.mod.ClockDomains {
+			if cd.Derivation != "enable" || cd.Divide < 2 {
+				continue
+			}
+			var cells []string
+			for _, reg := range sc.mod.Regs {
+				if reg.ClockDomain == cd {
+					cells = append(cells, sc.path+reg.Name+"_reg*")
+				}
+			}
+			if len(cells) == 0 {
+				continue
+			}
+			group := fmt.Sprintf("[get_cells {%s}]", strings.Join(cells, " "))
+			fmt.Fprintf(&b, "\n# %s%s: clock enable every %d cycles of %s\n", sc.path, cd.Name, cd.Divide, cd.Parent.Name)
+			fmt.Fprintf(&b, "set_multicycle_path %d -setup -from %s -to %s\n", cd.Divide, group, group)
+			fmt.Fprintf(&b, "set_multicycle_path %d -hold -from %s -to %s\n", cd.Divide-1, group, group)
+		}
+	}
+	
+	// Synchronizer stages, throughout the instance tree
+	domains := topDomains(mod)
+	for _, sc := range scopes {
+		for _, sync := range sc.mod.Synchronizers {
+			if len(sync.Captures) == 0 && sync.Kind != "reset" {
+				continue
+			}
+			fmt.Fprintf(&b, "\n# %s synchronizer %s%s\n", sync.Kind, sc.path, sync.Name)
+			if format == "xdc" && sc.path != "" && len(sync.Stages) > 0 {
+				// Flops below the top carry no attribute in the emitted Verilog
+				var cells []string
+				for _, stage := range sync.Stages {
+					cells = append(cells, sc.path+stage.Name+"_reg*")
+				}
+				fmt.Fprintf(&b, "set_property ASYNC_REG TRUE [get_cells {%s}]\n", strings.Join(cells, " "))
+			}
+			if sync.Kind == "reset" {
+				// The reset asserts asynchronously; only its release is
+				// timed, by the synchronizer, from the first stage on
+				if len(sync.Stages) > 0 {
+					fmt.Fprintf(&b, "set_false_path -to [get_cells {%s%s_reg*}]\n", sc.path, sync.Stages[0].Name)
+				}
+				continue
+			}
+			src, dest := domains[sync.SrcDomain], domains[sync.DestDomain]
+			if src == nil {
+				src = sync.SrcDomain
+			}
+			if dest == nil {
+				dest = sync.DestDomain
+			}
+			for _, capture := range sync.Captures {
+				from := ""
+				if src != nil && src.Frequency > 0 {
+					from = fmt.Sprintf(" -from [get_clocks %s]", src.Name)
+				}
+				to := fmt.Sprintf(" -to [get_cells {%s%s_reg*}]", sc.path, capture.Name)
+				
+				isStage := len(sync.Stages) > 0 && capture == sync.Stages[0]
+				if isStage && capture.Width == 1 {
+					fmt.Fprintf(&b, "set_false_path%s%s\n", from, to)
+					continue
+				}
+				delay := maxCrossingDelay(src, dest)
+				if delay == 0 {
+					fmt.Fprintf(&b, "# no frequencies set, falling back to a false path\n")
+					fmt.Fprintf(&b, "set_false_path%s%s\n", from, to)
+					continue
+				}
+				datapathOnly := ""
+				if format == "xdc" {
+					datapathOnly = " -datapath_only"
+				}
+				fmt.Fprintf(&b, "set_max_delay%s%s%s %.3f\n", datapathOnly, from, to, delay)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Object a domain's clock is defined on: the input port of a primary
+// clock, the divider flop of a divided clock or the net driven by a PLL
+func clockSource(cd *hdl.ClockDomain) string {
+	switch cd.Derivation {
+	case "divider":
+		return fmt.Sprintf("[get_pins {%s_clk_r_reg/Q}]", cd.Name)
+	case "generated", "gated", "mux":
+		return fmt.Sprintf("[get_nets {%s}]", cd.Clock.Name)
+	case "enable":
+		return clockSource(cd.Parent)
+	}
+	return fmt.Sprintf("[get_ports %s]", cd.Clock.Name)
+}
+
+// Period of the faster of the two clocks in nanoseconds, 0 if neither is known
+func maxCrossingDelay(src, dest *hdl.ClockDomain) float64 {
+	delay := 0.0
+	for _, cd := range []*hdl.ClockDomain{src, dest} {
+		if cd == nil {
+			continue
+		}
+		if p := cd.Period(); p > 0 && (delay == 0 || p < delay) {
+			delay = p
+		}
+	}
+	return delay
+}
+
+// Module of the instance tree and the prefix of its cell names, e.g.
+// "u_core/u_sync/"; the top module has an empty prefix
+type scopedModule struct {
+	path string
+	mod  *hdl.Module
+}
+
+// Modules of the instance tree built in Go, top first, depth first
+func hierarchy(mod *hdl.Module) []scopedModule {
+	scopes := []scopedModule{{mod: mod}}
+	for i := 0; i < len(scopes); i++ {
+		sc := scopes[i]
+		var children []scopedModule
+		for _, inst := range sc.mod.Instances {
+			if inst.Module != nil {
+				children = append(children, scopedModule{path: sc.path + inst.InstanceName + "/", mod: inst.Module})
+			}
+		}
+		// Keep depth-first order: children follow their parent
+		scopes = append(scopes[:i+1], append(children, scopes[i+1:]...)...)
+	}
+	return scopes
+}
+
+// Top-level domain of every domain in the instance tree whose clock input
+// is connected, through the instance ports, to a top-level domain's clock.
+// The clocks the constraints create are the top-level ones.
+func topDomains(mod *hdl.Module) map[*hdl.ClockDomain]*hdl.ClockDomain {
+	domains := map[*hdl.ClockDomain]*hdl.ClockDomain{}
+	var walk func(m *hdl.Module, ports map[string]*hdl.ClockDomain)
+	walk = func(m *hdl.Module, ports map[string]*hdl.ClockDomain) {
+		// Top-level domain clocking each net of m
+		clocks := map[string]*hdl.ClockDomain{}
+		for name, cd := range ports {
+			clocks[name] = cd
+		}
+		for _, cd := range m.ClockDomains {
+			if cd.Clock == nil {
+				continue
+			}
+			if top, ok := ports[cd.Clock.Name]; ok {
+				domains[cd] = top
+				continue
+			}
+			domains[cd] = cd
+			if _, ok := clocks[cd.Clock.Name]; !ok {
+				clocks[cd.Clock.Name] = cd
+			}
+		}
+		for _, inst := range m.Instances {
+			if inst.Module == nil {
+				continue
+			}
+			childPorts := map[string]*hdl.ClockDomain{}
+			for port, sig := range inst.Connections {
+				if cd, ok := clocks[sig.Name]; ok {
+					childPorts[port] = cd
+				}
+			}
+			walk(inst.Module, childPorts)
+		}
+	}
+	walk(mod, nil)
+	return domains
+}
@@ -50,8 +50,18 @@ func EmitVerilog(mod *hdl.Module) {
 		fmt.Fprintf(f, "  wire %s %s;\n", wire.Width.Bits(), wire.Name)
 	}
 	
-	// Emit reg declarations
+	// Emit reg declarations, marking synchronizer flops for the placer
+	asyncRegs := make(map[*hdl.Signal]bool)
+	for _, sync := range mod.Synchronizers {
+		for _, stage := range sync.Stages {
+			asyncRegs[stage] = true
+		}
+	}
 	for _, reg := range mod.Regs {
+		if asyncRegs[reg] {
+			fmt.Fprintf(f, "  (* ASYNC_REG = \"TRUE\" *) reg %s %s;\n", reg.Width.Bits(), reg.Name)
+			continue
+		}
 		fmt.Fprintf(f, "  reg %s %s;\n", reg.Width.Bits(), reg.Name)
 	}
 	
@@ -126,10 +136,20 @@ func EmitVerilog(mod *hdl.Module) {
 	if len(mod.ClockDomains) > 0 {
 		fmt.Fprintf(f, "  // Clock Domains:\n")
 		for _, cd := range mod.ClockDomains {
-			fmt.Fprintf(f, "  // - %s: clk=%s, rst=%s", cd.Name, cd.Clock.Name, cd.Reset.Name)
+			fmt.Fprintf(f, "  // - %s: clk=%s", cd.Name, cd.Clock.Name)
+			if cd.Reset != nil {
+				fmt.Fprintf(f, ", rst=%s", cd.Reset.Name)
+			}
 			if cd.Frequency > 0 {
 				fmt.Fprintf(f, ", freq=%d Hz", cd.Frequency)
 			}
+			if cd.Parent != nil {
+				fmt.Fprintf(f, ", %s of %s", cd.Derivation, cd.Parent.Name)
+				if cd.Multiply > 1 {
+					fmt.Fprintf(f, " *%d", cd.Multiply)
+				}
+				fmt.Fprintf(f, " /%d", cd.Divide)
+			}
 			fmt.Fprintf(f, "\n")
 		}
 		fmt.Fprintf(f, "\n")
@@ -159,5 +179,21 @@ func EmitVerilog(mod *hdl.Module) {
 		fmt.Fprintf(f, "  %s\n\n", always)
 	}
 
+	// Emit properties for simulation and formal tools only
+	if len(mod.Properties) > 0 {
+		fmt.Fprintf(f, "`ifndef SYNTHESIS\n")
+		for _, p := range mod.Properties {
+			switch mod.PropertyStyle {
+			case "", "sva":
+				fmt.Fprintf(f, "  %s\n", p.SVA())
+			case "verilog":
+				fmt.Fprintf(f, "  %s\n", p.Verilog())
+			default:
+				panic(fmt.Sprintf("Unknown property style %q for module %s", mod.PropertyStyle, mod.Name))
+			}
+		}
+		fmt.Fprintf(f, "`endif\n\n")
+	}
+
 	fmt.Fprintf(f, "endmodule\n")
 }
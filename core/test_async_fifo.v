@@ -7,22 +7,50 @@ module AsyncFIFOTest(
   input [0:0] test_fifo_wr_en,
   input [0:0] test_fifo_rd_en,
   output [0:0] test_fifo_wr_full,
+  output [5:0] test_fifo_wr_level,
   output [15:0] test_fifo_rd_data,
   output [0:0] test_fifo_rd_empty,
+  output [5:0] test_fifo_rd_level,
   output [15:0] wr_data_out,
   output [15:0] rd_data_out,
   output [0:0] wr_full_out,
   output [0:0] rd_empty_out
 );
 
+  wire [0:0] test_fifo_wr_push;
+  wire [0:0] test_fifo_rd_pop;
+  wire [5:0] test_fifo_wr_bin_next;
+  wire [5:0] test_fifo_wr_gray_next;
+  wire [5:0] test_fifo_rd_bin_next;
+  wire [5:0] test_fifo_rd_gray_next;
+  wire [5:0] test_fifo_rd_ptr_sync_bin;
+  wire [5:0] test_fifo_wr_ptr_sync_bin;
+  reg [5:0] test_fifo_wr_bin;
   reg [5:0] test_fifo_wr_ptr;
+  reg [5:0] test_fifo_rd_bin;
   reg [5:0] test_fifo_rd_ptr;
-  reg [5:0] test_fifo_wr_ptr_sync_sync_stage0;
-  reg [5:0] test_fifo_wr_ptr_sync_sync_stage1;
-  reg [5:0] test_fifo_rd_ptr_sync_sync_stage0;
-  reg [5:0] test_fifo_rd_ptr_sync_sync_stage1;
+  reg [0:0] test_fifo_wr_full_r;
+  reg [0:0] test_fifo_rd_empty_r;
+  reg [15:0] test_fifo_rd_data_r;
+  (* ASYNC_REG = "TRUE" *) reg [5:0] test_fifo_wr_ptr_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [5:0] test_fifo_wr_ptr_sync_sync_stage1;
+  (* ASYNC_REG = "TRUE" *) reg [5:0] test_fifo_rd_ptr_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [5:0] test_fifo_rd_ptr_sync_sync_stage1;
   reg [15:0] test_fifo_mem [0:31];
 
+  assign test_fifo_wr_push = test_fifo_wr_en && !test_fifo_wr_full_r;
+  assign test_fifo_rd_pop = test_fifo_rd_en && !test_fifo_rd_empty_r;
+  assign test_fifo_wr_bin_next = test_fifo_wr_bin + {5'b0, test_fifo_wr_push};
+  assign test_fifo_wr_gray_next = (test_fifo_wr_bin_next >> 1) ^ test_fifo_wr_bin_next;
+  assign test_fifo_rd_bin_next = test_fifo_rd_bin + {5'b0, test_fifo_rd_pop};
+  assign test_fifo_rd_gray_next = (test_fifo_rd_bin_next >> 1) ^ test_fifo_rd_bin_next;
+  assign test_fifo_rd_ptr_sync_bin = {^test_fifo_rd_ptr_sync_sync_stage1[5], ^test_fifo_rd_ptr_sync_sync_stage1[5:4], ^test_fifo_rd_ptr_sync_sync_stage1[5:3], ^test_fifo_rd_ptr_sync_sync_stage1[5:2], ^test_fifo_rd_ptr_sync_sync_stage1[5:1], ^test_fifo_rd_ptr_sync_sync_stage1[5:0]};
+  assign test_fifo_wr_ptr_sync_bin = {^test_fifo_wr_ptr_sync_sync_stage1[5], ^test_fifo_wr_ptr_sync_sync_stage1[5:4], ^test_fifo_wr_ptr_sync_sync_stage1[5:3], ^test_fifo_wr_ptr_sync_sync_stage1[5:2], ^test_fifo_wr_ptr_sync_sync_stage1[5:1], ^test_fifo_wr_ptr_sync_sync_stage1[5:0]};
+  assign test_fifo_wr_level = test_fifo_wr_bin - test_fifo_rd_ptr_sync_bin;
+  assign test_fifo_rd_level = test_fifo_wr_ptr_sync_bin - test_fifo_rd_bin;
+  assign test_fifo_wr_full = test_fifo_wr_full_r;
+  assign test_fifo_rd_empty = test_fifo_rd_empty_r;
+  assign test_fifo_rd_data = test_fifo_rd_data_r;
   assign wr_data_out = test_fifo_wr_data;
   assign rd_data_out = test_fifo_rd_data;
   assign wr_full_out = test_fifo_wr_full;
@@ -42,14 +70,54 @@ module AsyncFIFOTest(
 
   // AsyncFIFO test_fifo implementation
 
-  // Memory: test_fifo_mem
+  always @(posedge wr_clk) begin
 
-  // Write enable: test_fifo_wr_en
+    if (wr_rst) begin
 
-  // Read enable: test_fifo_rd_en
+      test_fifo_wr_bin <= 0;
 
-  // Write pointer sync: test_fifo_wr_ptr_sync_sync_stage1
+      test_fifo_wr_ptr <= 0;
 
-  // Read pointer sync: test_fifo_rd_ptr_sync_sync_stage1
+      test_fifo_wr_full_r <= 0;
+
+    end else begin
+
+      test_fifo_wr_bin <= test_fifo_wr_bin_next;
+
+      test_fifo_wr_ptr <= test_fifo_wr_gray_next;
+
+      test_fifo_wr_full_r <= (test_fifo_wr_gray_next == {~test_fifo_rd_ptr_sync_sync_stage1[5:4], test_fifo_rd_ptr_sync_sync_stage1[3:0]});
+
+    end
+
+  end
+
+  always @(posedge wr_clk) if (test_fifo_wr_push) test_fifo_mem[test_fifo_wr_bin[4:0]] <= test_fifo_wr_data;
+
+  always @(posedge rd_clk) begin
+
+    if (rd_rst) begin
+
+      test_fifo_rd_bin <= 0;
+
+      test_fifo_rd_ptr <= 0;
+
+      test_fifo_rd_empty_r <= 1;
+
+      test_fifo_rd_data_r <= 0;
+
+    end else begin
+
+      test_fifo_rd_bin <= test_fifo_rd_bin_next;
+
+      test_fifo_rd_ptr <= test_fifo_rd_gray_next;
+
+      test_fifo_rd_empty_r <= (test_fifo_rd_gray_next == test_fifo_wr_ptr_sync_sync_stage1);
+
+      if (test_fifo_rd_pop) test_fifo_rd_data_r <= test_fifo_mem[test_fifo_rd_bin[4:0]];
+
+    end
+
+  end
 
 endmodule
@@ -7,8 +7,8 @@ module ClockDomainTest(
 
   wire [7:0] sig1;
   wire [7:0] sig2;
-  reg [7:0] cross_sync_sync_stage0;
-  reg [7:0] cross_sync_sync_stage1;
+  (* ASYNC_REG = "TRUE" *) reg [7:0] cross_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [7:0] cross_sync_sync_stage1;
 
   // Clock Domains:
   // - fast_domain: clk=clk1, rst=rst1, freq=200000000 Hz
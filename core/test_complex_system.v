@@ -19,29 +19,68 @@ module ComplexSystem(
   output [0:0] memory_grant_0,
   output [0:0] memory_grant_1,
   output [0:0] main_fifo_wr_full,
+  output [7:0] main_fifo_wr_level,
   output [31:0] main_fifo_rd_data,
   output [0:0] main_fifo_rd_empty,
+  output [7:0] main_fifo_rd_level,
   output [31:0] data_out,
   output [7:0] status_out
 );
 
+  wire [1:0] memory_req_vec;
+  wire [1:0] memory_masked_req;
+  wire [1:0] memory_next_grant;
+  wire [0:0] memory_arb;
   wire [31:0] cpu_data;
+  wire [0:0] main_fifo_wr_push;
+  wire [0:0] main_fifo_rd_pop;
+  wire [7:0] main_fifo_wr_bin_next;
+  wire [7:0] main_fifo_wr_gray_next;
+  wire [7:0] main_fifo_rd_bin_next;
+  wire [7:0] main_fifo_rd_gray_next;
+  wire [7:0] main_fifo_rd_ptr_sync_bin;
+  wire [7:0] main_fifo_wr_ptr_sync_bin;
   reg [0:0] memory_counter;
-  reg [31:0] cpu_to_ddr_sync_stage0;
-  reg [31:0] cpu_to_ddr_sync_stage1;
-  reg [31:0] cpu_to_ddr_sync_stage2;
+  reg [1:0] memory_grant_r;
+  (* ASYNC_REG = "TRUE" *) reg [31:0] cpu_to_ddr_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [31:0] cpu_to_ddr_sync_stage1;
+  (* ASYNC_REG = "TRUE" *) reg [31:0] cpu_to_ddr_sync_stage2;
+  reg [7:0] main_fifo_wr_bin;
   reg [7:0] main_fifo_wr_ptr;
+  reg [7:0] main_fifo_rd_bin;
   reg [7:0] main_fifo_rd_ptr;
-  reg [7:0] main_fifo_wr_ptr_sync_sync_stage0;
-  reg [7:0] main_fifo_wr_ptr_sync_sync_stage1;
-  reg [7:0] main_fifo_rd_ptr_sync_sync_stage0;
-  reg [7:0] main_fifo_rd_ptr_sync_sync_stage1;
+  reg [0:0] main_fifo_wr_full_r;
+  reg [0:0] main_fifo_rd_empty_r;
+  reg [31:0] main_fifo_rd_data_r;
+  (* ASYNC_REG = "TRUE" *) reg [7:0] main_fifo_wr_ptr_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [7:0] main_fifo_wr_ptr_sync_sync_stage1;
+  (* ASYNC_REG = "TRUE" *) reg [7:0] main_fifo_rd_ptr_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [7:0] main_fifo_rd_ptr_sync_sync_stage1;
   reg [31:0] main_fifo_mem [0:127];
 
   assign bus_grant_3 = bus_req_3;
   assign bus_grant_2 = bus_req_2 && !(bus_req_3);
   assign bus_grant_1 = bus_req_1 && !(bus_req_2 || bus_req_3);
   assign bus_grant_0 = bus_req_0 && !(bus_req_1 || bus_req_2 || bus_req_3);
+  assign memory_req_vec = {memory_req_1, memory_req_0};
+  assign memory_masked_req = memory_req_vec & {(memory_counter <= 1), (memory_counter <= 0)};
+  assign memory_next_grant = (memory_masked_req != 0) ? (memory_masked_req & (~memory_masked_req + 2'h1)) : (memory_req_vec & (~memory_req_vec + 2'h1));
+  assign memory_grant_0 = memory_grant_r[0];
+  assign memory_grant_1 = memory_grant_r[1];
+  assign memory_arb = 1'b1;
+  assign main_fifo_wr_push = main_fifo_wr_en && !main_fifo_wr_full_r;
+  assign main_fifo_rd_pop = main_fifo_rd_en && !main_fifo_rd_empty_r;
+  assign main_fifo_wr_bin_next = main_fifo_wr_bin + {7'b0, main_fifo_wr_push};
+  assign main_fifo_wr_gray_next = (main_fifo_wr_bin_next >> 1) ^ main_fifo_wr_bin_next;
+  assign main_fifo_rd_bin_next = main_fifo_rd_bin + {7'b0, main_fifo_rd_pop};
+  assign main_fifo_rd_gray_next = (main_fifo_rd_bin_next >> 1) ^ main_fifo_rd_bin_next;
+  assign main_fifo_rd_ptr_sync_bin = {^main_fifo_rd_ptr_sync_sync_stage1[7], ^main_fifo_rd_ptr_sync_sync_stage1[7:6], ^main_fifo_rd_ptr_sync_sync_stage1[7:5], ^main_fifo_rd_ptr_sync_sync_stage1[7:4], ^main_fifo_rd_ptr_sync_sync_stage1[7:3], ^main_fifo_rd_ptr_sync_sync_stage1[7:2], ^main_fifo_rd_ptr_sync_sync_stage1[7:1], ^main_fifo_rd_ptr_sync_sync_stage1[7:0]};
+  assign main_fifo_wr_ptr_sync_bin = {^main_fifo_wr_ptr_sync_sync_stage1[7], ^main_fifo_wr_ptr_sync_sync_stage1[7:6], ^main_fifo_wr_ptr_sync_sync_stage1[7:5], ^main_fifo_wr_ptr_sync_sync_stage1[7:4], ^main_fifo_wr_ptr_sync_sync_stage1[7:3], ^main_fifo_wr_ptr_sync_sync_stage1[7:2], ^main_fifo_wr_ptr_sync_sync_stage1[7:1], ^main_fifo_wr_ptr_sync_sync_stage1[7:0]};
+  assign main_fifo_wr_level = main_fifo_wr_bin - main_fifo_rd_ptr_sync_bin;
+  assign main_fifo_rd_level = main_fifo_wr_ptr_sync_bin - main_fifo_rd_bin;
+  assign main_fifo_wr_full = main_fifo_wr_full_r;
+  assign main_fifo_rd_empty = main_fifo_rd_empty_r;
+  assign main_fifo_rd_data = main_fifo_rd_data_r;
   assign data_out = cpu_to_ddr_sync_stage2;
   assign status_out = {bus_grant_0, memory_grant_0, main_fifo_wr_full, main_fifo_rd_empty, {4{0}}};
 
@@ -61,11 +100,11 @@ module ComplexSystem(
 
   always @(posedge cpu_clk) begin
 
-    memory_grant_0 <= (memory_counter == 0) && memory_req_0;
+    if (memory_arb) memory_grant_r <= memory_next_grant;
 
-    memory_grant_1 <= (memory_counter == 1) && memory_req_1;
+    if (memory_arb && memory_next_grant[0]) memory_counter <= 1;
 
-    if (memory_grant_0 || memory_grant_1) memory_counter <= (memory_counter + 1) % 2;
+    if (memory_arb && memory_next_grant[1]) memory_counter <= 0;
 
   end
 
@@ -85,14 +124,54 @@ module ComplexSystem(
 
   // AsyncFIFO main_fifo implementation
 
-  // Memory: main_fifo_mem
+  always @(posedge cpu_clk) begin
+
+    if (cpu_rst) begin
+
+      main_fifo_wr_bin <= 0;
+
+      main_fifo_wr_ptr <= 0;
+
+      main_fifo_wr_full_r <= 0;
+
+    end else begin
+
+      main_fifo_wr_bin <= main_fifo_wr_bin_next;
+
+      main_fifo_wr_ptr <= main_fifo_wr_gray_next;
+
+      main_fifo_wr_full_r <= (main_fifo_wr_gray_next == {~main_fifo_rd_ptr_sync_sync_stage1[7:6], main_fifo_rd_ptr_sync_sync_stage1[5:0]});
+
+    end
+
+  end
 
-  // Write enable: main_fifo_wr_en
+  always @(posedge cpu_clk) if (main_fifo_wr_push) main_fifo_mem[main_fifo_wr_bin[6:0]] <= main_fifo_wr_data;
 
-  // Read enable: main_fifo_rd_en
+  always @(posedge ddr_clk) begin
 
-  // Write pointer sync: main_fifo_wr_ptr_sync_sync_stage1
+    if (ddr_rst) begin
 
-  // Read pointer sync: main_fifo_rd_ptr_sync_sync_stage1
+      main_fifo_rd_bin <= 0;
+
+      main_fifo_rd_ptr <= 0;
+
+      main_fifo_rd_empty_r <= 1;
+
+      main_fifo_rd_data_r <= 0;
+
+    end else begin
+
+      main_fifo_rd_bin <= main_fifo_rd_bin_next;
+
+      main_fifo_rd_ptr <= main_fifo_rd_gray_next;
+
+      main_fifo_rd_empty_r <= (main_fifo_rd_gray_next == main_fifo_wr_ptr_sync_sync_stage1);
+
+      if (main_fifo_rd_pop) main_fifo_rd_data_r <= main_fifo_mem[main_fifo_rd_bin[6:0]];
+
+    end
+
+  end
 
 endmodule
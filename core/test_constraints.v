@@ -0,0 +1,122 @@
+module ConstraintTest(
+  input [0:0] cpu_clk,
+  input [0:0] cpu_rst,
+  input [0:0] ddr_clk,
+  input [0:0] ddr_rst,
+  input [31:0] fifo_wr_data,
+  input [0:0] fifo_wr_en,
+  input [0:0] fifo_rd_en,
+  output [0:0] fifo_wr_full,
+  output [4:0] fifo_wr_level,
+  output [31:0] fifo_rd_data,
+  output [0:0] fifo_rd_empty,
+  output [4:0] fifo_rd_level
+);
+
+  wire [0:0] flag;
+  wire [0:0] fifo_wr_push;
+  wire [0:0] fifo_rd_pop;
+  wire [4:0] fifo_wr_bin_next;
+  wire [4:0] fifo_wr_gray_next;
+  wire [4:0] fifo_rd_bin_next;
+  wire [4:0] fifo_rd_gray_next;
+  wire [4:0] fifo_rd_ptr_sync_bin;
+  wire [4:0] fifo_wr_ptr_sync_bin;
+  (* ASYNC_REG = "TRUE" *) reg [0:0] flag_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [0:0] flag_sync_sync_stage1;
+  reg [4:0] fifo_wr_bin;
+  reg [4:0] fifo_wr_ptr;
+  reg [4:0] fifo_rd_bin;
+  reg [4:0] fifo_rd_ptr;
+  reg [0:0] fifo_wr_full_r;
+  reg [0:0] fifo_rd_empty_r;
+  reg [31:0] fifo_rd_data_r;
+  (* ASYNC_REG = "TRUE" *) reg [4:0] fifo_wr_ptr_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [4:0] fifo_wr_ptr_sync_sync_stage1;
+  (* ASYNC_REG = "TRUE" *) reg [4:0] fifo_rd_ptr_sync_sync_stage0;
+  (* ASYNC_REG = "TRUE" *) reg [4:0] fifo_rd_ptr_sync_sync_stage1;
+  reg [31:0] fifo_mem [0:15];
+
+  assign fifo_wr_push = fifo_wr_en && !fifo_wr_full_r;
+  assign fifo_rd_pop = fifo_rd_en && !fifo_rd_empty_r;
+  assign fifo_wr_bin_next = fifo_wr_bin + {4'b0, fifo_wr_push};
+  assign fifo_wr_gray_next = (fifo_wr_bin_next >> 1) ^ fifo_wr_bin_next;
+  assign fifo_rd_bin_next = fifo_rd_bin + {4'b0, fifo_rd_pop};
+  assign fifo_rd_gray_next = (fifo_rd_bin_next >> 1) ^ fifo_rd_bin_next;
+  assign fifo_rd_ptr_sync_bin = {^fifo_rd_ptr_sync_sync_stage1[4], ^fifo_rd_ptr_sync_sync_stage1[4:3], ^fifo_rd_ptr_sync_sync_stage1[4:2], ^fifo_rd_ptr_sync_sync_stage1[4:1], ^fifo_rd_ptr_sync_sync_stage1[4:0]};
+  assign fifo_wr_ptr_sync_bin = {^fifo_wr_ptr_sync_sync_stage1[4], ^fifo_wr_ptr_sync_sync_stage1[4:3], ^fifo_wr_ptr_sync_sync_stage1[4:2], ^fifo_wr_ptr_sync_sync_stage1[4:1], ^fifo_wr_ptr_sync_sync_stage1[4:0]};
+  assign fifo_wr_level = fifo_wr_bin - fifo_rd_ptr_sync_bin;
+  assign fifo_rd_level = fifo_wr_ptr_sync_bin - fifo_rd_bin;
+  assign fifo_wr_full = fifo_wr_full_r;
+  assign fifo_rd_empty = fifo_rd_empty_r;
+  assign fifo_rd_data = fifo_rd_data_r;
+
+  // Clock Domains:
+  // - cpu: clk=cpu_clk, rst=cpu_rst, freq=100000000 Hz
+  // - ddr: clk=ddr_clk, rst=ddr_rst, freq=200000000 Hz
+
+  always @(posedge ddr_clk) flag_sync_sync_stage0 <= flag;
+
+  always @(posedge ddr_clk) flag_sync_sync_stage1 <= flag_sync_sync_stage0;
+
+  always @(posedge ddr_clk) fifo_wr_ptr_sync_sync_stage0 <= fifo_wr_ptr;
+
+  always @(posedge ddr_clk) fifo_wr_ptr_sync_sync_stage1 <= fifo_wr_ptr_sync_sync_stage0;
+
+  always @(posedge cpu_clk) fifo_rd_ptr_sync_sync_stage0 <= fifo_rd_ptr;
+
+  always @(posedge cpu_clk) fifo_rd_ptr_sync_sync_stage1 <= fifo_rd_ptr_sync_sync_stage0;
+
+  // AsyncFIFO fifo implementation
+
+  always @(posedge cpu_clk) begin
+
+    if (cpu_rst) begin
+
+      fifo_wr_bin <= 0;
+
+      fifo_wr_ptr <= 0;
+
+      fifo_wr_full_r <= 0;
+
+    end else begin
+
+      fifo_wr_bin <= fifo_wr_bin_next;
+
+      fifo_wr_ptr <= fifo_wr_gray_next;
+
+      fifo_wr_full_r <= (fifo_wr_gray_next == {~fifo_rd_ptr_sync_sync_stage1[4:3], fifo_rd_ptr_sync_sync_stage1[2:0]});
+
+    end
+
+  end
+
+  always @(posedge cpu_clk) if (fifo_wr_push) fifo_mem[fifo_wr_bin[3:0]] <= fifo_wr_data;
+
+  always @(posedge ddr_clk) begin
+
+    if (ddr_rst) begin
+
+      fifo_rd_bin <= 0;
+
+      fifo_rd_ptr <= 0;
+
+      fifo_rd_empty_r <= 1;
+
+      fifo_rd_data_r <= 0;
+
+    end else begin
+
+      fifo_rd_bin <= fifo_rd_bin_next;
+
+      fifo_rd_ptr <= fifo_rd_gray_next;
+
+      fifo_rd_empty_r <= (fifo_rd_gray_next == fifo_wr_ptr_sync_sync_stage1);
+
+      if (fifo_rd_pop) fifo_rd_data_r <= fifo_mem[fifo_rd_bin[3:0]];
+
+    end
+
+  end
+
+endmodule
@@ -13,11 +13,22 @@ module MutexTest(
   output [0:0] rr_arb_grant_1
 );
 
+  wire [1:0] rr_arb_req_vec;
+  wire [1:0] rr_arb_masked_req;
+  wire [1:0] rr_arb_next_grant;
+  wire [0:0] rr_arb_arb;
   reg [0:0] rr_arb_counter;
+  reg [1:0] rr_arb_grant_r;
 
   assign priority_arb_grant_2 = priority_arb_req_2;
   assign priority_arb_grant_1 = priority_arb_req_1 && !(priority_arb_req_2);
   assign priority_arb_grant_0 = priority_arb_req_0 && !(priority_arb_req_1 || priority_arb_req_2);
+  assign rr_arb_req_vec = {rr_arb_req_1, rr_arb_req_0};
+  assign rr_arb_masked_req = rr_arb_req_vec & {(rr_arb_counter <= 1), (rr_arb_counter <= 0)};
+  assign rr_arb_next_grant = (rr_arb_masked_req != 0) ? (rr_arb_masked_req & (~rr_arb_masked_req + 2'h1)) : (rr_arb_req_vec & (~rr_arb_req_vec + 2'h1));
+  assign rr_arb_grant_0 = rr_arb_grant_r[0];
+  assign rr_arb_grant_1 = rr_arb_grant_r[1];
+  assign rr_arb_arb = 1'b1;
 
   // Mutex: priority_arb (priority arbitration)
   // Request[0]: priority_arb_req_0 -> Grant[0]: priority_arb_grant_0
@@ -30,11 +41,11 @@ module MutexTest(
 
   always @(posedge clk) begin
 
-    rr_arb_grant_0 <= (rr_arb_counter == 0) && rr_arb_req_0;
+    if (rr_arb_arb) rr_arb_grant_r <= rr_arb_next_grant;
 
-    rr_arb_grant_1 <= (rr_arb_counter == 1) && rr_arb_req_1;
+    if (rr_arb_arb && rr_arb_next_grant[0]) rr_arb_counter <= 1;
 
-    if (rr_arb_grant_0 || rr_arb_grant_1) rr_arb_counter <= (rr_arb_counter + 1) % 2;
+    if (rr_arb_arb && rr_arb_next_grant[1]) rr_arb_counter <= 0;
 
   end
 
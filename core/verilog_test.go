@@ -308,6 +308,11 @@ func TestVerilogAsyncFIFO(t *testing.T) {
 		"test_fifo_rd_ptr",
 		"test_fifo_wr_ptr_sync",
 		"test_fifo_rd_ptr_sync",
+		"assign test_fifo_wr_full = test_fifo_wr_full_r;",
+		"assign test_fifo_rd_empty = test_fifo_rd_empty_r;",
+		"assign test_fifo_rd_data = test_fifo_rd_data_r;",
+		"output [5:0] test_fifo_wr_level",
+		"output [5:0] test_fifo_rd_level",
 		"always @(posedge wr_clk)",
 		"always @(posedge rd_clk)",
 	}
@@ -380,4 +385,217 @@ func TestVerilogWidthInference(t *testing.T) {
 	
 	// Clean up
 	os.Rename("out.v", "test_width_inference.v")
-}
\ No newline at end of file
+}
+
+// Test timing constraint generation
+func TestVerilogConstraints(t *testing.T) {
+	m := NewModule("ConstraintTest")
+	
+	cpuDomain := m.NewClockDomain("cpu", m.Input("cpu_clk", 1), m.Input("cpu_rst", 1)).SetFrequency(100000000)
+	ddrDomain := m.NewClockDomain("ddr", m.Input("ddr_clk", 1), m.Input("ddr_rst", 1)).SetFrequency(200000000)
+	
+	flag := m.Wire("flag", 1).WithClockDomain(cpuDomain)
+	m.CDCSynchronizer("flag_sync", flag, ddrDomain, 2)
+	m.AsyncFIFO("fifo", 32, 16, cpuDomain, ddrDomain)
+	
+	EmitVerilog(m)
+	content, err := os.ReadFile("out.v")
+	if err != nil {
+		t.Fatalf("Failed to read generated Verilog: %v", err)
+	}
+	verilog := string(content)
+	for _, check := range []string{
+		"(* ASYNC_REG = \"TRUE\" *) reg [0:0] flag_sync_sync_stage0;",
+		"(* ASYNC_REG = \"TRUE\" *) reg [4:0] fifo_wr_ptr_sync_sync_stage1;",
+	} {
+		if !strings.Contains(verilog, check) {
+			t.Errorf("Missing ASYNC_REG attribute: %s", check)
+		}
+	}
+	if strings.Contains(verilog, "(* ASYNC_REG = \"TRUE\" *) reg [31:0] fifo_rd_data_r;") {
+		t.Errorf("FIFO read data register is not a synchronizer flop")
+	}
+	os.Rename("out.v", "test_constraints.v")
+	
+	sdc := Constraints(m, "sdc")
+	xdc := Constraints(m, "xdc")
+	checks := []string{
+		"create_clock -name cpu -period 10.000 [get_ports cpu_clk]",
+		"create_clock -name ddr -period 5.000 [get_ports ddr_clk]",
+		"set_false_path -from [get_clocks cpu] -to [get_cells {flag_sync_sync_stage0_reg*}]",
+	}
+	for _, check := range checks {
+		if !strings.Contains(sdc, check) || !strings.Contains(xdc, check) {
+			t.Errorf("Missing constraint: %s", check)
+		}
+	}
+	if !strings.Contains(sdc, "set_max_delay -from [get_clocks cpu] -to [get_cells {fifo_wr_ptr_sync_sync_stage0_reg*}] 5.000") {
+		t.Errorf("Gray pointer synchronizer should get a max delay in SDC")
+	}
+	if !strings.Contains(xdc, "set_max_delay -datapath_only -from [get_clocks cpu] -to [get_cells {fifo_rd_data_r_reg*}] 5.000") {
+		t.Errorf("FIFO read data capture should get a datapath-only max delay in XDC")
+	}
+	
+	EmitXDC(m)
+	if _, err := os.Stat("out.xdc"); err != nil {
+		t.Errorf("EmitXDC should write out.xdc: %v", err)
+	}
+	os.Rename("out.xdc", "test_constraints.xdc")
+}
+
+// Test constraints for synchronizers inside instances and reset synchronizers
+func TestVerilogHierarchyConstraints(t *testing.T) {
+	child := NewModule("SyncChild")
+	fast := child.NewClockDomain("fast", child.Input("clk_a", 1), child.Input("rst_a", 1))
+	slow := child.NewClockDomain("slow", child.Input("clk_b", 1), child.Input("rst_b", 1))
+	flag := child.Input("flag", 1).WithClockDomain(fast)
+	child.CDCSynchronizer("flag_sync", flag, slow, 2)
+	slow.SynchronizeReset(child, hdl.ResetConfig{})
+	
+	m := NewModule("HierarchyConstraintTest")
+	cpu := m.NewClockDomain("cpu", m.Input("cpu_clk", 1), m.Input("cpu_rst", 1)).SetFrequency(100000000)
+	ddr := m.NewClockDomain("ddr", m.Input("ddr_clk", 1), m.Input("ddr_rst", 1)).SetFrequency(200000000)
+	cpu.SynchronizeReset(m, hdl.ResetConfig{})
+	m.InstanceOf(child, "u_sync").
+		Connect("clk_a", cpu.Clock).
+		Connect("rst_a", cpu.Reset).
+		Connect("clk_b", ddr.Clock).
+		Connect("rst_b", ddr.Reset).
+		Connect("flag", m.Wire("flag", 1))
+	
+	sdc := Constraints(m, "sdc")
+	xdc := Constraints(m, "xdc")
+	for _, check := range []string{
+		"# flop synchronizer u_sync/flag_sync",
+		"set_false_path -from [get_clocks cpu] -to [get_cells {u_sync/flag_sync_sync_stage0_reg*}]",
+		"# reset synchronizer cpu_rst",
+		"set_false_path -to [get_cells {cpu_rst_stage0_reg*}]",
+		"set_false_path -to [get_cells {u_sync/slow_rst_stage0_reg*}]",
+	} {
+		if !strings.Contains(sdc, check) || !strings.Contains(xdc, check) {
+			t.Errorf("Missing constraint: %s\n%s", check, sdc)
+		}
+	}
+	if !strings.Contains(xdc, "set_property ASYNC_REG TRUE [get_cells {u_sync/flag_sync_sync_stage0_reg* u_sync/flag_sync_sync_stage1_reg*}]") {
+		t.Errorf("Synchronizer flops inside an instance should get ASYNC_REG in XDC:\n%s", xdc)
+	}
+	if strings.Contains(sdc, "ASYNC_REG") {
+		t.Errorf("SDC has no ASYNC_REG property:\n%s", sdc)
+	}
+}
+
+// Test constraints for derived clock domains
+func TestVerilogDerivedClockConstraints(t *testing.T) {
+	m := NewModule("DerivedClockTest")
+	
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1)).SetFrequency(100000000)
+	m.DividedClockDomain("div", sys, 4)
+	slow := m.EnableClockDomain("slow", sys, 2)
+	m.GeneratedClockDomain("fast", sys, m.Wire("mmcm_clk", 1), m.Input("fast_rst", 1), 2, 1)
+	m.Reg("slow_count", 8).WithClockDomain(slow)
+	
+	sdc := Constraints(m, "sdc")
+	checks := []string{
+		"create_clock -name sys -period 10.000 [get_ports clk]",
+		"create_generated_clock -name div -source [get_ports clk] -divide_by 4 [get_pins {div_clk_r_reg/Q}]",
+		"create_generated_clock -name fast -source [get_ports clk] -multiply_by 2 -divide_by 1 [get_nets {mmcm_clk}]",
+		"set_multicycle_path 2 -setup -from [get_cells {slow_count_reg*}] -to [get_cells {slow_count_reg*}]",
+		"set_multicycle_path 1 -hold -from [get_cells {slow_count_reg*}] -to [get_cells {slow_count_reg*}]",
+	}
+	for _, check := range checks {
+		if !strings.Contains(sdc, check) {
+			t.Errorf("Missing constraint: %s", check)
+		}
+	}
+	if strings.Contains(sdc, "create_clock -name slow") {
+		t.Errorf("Clock-enable domain should not create a clock")
+	}
+	
+	EmitVerilog(m)
+	content, err := os.ReadFile("out.v")
+	if err != nil {
+		t.Fatalf("Failed to read generated Verilog: %v", err)
+	}
+	if !strings.Contains(string(content), "div: clk=div_clk, rst=rst, freq=25000000 Hz, divider of sys /4") {
+		t.Errorf("Missing derived clock domain comment")
+	}
+	os.Remove("out.v")
+}
+
+
+// Test constraints for clock muxes and gates
+func TestVerilogClockMuxConstraints(t *testing.T) {
+	m := NewModule("ClockMuxConstraintTest")
+	
+	rec := m.NewClockDomain("rec", m.Input("rx_clk", 1), m.Input("rx_rst", 1)).SetFrequency(156250000)
+	ref := m.NewClockDomain("ref", m.Input("ref_clk", 1), m.Input("ref_rst", 1)).SetFrequency(125000000)
+	m.ClockMux("line", rec, ref, m.Input("use_ref", 1), nil)
+	m.ClockGate("gated", ref, m.Input("gate_en", 1))
+	
+	xdc := Constraints(m, "xdc")
+	checks := []string{
+		"create_generated_clock -name line_rec -source [get_ports rx_clk] -divide_by 1 -add -master_clock rec [get_nets {line_clk}]",
+		"create_generated_clock -name line_ref -source [get_ports ref_clk] -divide_by 1 -add -master_clock ref [get_nets {line_clk}]",
+		"set_clock_groups -physically_exclusive -group [get_clocks line_rec] -group [get_clocks line_ref]",
+		"create_generated_clock -name gated -source [get_ports ref_clk] -divide_by 1 [get_nets {gated_clk}]",
+		"set_false_path -from [get_clocks ref] -to [get_cells {line_en0_meta_reg*}]",
+	}
+	for _, check := range checks {
+		if !strings.Contains(xdc, check) {
+			t.Errorf("Missing constraint: %s", check)
+		}
+	}
+	
+	EmitVerilog(m)
+	content, err := os.ReadFile("out.v")
+	if err != nil {
+		t.Fatalf("Failed to read generated Verilog: %v", err)
+	}
+	if !strings.Contains(string(content), "// - line: clk=line_clk, freq=156250000 Hz") {
+		t.Errorf("Missing clock mux domain comment")
+	}
+	os.Remove("out.v")
+}
+
+func TestVerilogProperties(t *testing.T) {
+	m := NewModule("PropertyTest")
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	m.Input("full", 1)
+	wrEn := m.Input("wr_en", 1)
+	m.Assert("no_overflow", &hdl.Signal{Name: "!(full && wr_en)", Width: 1}, sys)
+	m.Cover("write", wrEn, sys)
+
+	emit := func() string {
+		EmitVerilog(m)
+		content, err := os.ReadFile("out.v")
+		if err != nil {
+			t.Fatalf("Failed to read generated Verilog: %v", err)
+		}
+		os.Remove("out.v")
+		return string(content)
+	}
+
+	verilog := emit()
+	checks := []string{
+		"`ifndef SYNTHESIS\n  assert_no_overflow: assert property (@(posedge clk) disable iff (rst) !(full && wr_en))",
+		"  cover_write: cover property (@(posedge clk) disable iff (rst) wr_en);\n`endif\n\nendmodule",
+	}
+	for _, check := range checks {
+		if !strings.Contains(verilog, check) {
+			t.Errorf("Missing SVA: %s\n%s", check, verilog)
+		}
+	}
+
+	m.PropertyStyle = "verilog"
+	verilog = emit()
+	if strings.Contains(verilog, "property") || !strings.Contains(verilog, "if (!(rst) && !(!(full && wr_en))) $error(") {
+		t.Errorf("Verilog style should use $error checks:\n%s", verilog)
+	}
+	
+	m.Cover("write_start", hdl.Rose(wrEn), sys)
+	verilog = emit()
+	if strings.Contains(verilog, "$rose") || !strings.Contains(verilog,
+		"  reg [0:0] cover_write_start_past0;\n  always @(posedge clk) cover_write_start_past0 <= wr_en;\n  always @(posedge clk) // cover_write_start\n") {
+		t.Errorf("Verilog style should lower $rose to a register:\n%s", verilog)
+	}
+}
@@ -0,0 +1,189 @@
+package coverage
+
+import (
+	"sort"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Bits of a net seen rising and falling
+type toggle struct {
+	name       string
+	width      int
+	last       uint64
+	rose, fell uint64
+}
+
+// Count toggles whenever the design settles
+func (c *Collector) watchToggles() {
+	sim := c.Sim
+	for _, name := range sim.Signals() {
+		c.toggles = append(c.toggles, &toggle{name: name, width: int(sim.Width(name)), last: sim.Peek(name)})
+	}
+	sim.Observe(func() {
+		for _, t := range c.toggles {
+			v := sim.Peek(t.name)
+			t.rose |= v &^ t.last
+			t.fell |= t.last &^ v
+			t.last = v
+		}
+	})
+}
+
+// Register that only ever takes constant values and selects a case
+// statement, so it is taken to be the state of a state machine
+type fsm struct {
+	name        string
+	width       int
+	hits        map[uint64]uint64
+	transitions map[[2]uint64]uint64
+	last        uint64
+	started     bool
+}
+
+// Find the state machines of the design and sample them on their clocks
+func (c *Collector) watchFSMs() {
+	n := c.Sim.Netlist
+	sources := map[string][]*hdl.Expr{}
+	partial := map[string]bool{}
+	clocks := map[string]string{}
+	selectors := map[string]bool{}
+	labels := map[string][]*hdl.Expr{}
+	assign := func(lhs, rhs *hdl.Expr, clock string) {
+		if lhs.Kind != hdl.ExprIdent {
+			for _, t := range lhs.Targets() {
+				partial[t] = true
+			}
+			return
+		}
+		sources[lhs.Name] = append(sources[lhs.Name], rhs)
+		if clock != "" {
+			clocks[lhs.Name] = clock
+		}
+	}
+	for _, a := range n.Assigns {
+		assign(a.LHS, a.RHS, "")
+	}
+	for _, p := range n.Processes {
+		walk(p.Body, func(st *hdl.Stmt) {
+			switch st.Kind {
+			case hdl.StmtBlocking, hdl.StmtNonblocking:
+				assign(st.LHS, st.RHS, p.Clock)
+			case hdl.StmtCase:
+				if st.Cond.Kind == hdl.ExprIdent {
+					name := st.Cond.Name
+					selectors[name] = true
+					for _, item := range st.Items {
+						labels[name] = append(labels[name], item.Labels...)
+					}
+				}
+			}
+		})
+	}
+
+	// Constant values a net can take through plain assignments, or false
+	// when it can take others
+	var constants func(e *hdl.Expr, states map[uint64]bool, seen map[string]bool) bool
+	constants = func(e *hdl.Expr, states map[uint64]bool, seen map[string]bool) bool {
+		switch e.Kind {
+		case hdl.ExprConst:
+			if e.XMask != 0 || e.ZMask != 0 {
+				return false
+			}
+			states[e.Value] = true
+			return true
+		case hdl.ExprTernary:
+			return constants(e.Args[1], states, seen) && constants(e.Args[2], states, seen)
+		case hdl.ExprIdent:
+			if seen[e.Name] {
+				return true
+			}
+			seen[e.Name] = true
+			if partial[e.Name] || len(sources[e.Name]) == 0 {
+				return false
+			}
+			for _, rhs := range sources[e.Name] {
+				if !constants(rhs, states, seen) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+
+	names := make([]string, 0, len(selectors))
+	for name := range selectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		net, ok := n.Nets[name]
+		if !ok || net.Kind != "reg" || clocks[name] == "" {
+			continue
+		}
+		states := map[uint64]bool{}
+		if !constants(&hdl.Expr{Kind: hdl.ExprIdent, Name: name}, states, map[string]bool{}) || len(states) < 2 {
+			continue
+		}
+		f := &fsm{name: name, width: int(net.Width), hits: map[uint64]uint64{}, transitions: map[[2]uint64]uint64{}}
+		for _, label := range labels[name] {
+			if label.Kind == hdl.ExprConst {
+				states[label.Value] = true
+			}
+		}
+		for v := range states {
+			f.hits[v] = 0
+		}
+		c.fsms = append(c.fsms, f)
+		c.Sim.OnClock(clocks[name], func() {
+			v := c.Sim.Peek(f.name)
+			f.hits[v]++
+			if f.started && v != f.last {
+				f.transitions[[2]uint64{f.last, v}]++
+			}
+			f.last, f.started = v, true
+		})
+	}
+}
+
+func (f *fsm) report() *FSMReport {
+	r := &FSMReport{Register: f.name}
+	values := make([]uint64, 0, len(f.hits))
+	for v := range f.hits {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, v := range values {
+		r.States = append(r.States, &BinReport{Name: sized(f.width, v), Hits: f.hits[v]})
+	}
+	arcs := make([][2]uint64, 0, len(f.transitions))
+	for arc := range f.transitions {
+		arcs = append(arcs, arc)
+	}
+	sort.Slice(arcs, func(i, j int) bool {
+		return arcs[i][0] < arcs[j][0] || arcs[i][0] == arcs[j][0] && arcs[i][1] < arcs[j][1]
+	})
+	for _, arc := range arcs {
+		r.Transitions = append(r.Transitions, &BinReport{
+			Name: sized(f.width, arc[0]) + " -> " + sized(f.width, arc[1]),
+			Hits: f.transitions[arc],
+		})
+	}
+	return r
+}
+
+func walk(st *hdl.Stmt, fn func(*hdl.Stmt)) {
+	if st == nil {
+		return
+	}
+	fn(st)
+	walk(st.Then, fn)
+	walk(st.Else, fn)
+	for _, b := range st.Body {
+		walk(b, fn)
+	}
+	for _, item := range st.Items {
+		walk(item.Body, fn)
+	}
+}
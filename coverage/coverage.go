@@ -0,0 +1,244 @@
+// Package coverage collects functional coverage from native simulation:
+// coverage groups over signal values with bins, ranges and crosses, and
+// automatic toggle, FSM-state and branch coverage of the design.
+//
+//	c := coverage.New(sim)
+//	g := c.Group("fifo", sys)
+//	level := g.Point(count, coverage.Value("empty", 0), coverage.Range("partial", 1, 14), coverage.Value("full", 15))
+//	push := g.Point(wrEn)
+//	g.Cross("level_x_push", level, push)
+//	... run the test ...
+//	c.Report().WriteText(os.Stdout)
+//
+// Reports of several runs merge into one with Merge, and round-trip
+// through JSON so runs in separate processes can be combined.
+package coverage
+
+import (
+	"fmt"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Values of a coverage point counted together
+type Bin struct {
+	Name   string
+	Lo, Hi uint64
+}
+
+// Bin of a single value
+func Value(name string, v uint64) Bin {
+	return Bin{Name: name, Lo: v, Hi: v}
+}
+
+// Bin of the values from lo to hi inclusive
+func Range(name string, lo, hi uint64) Bin {
+	if lo > hi {
+		panic(fmt.Sprintf("coverage: bin %s has empty range %d..%d", name, lo, hi))
+	}
+	return Bin{Name: name, Lo: lo, Hi: hi}
+}
+
+// Signal sampled by a group and its bins
+type Point struct {
+	Name string
+	Bins []Bin
+	Hits []uint64
+
+	matched []int // bins hit by the current sample
+}
+
+// Cross of points: one bin for each combination of their bins
+type Cross struct {
+	Name   string
+	Points []*Point
+	Bins   []string
+	Hits   []uint64
+}
+
+// Coverage points sampled together on the rising edges of a clock
+type Group struct {
+	Name    string
+	Points  []*Point
+	Crosses []*Cross
+
+	c     *Collector
+	reset string // samples are skipped while it is high
+}
+
+// Coverage of one simulation
+type Collector struct {
+	Sim    *simulator.Simulator
+	Groups []*Group
+
+	toggles []*toggle
+	fsms    []*fsm
+}
+
+// Collect coverage from the simulator from now on. Toggle and FSM-state
+// coverage start at once; branch coverage counts from the start of the
+// simulation.
+func New(sim *simulator.Simulator) *Collector {
+	c := &Collector{Sim: sim}
+	c.watchToggles()
+	c.watchFSMs()
+	return c
+}
+
+// Group sampled on the domain's clock, skipping cycles in which the
+// domain's reset is high. A nil domain samples on the primary clock.
+func (c *Collector) Group(name string, domain *hdl.ClockDomain) *Group {
+	g := &Group{Name: name, c: c}
+	var clock string
+	if domain != nil {
+		clock = domain.Clock.Name
+		if domain.Reset != nil {
+			g.reset = domain.Reset.Name
+		}
+	} else if clocks := c.Sim.Clocks(); len(clocks) > 0 {
+		clock = clocks[0]
+	} else {
+		panic(fmt.Sprintf("coverage: %s has no clock to sample group %s on", c.Sim.Netlist.Top.Name, name))
+	}
+	c.Sim.OnClock(clock, g.sample)
+	c.Groups = append(c.Groups, g)
+	return g
+}
+
+// Cover a signal's values. Without bins every value of a signal up to 4
+// bits wide gets its own bin, and wider signals are split into 16 equal
+// ranges.
+func (g *Group) Point(sig *hdl.Signal, bins ...Bin) *Point {
+	return g.PointPath(sig.Name, bins...)
+}
+
+// Cover a signal by flat name, e.g. "u_fifo.count"
+func (g *Group) PointPath(name string, bins ...Bin) *Point {
+	width := int(g.c.Sim.Width(name))
+	if len(bins) == 0 {
+		bins = autoBins(width)
+	}
+	p := &Point{Name: name, Bins: bins, Hits: make([]uint64, len(bins))}
+	g.Points = append(g.Points, p)
+	return p
+}
+
+func autoBins(width int) []Bin {
+	var bins []Bin
+	if width <= 4 {
+		for v := uint64(0); v < 1<<uint(width); v++ {
+			bins = append(bins, Value(fmt.Sprint(v), v))
+		}
+		return bins
+	}
+	step := uint64(1) << uint(width-4)
+	for i := uint64(0); i < 16; i++ {
+		lo, hi := i*step, (i+1)*step-1
+		bins = append(bins, Range(fmt.Sprintf("%d..%d", lo, hi), lo, hi))
+	}
+	return bins
+}
+
+// Cover every combination of the points' bins
+func (g *Group) Cross(name string, points ...*Point) *Cross {
+	x := &Cross{Name: name, Points: points}
+	names := []string{""}
+	for i, p := range points {
+		var next []string
+		for _, prefix := range names {
+			for _, b := range p.Bins {
+				if i > 0 {
+					next = append(next, prefix+" & "+b.Name)
+				} else {
+					next = append(next, b.Name)
+				}
+			}
+		}
+		names = next
+	}
+	x.Bins = names
+	x.Hits = make([]uint64, len(names))
+	g.Crosses = append(g.Crosses, x)
+	return x
+}
+
+func (g *Group) sample() {
+	if g.reset != "" && g.c.Sim.Peek(g.reset) != 0 {
+		return
+	}
+	for _, p := range g.Points {
+		v := g.c.Sim.Peek(p.Name)
+		p.matched = p.matched[:0]
+		for i, b := range p.Bins {
+			if v >= b.Lo && v <= b.Hi {
+				p.Hits[i]++
+				p.matched = append(p.matched, i)
+			}
+		}
+	}
+	for _, x := range g.Crosses {
+		x.sample(0, 0)
+	}
+}
+
+// Count every combination of the bins the points matched, index being the
+// combination of the points before the i-th
+func (x *Cross) sample(i, index int) {
+	if i == len(x.Points) {
+		x.Hits[index]++
+		return
+	}
+	p := x.Points[i]
+	for _, b := range p.matched {
+		x.sample(i+1, index*len(p.Bins)+b)
+	}
+}
+
+// Snapshot of everything collected so far
+func (c *Collector) Report() *Report {
+	r := &Report{Module: c.Sim.Netlist.Top.Name, Runs: 1}
+	for _, g := range c.Groups {
+		gr := &GroupReport{Name: g.Name}
+		for _, p := range g.Points {
+			pr := &PointReport{Name: p.Name}
+			for i, b := range p.Bins {
+				pr.Bins = append(pr.Bins, &BinReport{Name: b.Name, Hits: p.Hits[i]})
+			}
+			gr.Points = append(gr.Points, pr)
+		}
+		for _, x := range g.Crosses {
+			pr := &PointReport{Name: x.Name, Cross: true}
+			for i, name := range x.Bins {
+				pr.Bins = append(pr.Bins, &BinReport{Name: name, Hits: x.Hits[i]})
+			}
+			gr.Points = append(gr.Points, pr)
+		}
+		r.Groups = append(r.Groups, gr)
+	}
+	for _, t := range c.toggles {
+		r.Toggles = append(r.Toggles, &ToggleReport{Net: t.name, Width: t.width, Rose: t.rose, Fell: t.fell})
+	}
+	for _, f := range c.fsms {
+		r.FSMs = append(r.FSMs, f.report())
+	}
+	seen := map[string]int{}
+	for _, b := range c.Sim.Branches() {
+		// Identical statements in one block are told apart by number
+		name := b.String()
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s #%d", name, seen[name])
+		}
+		br := &BranchReport{Branch: name}
+		for i, arm := range b.Arms {
+			br.Arms = append(br.Arms, &BinReport{Name: arm, Hits: b.Hits[i]})
+		}
+		r.Branches = append(r.Branches, br)
+	}
+	return r
+}
+
+// Verilog-style sized decimal, e.g. 3'd5
+func sized(width int, v uint64) string {
+	return fmt.Sprintf("%d'd%d", width, v)
+}
@@ -0,0 +1,241 @@
+package coverage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newFIFO(t *testing.T) (*hdl.Module, *simulator.Simulator) {
+	top := core.NewModule("Top")
+	m := top.InstantiateTemplate(hdl.FIFOTemplate(), "fifo", map[string]interface{}{
+		"DATA_WIDTH": hdl.Width(8),
+		"DEPTH":      4,
+		"FWFT":       true,
+	})
+	m.NewClockDomain("sys", m.Inputs[0], m.Inputs[1])
+	sim, err := simulator.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, sim
+}
+
+// Start/finish controller with states idle, busy and done
+func newController(t *testing.T) *simulator.Simulator {
+	m := core.NewModule("Ctl")
+	m.Input("clk", 1)
+	m.Input("rst", 1)
+	m.Input("start", 1)
+	m.Input("finish", 1)
+	m.Output("state", 2)
+	m.Reg("state_r", 2)
+	m.AssignName("state", "state_r")
+	m.Always = append(m.Always,
+		"always @(posedge clk) begin",
+		"  if (rst) state_r <= 2'd0;",
+		"  else case (state_r)",
+		"    2'd0: if (start) state_r <= 2'd1;",
+		"    2'd1: if (finish) state_r <= 2'd2;",
+		"    2'd2: state_r <= 2'd0;",
+		"  endcase",
+		"end")
+	sim, err := simulator.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+func hits(bins []*BinReport) map[string]uint64 {
+	out := map[string]uint64{}
+	for _, b := range bins {
+		out[b.Name] = b.Hits
+	}
+	return out
+}
+
+func TestGroups(t *testing.T) {
+	m, sim := newFIFO(t)
+	c := New(sim)
+	g := c.Group("fifo", m.ClockDomains[0])
+	level := g.Point(m.Outputs[3], Value("empty", 0), Range("partial", 1, 3), Value("full", 4))
+	push := g.Point(m.Inputs[3])
+	g.Cross("level_x_push", level, push)
+
+	sim.Poke("rst", 1)
+	sim.Cycle(2) // not sampled
+	sim.Poke("rst", 0)
+	sim.Poke("wr_en", 1)
+	sim.Cycle(4) // count 0 to 3 with a push
+	sim.Poke("wr_en", 0)
+	sim.Cycle(2) // full without a push
+
+	r := c.Report()
+	if len(r.Groups) != 1 || len(r.Groups[0].Points) != 3 {
+		t.Fatalf("Expected one group with two points and a cross, got %+v", r.Groups)
+	}
+	points := r.Groups[0].Points
+	if got := hits(points[0].Bins); !reflect.DeepEqual(got, map[string]uint64{"empty": 1, "partial": 3, "full": 2}) {
+		t.Errorf("count bins %v", got)
+	}
+	if got := hits(points[1].Bins); !reflect.DeepEqual(got, map[string]uint64{"0": 2, "1": 4}) {
+		t.Errorf("wr_en bins %v", got)
+	}
+	want := map[string]uint64{
+		"empty & 0": 0, "empty & 1": 1,
+		"partial & 0": 0, "partial & 1": 3,
+		"full & 0": 2, "full & 1": 0,
+	}
+	if got := hits(points[2].Bins); !points[2].Cross || !reflect.DeepEqual(got, want) {
+		t.Errorf("Cross bins %v", got)
+	}
+	if s := r.GroupScore(); s.Covered != 8 || s.Total != 11 {
+		t.Errorf("Group score %v, want 8/11", s)
+	}
+
+	if got := autoBins(8); len(got) != 16 || got[1].Name != "16..31" || got[15].Hi != 255 {
+		t.Errorf("Automatic bins of an 8-bit signal: %v", got)
+	}
+}
+
+func TestFSMAndBranches(t *testing.T) {
+	sim := newController(t)
+	c := New(sim)
+	sim.Poke("rst", 1)
+	sim.Cycle(1)
+	sim.Poke("rst", 0)
+	sim.Poke("start", 1)
+	sim.Cycle(2) // idle -> busy, busy waits for finish
+	sim.Poke("finish", 1)
+	sim.Cycle(3) // busy -> done -> idle -> busy
+
+	r := c.Report()
+	if len(r.FSMs) != 1 || r.FSMs[0].Register != "state_r" {
+		t.Fatalf("Expected state_r to be found as a state machine, got %+v", r.FSMs)
+	}
+	f := r.FSMs[0]
+	if got := hits(f.States); !reflect.DeepEqual(got, map[string]uint64{"2'd0": 3, "2'd1": 2, "2'd2": 1}) {
+		t.Errorf("FSM states %v", got)
+	}
+	if got := hits(f.Transitions); !reflect.DeepEqual(got, map[string]uint64{"2'd0 -> 2'd1": 1, "2'd1 -> 2'd2": 1, "2'd2 -> 2'd0": 1}) {
+		t.Errorf("FSM transitions %v", got)
+	}
+
+	var names []string
+	for _, b := range r.Branches {
+		names = append(names, b.Branch)
+	}
+	wantNames := []string{
+		"always @(posedge clk): if (rst)",
+		"always @(posedge clk): case (state_r)",
+		"always @(posedge clk): if (start)",
+		"always @(posedge clk): if (finish)",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("Branches %q", names)
+	}
+	if got := hits(r.Branches[1].Arms); !reflect.DeepEqual(got, map[string]uint64{"2'h0": 2, "2'h1": 2, "2'h2": 1, "default": 0}) {
+		t.Errorf("Case arms %v", got)
+	}
+	if got := hits(r.Branches[2].Arms); got["then"] != 2 || got["else"] != 0 {
+		t.Errorf("if (start) arms %v", got)
+	}
+	if s := r.BranchScore(); s.Covered != 8 || s.Total != 10 {
+		t.Errorf("Branch score %v, want 8/10", s)
+	}
+}
+
+func TestToggles(t *testing.T) {
+	sim := newController(t)
+	c := New(sim)
+	sim.Poke("start", 1)
+	sim.Poke("finish", 1)
+	sim.Cycle(3)
+	r := c.Report()
+	toggles := map[string]*ToggleReport{}
+	for _, tr := range r.Toggles {
+		toggles[tr.Net] = tr
+	}
+	// state_r went 0, 1, 2, 0
+	if tr := toggles["state_r"]; tr == nil || tr.Rose != 3 || tr.Fell != 3 {
+		t.Errorf("state_r toggles %+v", tr)
+	}
+	// start rose but never fell, rst never moved
+	if tr := toggles["start"]; tr.Rose != 1 || tr.Fell != 0 {
+		t.Errorf("start toggles %+v", tr)
+	}
+	if tr := toggles["rst"]; tr.Rose != 0 || tr.Fell != 0 {
+		t.Errorf("rst toggles %+v", tr)
+	}
+}
+
+func TestMergeAndWrite(t *testing.T) {
+	run := func(start uint64) *Report {
+		sim := newController(t)
+		c := New(sim)
+		c.Group("ctl", nil).Point(&hdl.Signal{Name: "state"}, Value("idle", 0), Value("busy", 1), Value("done", 2))
+		sim.Poke("start", start)
+		sim.Cycle(2)
+		return c.Report()
+	}
+	a, b := run(0), run(1)
+	merged, err := Merge(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Runs != 2 {
+		t.Errorf("Merged %d runs, want 2", merged.Runs)
+	}
+	if got := hits(merged.Groups[0].Points[0].Bins); !reflect.DeepEqual(got, map[string]uint64{"idle": 3, "busy": 1, "done": 0}) {
+		t.Errorf("Merged bins %v", got)
+	}
+	if got := hits(merged.FSMs[0].States); got["2'd0"] != 3 || got["2'd1"] != 1 {
+		t.Errorf("Merged states %v", got)
+	}
+	if a.Groups[0].Points[0].Bins[0].Hits != 2 {
+		t.Errorf("Merging should not change its inputs")
+	}
+
+	var js bytes.Buffer
+	if err := merged.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadJSON(&js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, merged) {
+		t.Errorf("JSON round trip changed the report")
+	}
+
+	var text bytes.Buffer
+	if err := merged.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Coverage of Ctl over 2 runs",
+		"groups    2/3 (66.7%)",
+		"fsm       2/3 (66.7%)",
+		"group ctl\n  point state\n",
+		"done                            0  <- missed",
+		"2'd0 -> 2'd1",
+		"always @(posedge clk): case (state_r)",
+		"untoggled bits\n",
+		"rst                      never rose 1, never fell 1",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Text report lacks %q:\n%s", want, text.String())
+		}
+	}
+
+	_, sim := newFIFO(t)
+	if _, err := Merge(a, New(sim).Report()); err == nil || !strings.Contains(err.Error(), "cannot merge reports of Ctl and") {
+		t.Errorf("Reports of different modules should not merge, got %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package coverage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Coverage of one or more runs of a module
+type Report struct {
+	Module   string          `json:"module"`
+	Runs     int             `json:"runs"`
+	Groups   []*GroupReport  `json:"groups,omitempty"`
+	Toggles  []*ToggleReport `json:"toggles,omitempty"`
+	FSMs     []*FSMReport    `json:"fsms,omitempty"`
+	Branches []*BranchReport `json:"branches,omitempty"`
+}
+
+// Named count, used for bins, FSM states and transitions and branch arms
+type BinReport struct {
+	Name string `json:"name"`
+	Hits uint64 `json:"hits"`
+}
+
+type GroupReport struct {
+	Name   string         `json:"name"`
+	Points []*PointReport `json:"points"`
+}
+
+type PointReport struct {
+	Name  string       `json:"name"`
+	Cross bool         `json:"cross,omitempty"`
+	Bins  []*BinReport `json:"bins"`
+}
+
+// Bits of a net seen rising and falling, as masks
+type ToggleReport struct {
+	Net   string `json:"net"`
+	Width int    `json:"width"`
+	Rose  uint64 `json:"rose"`
+	Fell  uint64 `json:"fell"`
+}
+
+// States of a state machine, and the transitions between them that were
+// seen
+type FSMReport struct {
+	Register    string       `json:"register"`
+	States      []*BinReport `json:"states"`
+	Transitions []*BinReport `json:"transitions,omitempty"`
+}
+
+type BranchReport struct {
+	Branch string       `json:"branch"`
+	Arms   []*BinReport `json:"arms"`
+}
+
+// Items covered out of the total in one kind of coverage
+type Score struct {
+	Covered, Total int
+}
+
+func (s Score) Percent() float64 {
+	if s.Total == 0 {
+		return 100
+	}
+	return 100 * float64(s.Covered) / float64(s.Total)
+}
+
+func (s Score) String() string {
+	return fmt.Sprintf("%d/%d (%.1f%%)", s.Covered, s.Total, s.Percent())
+}
+
+func score(s *Score, bins []*BinReport) {
+	for _, b := range bins {
+		s.Total++
+		if b.Hits > 0 {
+			s.Covered++
+		}
+	}
+}
+
+// Bins of the coverage groups, crosses included
+func (r *Report) GroupScore() Score {
+	var s Score
+	for _, g := range r.Groups {
+		for _, p := range g.Points {
+			score(&s, p.Bins)
+		}
+	}
+	return s
+}
+
+// Net bits that both rose and fell
+func (r *Report) ToggleScore() Score {
+	var s Score
+	for _, t := range r.Toggles {
+		s.Total += t.Width
+		s.Covered += bits.OnesCount64(t.Rose & t.Fell)
+	}
+	return s
+}
+
+// States of the state machines that were visited
+func (r *Report) FSMScore() Score {
+	var s Score
+	for _, f := range r.FSMs {
+		score(&s, f.States)
+	}
+	return s
+}
+
+// Arms of the branches that ran
+func (r *Report) BranchScore() Score {
+	var s Score
+	for _, b := range r.Branches {
+		score(&s, b.Arms)
+	}
+	return s
+}
+
+// Combine reports of the same module: counts add up and masks are or-ed
+func Merge(reports ...*Report) (*Report, error) {
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("coverage: no reports to merge")
+	}
+	out := &Report{Module: reports[0].Module}
+	for _, r := range reports {
+		if r.Module != out.Module {
+			return nil, fmt.Errorf("coverage: cannot merge reports of %s and %s", out.Module, r.Module)
+		}
+		out.Runs += r.Runs
+		for _, g := range r.Groups {
+			var into *GroupReport
+			for _, o := range out.Groups {
+				if o.Name == g.Name {
+					into = o
+				}
+			}
+			if into == nil {
+				into = &GroupReport{Name: g.Name}
+				out.Groups = append(out.Groups, into)
+			}
+			for _, p := range g.Points {
+				var pr *PointReport
+				for _, o := range into.Points {
+					if o.Name == p.Name && o.Cross == p.Cross {
+						pr = o
+					}
+				}
+				if pr == nil {
+					pr = &PointReport{Name: p.Name, Cross: p.Cross}
+					into.Points = append(into.Points, pr)
+				}
+				pr.Bins = mergeBins(pr.Bins, p.Bins)
+			}
+		}
+		for _, t := range r.Toggles {
+			var into *ToggleReport
+			for _, o := range out.Toggles {
+				if o.Net == t.Net {
+					into = o
+				}
+			}
+			switch {
+			case into == nil:
+				copied := *t
+				out.Toggles = append(out.Toggles, &copied)
+			case into.Width != t.Width:
+				return nil, fmt.Errorf("coverage: %s is %d bits wide in one report and %d in another", t.Net, into.Width, t.Width)
+			default:
+				into.Rose |= t.Rose
+				into.Fell |= t.Fell
+			}
+		}
+		for _, f := range r.FSMs {
+			var into *FSMReport
+			for _, o := range out.FSMs {
+				if o.Register == f.Register {
+					into = o
+				}
+			}
+			if into == nil {
+				into = &FSMReport{Register: f.Register}
+				out.FSMs = append(out.FSMs, into)
+			}
+			into.States = mergeBins(into.States, f.States)
+			into.Transitions = mergeBins(into.Transitions, f.Transitions)
+		}
+		for _, b := range r.Branches {
+			var into *BranchReport
+			for _, o := range out.Branches {
+				if o.Branch == b.Branch {
+					into = o
+				}
+			}
+			if into == nil {
+				into = &BranchReport{Branch: b.Branch}
+				out.Branches = append(out.Branches, into)
+			}
+			into.Arms = mergeBins(into.Arms, b.Arms)
+		}
+	}
+	return out, nil
+}
+
+func mergeBins(into, from []*BinReport) []*BinReport {
+	index := map[string]*BinReport{}
+	for _, b := range into {
+		index[b.Name] = b
+	}
+	for _, b := range from {
+		if old, ok := index[b.Name]; ok {
+			old.Hits += b.Hits
+			continue
+		}
+		copied := *b
+		index[b.Name] = &copied
+		into = append(into, &copied)
+	}
+	return into
+}
+
+// Write the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Read a report written by WriteJSON
+func ReadJSON(rd io.Reader) (*Report, error) {
+	r := &Report{}
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, fmt.Errorf("coverage: %v", err)
+	}
+	return r, nil
+}
+
+// Write a summary followed by every bin, state and branch arm, marking the
+// ones never hit, and the nets with bits that did not toggle both ways
+func (r *Report) WriteText(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	runs := "1 run"
+	if r.Runs != 1 {
+		runs = fmt.Sprintf("%d runs", r.Runs)
+	}
+	fmt.Fprintf(out, "Coverage of %s over %s\n", r.Module, runs)
+	fmt.Fprintf(out, "  groups    %s\n", r.GroupScore())
+	fmt.Fprintf(out, "  toggle    %s\n", r.ToggleScore())
+	fmt.Fprintf(out, "  fsm       %s\n", r.FSMScore())
+	fmt.Fprintf(out, "  branch    %s\n", r.BranchScore())
+
+	bins := func(indent string, list []*BinReport) {
+		for _, b := range list {
+			mark := ""
+			if b.Hits == 0 {
+				mark = "  <- missed"
+			}
+			fmt.Fprintf(out, "%s%-24s %8d%s\n", indent, b.Name, b.Hits, mark)
+		}
+	}
+	for _, g := range r.Groups {
+		fmt.Fprintf(out, "\ngroup %s\n", g.Name)
+		for _, p := range g.Points {
+			kind := "point"
+			if p.Cross {
+				kind = "cross"
+			}
+			fmt.Fprintf(out, "  %s %s\n", kind, p.Name)
+			bins("    ", p.Bins)
+		}
+	}
+	for _, f := range r.FSMs {
+		fmt.Fprintf(out, "\nfsm %s\n", f.Register)
+		bins("  ", f.States)
+		if len(f.Transitions) > 0 {
+			fmt.Fprintf(out, "  transitions\n")
+			bins("    ", f.Transitions)
+		}
+	}
+	if len(r.Branches) > 0 {
+		fmt.Fprintf(out, "\nbranches\n")
+		for _, b := range r.Branches {
+			fmt.Fprintf(out, "  %s\n", b.Branch)
+			bins("    ", b.Arms)
+		}
+	}
+	header := false
+	for _, t := range r.Toggles {
+		full := mask(t.Width)
+		if t.Rose&t.Fell == full {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(out, "\nuntoggled bits\n")
+			header = true
+		}
+		fmt.Fprintf(out, "  %-24s never rose %0*b, never fell %0*b\n", t.Net, t.Width, full&^t.Rose, t.Width, full&^t.Fell)
+	}
+	return out.Flush()
+}
+
+func mask(width int) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << uint(width)) - 1
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		status int
+		out    string
+	}{
+		{[]string{"-a", "adder", "-b", "adder-complement"}, 0, "SimpleAdder: the two versions are equivalent"},
+		{[]string{"-a", "counter", "-b", "counter-increment"}, 0, "Counter: the two versions are equivalent"},
+		{[]string{"-list"}, 0, "adder\nadder-complement\ncounter\ncounter-increment\n"},
+		{[]string{"-a", "adder", "-b", "subtractor"}, 2, "equiv: unknown version \"subtractor\""},
+		{[]string{"-a", "adder"}, 2, "Versions: adder, adder-complement, counter, counter-increment"},
+		{[]string{"-a", "adder", "-b", "counter"}, 2, "equivalence check of SimpleAdder failed: "},
+	} {
+		var stdout, stderr strings.Builder
+		status := run(tc.args, &stdout, &stderr)
+		out := stdout.String() + stderr.String()
+		if status != tc.status || !strings.Contains(out, tc.out) {
+			t.Errorf("equiv %s = %d, %q, want %d, %q", strings.Join(tc.args, " "), status, out, tc.status, tc.out)
+		}
+	}
+}
+
+func TestRunDifference(t *testing.T) {
+	versions["adder-broken"] = func() *hdl.Module {
+		m := adderComplement()
+		m.Assigns = nil
+		m.AssignExpr(m.Outputs[0], "a - b")
+		return m
+	}
+	defer delete(versions, "adder-broken")
+	var stdout, stderr strings.Builder
+	if status := run([]string{"-a", "adder", "-b", "adder-broken"}, &stdout, &stderr); status != 1 || !strings.Contains(stdout.String(), "sum differs: ") {
+		t.Errorf("equiv of different adders = %d, %q", status, stdout.String())
+	}
+}
@@ -0,0 +1,324 @@
+package formal
+
+// Terms are bit-blasted into clauses for the SAT solver with the Tseitin
+// encoding: every gate gets a variable constrained to its function. Gates
+// with constant inputs fold away, so constants cost no clauses.
+
+type blaster struct {
+	sat   *satSolver
+	true_ lit
+}
+
+func newBlaster() *blaster {
+	b := &blaster{sat: newSatSolver()}
+	b.true_ = mkLit(b.sat.newVar(), false)
+	b.sat.addClause(b.true_)
+	return b
+}
+
+func (b *blaster) constant(v bool) lit {
+	if v {
+		return b.true_
+	}
+	return b.true_.not()
+}
+
+func (b *blaster) isConst(l lit) bool {
+	return l.v() == b.true_.v()
+}
+
+func (b *blaster) fresh(width int) []lit {
+	bits := make([]lit, width)
+	for i := range bits {
+		bits[i] = mkLit(b.sat.newVar(), false)
+	}
+	return bits
+}
+
+func (b *blaster) and(x, y lit) lit {
+	switch {
+	case x == b.true_.not() || y == b.true_.not() || x == y.not():
+		return b.true_.not()
+	case x == b.true_ || x == y:
+		return y
+	case y == b.true_:
+		return x
+	}
+	g := mkLit(b.sat.newVar(), false)
+	b.sat.addClause(g.not(), x)
+	b.sat.addClause(g.not(), y)
+	b.sat.addClause(g, x.not(), y.not())
+	return g
+}
+
+func (b *blaster) or(x, y lit) lit {
+	return b.and(x.not(), y.not()).not()
+}
+
+func (b *blaster) xor(x, y lit) lit {
+	switch {
+	case b.isConst(x):
+		if x == b.true_ {
+			return y.not()
+		}
+		return y
+	case b.isConst(y):
+		return b.xor(y, x)
+	case x == y:
+		return b.true_.not()
+	case x == y.not():
+		return b.true_
+	}
+	g := mkLit(b.sat.newVar(), false)
+	b.sat.addClause(g.not(), x, y)
+	b.sat.addClause(g.not(), x.not(), y.not())
+	b.sat.addClause(g, x.not(), y)
+	b.sat.addClause(g, x, y.not())
+	return g
+}
+
+func (b *blaster) mux(c, x, y lit) lit {
+	switch {
+	case c == b.true_ || x == y:
+		return x
+	case c == b.true_.not():
+		return y
+	}
+	return b.or(b.and(c, x), b.and(c.not(), y))
+}
+
+func (b *blaster) add(x, y []lit, carry lit) []lit {
+	sum := make([]lit, len(x))
+	for i := range x {
+		t := b.xor(x[i], y[i])
+		sum[i] = b.xor(t, carry)
+		carry = b.or(b.and(x[i], y[i]), b.and(t, carry))
+	}
+	return sum
+}
+
+func (b *blaster) invert(x []lit) []lit {
+	out := make([]lit, len(x))
+	for i, l := range x {
+		out[i] = l.not()
+	}
+	return out
+}
+
+// x < y, unsigned
+func (b *blaster) ult(x, y []lit) lit {
+	lt := b.true_.not()
+	for i := range x {
+		differ := b.xor(x[i], y[i])
+		lt = b.mux(differ, y[i], lt)
+	}
+	return lt
+}
+
+func (b *blaster) eq(x, y []lit) lit {
+	all := b.true_
+	for i := range x {
+		all = b.and(all, b.xor(x[i], y[i]).not())
+	}
+	return all
+}
+
+func (b *blaster) mul(x, y []lit) []lit {
+	w := len(x)
+	acc := make([]lit, w)
+	for i := range acc {
+		acc[i] = b.true_.not()
+	}
+	for i := 0; i < w; i++ {
+		if y[i] == b.true_.not() {
+			continue
+		}
+		row := make([]lit, w)
+		for j := range row {
+			if j < i {
+				row[j] = b.true_.not()
+			} else {
+				row[j] = b.and(x[j-i], y[i])
+			}
+		}
+		acc = b.add(acc, row, b.true_.not())
+	}
+	return acc
+}
+
+// Restoring division; dividing by zero gives all ones and the dividend as
+// the remainder, as in SMT-LIB
+func (b *blaster) divide(x, y []lit) (quot, rem []lit) {
+	w := len(x)
+	zero := b.true_.not()
+	r := make([]lit, w+1)
+	for i := range r {
+		r[i] = zero
+	}
+	yy := append(append([]lit{}, y...), zero)
+	quot = make([]lit, w)
+	for i := w - 1; i >= 0; i-- {
+		r = append([]lit{x[i]}, r[:w]...)
+		fits := b.ult(r, yy).not()
+		diff := b.add(r, b.invert(yy), b.true_)
+		for j := range r {
+			r[j] = b.mux(fits, diff[j], r[j])
+		}
+		quot[i] = fits
+	}
+	return quot, r[:w]
+}
+
+func (b *blaster) shift(x, amount []lit, left bool) []lit {
+	w := len(x)
+	out := append([]lit{}, x...)
+	zero := b.true_.not()
+	tooFar := zero
+	for k, a := range amount {
+		dist := 1 << uint(k)
+		if k >= 31 || dist >= w {
+			tooFar = b.or(tooFar, a)
+			continue
+		}
+		next := make([]lit, w)
+		for i := range next {
+			src := i + dist
+			if left {
+				src = i - dist
+			}
+			moved := zero
+			if src >= 0 && src < w {
+				moved = out[src]
+			}
+			next[i] = b.mux(a, moved, out[i])
+		}
+		out = next
+	}
+	for i := range out {
+		out[i] = b.and(out[i], tooFar.not())
+	}
+	return out
+}
+
+// Bits of a term, least significant first, given the bits of its
+// arguments
+func (b *blaster) node(n *Node, args [][]lit) []lit {
+	w := n.Width
+	bits := make([]lit, w)
+	switch n.Op {
+	case "const":
+		for i := range bits {
+			bits[i] = b.constant(n.Value>>uint(i)&1 == 1)
+		}
+	case "not":
+		bits = b.invert(args[0])
+	case "neg":
+		zero := make([]lit, w)
+		for i := range zero {
+			zero[i] = b.true_.not()
+		}
+		bits = b.add(zero, b.invert(args[0]), b.true_)
+	case "redand", "redor", "redxor":
+		acc := b.constant(n.Op == "redand")
+		for _, l := range args[0] {
+			switch n.Op {
+			case "redand":
+				acc = b.and(acc, l)
+			case "redor":
+				acc = b.or(acc, l)
+			default:
+				acc = b.xor(acc, l)
+			}
+		}
+		bits[0] = acc
+	case "and", "or", "xor":
+		for i := range bits {
+			switch n.Op {
+			case "and":
+				bits[i] = b.and(args[0][i], args[1][i])
+			case "or":
+				bits[i] = b.or(args[0][i], args[1][i])
+			default:
+				bits[i] = b.xor(args[0][i], args[1][i])
+			}
+		}
+	case "add":
+		bits = b.add(args[0], args[1], b.true_.not())
+	case "sub":
+		bits = b.add(args[0], b.invert(args[1]), b.true_)
+	case "mul":
+		bits = b.mul(args[0], args[1])
+	case "udiv":
+		bits, _ = b.divide(args[0], args[1])
+	case "urem":
+		_, bits = b.divide(args[0], args[1])
+	case "shl":
+		bits = b.shift(args[0], args[1], true)
+	case "lshr":
+		bits = b.shift(args[0], args[1], false)
+	case "eq":
+		bits[0] = b.eq(args[0], args[1])
+	case "ult":
+		bits[0] = b.ult(args[0], args[1])
+	case "ule":
+		bits[0] = b.ult(args[1], args[0]).not()
+	case "ite":
+		for i := range bits {
+			bits[i] = b.mux(args[0][0], args[1][i], args[2][i])
+		}
+	case "concat":
+		bits = append(append([]lit{}, args[1]...), args[0]...)
+	case "slice":
+		copy(bits, args[0][n.Lo:n.Hi+1])
+	case "zext":
+		copy(bits, args[0])
+		for i := len(args[0]); i < w; i++ {
+			bits[i] = b.true_.not()
+		}
+	default:
+		panic("formal: cannot bit-blast " + n.Op)
+	}
+	return bits
+}
+
+// Bit-blast the roots and every term they depend on, taking the bits of
+// inputs and states from leaf. Nodes lists the terms in ID order.
+func (b *blaster) blast(nodes []*Node, roots []*Node, leaf func(*Node) []lit) map[*Node][]lit {
+	need := map[*Node]bool{}
+	for _, r := range roots {
+		need[r] = true
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if need[nodes[i]] {
+			for _, arg := range nodes[i].Args {
+				need[arg] = true
+			}
+		}
+	}
+	bits := map[*Node][]lit{}
+	for _, n := range nodes {
+		if !need[n] {
+			continue
+		}
+		if n.Op == "input" || n.Op == "state" {
+			bits[n] = leaf(n)
+			continue
+		}
+		args := make([][]lit, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = bits[arg]
+		}
+		bits[n] = b.node(n, args)
+	}
+	return bits
+}
+
+func (b *blaster) value(bits []lit) uint64 {
+	var v uint64
+	for i, l := range bits {
+		if b.sat.modelValue(l) {
+			v |= 1 << uint(i)
+		}
+	}
+	return v
+}
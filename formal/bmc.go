@@ -0,0 +1,361 @@
+package formal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/vcd"
+)
+
+// Decides whether an assertion of a system can fail on a given cycle
+type Solver interface {
+	// Inputs and initial state that make an assertion fail on the cycle,
+	// or nil if none do
+	Counterexample(s *System, cycle int) (*Trace, error)
+}
+
+// SMT-LIB2 solver run as a process that reads the query on standard input
+type SMTSolver struct {
+	Path string
+	Args []string
+}
+
+// Solvers tried by FindSolver, in order
+var KnownSolvers = []SMTSolver{
+	{Path: "z3", Args: []string{"-in"}},
+	{Path: "bitwuzla"},
+	{Path: "boolector", Args: []string{"--smt2"}},
+	{Path: "cvc5", Args: []string{"--lang", "smt2"}},
+	{Path: "yices-smt2"},
+}
+
+// First of the KnownSolvers installed on this machine
+func FindSolver() (*SMTSolver, error) {
+	for _, s := range KnownSolvers {
+		if path, err := exec.LookPath(s.Path); err == nil {
+			return &SMTSolver{Path: path, Args: s.Args}, nil
+		}
+	}
+	return nil, fmt.Errorf("formal: no SMT solver found, install one of z3, bitwuzla, boolector, cvc5 or yices")
+}
+
+func (sv *SMTSolver) Counterexample(s *System, cycle int) (*Trace, error) {
+	var query bytes.Buffer
+	out := bufio.NewWriter(&query)
+	s.writeSMT2(out, cycle, cycle)
+	out.Flush()
+
+	cmd := exec.Command(sv.Path, sv.Args...)
+	cmd.Stdin = &query
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	answer, rest, _ := strings.Cut(strings.TrimLeft(stdout.String(), " \t\r\n"), "\n")
+	switch strings.TrimSpace(answer) {
+	case "unsat":
+		return nil, nil
+	case "sat":
+	default:
+		msg := strings.TrimSpace(stderr.String() + "\n" + stdout.String())
+		if runErr != nil {
+			return nil, fmt.Errorf("formal: %s: %v: %s", sv.Path, runErr, msg)
+		}
+		return nil, fmt.Errorf("formal: %s answered %q", sv.Path, msg)
+	}
+	model, err := parseModel(rest)
+	if err != nil {
+		return nil, fmt.Errorf("formal: %s: %v", sv.Path, err)
+	}
+	return s.trace(model, cycle)
+}
+
+// Built-in solver: bit-blasts the unrolled system for the SAT solver of
+// this package, so no tools need to be installed. Wide multipliers and
+// dividers make it slow.
+type SATSolver struct {
+	MaxConflicts int // give up after this many conflicts, 0 for no limit
+}
+
+func (sv *SATSolver) Counterexample(s *System, cycle int) (*Trace, error) {
+	b := newBlaster()
+	states := map[*Node][]lit{}
+	for _, st := range s.States {
+		states[st.Node] = b.fresh(st.Node.Width)
+	}
+	initial := states
+	inputs := make([]map[*Node][]lit, cycle+1)
+	var bad []lit
+	var failing []*Property
+	for c := 0; c <= cycle; c++ {
+		var roots []*Node
+		for _, p := range s.Assumes {
+			roots = append(roots, p.Bad)
+		}
+		for _, st := range s.States {
+			if c == 0 && st.Init != nil {
+				roots = append(roots, st.Init)
+			}
+			if c < cycle {
+				roots = append(roots, st.Next)
+			}
+		}
+		if c == cycle {
+			for _, p := range s.Asserts {
+				roots = append(roots, p.Bad)
+			}
+		}
+		ins := map[*Node][]lit{}
+		bits := b.blast(s.Nodes, roots, func(n *Node) []lit {
+			if n.Op == "state" {
+				return states[n]
+			}
+			ins[n] = b.fresh(n.Width)
+			return ins[n]
+		})
+		inputs[c] = ins
+
+		for _, p := range s.Assumes {
+			b.sat.addClause(bits[p.Bad][0].not())
+		}
+		if c == 0 {
+			for _, st := range s.States {
+				if st.Init == nil {
+					continue
+				}
+				for i, l := range states[st.Node] {
+					init := bits[st.Init][i]
+					b.sat.addClause(l.not(), init)
+					b.sat.addClause(l, init.not())
+				}
+			}
+		}
+		if c == cycle {
+			for _, p := range s.Asserts {
+				bad = append(bad, bits[p.Bad][0])
+				failing = append(failing, p)
+			}
+			break
+		}
+		next := map[*Node][]lit{}
+		for _, st := range s.States {
+			next[st.Node] = bits[st.Next]
+		}
+		states = next
+	}
+	b.sat.addClause(bad...)
+
+	switch b.sat.solve(sv.MaxConflicts) {
+	case satNo:
+		return nil, nil
+	case satUnknown:
+		return nil, fmt.Errorf("formal: cycle %d undecided after %d conflicts", cycle, sv.MaxConflicts)
+	}
+	t := &Trace{System: s, State: map[string]uint64{}}
+	for i, p := range failing {
+		if b.sat.modelValue(bad[i]) {
+			t.Failed = append(t.Failed, p.Name)
+		}
+	}
+	for _, st := range s.States {
+		t.State[st.Node.Name] = b.value(initial[st.Node])
+	}
+	for _, ins := range inputs {
+		values := map[string]uint64{}
+		for _, in := range s.Inputs {
+			values[in.Name] = b.value(ins[in]) // 0 when nothing reads it
+		}
+		t.Inputs = append(t.Inputs, values)
+	}
+	return t, nil
+}
+
+// Build a trace from solver values named like |en@3|
+func (s *System) trace(model map[string]uint64, cycle int) (*Trace, error) {
+	value := func(name string, cycle int) (uint64, error) {
+		v, ok := model[fmt.Sprintf("%s@%d", name, cycle)]
+		if !ok {
+			return 0, fmt.Errorf("formal: the solver gave no value for %s on cycle %d", name, cycle)
+		}
+		return v, nil
+	}
+	t := &Trace{System: s, State: map[string]uint64{}}
+	for _, c := range s.Asserts {
+		if v, err := value("assert:"+c.Name, cycle); err != nil {
+			return nil, err
+		} else if v == 1 {
+			t.Failed = append(t.Failed, c.Name)
+		}
+	}
+	if len(t.Failed) == 0 {
+		return nil, fmt.Errorf("formal: the solver found no failing assertion on cycle %d", cycle)
+	}
+	for _, st := range s.States {
+		v, err := value(st.Node.Name, 0)
+		if err != nil {
+			return nil, err
+		}
+		t.State[st.Node.Name] = v
+	}
+	for i := 0; i <= cycle; i++ {
+		inputs := map[string]uint64{}
+		for _, in := range s.Inputs {
+			v, err := value(in.Name, i)
+			if err != nil {
+				return nil, err
+			}
+			inputs[in.Name] = v
+		}
+		t.Inputs = append(t.Inputs, inputs)
+	}
+	return t, nil
+}
+
+// Parse the answer to get-value, a list of (symbol value) pairs whose
+// values are #b or #x literals or (_ bvN width)
+func parseModel(text string) (map[string]uint64, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '|':
+			end := strings.IndexByte(text[i+1:], '|')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated symbol in model")
+			}
+			tokens = append(tokens, text[i+1:i+1+end])
+			i += end + 2
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		default:
+			j := i
+			for j < len(text) && !strings.ContainsRune("()| \t\r\n", rune(text[j])) {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		}
+	}
+
+	model := map[string]uint64{}
+	literal := func(tok string) (uint64, error) {
+		switch {
+		case strings.HasPrefix(tok, "#b"):
+			return strconv.ParseUint(tok[2:], 2, 64)
+		case strings.HasPrefix(tok, "#x"):
+			return strconv.ParseUint(tok[2:], 16, 64)
+		case strings.HasPrefix(tok, "bv"):
+			return strconv.ParseUint(tok[2:], 10, 64)
+		}
+		return 0, fmt.Errorf("unexpected value %s in model", tok)
+	}
+	// Pairs are the innermost lists that start with a symbol
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i] != "(" || tokens[i+1] == "(" || tokens[i+1] == ")" {
+			continue
+		}
+		name, val := tokens[i+1], tokens[i+2]
+		if val == "(" && i+5 < len(tokens) && tokens[i+3] == "_" {
+			val = tokens[i+4] // (_ bvN width)
+		}
+		if name == "_" {
+			continue
+		}
+		v, err := literal(val)
+		if err != nil {
+			return nil, err
+		}
+		model[name] = v
+	}
+	return model, nil
+}
+
+// Counterexample found by bounded model checking: the initial state and
+// the inputs on each cycle up to the one where assertions fail
+type Trace struct {
+	System *System
+	Failed []string            // assertions failing on the last cycle
+	State  map[string]uint64   // initial value of every state, by name
+	Inputs []map[string]uint64 // input values of each cycle
+}
+
+// Cycles in the trace, including the failing one
+func (t *Trace) Cycles() int {
+	return len(t.Inputs)
+}
+
+// Check that no assertion can fail within the given number of cycles after
+// the start, trying each cycle in turn so a counterexample is as short as
+// possible. It returns nil when every assertion holds up to the bound.
+func Check(s *System, solver Solver, depth int) (*Trace, error) {
+	if len(s.Asserts) == 0 {
+		return nil, fmt.Errorf("formal: %s has no assertions to check", s.Name)
+	}
+	for cycle := 0; cycle <= depth; cycle++ {
+		t, err := solver.Counterexample(s, cycle)
+		if err != nil || t != nil {
+			return t, err
+		}
+	}
+	return nil, nil
+}
+
+// Drive the trace into a simulator of the same module, started fresh: the
+// state is deposited, inputs are poked before each rising edge of the
+// clock, and the failures the trace predicts must be reported on the last
+// edge
+func (t *Trace) Replay(sim *simulator.Simulator) error {
+	for _, st := range t.System.States {
+		switch {
+		case st.Internal:
+		case st.Memory != "":
+			sim.PokeMem(st.Memory, st.Addr, t.State[st.Node.Name])
+		default:
+			sim.Deposit(st.Node.Name, t.State[st.Node.Name])
+		}
+	}
+	before := len(sim.PropertyFailures())
+	for _, inputs := range t.Inputs {
+		for _, in := range t.System.Inputs {
+			sim.Poke(in.Name, inputs[in.Name])
+		}
+		sim.Cycle(1)
+	}
+	failed := map[string]bool{}
+	for _, f := range sim.PropertyFailures()[before:] {
+		if f.Kind == "assert" && f.Cycle == len(t.Inputs) {
+			failed[f.Name] = true
+		}
+	}
+	for _, name := range t.Failed {
+		if !failed[name] {
+			return fmt.Errorf("formal: assertion %s did not fail when the counterexample was simulated", name)
+		}
+	}
+	return nil
+}
+
+// Replay the trace in a new simulator and write the waveform as VCD
+func (t *Trace) WriteVCD(w io.Writer) error {
+	sim, err := simulator.New(t.System.Netlist.Top)
+	if err != nil {
+		return err
+	}
+	vw, err := vcd.NewWriter(w, sim, vcd.Options{})
+	if err != nil {
+		return err
+	}
+	err = t.Replay(sim)
+	if cerr := vw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package formal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+	"github.com/SoulPancake/HFT/vcd"
+)
+
+// Stand-in for an SMT solver, run by re-executing the test binary. It
+// finds no counterexample before cycle 1 and then answers with reset on
+// cycle 0 and every other value 0, which breaks newEnabledCounter's
+// assertion.
+func TestHelperSolver(t *testing.T) {
+	if os.Getenv("FORMAL_HELPER_SOLVER") != "1" {
+		return
+	}
+	query, _ := io.ReadAll(os.Stdin)
+	if !strings.Contains(string(query), "@1|") {
+		fmt.Println("unsat")
+		os.Exit(0)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprintln(out, "sat")
+	fmt.Fprintln(out, "(")
+	get := regexp.MustCompile(`\(get-value \((.*)\)\)`).FindStringSubmatch(string(query))
+	for _, sym := range strings.Fields(get[1]) {
+		v := "#b0"
+		if sym == "|rst@0|" || strings.HasPrefix(sym, "|assert:") {
+			v = "#b1"
+		}
+		fmt.Fprintf(out, "  (%s %s)\n", sym, v)
+	}
+	fmt.Fprintln(out, ")")
+	out.Flush()
+	os.Exit(0)
+}
+
+func helperSolver(t *testing.T) *SMTSolver {
+	t.Setenv("FORMAL_HELPER_SOLVER", "1")
+	return &SMTSolver{Path: os.Args[0], Args: []string{"-test.run=^TestHelperSolver$"}}
+}
+
+func newEnabledCounter() *hdl.Module {
+	m := testdesigns.Counter()
+	m.Assert("enabled", &hdl.Signal{Name: "en", Width: 1}, m.ClockDomains[0])
+	return m
+}
+
+func TestCheck(t *testing.T) {
+	s, err := Build(newEnabledCounter(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := Check(s, helperSolver(t), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace == nil {
+		t.Fatal("Expected a counterexample")
+	}
+	if trace.Cycles() != 2 || len(trace.Failed) != 1 || trace.Failed[0] != "enabled" {
+		t.Errorf("Trace of %d cycles failing %v, want 2 cycles failing enabled", trace.Cycles(), trace.Failed)
+	}
+	if trace.Inputs[0]["rst"] != 1 || trace.Inputs[1]["rst"] != 0 {
+		t.Errorf("Inputs = %v", trace.Inputs)
+	}
+
+	var b bytes.Buffer
+	if err := trace.WriteVCD(&b); err != nil {
+		t.Fatal(err)
+	}
+	f, err := vcd.Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk, err := f.Lookup("clk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rises := len(clk.Rises()); rises != 2 {
+		t.Errorf("The waveform should show 2 clock edges, got %d", rises)
+	}
+	if v, _ := f.Value("rst", 0).Uint64(); v != 1 {
+		t.Errorf("rst should start high in the waveform")
+	}
+}
+
+func TestCheckReplayMismatch(t *testing.T) {
+	// The helper's answer does not break this assertion, which the replay
+	// must notice
+	m := testdesigns.Counter()
+	m.Assert("enabled", &hdl.Signal{Name: "count_r == 8'd0", Width: 1}, m.ClockDomains[0])
+	s, err := Build(m, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := Check(s, helperSolver(t), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = trace.WriteVCD(io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "did not fail when the counterexample was simulated") {
+		t.Errorf("Expected a replay mismatch, got %v", err)
+	}
+}
+
+func TestCheckWithoutCounterexample(t *testing.T) {
+	s, err := Build(newEnabledCounter(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := Check(s, helperSolver(t), 0)
+	if err != nil || trace != nil {
+		t.Errorf("Check = %v, %v; want no counterexample", trace, err)
+	}
+
+	broken := &SMTSolver{Path: os.Args[0], Args: []string{"-test.run=^$"}}
+	if _, err := Check(s, broken, 0); err == nil || !strings.Contains(err.Error(), "answered") {
+		t.Errorf("A solver answering neither sat nor unsat should fail, got %v", err)
+	}
+}
+
+func TestParseModel(t *testing.T) {
+	model, err := parseModel("((|a@0| #b101)\n (|u.b@1| #x1f) (c@2 (_ bv300 9)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model["a@0"] != 5 || model["u.b@1"] != 31 || model["c@2"] != 300 {
+		t.Errorf("Model = %v", model)
+	}
+}
+
+// Runs when a solver is installed
+func TestCheckWithSolver(t *testing.T) {
+	solver, err := FindSolver()
+	if err != nil {
+		t.Skip(err)
+	}
+	checkCounterAndFIFO(t, solver)
+}
+
+func TestCheckWithSATSolver(t *testing.T) {
+	checkCounterAndFIFO(t, &SATSolver{})
+}
+
+func checkCounterAndFIFO(t *testing.T, solver Solver) {
+	s, err := Build(newCheckedCounter(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := Check(s, solver, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reset, then three enabled cycles bring the count to 3
+	if trace == nil || trace.Cycles() != 5 {
+		t.Fatalf("Expected a 5-cycle counterexample, got %+v", trace)
+	}
+	if err := trace.WriteVCD(io.Discard); err != nil {
+		t.Error(err)
+	}
+
+	m := newFIFO()
+	sys := &hdl.ClockDomain{Name: "sys", Clock: m.Inputs[0], Reset: m.Inputs[1]}
+	m.Assert("not_full_and_empty", &hdl.Signal{Name: "!(wr_full && rd_empty)", Width: 1}, sys)
+	if s, err = Build(m, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if trace, err := Check(s, solver, 8); err != nil || trace != nil {
+		t.Errorf("The FIFO cannot be full and empty, got %+v, %v", trace, err)
+	}
+}
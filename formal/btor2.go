@@ -0,0 +1,111 @@
+package formal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+var btor2Ops = map[string]string{
+	"not": "not", "neg": "neg", "redand": "redand", "redor": "redor", "redxor": "redxor",
+	"and": "and", "or": "or", "xor": "xor", "add": "add", "sub": "sub", "mul": "mul",
+	"udiv": "udiv", "urem": "urem", "shl": "sll", "lshr": "srl",
+	"eq": "eq", "ult": "ult", "ule": "ulte", "ite": "ite", "concat": "concat",
+}
+
+// Terms needed by the next-state functions, initial values and checks, in
+// ID order
+func (s *System) reachable() []*Node {
+	seen := make([]bool, len(s.Nodes))
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		if n == nil || seen[n.ID] {
+			return
+		}
+		seen[n.ID] = true
+		for _, arg := range n.Args {
+			visit(arg)
+		}
+	}
+	for _, in := range s.Inputs {
+		visit(in)
+	}
+	for _, st := range s.States {
+		visit(st.Node)
+		visit(st.Init)
+		visit(st.Next)
+	}
+	for _, c := range append(append([]*Property{}, s.Asserts...), s.Assumes...) {
+		visit(c.Bad)
+	}
+	var nodes []*Node
+	for _, n := range s.Nodes {
+		if seen[n.ID] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// Write the system in BTOR2, the input format of hardware model checkers
+// such as btormc, pono and AVR. Assertions become bad properties and
+// assumptions constraints, both named after the property.
+func WriteBTOR2(w io.Writer, s *System) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "; BTOR2 model of %s, clocked by %s\n", s.Name, s.Clock)
+	line := 0
+	next := func(format string, args ...interface{}) int {
+		line++
+		fmt.Fprintf(out, "%d ", line)
+		fmt.Fprintf(out, format, args...)
+		out.WriteByte('\n')
+		return line
+	}
+
+	nodes := s.reachable()
+	sorts := map[int]int{}
+	for _, n := range nodes {
+		if _, ok := sorts[n.Width]; !ok {
+			sorts[n.Width] = next("sort bitvec %d", n.Width)
+		}
+	}
+	ids := map[*Node]int{}
+	for _, n := range nodes {
+		sort := sorts[n.Width]
+		arg := func(i int) int { return ids[n.Args[i]] }
+		switch n.Op {
+		case "const":
+			ids[n] = next("constd %d %d", sort, n.Value)
+		case "input", "state":
+			ids[n] = next("%s %d %s", n.Op, sort, n.Name)
+		case "slice":
+			ids[n] = next("slice %d %d %d %d", sort, arg(0), n.Hi, n.Lo)
+		case "zext":
+			ids[n] = next("uext %d %d %d", sort, arg(0), n.Width-n.Args[0].Width)
+		default:
+			op, ok := btor2Ops[n.Op]
+			if !ok {
+				return fmt.Errorf("formal: no BTOR2 operator for %s", n.Op)
+			}
+			text := fmt.Sprintf("%s %d", op, sort)
+			for i := range n.Args {
+				text += fmt.Sprintf(" %d", arg(i))
+			}
+			ids[n] = next("%s", text)
+		}
+	}
+	for _, st := range s.States {
+		if st.Init != nil {
+			next("init %d %d %d", sorts[st.Node.Width], ids[st.Node], ids[st.Init])
+		}
+		next("next %d %d %d", sorts[st.Node.Width], ids[st.Node], ids[st.Next])
+	}
+	for _, c := range s.Assumes {
+		held := next("not %d %d", sorts[1], ids[c.Bad])
+		next("constraint %d %s", held, c.Name)
+	}
+	for _, c := range s.Asserts {
+		next("bad %d %s", ids[c.Bad], c.Name)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,263 @@
+package formal
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Options for Equivalent
+type EquivOptions struct {
+	Vectors      int   // random vectors simulated before the SAT check, 1000 by default
+	Seed         int64 // seed of the random vectors
+	MaxConflicts int   // give up the SAT check after this many conflicts, 0 for no limit
+}
+
+// Output or next register value that two versions of a module compute
+// differently, with the inputs that show it
+type Difference struct {
+	Signal string            // output, or register whose next value differs
+	Inputs map[string]uint64 // inputs and current register and memory values
+	A, B   uint64            // values the two versions compute
+	Method string            // "simulation" or "SAT", whichever found it
+}
+
+func (d *Difference) String() string {
+	names := make([]string, 0, len(d.Inputs))
+	for name := range d.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var vector []string
+	for _, name := range names {
+		vector = append(vector, fmt.Sprintf("%s=%#x", name, d.Inputs[name]))
+	}
+	return fmt.Sprintf("%s differs: %#x in the first version, %#x in the second, for %s (found by %s)",
+		d.Signal, d.A, d.B, strings.Join(vector, " "), d.Method)
+}
+
+// Signal compared by the miter, as computed by each version
+type miterPair struct {
+	name string
+	a, b *Node
+}
+
+// Check that two versions of a module compute the same outputs and the
+// same next register and memory values from the same inputs and current
+// state. Ports must match by name and width, and so must the registers and
+// memories: they are cut points taken as free inputs, so the check is
+// combinational and cannot relate versions that encode their state
+// differently. Random simulation runs first and catches most differences;
+// the SAT check then proves equivalence or finds a distinguishing input.
+// The result is nil when the versions are equivalent.
+func Equivalent(a, b *hdl.Module, opts EquivOptions) (*Difference, error) {
+	if opts.Vectors == 0 {
+		opts.Vectors = 1000
+	}
+	sa, err := extract(a, nil)
+	if err != nil {
+		return nil, fmt.Errorf("formal: %s: %v", a.Name, err)
+	}
+	// The second version adds its terms after the first's, so every term
+	// of the first must exist before it is extracted
+	outA, err := outputs(sa)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := extract(b, sa)
+	if err != nil {
+		return nil, fmt.Errorf("formal: %s: %v", b.Name, err)
+	}
+	outB, err := outputs(sb)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := miter(sa, sb, outA, outB)
+	if err != nil {
+		return nil, err
+	}
+	// Leaves in name order, so a seed always draws the same vectors
+	var leaves []*Node
+	seen := map[*Node]bool{}
+	for _, s := range []*System{sa, sb} {
+		for _, in := range s.Inputs {
+			if !seen[in] {
+				seen[in] = true
+				leaves = append(leaves, in)
+			}
+		}
+		for _, st := range s.States {
+			if !seen[st.Node] {
+				seen[st.Node] = true
+				leaves = append(leaves, st.Node)
+			}
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].Name < leaves[j].Name })
+
+	// Random vectors, starting with all zeros and all ones
+	rng := rand.New(rand.NewSource(opts.Seed))
+	for i := 0; i < opts.Vectors; i++ {
+		values := map[string]uint64{}
+		for _, n := range leaves {
+			switch {
+			case i == 1:
+				values[n.Name] = mask(n.Width)
+			case i > 1:
+				switch rng.Intn(8) {
+				case 0:
+				case 1:
+					values[n.Name] = mask(n.Width)
+				default:
+					values[n.Name] = rng.Uint64() & mask(n.Width)
+				}
+			}
+		}
+		if d := compare(sb, pairs, values, "simulation"); d != nil {
+			return d, nil
+		}
+	}
+
+	bl := newBlaster()
+	leafBits := map[*Node][]lit{}
+	var roots []*Node
+	for _, p := range pairs {
+		roots = append(roots, p.a, p.b)
+	}
+	bits := bl.blast(sb.Nodes, roots, func(n *Node) []lit {
+		leafBits[n] = bl.fresh(n.Width)
+		return leafBits[n]
+	})
+	var differ []lit
+	for _, p := range pairs {
+		for i := range bits[p.a] {
+			differ = append(differ, bl.xor(bits[p.a][i], bits[p.b][i]))
+		}
+	}
+	bl.sat.addClause(differ...)
+	switch bl.sat.solve(opts.MaxConflicts) {
+	case satNo:
+		return nil, nil
+	case satUnknown:
+		return nil, fmt.Errorf("formal: equivalence of %s and %s undecided after %d conflicts", a.Name, b.Name, opts.MaxConflicts)
+	}
+	values := map[string]uint64{}
+	for _, n := range leaves {
+		values[n.Name] = bl.value(leafBits[n])
+	}
+	if d := compare(sb, pairs, values, "SAT"); d != nil {
+		return d, nil
+	}
+	return nil, fmt.Errorf("formal: the SAT model does not distinguish %s from %s", a.Name, b.Name)
+}
+
+// Terms of the outputs of a system by name
+func outputs(s *System) (map[string]*Node, error) {
+	out := map[string]*Node{}
+	for name, net := range s.Netlist.Nets {
+		if net.Scope != "" || net.Kind != "output" {
+			continue
+		}
+		n, err := s.net(name)
+		if err != nil {
+			return nil, fmt.Errorf("formal: %s: %v", s.Name, err)
+		}
+		out[name] = n
+	}
+	return out, nil
+}
+
+// Pairs of outputs and next-state functions to compare, after checking
+// that the ports and state of the versions match
+func miter(sa, sb *System, outA, outB map[string]*Node) ([]*miterPair, error) {
+	ports := func(s *System) map[string]*hdl.Net {
+		out := map[string]*hdl.Net{}
+		for name, net := range s.Netlist.Nets {
+			if net.Scope == "" && (net.Kind == "input" || net.Kind == "output") {
+				out[name] = net
+			}
+		}
+		return out
+	}
+	pa, pb := ports(sa), ports(sb)
+	for _, pair := range [][2]map[string]*hdl.Net{{pa, pb}, {pb, pa}} {
+		for _, name := range sortedKeys(toSet(pair[0])) {
+			x, y := pair[0][name], pair[1][name]
+			switch {
+			case y == nil:
+				return nil, fmt.Errorf("formal: %s %s is missing from one version", x.Kind, name)
+			case x.Kind != y.Kind || x.Width != y.Width:
+				return nil, fmt.Errorf("formal: port %s is a %d-bit %s in %s and a %d-bit %s in %s",
+					name, pa[name].Width, pa[name].Kind, sa.Name, pb[name].Width, pb[name].Kind, sb.Name)
+			}
+		}
+	}
+	for _, pair := range [][2]*System{{sa, sb}, {sb, sa}} {
+		for _, st := range pair[0].States {
+			other := pair[1].State(st.Node.Name)
+			if other == nil {
+				return nil, fmt.Errorf("formal: %s has state %s that %s lacks, the check needs the same registers and memories in both",
+					pair[0].Name, st.Node.Name, pair[1].Name)
+			}
+			if other.Node.Width != st.Node.Width {
+				return nil, fmt.Errorf("formal: %s is %d bits wide in %s and %d in %s",
+					st.Node.Name, st.Node.Width, pair[0].Name, other.Node.Width, pair[1].Name)
+			}
+		}
+	}
+
+	var pairs []*miterPair
+	for _, name := range sa.Netlist.NetOrder {
+		if outA[name] != nil {
+			pairs = append(pairs, &miterPair{name: name, a: outA[name], b: outB[name]})
+		}
+	}
+	for _, st := range sa.States {
+		pairs = append(pairs, &miterPair{name: st.Node.Name, a: st.Next, b: sb.State(st.Node.Name).Next})
+	}
+	return pairs, nil
+}
+
+func toSet(nets map[string]*hdl.Net) map[string]bool {
+	set := map[string]bool{}
+	for name := range nets {
+		set[name] = true
+	}
+	return set
+}
+
+// First pair the versions disagree on for the given leaf values
+func compare(s *System, pairs []*miterPair, values map[string]uint64, method string) *Difference {
+	out := s.Eval(values)
+	for _, p := range pairs {
+		if x, y := out[p.a.ID], out[p.b.ID]; x != y {
+			d := &Difference{Signal: p.name, Inputs: map[string]uint64{}, A: x, B: y, Method: method}
+			for name, v := range values {
+				d.Inputs[name] = v
+			}
+			return d
+		}
+	}
+	return nil
+}
+
+// Front end of an equivalence-check command: compare the two versions,
+// write the verdict or the distinguishing inputs to w and return the exit
+// status, 0 when equivalent, 1 on a difference and 2 when the check fails
+func CheckEquivalent(a, b *hdl.Module, opts EquivOptions, w io.Writer) int {
+	d, err := Equivalent(a, b, opts)
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "equivalence check of %s failed: %v\n", a.Name, err)
+		return 2
+	case d != nil:
+		fmt.Fprintln(w, d.String())
+		return 1
+	}
+	fmt.Fprintf(w, "%s: the two versions are equivalent\n", a.Name)
+	return 0
+}
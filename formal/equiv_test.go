@@ -0,0 +1,137 @@
+package formal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newAdder(width hdl.Width, expr string) *hdl.Module {
+	m := core.NewModule("Adder")
+	m.Input("a", width)
+	m.Input("b", width)
+	m.AssignExpr(m.Output("y", width), expr)
+	return m
+}
+
+func TestEquivalent(t *testing.T) {
+	d, err := Equivalent(newAdder(8, "a + b"), newAdder(8, "a - ~b - 8'd1"), EquivOptions{})
+	if err != nil || d != nil {
+		t.Errorf("a + b and a - ~b - 1 should be equivalent, got %v, %v", d, err)
+	}
+
+	// The same counter written another way
+	other := testdesigns.Counter()
+	other.Always = []string{
+		"always @(posedge clk)",
+		"  count_r <= rst ? 8'h0 : count_r + {7'h0, en};",
+	}
+	d, err = Equivalent(testdesigns.Counter(), other, EquivOptions{})
+	if err != nil || d != nil {
+		t.Errorf("The counters should be equivalent, got %v, %v", d, err)
+	}
+}
+
+func TestDifferenceBySimulation(t *testing.T) {
+	d, err := Equivalent(newAdder(8, "a + b"), newAdder(8, "a - b"), EquivOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Signal != "y" || d.Method != "simulation" {
+		t.Fatalf("Expected simulation to tell a + b from a - b, got %v", d)
+	}
+	if d.A != (d.Inputs["a"]+d.Inputs["b"])&0xff || d.B != (d.Inputs["a"]-d.Inputs["b"])&0xff {
+		t.Errorf("Values do not match the inputs: %v", d)
+	}
+}
+
+func TestDifferenceBySAT(t *testing.T) {
+	// One input value in 2^16 differs, too rare for random vectors
+	d, err := Equivalent(newAdder(16, "a + b"), newAdder(16, "(a == 16'hbeef) ? b : a + b"), EquivOptions{Vectors: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Method != "SAT" || d.Inputs["a"] != 0xbeef || d.Signal != "y" {
+		t.Fatalf("Expected SAT to find a = 0xbeef, got %v", d)
+	}
+	if !strings.Contains(d.String(), "y differs: ") || !strings.Contains(d.String(), "a=0xbeef") {
+		t.Errorf("Difference reads %q", d)
+	}
+
+	// Next register values are compared too
+	other := testdesigns.Counter()
+	other.Always = []string{
+		"always @(posedge clk)",
+		"  count_r <= rst ? 8'h0 : count_r + {7'h0, en & (count_r != 8'd77)};",
+	}
+	d, err = Equivalent(testdesigns.Counter(), other, EquivOptions{Vectors: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Signal != "count_r" || d.Inputs["count_r"] != 77 || d.Inputs["en"] != 1 || d.Inputs["rst"] != 0 {
+		t.Errorf("Expected the counters to differ at count_r = 77, got %v", d)
+	}
+}
+
+func TestDifferenceIsReproducible(t *testing.T) {
+	// All zeros and all ones agree, so the random vectors find the difference
+	newGate := func(expr string) *hdl.Module {
+		m := core.NewModule("Gate")
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			m.Input(name, 8)
+		}
+		m.AssignExpr(m.Output("y", 8), expr)
+		return m
+	}
+	opts := EquivOptions{Seed: 42}
+	first, err := Equivalent(newGate("a & b & c & d & e"), newGate("a | b | c | d | e"), opts)
+	if err != nil || first == nil || first.Method != "simulation" {
+		t.Fatalf("Expected simulation to find a difference, got %v, %v", first, err)
+	}
+	for i := 0; i < 5; i++ {
+		d, err := Equivalent(newGate("a & b & c & d & e"), newGate("a | b | c | d | e"), opts)
+		if err != nil || !reflect.DeepEqual(d, first) {
+			t.Fatalf("The same seed should give the same difference, got %v and %v", first, d)
+		}
+	}
+}
+
+func TestEquivalenceMismatch(t *testing.T) {
+	if _, err := Equivalent(newAdder(8, "a + b"), newAdder(9, "a + b"), EquivOptions{}); err == nil || !strings.Contains(err.Error(), "8-bit input in Adder and a 9-bit input") {
+		t.Errorf("Port widths should be compared, got %v", err)
+	}
+	other := newAdder(8, "a + b")
+	other.Input("c", 1)
+	if _, err := Equivalent(newAdder(8, "a + b"), other, EquivOptions{}); err == nil || !strings.Contains(err.Error(), "input c is missing") {
+		t.Errorf("Missing ports should be reported, got %v", err)
+	}
+	renamed := testdesigns.Counter()
+	renamed.Regs[0].Name = "value"
+	renamed.Always = []string{"always @(posedge clk) value <= rst ? 8'h0 : value + en;"}
+	renamed.Assigns = nil
+	renamed.AssignName("count", "value")
+	if _, err := Equivalent(testdesigns.Counter(), renamed, EquivOptions{}); err == nil || !strings.Contains(err.Error(), "same registers") {
+		t.Errorf("Different registers should be rejected, got %v", err)
+	}
+}
+
+func TestCheckEquivalent(t *testing.T) {
+	for _, tc := range []struct {
+		b      *hdl.Module
+		status int
+		out    string
+	}{
+		{newAdder(8, "a - ~b - 8'd1"), 0, "Adder: the two versions are equivalent"},
+		{newAdder(8, "a - b"), 1, "y differs: "},
+		{newAdder(9, "a + b"), 2, "equivalence check of Adder failed: "},
+	} {
+		var out strings.Builder
+		if status := CheckEquivalent(newAdder(8, "a + b"), tc.b, EquivOptions{}, &out); status != tc.status || !strings.Contains(out.String(), tc.out) {
+			t.Errorf("CheckEquivalent = %d, %q, want %d, %q", status, out.String(), tc.status, tc.out)
+		}
+	}
+}
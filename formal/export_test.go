@@ -0,0 +1,80 @@
+package formal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newCheckedCounter() *hdl.Module {
+	m := testdesigns.Counter()
+	m.Assert("below_limit", &hdl.Signal{Name: "count_r < 8'd3", Width: 1}, m.ClockDomains[0])
+	m.Assume("steady", &hdl.Signal{Name: "!$fell(en)", Width: 1}, m.ClockDomains[0])
+	return m
+}
+
+func TestWriteBTOR2(t *testing.T) {
+	s, err := Build(newCheckedCounter(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteBTOR2(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"; BTOR2 model of Counter, clocked by clk\n",
+		"1 sort bitvec 1\n",
+		" input 1 rst\n",
+		" input 1 en\n",
+		" state 2 count_r\n",
+		" ult 1 ",
+		" constraint ",
+		" steady\n",
+		" constraint ",
+		"_reset_rst\n",
+		" bad ",
+		" below_limit\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("BTOR2 lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "input 1 clk") {
+		t.Errorf("The clock should not be an input:\n%s", out)
+	}
+}
+
+func TestWriteSMT2(t *testing.T) {
+	s, err := Build(newCheckedCounter(), Options{ResetCycles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteSMT2(&b, s, 3); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"(set-logic QF_BV)\n",
+		"(declare-fun |en@3| () (_ BitVec 1))\n",
+		"(declare-fun |count_r@0| () (_ BitVec 8))\n",
+		"(define-fun |count_r@1| () (_ BitVec 8) |_n",
+		"(define-fun |assert:below_limit@2| () (_ BitVec 1) ",
+		"(assert (= |_reset_cycles@0| #b00))\n",
+		"(assert (or (= |assert:below_limit@0| #b1) ",
+		" (= |assert:below_limit@3| #b1)))\n",
+		"(check-sat)\n(get-value (",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("SMT-LIB2 lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "@4|") {
+		t.Errorf("Depth 3 should unroll cycles 0 to 3:\n%s", out)
+	}
+}
@@ -0,0 +1,698 @@
+package formal
+
+import (
+	"fmt"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Expressions and statements are executed symbolically: every net and
+// assignment target gets a term over the inputs and state. Widths follow
+// the simulator, so a counterexample replays exactly: operands extend to
+// the width of their context and out-of-range bit selects read 0.
+
+// Values assigned so far in a block of statements
+type env struct {
+	clocked bool
+	vars    map[string]*Node // blocking assignments, visible to later reads
+	pending map[string]*Node // nonblocking assignments of a clocked process
+}
+
+func newEnv(clocked bool) *env {
+	return &env{clocked: clocked, vars: make(map[string]*Node), pending: make(map[string]*Node)}
+}
+
+func (e *env) clone() *env {
+	c := newEnv(e.clocked)
+	for k, v := range e.vars {
+		c.vars[k] = v
+	}
+	for k, v := range e.pending {
+		c.pending[k] = v
+	}
+	return c
+}
+
+// Translates expressions and statements to terms
+type builder struct {
+	s    *System
+	env  *env
+	past bool // sampled-value functions are allowed
+}
+
+// Value of a net or memory word before the block assigned it
+func (b *builder) initial(name string) (*Node, error) {
+	if st, ok := b.s.state[name]; ok && st.Memory != "" {
+		return st.Node, nil
+	}
+	return b.s.net(name)
+}
+
+func (b *builder) read(name string) (*Node, error) {
+	if v, ok := b.env.vars[name]; ok {
+		return v, nil
+	}
+	return b.initial(name)
+}
+
+// Current value of a target, including nonblocking writes still pending
+func (b *builder) target(name string, nonblocking bool) (*Node, error) {
+	if v, ok := b.env.pending[name]; ok && nonblocking {
+		return v, nil
+	}
+	return b.read(name)
+}
+
+// Self-determined width of an expression
+func (b *builder) width(e *hdl.Expr) (int, error) {
+	return b.s.Netlist.ExprWidth(e)
+}
+
+func (b *builder) maxWidth(x, y *hdl.Expr) (int, error) {
+	return b.s.Netlist.MaxExprWidth(x, y)
+}
+
+// Term of an expression evaluated in a context of at least ctx bits
+func (b *builder) expr(e *hdl.Expr, ctx int) (*Node, error) {
+	self, err := b.width(e)
+	if err != nil {
+		return nil, err
+	}
+	w := self
+	if ctx > w {
+		w = ctx
+	}
+	if w > 64 {
+		return nil, fmt.Errorf("%s is %d bits wide, formal export supports up to 64", e, w)
+	}
+	s := b.s
+
+	switch e.Kind {
+	case hdl.ExprIdent:
+		v, err := b.read(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		return s.resize(v, w), nil
+
+	case hdl.ExprConst:
+		if e.XMask != 0 {
+			return nil, fmt.Errorf("%s: x and z literals are not supported", e)
+		}
+		return s.constant(e.Value, w), nil
+
+	case hdl.ExprIndex:
+		idx, err := b.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, err
+		}
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if _, ok := s.Netlist.Memories[base.Name]; ok {
+				v, err := b.memRead(base.Name, idx)
+				if err != nil {
+					return nil, err
+				}
+				return s.resize(v, w), nil
+			}
+		}
+		base, err := b.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, err
+		}
+		bit := s.slice(s.shift("lshr", base, idx), 0, 0)
+		return s.resize(bit, w), nil
+
+	case hdl.ExprSlice:
+		base, err := b.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, err
+		}
+		if base.Width <= e.Hi {
+			base = s.resize(base, e.Hi+1)
+		}
+		return s.resize(s.slice(base, e.Hi, e.Lo), w), nil
+
+	case hdl.ExprUnary:
+		return b.unary(e, w)
+
+	case hdl.ExprBinary:
+		return b.binary(e, w)
+
+	case hdl.ExprTernary:
+		cond, err := b.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, err
+		}
+		x, err := b.expr(e.Args[1], w)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b.expr(e.Args[2], w)
+		if err != nil {
+			return nil, err
+		}
+		return s.ite(s.truth(cond), x, y), nil
+
+	case hdl.ExprConcat, hdl.ExprRepeat:
+		var one *Node
+		for _, arg := range e.Args {
+			part, err := b.expr(arg, 0)
+			if err != nil {
+				return nil, err
+			}
+			if one == nil {
+				one = part
+			} else {
+				one = s.op("concat", one.Width+part.Width, one, part)
+			}
+		}
+		v := one
+		if e.Kind == hdl.ExprRepeat {
+			for r := 1; r < e.Count; r++ {
+				v = s.op("concat", v.Width+one.Width, v, one)
+			}
+		}
+		return s.resize(v, w), nil
+
+	case hdl.ExprCall:
+		v, err := b.call(e)
+		if err != nil {
+			return nil, err
+		}
+		return s.resize(v, w), nil
+	}
+	return nil, fmt.Errorf("unsupported expression %s", e)
+}
+
+func (b *builder) unary(e *hdl.Expr, w int) (*Node, error) {
+	s := b.s
+	switch e.Op {
+	case "~", "-", "+":
+		arg, err := b.expr(e.Args[0], w)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case "~":
+			return s.op("not", w, arg), nil
+		case "-":
+			return s.op("neg", w, arg), nil
+		}
+		return arg, nil
+	}
+	arg, err := b.expr(e.Args[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	var v *Node
+	switch e.Op {
+	case "!", "~|":
+		v = s.op("not", 1, s.op("redor", 1, arg))
+	case "&":
+		v = s.op("redand", 1, arg)
+	case "~&":
+		v = s.op("not", 1, s.op("redand", 1, arg))
+	case "|":
+		v = s.op("redor", 1, arg)
+	case "^":
+		v = s.op("redxor", 1, arg)
+	case "~^", "^~":
+		v = s.op("not", 1, s.op("redxor", 1, arg))
+	default:
+		return nil, fmt.Errorf("unsupported operator %s", e.Op)
+	}
+	return s.resize(v, w), nil
+}
+
+func (b *builder) binary(e *hdl.Expr, w int) (*Node, error) {
+	s := b.s
+	switch e.Op {
+	case "==", "!=", "===", "!==", "<", "<=", ">", ">=":
+		// Operands are sized to each other, not to the context
+		ow, err := b.maxWidth(e.Args[0], e.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		x, err := b.expr(e.Args[0], ow)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b.expr(e.Args[1], ow)
+		if err != nil {
+			return nil, err
+		}
+		var v *Node
+		switch e.Op {
+		case "==", "===":
+			v = s.op("eq", 1, x, y)
+		case "!=", "!==":
+			v = s.op("not", 1, s.op("eq", 1, x, y))
+		case "<":
+			v = s.op("ult", 1, x, y)
+		case "<=":
+			v = s.op("ule", 1, x, y)
+		case ">":
+			v = s.op("ult", 1, y, x)
+		default:
+			v = s.op("ule", 1, y, x)
+		}
+		return s.resize(v, w), nil
+
+	case "&&", "||":
+		x, err := b.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, err
+		}
+		op := "and"
+		if e.Op == "||" {
+			op = "or"
+		}
+		return s.resize(s.op(op, 1, s.truth(x), s.truth(y)), w), nil
+
+	case "<<", ">>", "<<<", ">>>", "**":
+		x, err := b.expr(e.Args[0], w)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case "<<", "<<<":
+			return s.shift("shl", x, y), nil
+		case ">>", ">>>":
+			return s.shift("lshr", x, y), nil
+		}
+		if y.Op != "const" {
+			return nil, fmt.Errorf("%s: the exponent must be constant", e)
+		}
+		v := s.constant(1, w)
+		for i := uint64(0); i < y.Value && i < 64; i++ {
+			v = s.op("mul", w, v, x)
+		}
+		return v, nil
+	}
+
+	x, err := b.expr(e.Args[0], w)
+	if err != nil {
+		return nil, err
+	}
+	y, err := b.expr(e.Args[1], w)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "+":
+		return s.op("add", w, x, y), nil
+	case "-":
+		return s.op("sub", w, x, y), nil
+	case "*":
+		return s.op("mul", w, x, y), nil
+	case "/", "%":
+		// The simulator divides by zero to 0
+		op := "udiv"
+		if e.Op == "%" {
+			op = "urem"
+		}
+		zero := s.constant(0, w)
+		return s.ite(s.op("eq", 1, y, zero), zero, s.op(op, w, x, y)), nil
+	case "&":
+		return s.op("and", w, x, y), nil
+	case "|":
+		return s.op("or", w, x, y), nil
+	case "^":
+		return s.op("xor", w, x, y), nil
+	case "~^", "^~":
+		return s.op("not", w, s.op("xor", w, x, y)), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+// Word of a memory at a symbolic address; addresses past the end read 0
+func (b *builder) memRead(name string, addr *Node) (*Node, error) {
+	s := b.s
+	words := s.words[name]
+	v := s.constant(0, words[0].Node.Width)
+	for i := len(words) - 1; i >= 0; i-- {
+		if addr.Width < 64 && uint64(i) > mask(addr.Width) {
+			continue
+		}
+		word, err := b.read(words[i].Node.Name)
+		if err != nil {
+			return nil, err
+		}
+		v = s.ite(s.op("eq", 1, addr, s.constant(uint64(i), addr.Width)), word, v)
+	}
+	return v, nil
+}
+
+// Sampled-value function of a property: $past reads a chain of internal
+// registers that start at 0, as in the simulator
+func (b *builder) call(e *hdl.Expr) (*Node, error) {
+	if !b.past {
+		return nil, fmt.Errorf("%s is only allowed in properties", e.Name)
+	}
+	depth := 1
+	switch e.Name {
+	case "$past":
+		if len(e.Args) == 2 {
+			n := e.Args[1]
+			if n.Kind != hdl.ExprConst || n.Value < 1 || n.Value > 63 {
+				return nil, fmt.Errorf("%s: cycles must be a constant from 1 to 63", e)
+			}
+			depth = int(n.Value)
+		} else if len(e.Args) != 1 {
+			return nil, fmt.Errorf("%s takes an expression and a cycle count", e)
+		}
+	case "$rose", "$fell", "$stable":
+		if len(e.Args) != 1 {
+			return nil, fmt.Errorf("%s takes one expression", e)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported function %s", e.Name)
+	}
+	arg, err := b.expr(e.Args[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	s := b.s
+	past := arg
+	for i := 1; i <= depth; i++ {
+		st := s.addState(fmt.Sprintf("_past%d_%d", len(s.States), i), arg.Width)
+		st.Internal = true
+		st.Init = s.constant(0, arg.Width)
+		st.Next = past
+		past = st.Node
+	}
+	now, was := s.slice(arg, 0, 0), s.slice(past, 0, 0)
+	switch e.Name {
+	case "$past":
+		return past, nil
+	case "$rose":
+		return s.op("and", 1, now, s.op("not", 1, was)), nil
+	case "$fell":
+		return s.op("and", 1, s.op("not", 1, now), was), nil
+	}
+	return s.op("eq", 1, arg, past), nil
+}
+
+// Execute a statement, updating the values in the environment
+func (b *builder) stmt(st *hdl.Stmt) error {
+	if st == nil {
+		return nil
+	}
+	switch st.Kind {
+	case hdl.StmtBlock:
+		for _, body := range st.Body {
+			if err := b.stmt(body); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case hdl.StmtIf:
+		cond, err := b.expr(st.Cond, 0)
+		if err != nil {
+			return err
+		}
+		return b.branch(b.s.truth(cond), func(then *builder) error {
+			return then.stmt(st.Then)
+		}, func(els *builder) error {
+			return els.stmt(st.Else)
+		})
+
+	case hdl.StmtCase:
+		return b.caseStmt(st)
+
+	case hdl.StmtBlocking, hdl.StmtNonblocking:
+		return b.assign(st.LHS, st.RHS, st.Kind == hdl.StmtNonblocking && b.env.clocked)
+	}
+	return fmt.Errorf("unsupported statement")
+}
+
+// Run both sides of a condition and merge what they assigned
+func (b *builder) branch(cond *Node, then, els func(*builder) error) error {
+	tb := &builder{s: b.s, env: b.env.clone(), past: b.past}
+	eb := &builder{s: b.s, env: b.env.clone(), past: b.past}
+	if err := then(tb); err != nil {
+		return err
+	}
+	if err := els(eb); err != nil {
+		return err
+	}
+	merge := func(into, x, y map[string]*Node, fallback func(string) (*Node, error)) error {
+		names := map[string]bool{}
+		for k := range x {
+			names[k] = true
+		}
+		for k := range y {
+			names[k] = true
+		}
+		for _, k := range sortedKeys(names) {
+			vx, okx := x[k]
+			vy, oky := y[k]
+			if !okx || !oky {
+				old, err := fallback(k)
+				if err != nil {
+					return err
+				}
+				if !okx {
+					vx = old
+				} else {
+					vy = old
+				}
+			}
+			into[k] = b.s.ite(cond, vx, vy)
+		}
+		return nil
+	}
+	if err := merge(b.env.vars, tb.env.vars, eb.env.vars, b.initial); err != nil {
+		return err
+	}
+	return merge(b.env.pending, tb.env.pending, eb.env.pending, b.read)
+}
+
+func (b *builder) caseStmt(st *hdl.Stmt) error {
+	// Selector and labels are sized to each other like an equality
+	w, err := b.width(st.Cond)
+	if err != nil {
+		return err
+	}
+	for _, item := range st.Items {
+		for _, label := range item.Labels {
+			lw, err := b.width(label)
+			if err != nil {
+				return err
+			}
+			if lw > w {
+				w = lw
+			}
+		}
+	}
+	sel, err := b.expr(st.Cond, w)
+	if err != nil {
+		return err
+	}
+	var items []*hdl.CaseItem
+	var fallback *hdl.Stmt
+	for _, item := range st.Items {
+		if item.Labels == nil {
+			fallback = item.Body
+		} else {
+			items = append(items, item)
+		}
+	}
+	// The first matching item wins, so conditions nest from the front
+	var run func(b *builder, i int) error
+	run = func(b *builder, i int) error {
+		if i == len(items) {
+			return b.stmt(fallback)
+		}
+		match := b.s.constant(0, 1)
+		for _, label := range items[i].Labels {
+			v, err := b.expr(label, w)
+			if err != nil {
+				return err
+			}
+			match = b.s.op("or", 1, match, b.s.op("eq", 1, sel, v))
+		}
+		return b.branch(match, func(then *builder) error {
+			return then.stmt(items[i].Body)
+		}, func(els *builder) error {
+			return run(els, i+1)
+		})
+	}
+	return run(b, 0)
+}
+
+// Width of an assignment target
+func (b *builder) lvalueWidth(e *hdl.Expr) (int, error) {
+	switch e.Kind {
+	case hdl.ExprIdent, hdl.ExprIndex, hdl.ExprSlice:
+		return b.width(e)
+	case hdl.ExprConcat:
+		total := 0
+		for _, arg := range e.Args {
+			w, err := b.lvalueWidth(arg)
+			if err != nil {
+				return 0, err
+			}
+			total += w
+		}
+		return total, nil
+	}
+	return 0, fmt.Errorf("%s is not assignable", e)
+}
+
+func (b *builder) assign(lhs, rhs *hdl.Expr, nonblocking bool) error {
+	w, err := b.lvalueWidth(lhs)
+	if err != nil {
+		return err
+	}
+	v, err := b.expr(rhs, w)
+	if err != nil {
+		return err
+	}
+	return b.write(lhs, b.s.resize(v, w), nonblocking)
+}
+
+func (b *builder) set(name string, v *Node, nonblocking bool) {
+	if nonblocking {
+		b.env.pending[name] = v
+	} else {
+		b.env.vars[name] = v
+	}
+}
+
+// Assign v to a target by rewriting the whole of its base signal
+func (b *builder) write(e *hdl.Expr, v *Node, nonblocking bool) error {
+	s := b.s
+	switch e.Kind {
+	case hdl.ExprIdent:
+		if _, ok := s.Netlist.Nets[e.Name]; !ok {
+			return fmt.Errorf("undeclared identifier %s", e.Name)
+		}
+		b.set(e.Name, v, nonblocking)
+		return nil
+
+	case hdl.ExprIndex:
+		idx, err := b.expr(e.Args[1], 0)
+		if err != nil {
+			return err
+		}
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if _, ok := s.Netlist.Memories[base.Name]; ok {
+				for i, word := range s.words[base.Name] {
+					if idx.Width < 64 && uint64(i) > mask(idx.Width) {
+						break
+					}
+					old, err := b.target(word.Node.Name, nonblocking)
+					if err != nil {
+						return err
+					}
+					hit := s.op("eq", 1, idx, s.constant(uint64(i), idx.Width))
+					b.set(word.Node.Name, s.ite(hit, v, old), nonblocking)
+				}
+				return nil
+			}
+		}
+		old, err := b.lvalueRead(e.Args[0], nonblocking)
+		if err != nil {
+			return err
+		}
+		bw := old.Width
+		bit := s.shift("shl", s.constant(1, bw), idx)
+		moved := s.shift("shl", s.resize(v, bw), idx)
+		next := s.op("or", bw, s.op("and", bw, old, s.op("not", bw, bit)), s.op("and", bw, moved, bit))
+		return b.write(e.Args[0], next, nonblocking)
+
+	case hdl.ExprSlice:
+		old, err := b.lvalueRead(e.Args[0], nonblocking)
+		if err != nil {
+			return err
+		}
+		bw := old.Width
+		if e.Lo >= bw {
+			return nil
+		}
+		hi := e.Hi
+		if hi >= bw {
+			hi = bw - 1
+		}
+		next := s.resize(v, hi-e.Lo+1)
+		if e.Lo > 0 {
+			next = s.op("concat", next.Width+e.Lo, next, s.slice(old, e.Lo-1, 0))
+		}
+		if hi < bw-1 {
+			next = s.op("concat", bw, s.slice(old, bw-1, hi+1), next)
+		}
+		return b.write(e.Args[0], next, nonblocking)
+
+	case hdl.ExprConcat:
+		lo := 0
+		for i := len(e.Args) - 1; i >= 0; i-- {
+			w, err := b.lvalueWidth(e.Args[i])
+			if err != nil {
+				return err
+			}
+			if err := b.write(e.Args[i], s.slice(v, lo+w-1, lo), nonblocking); err != nil {
+				return err
+			}
+			lo += w
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not assignable", e)
+}
+
+// Current value of a target that is partly overwritten
+func (b *builder) lvalueRead(e *hdl.Expr, nonblocking bool) (*Node, error) {
+	switch e.Kind {
+	case hdl.ExprIdent:
+		return b.target(e.Name, nonblocking)
+	case hdl.ExprIndex, hdl.ExprSlice:
+		if e.Args[0].Kind == hdl.ExprIdent {
+			if _, ok := b.s.Netlist.Memories[e.Args[0].Name]; ok {
+				return nil, fmt.Errorf("%s: bits of memory words cannot be assigned", e)
+			}
+		}
+		v, err := b.lvalueRead(e.Args[0], nonblocking)
+		if err != nil {
+			return nil, err
+		}
+		if e.Kind == hdl.ExprSlice {
+			return b.s.slice(b.s.resize(v, e.Hi+1), e.Hi, e.Lo), nil
+		}
+		idx, err := b.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, err
+		}
+		return b.s.slice(b.s.shift("lshr", v, idx), 0, 0), nil
+	}
+	return nil, fmt.Errorf("%s is not assignable", e)
+}
+
+// Call fn for every assignment in a statement
+func assignments(st *hdl.Stmt, fn func(*hdl.Stmt)) {
+	if st == nil {
+		return
+	}
+	switch st.Kind {
+	case hdl.StmtBlocking, hdl.StmtNonblocking:
+		fn(st)
+	case hdl.StmtIf:
+		assignments(st.Then, fn)
+		assignments(st.Else, fn)
+	}
+	for _, body := range st.Body {
+		assignments(body, fn)
+	}
+	for _, item := range st.Items {
+		assignments(item.Body, fn)
+	}
+}
@@ -0,0 +1,217 @@
+package formal
+
+import (
+	"fmt"
+	"strings"
+)
+
+func mask(width int) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << uint(width)) - 1
+}
+
+// Add a term, reusing an identical one if it exists
+func (s *System) add(n *Node) *Node {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s/%d/%d/%s/%d/%d", n.Op, n.Width, n.Value, n.Name, n.Hi, n.Lo)
+	for _, arg := range n.Args {
+		fmt.Fprintf(&key, "/%d", arg.ID)
+	}
+	if old, ok := s.cache[key.String()]; ok {
+		return old
+	}
+	n.ID = len(s.Nodes)
+	s.Nodes = append(s.Nodes, n)
+	s.cache[key.String()] = n
+	return n
+}
+
+func (s *System) constant(v uint64, width int) *Node {
+	return s.add(&Node{Op: "const", Width: width, Value: v & mask(width)})
+}
+
+// Operator term, folded when the arguments allow it
+func (s *System) op(op string, width int, args ...*Node) *Node {
+	n := &Node{Op: op, Width: width, Args: args}
+	folded := true
+	vals := make([]uint64, len(args))
+	for i, arg := range args {
+		if arg.Op != "const" {
+			folded = false
+			break
+		}
+		vals[i] = arg.Value
+	}
+	if folded {
+		return s.constant(n.Apply(vals), width)
+	}
+	isConst := func(a *Node, v uint64) bool { return a.Op == "const" && a.Value == v }
+	switch op {
+	case "redand", "redor", "redxor":
+		if args[0].Width == 1 {
+			return args[0]
+		}
+	case "not":
+		if args[0].Op == "not" {
+			return args[0].Args[0]
+		}
+	case "and":
+		for i, a := range args {
+			if isConst(a, 0) {
+				return a
+			}
+			if isConst(a, mask(width)) {
+				return args[1-i]
+			}
+		}
+		if args[0] == args[1] {
+			return args[0]
+		}
+	case "or", "xor", "add":
+		for i, a := range args {
+			if isConst(a, 0) {
+				return args[1-i]
+			}
+		}
+		if op == "or" && args[0] == args[1] {
+			return args[0]
+		}
+	case "zext":
+		if args[0].Width == width {
+			return args[0]
+		}
+	}
+	return s.add(n)
+}
+
+// Value of the term given the values of its arguments
+func (n *Node) Apply(args []uint64) uint64 {
+	m := mask(n.Width)
+	switch n.Op {
+	case "const":
+		return n.Value
+	case "not":
+		return ^args[0] & m
+	case "neg":
+		return -args[0] & m
+	case "redand":
+		return b2u(args[0] == mask(n.Args[0].Width))
+	case "redor":
+		return b2u(args[0] != 0)
+	case "redxor":
+		v := args[0]
+		v ^= v >> 32
+		v ^= v >> 16
+		v ^= v >> 8
+		v ^= v >> 4
+		v ^= v >> 2
+		v ^= v >> 1
+		return v & 1
+	case "and":
+		return args[0] & args[1]
+	case "or":
+		return args[0] | args[1]
+	case "xor":
+		return args[0] ^ args[1]
+	case "add":
+		return (args[0] + args[1]) & m
+	case "sub":
+		return (args[0] - args[1]) & m
+	case "mul":
+		return (args[0] * args[1]) & m
+	case "udiv":
+		if args[1] == 0 {
+			return m
+		}
+		return args[0] / args[1]
+	case "urem":
+		if args[1] == 0 {
+			return args[0]
+		}
+		return args[0] % args[1]
+	case "shl":
+		if args[1] >= uint64(n.Width) {
+			return 0
+		}
+		return args[0] << args[1] & m
+	case "lshr":
+		if args[1] >= uint64(n.Width) {
+			return 0
+		}
+		return args[0] >> args[1]
+	case "eq":
+		return b2u(args[0] == args[1])
+	case "ult":
+		return b2u(args[0] < args[1])
+	case "ule":
+		return b2u(args[0] <= args[1])
+	case "ite":
+		if args[0] != 0 {
+			return args[1]
+		}
+		return args[2]
+	case "concat":
+		return (args[0]<<uint(n.Args[1].Width) | args[1]) & m
+	case "slice":
+		return args[0] >> uint(n.Lo) & m
+	case "zext":
+		return args[0]
+	}
+	panic(fmt.Sprintf("formal: cannot evaluate %s", n.Op))
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *System) ite(cond, a, b *Node) *Node {
+	if a == b {
+		return a
+	}
+	return s.op("ite", a.Width, cond, a, b)
+}
+
+func (s *System) slice(n *Node, hi, lo int) *Node {
+	if lo == 0 && hi == n.Width-1 {
+		return n
+	}
+	if n.Op == "const" {
+		return s.constant(n.Value>>uint(lo), hi-lo+1)
+	}
+	return s.add(&Node{Op: "slice", Width: hi - lo + 1, Args: []*Node{n}, Hi: hi, Lo: lo})
+}
+
+// Zero-extend or truncate to a width
+func (s *System) resize(n *Node, width int) *Node {
+	switch {
+	case n.Width < width:
+		return s.op("zext", width, n)
+	case n.Width > width:
+		return s.slice(n, width-1, 0)
+	}
+	return n
+}
+
+// 1 when any bit is set
+func (s *System) truth(n *Node) *Node {
+	if n.Width == 1 {
+		return n
+	}
+	return s.op("redor", 1, n)
+}
+
+// Shift by an amount of any width; amounts of the value's width or more
+// give 0
+func (s *System) shift(op string, v, amount *Node) *Node {
+	w := v.Width
+	if amount.Width <= w {
+		return s.op(op, w, v, s.resize(amount, w))
+	}
+	inRange := s.op("ult", 1, amount, s.constant(uint64(w), amount.Width))
+	return s.ite(inRange, s.op(op, w, v, s.resize(amount, w)), s.constant(0, w))
+}
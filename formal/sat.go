@@ -0,0 +1,442 @@
+package formal
+
+import "sort"
+
+// Conflict-driven clause learning SAT solver in the style of MiniSat: two
+// watched literals, first-UIP learning, VSIDS branching with phase saving
+// and Luby restarts. Literals are 2*var for the positive and 2*var+1 for
+// the negative polarity.
+
+type lit int32
+
+func (l lit) not() lit { return l ^ 1 }
+func (l lit) v() int   { return int(l >> 1) }
+
+func mkLit(v int, negative bool) lit {
+	if negative {
+		return lit(2*v + 1)
+	}
+	return lit(2 * v)
+}
+
+type clause struct {
+	lits     []lit
+	learnt   bool
+	deleted  bool
+	activity float64
+}
+
+type satStatus int
+
+const (
+	satUnknown satStatus = iota
+	satYes
+	satNo
+)
+
+type satSolver struct {
+	ok       bool // false once the clauses are known to be unsatisfiable
+	learnts  []*clause
+	watches  [][]*clause // clauses watching each literal
+	assigns  []int8      // 1 true, -1 false, 0 unassigned
+	level    []int
+	reason   []*clause
+	trail    []lit
+	trailLim []int
+	qhead    int
+	model    []bool
+
+	activity  []float64
+	varInc    float64
+	clauseInc float64
+	heap      []int // unassigned variables ordered by activity
+	heapPos   []int // -1 when not in the heap
+	polarity  []bool
+	seen      []bool
+
+	conflicts int
+}
+
+func newSatSolver() *satSolver {
+	return &satSolver{ok: true, varInc: 1, clauseInc: 1}
+}
+
+func (s *satSolver) newVar() int {
+	v := len(s.assigns)
+	s.watches = append(s.watches, nil, nil)
+	s.assigns = append(s.assigns, 0)
+	s.level = append(s.level, 0)
+	s.reason = append(s.reason, nil)
+	s.activity = append(s.activity, 0)
+	s.heapPos = append(s.heapPos, -1)
+	s.polarity = append(s.polarity, true)
+	s.seen = append(s.seen, false)
+	s.heapInsert(v)
+	return v
+}
+
+func (s *satSolver) value(l lit) int8 {
+	a := s.assigns[l.v()]
+	if l&1 == 1 {
+		return -a
+	}
+	return a
+}
+
+func (s *satSolver) decisionLevel() int {
+	return len(s.trailLim)
+}
+
+// Add a clause before solving
+func (s *satSolver) addClause(lits ...lit) {
+	if !s.ok {
+		return
+	}
+	sort.Slice(lits, func(i, j int) bool { return lits[i] < lits[j] })
+	var kept []lit
+	for i, l := range lits {
+		switch {
+		case s.value(l) == 1 || i > 0 && l == lits[i-1].not():
+			return
+		case s.value(l) == -1 || i > 0 && l == lits[i-1]:
+		default:
+			kept = append(kept, l)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		s.ok = false
+	case 1:
+		s.enqueue(kept[0], nil)
+		s.ok = s.propagate() == nil
+	default:
+		s.attach(&clause{lits: kept})
+	}
+}
+
+func (s *satSolver) attach(c *clause) {
+	s.watches[c.lits[0]] = append(s.watches[c.lits[0]], c)
+	s.watches[c.lits[1]] = append(s.watches[c.lits[1]], c)
+}
+
+func (s *satSolver) enqueue(l lit, from *clause) {
+	v := l.v()
+	if l&1 == 1 {
+		s.assigns[v] = -1
+	} else {
+		s.assigns[v] = 1
+	}
+	s.level[v] = s.decisionLevel()
+	s.reason[v] = from
+	s.trail = append(s.trail, l)
+}
+
+// Unit propagation; returns a conflicting clause or nil
+func (s *satSolver) propagate() *clause {
+	for s.qhead < len(s.trail) {
+		falseLit := s.trail[s.qhead].not()
+		s.qhead++
+		ws := s.watches[falseLit]
+		kept := ws[:0]
+		for i := 0; i < len(ws); i++ {
+			c := ws[i]
+			if c.deleted {
+				continue
+			}
+			if c.lits[0] == falseLit {
+				c.lits[0], c.lits[1] = c.lits[1], c.lits[0]
+			}
+			if s.value(c.lits[0]) == 1 {
+				kept = append(kept, c)
+				continue
+			}
+			moved := false
+			for k := 2; k < len(c.lits); k++ {
+				if s.value(c.lits[k]) != -1 {
+					c.lits[1], c.lits[k] = c.lits[k], c.lits[1]
+					s.watches[c.lits[1]] = append(s.watches[c.lits[1]], c)
+					moved = true
+					break
+				}
+			}
+			if moved {
+				continue
+			}
+			kept = append(kept, c)
+			if s.value(c.lits[0]) == -1 {
+				kept = append(kept, ws[i+1:]...)
+				s.watches[falseLit] = kept
+				s.qhead = len(s.trail)
+				return c
+			}
+			s.enqueue(c.lits[0], c)
+		}
+		s.watches[falseLit] = kept
+	}
+	return nil
+}
+
+// First-UIP conflict analysis: the learnt clause, asserting literal first,
+// and the level to return to
+func (s *satSolver) analyze(confl *clause) ([]lit, int) {
+	learnt := []lit{0}
+	pathC := 0
+	p := lit(-1)
+	idx := len(s.trail) - 1
+	for {
+		if confl.learnt {
+			s.bumpClause(confl)
+		}
+		start := 0
+		if p != -1 {
+			start = 1
+		}
+		for _, q := range confl.lits[start:] {
+			v := q.v()
+			if !s.seen[v] && s.level[v] > 0 {
+				s.bumpVar(v)
+				s.seen[v] = true
+				if s.level[v] >= s.decisionLevel() {
+					pathC++
+				} else {
+					learnt = append(learnt, q)
+				}
+			}
+		}
+		for !s.seen[s.trail[idx].v()] {
+			idx--
+		}
+		p = s.trail[idx]
+		idx--
+		confl = s.reason[p.v()]
+		s.seen[p.v()] = false
+		pathC--
+		if pathC == 0 {
+			break
+		}
+	}
+	learnt[0] = p.not()
+
+	back := 0
+	for i := 1; i < len(learnt); i++ {
+		if s.level[learnt[i].v()] > s.level[learnt[back].v()] || back == 0 {
+			back = i
+		}
+	}
+	for _, l := range learnt {
+		s.seen[l.v()] = false
+	}
+	if len(learnt) == 1 {
+		return learnt, 0
+	}
+	learnt[1], learnt[back] = learnt[back], learnt[1]
+	return learnt, s.level[learnt[1].v()]
+}
+
+func (s *satSolver) cancelUntil(level int) {
+	if s.decisionLevel() <= level {
+		return
+	}
+	for i := len(s.trail) - 1; i >= s.trailLim[level]; i-- {
+		v := s.trail[i].v()
+		s.polarity[v] = s.assigns[v] == -1
+		s.assigns[v] = 0
+		s.reason[v] = nil
+		s.heapInsert(v)
+	}
+	s.trail = s.trail[:s.trailLim[level]]
+	s.trailLim = s.trailLim[:level]
+	s.qhead = len(s.trail)
+}
+
+func (s *satSolver) bumpVar(v int) {
+	s.activity[v] += s.varInc
+	if s.activity[v] > 1e100 {
+		for i := range s.activity {
+			s.activity[i] *= 1e-100
+		}
+		s.varInc *= 1e-100
+	}
+	if s.heapPos[v] >= 0 {
+		s.heapUp(s.heapPos[v])
+	}
+}
+
+func (s *satSolver) bumpClause(c *clause) {
+	c.activity += s.clauseInc
+	if c.activity > 1e20 {
+		for _, l := range s.learnts {
+			l.activity *= 1e-20
+		}
+		s.clauseInc *= 1e-20
+	}
+}
+
+// Drop the less active half of the learnt clauses that are not the reason
+// for a current assignment
+func (s *satSolver) reduce() {
+	sort.Slice(s.learnts, func(i, j int) bool { return s.learnts[i].activity < s.learnts[j].activity })
+	kept := s.learnts[:0]
+	for i, c := range s.learnts {
+		locked := s.reason[c.lits[0].v()] == c && s.value(c.lits[0]) == 1
+		if i < len(s.learnts)/2 && !locked && len(c.lits) > 2 {
+			c.deleted = true
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	s.learnts = kept
+}
+
+// Search for a satisfying assignment, giving up after maxConflicts
+// conflicts unless it is 0
+func (s *satSolver) solve(maxConflicts int) satStatus {
+	if !s.ok {
+		return satNo
+	}
+	if s.propagate() != nil {
+		s.ok = false
+		return satNo
+	}
+	maxLearnts := len(s.assigns)/3 + 1000
+	restart, sinceRestart := 1, 0
+	for {
+		if confl := s.propagate(); confl != nil {
+			s.conflicts++
+			sinceRestart++
+			if s.decisionLevel() == 0 {
+				s.ok = false
+				return satNo
+			}
+			learnt, back := s.analyze(confl)
+			s.cancelUntil(back)
+			if len(learnt) == 1 {
+				s.enqueue(learnt[0], nil)
+			} else {
+				c := &clause{lits: learnt, learnt: true}
+				s.bumpClause(c)
+				s.attach(c)
+				s.learnts = append(s.learnts, c)
+				s.enqueue(learnt[0], c)
+			}
+			s.varInc /= 0.95
+			s.clauseInc /= 0.999
+			if maxConflicts > 0 && s.conflicts >= maxConflicts {
+				s.cancelUntil(0)
+				return satUnknown
+			}
+			if sinceRestart >= 100*luby(restart) {
+				restart++
+				sinceRestart = 0
+				s.cancelUntil(0)
+			}
+			continue
+		}
+		if len(s.learnts)-len(s.trail) >= maxLearnts {
+			s.reduce()
+			maxLearnts += maxLearnts / 10
+		}
+		v := s.pickBranch()
+		if v < 0 {
+			s.model = make([]bool, len(s.assigns))
+			for i, a := range s.assigns {
+				s.model[i] = a == 1
+			}
+			s.cancelUntil(0)
+			return satYes
+		}
+		s.trailLim = append(s.trailLim, len(s.trail))
+		s.enqueue(mkLit(v, s.polarity[v]), nil)
+	}
+}
+
+// Value of a literal in the last satisfying assignment
+func (s *satSolver) modelValue(l lit) bool {
+	return s.model[l.v()] != (l&1 == 1)
+}
+
+func (s *satSolver) pickBranch() int {
+	for len(s.heap) > 0 {
+		v := s.heapPop()
+		if s.assigns[v] == 0 {
+			return v
+		}
+	}
+	return -1
+}
+
+// Luby restart sequence 1 1 2 1 1 2 4 ...
+func luby(i int) int {
+	size, seq := 1, 0
+	for size < i+1 {
+		seq++
+		size = 2*size + 1
+	}
+	x := i
+	for size-1 != x {
+		size = (size - 1) / 2
+		seq--
+		x %= size
+	}
+	return 1 << uint(seq)
+}
+
+// Binary max-heap of variables by activity
+
+func (s *satSolver) heapInsert(v int) {
+	if s.heapPos[v] >= 0 {
+		return
+	}
+	s.heapPos[v] = len(s.heap)
+	s.heap = append(s.heap, v)
+	s.heapUp(len(s.heap) - 1)
+}
+
+func (s *satSolver) heapPop() int {
+	v := s.heap[0]
+	last := s.heap[len(s.heap)-1]
+	s.heap = s.heap[:len(s.heap)-1]
+	s.heapPos[v] = -1
+	if len(s.heap) > 0 {
+		s.heap[0] = last
+		s.heapPos[last] = 0
+		s.heapDown(0)
+	}
+	return v
+}
+
+func (s *satSolver) heapUp(i int) {
+	v := s.heap[i]
+	for i > 0 {
+		parent := (i - 1) / 2
+		if s.activity[s.heap[parent]] >= s.activity[v] {
+			break
+		}
+		s.heap[i] = s.heap[parent]
+		s.heapPos[s.heap[i]] = i
+		i = parent
+	}
+	s.heap[i] = v
+	s.heapPos[v] = i
+}
+
+func (s *satSolver) heapDown(i int) {
+	v := s.heap[i]
+	for {
+		child := 2*i + 1
+		if child >= len(s.heap) {
+			break
+		}
+		if child+1 < len(s.heap) && s.activity[s.heap[child+1]] > s.activity[s.heap[child]] {
+			child++
+		}
+		if s.activity[s.heap[child]] <= s.activity[v] {
+			break
+		}
+		s.heap[i] = s.heap[child]
+		s.heapPos[s.heap[i]] = i
+		i = child
+	}
+	s.heap[i] = v
+	s.heapPos[v] = i
+}
@@ -0,0 +1,150 @@
+package formal
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Random small formulas decided by the solver and by enumeration
+func TestSATAgainstEnumeration(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for round := 0; round < 300; round++ {
+		vars := 3 + rng.Intn(8)
+		var clauses [][]lit
+		for i := 0; i < vars*4+rng.Intn(vars*2); i++ {
+			var c []lit
+			for j := 0; j < 3; j++ {
+				c = append(c, mkLit(rng.Intn(vars), rng.Intn(2) == 1))
+			}
+			clauses = append(clauses, c)
+		}
+		s := newSatSolver()
+		for i := 0; i < vars; i++ {
+			s.newVar()
+		}
+		for _, c := range clauses {
+			s.addClause(append([]lit{}, c...)...)
+		}
+		got := s.solve(0)
+
+		satisfiable := false
+		for assign := 0; assign < 1<<uint(vars) && !satisfiable; assign++ {
+			satisfiable = true
+			for _, c := range clauses {
+				hit := false
+				for _, l := range c {
+					if (assign>>uint(l.v())&1 == 1) != (l&1 == 1) {
+						hit = true
+					}
+				}
+				if !hit {
+					satisfiable = false
+					break
+				}
+			}
+		}
+		if (got == satYes) != satisfiable {
+			t.Fatalf("Round %d: solver says %v, enumeration %v", round, got, satisfiable)
+		}
+		if got == satYes {
+			for _, c := range clauses {
+				hit := false
+				for _, l := range c {
+					hit = hit || s.modelValue(l)
+				}
+				if !hit {
+					t.Fatalf("Round %d: the model breaks clause %v", round, c)
+				}
+			}
+		}
+	}
+}
+
+// Five pigeons do not fit in four holes
+func TestSATPigeonhole(t *testing.T) {
+	const pigeons, holes = 5, 4
+	s := newSatSolver()
+	in := func(p, h int) lit { return mkLit(p*holes+h, false) }
+	for i := 0; i < pigeons*holes; i++ {
+		s.newVar()
+	}
+	for p := 0; p < pigeons; p++ {
+		var somewhere []lit
+		for h := 0; h < holes; h++ {
+			somewhere = append(somewhere, in(p, h))
+		}
+		s.addClause(somewhere...)
+	}
+	for h := 0; h < holes; h++ {
+		for p := 0; p < pigeons; p++ {
+			for q := p + 1; q < pigeons; q++ {
+				s.addClause(in(p, h).not(), in(q, h).not())
+			}
+		}
+	}
+	if got := s.solve(0); got != satNo {
+		t.Errorf("Pigeonhole formula should be unsatisfiable, got %v", got)
+	}
+	if got := s.solve(0); got != satNo {
+		t.Errorf("Solving again should still be unsatisfiable, got %v", got)
+	}
+}
+
+// Bit-blasted operators agree with Node.Apply
+func TestBlastMatchesApply(t *testing.T) {
+	ops := []string{"not", "neg", "redand", "redor", "redxor", "and", "or", "xor", "add", "sub",
+		"mul", "udiv", "urem", "shl", "lshr", "eq", "ult", "ule", "concat", "slice", "zext"}
+	rng := rand.New(rand.NewSource(3))
+	for _, op := range ops {
+		s := &System{cache: map[string]*Node{}}
+		x := s.add(&Node{Op: "input", Name: "x", Width: 6})
+		y := s.add(&Node{Op: "input", Name: "y", Width: 6})
+		var n *Node
+		switch op {
+		case "not", "neg":
+			n = s.op(op, 6, x)
+		case "redand", "redor", "redxor":
+			n = s.op(op, 1, x)
+		case "eq", "ult", "ule":
+			n = s.op(op, 1, x, y)
+		case "concat":
+			n = s.op(op, 12, x, y)
+		case "slice":
+			n = s.slice(x, 4, 2)
+		case "zext":
+			n = s.op(op, 9, x)
+		default:
+			n = s.op(op, 6, x, y)
+		}
+		for i := 0; i < 40; i++ {
+			vx, vy := rng.Uint64()&63, rng.Uint64()&63
+			if i < 4 {
+				vx, vy = uint64(i/2*63), uint64(i%2*63) // corners, including division by zero
+			}
+			b := newBlaster()
+			bits := b.blast(s.Nodes, []*Node{n}, func(leaf *Node) []lit {
+				v := vx
+				if leaf == y {
+					v = vy
+				}
+				// Free variables fixed by unit clauses, so the gates
+				// are encoded rather than folded
+				out := b.fresh(leaf.Width)
+				for k, l := range out {
+					if v>>uint(k)&1 == 0 {
+						l = l.not()
+					}
+					b.sat.addClause(l)
+				}
+				return out
+			})
+			if b.sat.solve(0) != satYes {
+				t.Fatalf("%s: the blasted term is unsatisfiable", op)
+			}
+			want := s.Eval(map[string]uint64{"x": vx, "y": vy})[n.ID]
+			if got := b.value(bits[n]); got != want {
+				t.Errorf("%s of %#x and %#x: blasted %#x, evaluated %#x", op, vx, vy, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package formal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Write an SMT-LIB2 bounded model checking query: the system unrolled for
+// cycles 0 to depth, satisfiable when an assertion can fail on one of them.
+// The query ends by asking for the inputs, the initial state and which
+// assertions failed, named like |en@3| and |assert:name@3|.
+func WriteSMT2(w io.Writer, s *System, depth int) error {
+	out := bufio.NewWriter(w)
+	s.writeSMT2(out, 0, depth)
+	return out.Flush()
+}
+
+var smt2Ops = map[string]string{
+	"not": "bvnot", "neg": "bvneg", "and": "bvand", "or": "bvor", "xor": "bvxor",
+	"add": "bvadd", "sub": "bvsub", "mul": "bvmul", "udiv": "bvudiv", "urem": "bvurem",
+	"shl": "bvshl", "lshr": "bvlshr", "concat": "concat",
+}
+
+// Query for an assertion failure on a cycle from from to to
+func (s *System) writeSMT2(out *bufio.Writer, from, to int) {
+	fmt.Fprintf(out, "; %s unrolled for %d cycles, clocked by %s\n", s.Name, to+1, s.Clock)
+	out.WriteString("(set-option :produce-models true)\n(set-logic QF_BV)\n")
+	nodes := s.reachable()
+	for cycle := 0; cycle <= to; cycle++ {
+		fmt.Fprintf(out, "; cycle %d\n", cycle)
+		for _, in := range s.Inputs {
+			fmt.Fprintf(out, "(declare-fun %s () %s)\n", smt2Symbol(in.Name, cycle), smt2Sort(in.Width))
+		}
+		for _, st := range s.States {
+			if cycle == 0 {
+				fmt.Fprintf(out, "(declare-fun %s () %s)\n", smt2Symbol(st.Node.Name, 0), smt2Sort(st.Node.Width))
+			} else {
+				fmt.Fprintf(out, "(define-fun %s () %s %s)\n", smt2Symbol(st.Node.Name, cycle), smt2Sort(st.Node.Width), smt2Term(st.Next, cycle-1))
+			}
+		}
+		for _, n := range nodes {
+			switch n.Op {
+			case "const", "input", "state":
+				continue
+			}
+			fmt.Fprintf(out, "(define-fun %s () %s %s)\n", smt2Symbol(fmt.Sprintf("_n%d", n.ID), cycle), smt2Sort(n.Width), smt2Expr(n, cycle))
+		}
+		for _, c := range s.Asserts {
+			fmt.Fprintf(out, "(define-fun %s () %s %s)\n", smt2Symbol("assert:"+c.Name, cycle), smt2Sort(1), smt2Term(c.Bad, cycle))
+		}
+		for _, c := range s.Assumes {
+			fmt.Fprintf(out, "(assert (= %s #b0))\n", smt2Term(c.Bad, cycle))
+		}
+	}
+	for _, st := range s.States {
+		if st.Init != nil {
+			fmt.Fprintf(out, "(assert (= %s %s))\n", smt2Symbol(st.Node.Name, 0), smt2Term(st.Init, 0))
+		}
+	}
+
+	var bad, values []string
+	for cycle := from; cycle <= to; cycle++ {
+		for _, c := range s.Asserts {
+			sym := smt2Symbol("assert:"+c.Name, cycle)
+			bad = append(bad, fmt.Sprintf("(= %s #b1)", sym))
+			values = append(values, sym)
+		}
+	}
+	switch len(bad) {
+	case 0:
+		out.WriteString("(assert false)\n")
+	case 1:
+		fmt.Fprintf(out, "(assert %s)\n", bad[0])
+	default:
+		fmt.Fprintf(out, "(assert (or %s))\n", strings.Join(bad, " "))
+	}
+	out.WriteString("(check-sat)\n")
+	for _, st := range s.States {
+		values = append(values, smt2Symbol(st.Node.Name, 0))
+	}
+	for cycle := 0; cycle <= to; cycle++ {
+		for _, in := range s.Inputs {
+			values = append(values, smt2Symbol(in.Name, cycle))
+		}
+	}
+	fmt.Fprintf(out, "(get-value (%s))\n(exit)\n", strings.Join(values, " "))
+}
+
+func smt2Sort(width int) string {
+	return fmt.Sprintf("(_ BitVec %d)", width)
+}
+
+func smt2Symbol(name string, cycle int) string {
+	return fmt.Sprintf("|%s@%d|", name, cycle)
+}
+
+// Reference to a term on a cycle: constants inline, leaves and operators
+// by their symbol
+func smt2Term(n *Node, cycle int) string {
+	switch n.Op {
+	case "const":
+		return smt2Const(n.Value, n.Width)
+	case "input", "state":
+		return smt2Symbol(n.Name, cycle)
+	}
+	return smt2Symbol(fmt.Sprintf("_n%d", n.ID), cycle)
+}
+
+func smt2Const(v uint64, width int) string {
+	bits := strconv.FormatUint(v, 2)
+	return "#b" + strings.Repeat("0", width-len(bits)) + bits
+}
+
+// Definition of an operator term
+func smt2Expr(n *Node, cycle int) string {
+	arg := func(i int) string { return smt2Term(n.Args[i], cycle) }
+	bit := func(cond string) string { return fmt.Sprintf("(ite %s #b1 #b0)", cond) }
+	switch n.Op {
+	case "eq":
+		return bit(fmt.Sprintf("(= %s %s)", arg(0), arg(1)))
+	case "ult":
+		return bit(fmt.Sprintf("(bvult %s %s)", arg(0), arg(1)))
+	case "ule":
+		return bit(fmt.Sprintf("(bvule %s %s)", arg(0), arg(1)))
+	case "ite":
+		return fmt.Sprintf("(ite (= %s #b1) %s %s)", arg(0), arg(1), arg(2))
+	case "slice":
+		return fmt.Sprintf("((_ extract %d %d) %s)", n.Hi, n.Lo, arg(0))
+	case "zext":
+		return fmt.Sprintf("((_ zero_extend %d) %s)", n.Width-n.Args[0].Width, arg(0))
+	case "redand":
+		return bit(fmt.Sprintf("(= %s %s)", arg(0), smt2Const(mask(n.Args[0].Width), n.Args[0].Width)))
+	case "redor":
+		return bit(fmt.Sprintf("(distinct %s %s)", arg(0), smt2Const(0, n.Args[0].Width)))
+	case "redxor":
+		v := fmt.Sprintf("((_ extract 0 0) %s)", arg(0))
+		for i := 1; i < n.Args[0].Width; i++ {
+			v = fmt.Sprintf("(bvxor %s ((_ extract %d %d) %s))", v, i, i, arg(0))
+		}
+		return v
+	}
+	parts := []string{smt2Ops[n.Op]}
+	for i := range n.Args {
+		parts = append(parts, arg(i))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
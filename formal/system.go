@@ -0,0 +1,442 @@
+// Package formal checks the assertions of hdl modules with a model
+// checker. Build turns a single-clock module into a transition system of
+// bit-vector terms: free inputs, state with its next-state functions, the
+// assertions to prove and the assumptions that constrain the inputs. The
+// system is written as BTOR2 for hardware model checkers or unrolled into
+// SMT-LIB2 queries, which Check hands to a solver for bounded model
+// checking. Counterexamples are replayed in the simulator and written as
+// VCD.
+package formal
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Term of a transition system: a bit vector of Width bits computed by Op
+// from Args. Operators follow SMT-LIB, so unsigned division by zero gives
+// all ones and the remainder the dividend.
+//
+//	const input state                          leaves
+//	not neg                                    bitwise and arithmetic negation
+//	redand redor redxor                        reductions to 1 bit
+//	and or xor add sub mul udiv urem shl lshr  operands as wide as the result
+//	eq ult ule                                 comparisons to 1 bit
+//	ite                                        Args[0] ? Args[1] : Args[2]
+//	concat                                     Args[0] in the high bits
+//	slice                                      bits Hi down to Lo of Args[0]
+//	zext                                       Args[0] zero-extended to Width
+type Node struct {
+	ID    int // index in System.Nodes, above the IDs of its arguments
+	Op    string
+	Width int
+	Args  []*Node
+	Value uint64 // "const"
+	Name  string // "input" and "state"
+	Hi    int    // "slice"
+	Lo    int
+}
+
+// Register, memory word or internal state of a transition system
+type State struct {
+	Node     *Node  // the "state" leaf
+	Init     *Node  // nil when the initial value is unconstrained
+	Next     *Node  // value after the clock edge
+	Memory   string // memory holding the word, "" for registers
+	Addr     int
+	Internal bool // added by Build rather than part of the design
+}
+
+// Assertion or assumption; Bad is 1 on cycles that violate it
+type Property struct {
+	Name   string        // hierarchical name
+	Source *hdl.Property // nil for the resets held at the start
+	Bad    *Node
+}
+
+// Options for Build
+type Options struct {
+	ResetCycles int // cycles the resets are held at the start, 1 by default
+}
+
+// Transition system of a module clocked by a single top-level clock.
+// Registers start with any value, except that every reset is held for the
+// first ResetCycles cycles; assertions are not checked while their reset
+// is asserted.
+type System struct {
+	Name    string
+	Clock   string
+	Inputs  []*Node // top-level inputs other than the clock and undriven nets
+	States  []*State
+	Asserts []*Property
+	Assumes []*Property // assumptions, and resets held during the first cycles
+	Nodes   []*Node     // every term, arguments first
+	Netlist *hdl.Netlist
+
+	cache map[string]*Node
+	nets  map[string]*Node // value of each net
+	state map[string]*State
+	words map[string][]*State // memory words by memory name
+	comb  map[string][]combDriver
+	busy  map[string]bool
+}
+
+// Continuous assignment or combinational always block driving a net
+type combDriver struct {
+	assign *hdl.ContinuousAssign
+	proc   *hdl.Process
+}
+
+// Extract the transition system of a module. Designs with more than one
+// clock, negative edges or temporal properties are rejected; asynchronous
+// resets are treated as synchronous ones.
+func Build(m *hdl.Module, opts Options) (*System, error) {
+	if opts.ResetCycles == 0 {
+		opts.ResetCycles = 1
+	}
+	s, err := extract(m, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.findClock(); err != nil {
+		return nil, err
+	}
+	if err := s.properties(); err != nil {
+		return nil, err
+	}
+	s.holdResets(opts.ResetCycles)
+	return s, nil
+}
+
+// Inputs, state and next-state functions of a module. Terms are added to
+// those of base when it is given, so the two systems share the inputs and
+// states they both have; base must add no terms afterwards.
+func extract(m *hdl.Module, base *System) (*System, error) {
+	n, err := m.Flatten()
+	if err != nil {
+		return nil, err
+	}
+	if len(n.Blackboxes) > 0 {
+		var names []string
+		for name := range n.Blackboxes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("instance %s has no Go definition", names[0])
+	}
+	s := &System{
+		Name:    m.Name,
+		Netlist: n,
+		cache:   make(map[string]*Node),
+		nets:    make(map[string]*Node),
+		state:   make(map[string]*State),
+		words:   make(map[string][]*State),
+		comb:    make(map[string][]combDriver),
+		busy:    make(map[string]bool),
+	}
+	if base != nil {
+		s.cache, s.Nodes = base.cache, base.Nodes
+	}
+	for _, name := range n.NetOrder {
+		if net := n.Nets[name]; net.Width > 64 {
+			return nil, fmt.Errorf("%s is %d bits wide, formal export supports up to 64", name, net.Width)
+		}
+	}
+
+	// Classify the nets: inputs, registers, combinational, undriven
+	for _, a := range n.Assigns {
+		for _, t := range a.LHS.Targets() {
+			s.comb[t] = append(s.comb[t], combDriver{assign: a})
+		}
+	}
+	registers, clocks := map[string]bool{}, map[string]bool{}
+	for _, p := range n.Properties {
+		clocks[n.Resolve(p.Clock)] = true
+	}
+	for _, proc := range n.Processes {
+		if proc.Clock != "" {
+			clocks[n.Resolve(proc.Clock)] = true
+		}
+		targets := map[string]bool{}
+		assignments(proc.Body, func(st *hdl.Stmt) {
+			for _, t := range st.LHS.Targets() {
+				targets[t] = true
+			}
+		})
+		for _, t := range sortedKeys(targets) {
+			if proc.Clock == "" {
+				s.comb[t] = append(s.comb[t], combDriver{proc: proc})
+			} else {
+				registers[t] = true
+			}
+		}
+	}
+	for _, name := range n.NetOrder {
+		net := n.Nets[name]
+		switch {
+		case registers[name]:
+			st := s.addState(name, int(net.Width))
+			s.nets[name] = st.Node
+		case clocks[name]:
+		case net.Kind == "input" && net.Scope == "" || len(s.comb[name]) == 0:
+			in := s.add(&Node{Op: "input", Width: int(net.Width), Name: name})
+			s.Inputs = append(s.Inputs, in)
+			s.nets[name] = in
+		}
+	}
+	var mems []string
+	for name := range n.Memories {
+		mems = append(mems, name)
+	}
+	sort.Strings(mems)
+	for _, name := range mems {
+		mem := n.Memories[name].Memory
+		if mem.Depth > 1024 {
+			return nil, fmt.Errorf("memory %s has %d words, formal export supports up to 1024", name, mem.Depth)
+		}
+		if mem.Width > 64 {
+			return nil, fmt.Errorf("memory %s is %d bits wide, formal export supports up to 64", name, mem.Width)
+		}
+		for addr := 0; addr < mem.Depth; addr++ {
+			st := s.addState(fmt.Sprintf("%s[%d]", name, addr), int(mem.Width))
+			st.Memory, st.Addr = name, addr
+			s.words[name] = append(s.words[name], st)
+		}
+	}
+
+	if err := s.nextState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// The one clock of every clocked process and property
+func (s *System) findClock() error {
+	n := s.Netlist
+	use := func(name, what string) error {
+		root := n.Resolve(name)
+		if s.Clock == "" {
+			net, ok := n.Nets[root]
+			if !ok || net.Scope != "" || net.Kind != "input" {
+				return fmt.Errorf("%s is clocked by %s, which is not a top-level input", what, root)
+			}
+			s.Clock = root
+		} else if root != s.Clock {
+			return fmt.Errorf("%s is clocked by %s as well as %s, formal export supports one clock", what, root, s.Clock)
+		}
+		return nil
+	}
+	for _, proc := range n.Processes {
+		if proc.Clock == "" {
+			continue
+		}
+		if proc.Edge != "posedge" {
+			return fmt.Errorf("always block in %q clocked on the %s of %s, formal export supports rising edges", proc.Scope, proc.Edge, proc.Clock)
+		}
+		if err := use(proc.Clock, fmt.Sprintf("always block in %q", proc.Scope)); err != nil {
+			return err
+		}
+	}
+	for _, p := range n.Properties {
+		if err := use(p.Clock, p.Property.Kind+" "+p.Name); err != nil {
+			return err
+		}
+	}
+	if s.Clock == "" {
+		return fmt.Errorf("module %s has no clocked logic or properties", s.Name)
+	}
+	return nil
+}
+
+func (s *System) addState(name string, width int) *State {
+	st := &State{Node: s.add(&Node{Op: "state", Width: width, Name: name})}
+	st.Next = st.Node
+	s.States = append(s.States, st)
+	s.state[name] = st
+	return st
+}
+
+// Value of a net, built from its drivers on first use
+func (s *System) net(name string) (*Node, error) {
+	if v, ok := s.nets[name]; ok {
+		return v, nil
+	}
+	net, ok := s.Netlist.Nets[name]
+	if !ok {
+		if _, isMem := s.Netlist.Memories[name]; isMem {
+			return nil, fmt.Errorf("memory %s used without an address", name)
+		}
+		return nil, fmt.Errorf("undeclared identifier %s", name)
+	}
+	if s.busy[name] {
+		return nil, fmt.Errorf("combinational loop through %s", name)
+	}
+	s.busy[name] = true
+	defer delete(s.busy, name)
+
+	// Drivers apply in order, each on top of the bits set so far
+	v := s.constant(0, int(net.Width))
+	for _, d := range s.comb[name] {
+		b := &builder{s: s, env: newEnv(false)}
+		b.env.vars[name] = v
+		var err error
+		if d.assign != nil {
+			err = b.assign(d.assign.LHS, d.assign.RHS, false)
+		} else {
+			err = b.stmt(d.proc.Body)
+		}
+		if err != nil {
+			return nil, err
+		}
+		v = b.env.vars[name]
+	}
+	s.nets[name] = v
+	return v, nil
+}
+
+// Next-state functions of the registers and memories, from the clocked
+// processes in order
+func (s *System) nextState() error {
+	b := &builder{s: s, env: newEnv(true)}
+	for _, proc := range s.Netlist.Processes {
+		if proc.Clock == "" {
+			continue
+		}
+		if err := b.stmt(proc.Body); err != nil {
+			return fmt.Errorf("always block in %q: %v", proc.Scope, err)
+		}
+	}
+	for name, v := range b.env.vars {
+		if st, ok := s.state[name]; ok {
+			st.Next = v
+		}
+	}
+	for name, v := range b.env.pending {
+		if st, ok := s.state[name]; ok {
+			st.Next = v
+		}
+	}
+	return nil
+}
+
+// Bad states of the assertions and constraints of the assumptions
+func (s *System) properties() error {
+	for _, p := range s.Netlist.Properties {
+		kind := p.Property.Kind
+		if kind == "cover" {
+			continue
+		}
+		if p.Cond == nil {
+			return fmt.Errorf("%s %s is temporal, formal export supports single-cycle properties", kind, p.Name)
+		}
+		b := &builder{s: s, env: newEnv(false), past: true}
+		cond, err := b.expr(p.Cond, 0)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", kind, p.Name, err)
+		}
+		bad := s.op("not", 1, s.truth(cond))
+		if p.Reset != "" {
+			rst, err := s.net(s.Netlist.Resolve(p.Reset))
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", kind, p.Name, err)
+			}
+			bad = s.op("and", 1, s.op("not", 1, s.slice(rst, 0, 0)), bad)
+		}
+		c := &Property{Name: p.Name, Source: p.Property, Bad: bad}
+		if kind == "assume" {
+			s.Assumes = append(s.Assumes, c)
+		} else {
+			s.Asserts = append(s.Asserts, c)
+		}
+	}
+	return nil
+}
+
+// Hold every top-level reset for the first cycles: a counter state that
+// stops at cycles, and an assumption that resets are high below it
+func (s *System) holdResets(cycles int) {
+	var resets []*Node
+	seen := map[string]bool{}
+	add := func(name string) {
+		root := s.Netlist.Resolve(name)
+		net, ok := s.Netlist.Nets[root]
+		if !ok || net.Scope != "" || net.Kind != "input" || seen[root] {
+			return
+		}
+		seen[root] = true
+		resets = append(resets, s.nets[root])
+	}
+	top := s.Netlist.Top
+	if top.Reset != nil {
+		add(top.Reset.Name)
+	}
+	for _, cd := range top.ClockDomains {
+		if cd.RawReset != nil {
+			add(cd.RawReset.Name)
+		} else if cd.Reset != nil {
+			add(cd.Reset.Name)
+		}
+	}
+	for _, p := range s.Netlist.Properties {
+		if p.Reset != "" {
+			add(p.Reset)
+		}
+	}
+	if len(resets) == 0 {
+		return
+	}
+
+	w := 1
+	for uint64(cycles) >= uint64(1)<<uint(w) {
+		w++
+	}
+	count := s.addState("_reset_cycles", w)
+	count.Internal = true
+	count.Init = s.constant(0, w)
+	limit := s.constant(uint64(cycles), w)
+	early := s.op("ult", 1, count.Node, limit)
+	count.Next = s.ite(early, s.op("add", w, count.Node, s.constant(1, w)), count.Node)
+	for _, rst := range resets {
+		held := s.op("redand", 1, rst)
+		s.Assumes = append(s.Assumes, &Property{
+			Name: "_reset_" + rst.Name,
+			Bad:  s.op("and", 1, early, s.op("not", 1, held)),
+		})
+	}
+}
+
+// Value of every term, indexed by ID, with inputs and states taken from
+// values by name; missing ones are 0
+func (s *System) Eval(values map[string]uint64) []uint64 {
+	out := make([]uint64, len(s.Nodes))
+	var args []uint64
+	for _, n := range s.Nodes {
+		switch n.Op {
+		case "input", "state":
+			out[n.ID] = values[n.Name] & mask(n.Width)
+		default:
+			args = args[:0]
+			for _, arg := range n.Args {
+				args = append(args, out[arg.ID])
+			}
+			out[n.ID] = n.Apply(args)
+		}
+	}
+	return out
+}
+
+// Register or memory word by name
+func (s *System) State(name string) *State {
+	return s.state[name]
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
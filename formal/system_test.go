@@ -0,0 +1,177 @@
+package formal
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newMemCase() *hdl.Module {
+	m := core.NewModule("Mem")
+	m.Input("clk", 1)
+	addr := m.Input("addr", 3)
+	m.Input("wdata", 8)
+	m.Input("we", 1)
+	mem := m.SyncMem("ram", 8, 6)
+	m.Assign(m.Output("rdata", 8), mem.Read(addr))
+	m.Input("op", 2)
+	m.Reg("result", 8)
+	m.Reg("flags", 4)
+	m.Always = append(m.Always,
+		"always @(posedge clk) begin",
+		"  "+mem.Write(addr, &hdl.Signal{Name: "wdata"}, &hdl.Signal{Name: "we"}),
+		"  flags[addr[1:0]] <= ^wdata;",
+		"  if (op == 2'd3) flags[3:2] <= {we, 1'b1};",
+		"end",
+		"always @(*) begin",
+		"  case (op)",
+		"    2'd0: result = rdata;",
+		"    2'd1, 2'd2: result = ~rdata >> addr;",
+		"    default: result = wdata / addr + (wdata % 8'd3);",
+		"  endcase",
+		"end")
+	return m
+}
+
+func newArbiter() *hdl.Module {
+	m := core.NewModule("Arbiter")
+	clk := m.Input("clk", 1)
+	m.SetReset(m.Input("rst", 1))
+	m.Mutex("bus", 3, "round_robin").GenerateRoundRobin(m, clk)
+	return m
+}
+
+func newFIFO() *hdl.Module {
+	top := core.NewModule("Top")
+	return top.InstantiateTemplate(hdl.FIFOTemplate(), "fifo", map[string]interface{}{
+		"DATA_WIDTH": hdl.Width(8),
+		"DEPTH":      4,
+		"FWFT":       true,
+	})
+}
+
+// The system must compute the same nets and state as the simulator on
+// random stimulus
+func TestSystemMatchesSimulator(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		build func() *hdl.Module
+	}{
+		{"counter", testdesigns.Counter},
+		{"memory", newMemCase},
+		{"arbiter", newArbiter},
+		{"fifo", newFIFO},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := tc.build()
+			s, err := Build(m, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sim, err := simulator.New(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			state := map[string]uint64{}
+			for cycle := 0; cycle < 200; cycle++ {
+				inputs := map[string]uint64{}
+				for _, in := range s.Inputs {
+					v := rng.Uint64() & mask(in.Width)
+					if in.Name == "rst" {
+						v = uint64(rng.Intn(8) / 7)
+					}
+					inputs[in.Name] = v
+					sim.Poke(in.Name, v)
+				}
+				for name, v := range inputs {
+					state[name] = v
+				}
+				values := s.Eval(state)
+				for _, name := range s.Netlist.NetOrder {
+					if n, ok := s.nets[name]; ok {
+						if got, want := values[n.ID], sim.Peek(name); got != want {
+							t.Fatalf("Cycle %d: %s = %#x, simulator has %#x", cycle, name, got, want)
+						}
+					}
+				}
+				next := map[string]uint64{}
+				for _, st := range s.States {
+					next[st.Node.Name] = values[st.Next.ID]
+				}
+				state = next
+				sim.Cycle(1)
+				for _, st := range s.States {
+					want := uint64(0)
+					switch {
+					case st.Internal:
+						continue
+					case st.Memory != "":
+						want = sim.PeekMem(st.Memory, st.Addr)
+					default:
+						want = sim.Peek(st.Node.Name)
+					}
+					if got := state[st.Node.Name]; got != want {
+						t.Fatalf("Cycle %d: next %s = %#x, simulator has %#x", cycle, st.Node.Name, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	s, err := Build(newFIFO(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Clock != "clk" {
+		t.Errorf("Clock = %s, want clk", s.Clock)
+	}
+	var inputs []string
+	for _, in := range s.Inputs {
+		inputs = append(inputs, in.Name)
+	}
+	if got := strings.Join(inputs, " "); got != "rst wr_data wr_en rd_en" {
+		t.Errorf("Inputs = %s", got)
+	}
+	if s.State("fifo_mem[3]") == nil || s.State("fifo_mem[3]").Memory != "fifo_mem" {
+		t.Errorf("Memory words should be states")
+	}
+}
+
+func TestUnsupportedSystems(t *testing.T) {
+	m := core.NewModule("TwoClocks")
+	a := m.Input("a", 1)
+	b := m.Input("b", 1)
+	m.Reg("x", 1)
+	m.Reg("y", 1)
+	m.Always = append(m.Always, "always @(posedge a) x <= ~x;", "always @(posedge b) y <= ~y;")
+	m.NewClockDomain("a", a, nil)
+	m.NewClockDomain("b", b, nil)
+	if _, err := Build(m, Options{}); err == nil || !strings.Contains(err.Error(), "one clock") {
+		t.Errorf("Two clocks should be rejected, got %v", err)
+	}
+
+	m = testdesigns.Counter()
+	en := &hdl.Signal{Name: "en", Width: 1}
+	m.AssertProperty("held", hdl.Seq(en).ImpliesNext(hdl.Seq(en)), m.ClockDomains[0])
+	if _, err := Build(m, Options{}); err == nil || !strings.Contains(err.Error(), "temporal") {
+		t.Errorf("Temporal properties should be rejected, got %v", err)
+	}
+
+	m = core.NewModule("Loop")
+	m.Input("clk", 1)
+	m.AssignExpr(m.Wire("a", 1), "b")
+	m.AssignExpr(m.Wire("b", 1), "a")
+	m.Reg("r", 1)
+	m.Always = append(m.Always, "always @(posedge clk) r <= a;")
+	if _, err := Build(m, Options{}); err == nil || !strings.Contains(err.Error(), "combinational loop") {
+		t.Errorf("Combinational loops should be rejected, got %v", err)
+	}
+}
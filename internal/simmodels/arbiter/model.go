@@ -0,0 +1,313 @@
+// Code generated by simulator.Generate from module Arbiter. DO NOT EDIT.
+
+// Package arbiter is a compiled simulation model of module Arbiter
+package arbiter
+
+import "math/bits"
+
+var signals = []string{
+	"clk",
+	"rst",
+	"bus_req_0",
+	"bus_req_1",
+	"bus_req_2",
+	"bus_grant_0",
+	"bus_grant_1",
+	"bus_grant_2",
+	"bus_req_vec",
+	"bus_masked_req",
+	"bus_next_grant",
+	"bus_arb",
+	"bus_counter",
+	"bus_grant_r",
+}
+
+// Word, shift and mask of each signal in the packed state
+var layout = [...]struct {
+	word  int
+	shift uint
+	mask  uint64
+}{
+	{0, 0, 0x1},  // clk
+	{0, 1, 0x1},  // rst
+	{0, 2, 0x1},  // bus_req_0
+	{0, 3, 0x1},  // bus_req_1
+	{0, 4, 0x1},  // bus_req_2
+	{0, 5, 0x1},  // bus_grant_0
+	{0, 6, 0x1},  // bus_grant_1
+	{0, 7, 0x1},  // bus_grant_2
+	{0, 8, 0x7},  // bus_req_vec
+	{0, 11, 0x7}, // bus_masked_req
+	{0, 14, 0x7}, // bus_next_grant
+	{0, 17, 0x1}, // bus_arb
+	{0, 18, 0x3}, // bus_counter
+	{0, 20, 0x7}, // bus_grant_r
+}
+
+// Compiled model of Arbiter, run with simulator.NewCompiled
+type Model struct {
+	st    [1]uint64
+	last0 uint64 // clk
+	nbf0  bool
+	nbv0  uint64
+	nbf1  bool
+	nbv1  uint64
+	nbf2  bool
+	nbv2  uint64
+	nbf3  bool
+	nbv3  uint64
+	nbf4  bool
+	nbv4  uint64
+	nbf5  bool
+	nbv5  uint64
+}
+
+// Model with every signal zero and combinational logic settled
+func New() *Model {
+	d := &Model{}
+	d.settle()
+	d.last0 = (d.st[0] & 0x1) & 1
+	return d
+}
+
+func (d *Model) Signals() []string {
+	return signals
+}
+
+func (d *Model) Get(slot int) uint64 {
+	l := &layout[slot]
+	return d.st[l.word] >> l.shift & l.mask
+}
+
+func (d *Model) Set(slot int, value uint64) {
+	l := &layout[slot]
+	d.st[l.word] = d.st[l.word]&^(l.mask<<l.shift) | (value&l.mask)<<l.shift
+}
+
+func (d *Model) Memory(name string) []uint64 {
+	switch name {
+	}
+	return nil
+}
+
+// Clock inputs the model toggles, primary clock first
+var clockSlots = []int{0}
+
+// Half period of each clock in picoseconds
+var halfPeriods = []uint64{5000}
+
+func (d *Model) ClockSlots() []int {
+	return clockSlots
+}
+
+func (d *Model) HalfPeriods() []uint64 {
+	return halfPeriods
+}
+
+// Advance by n rising edges of clock c, toggling each clock when its
+// next toggle is due, and return the time of the last edge
+func (d *Model) Cycle(c, n int, now uint64, next []uint64) uint64 {
+	next0 := next[0]
+	for rises := 0; rises < n; {
+		now = next0
+		settle := false
+		if next0 == now {
+			d.st[0] ^= 0x1
+			next0 += 5000
+			if d.st[0]&0x1 != 0 {
+				settle = true
+				if c == 0 {
+					rises++
+				}
+			} else {
+				d.last0 = 0
+			}
+		}
+		if settle {
+			d.Propagate()
+		}
+	}
+	next[0] = next0
+	return now
+}
+
+func (d *Model) settle() {
+	{
+		v1 := uint64((((d.st[0] >> 2 & 0x1) | (d.st[0]>>3&0x1)<<1 | (d.st[0]>>4&0x1)<<2) & 0x7))
+		d.st[0] = d.st[0]&^0x700 | ((v1)&0x7)<<8
+	}
+	{
+		v2 := uint64(((d.st[0] >> 8 & 0x7) & ((b2u((d.st[0]>>18&0x3) <= 0x0) | b2u((d.st[0]>>18&0x3) <= 0x1)<<1 | b2u((d.st[0]>>18&0x3) <= 0x2)<<2) & 0x7)))
+		d.st[0] = d.st[0]&^0x3800 | ((v2)&0x7)<<11
+	}
+	{
+		v3 := uint64(mux(b2u((d.st[0]>>11&0x7) != 0x0), ((d.st[0] >> 11 & 0x7) & (((^(d.st[0] >> 11 & 0x7) & 0x7) + 0x1) & 0x7)), ((d.st[0] >> 8 & 0x7) & (((^(d.st[0] >> 8 & 0x7) & 0x7) + 0x1) & 0x7))))
+		d.st[0] = d.st[0]&^0x1c000 | ((v3)&0x7)<<14
+	}
+	{
+		v4 := uint64(bit((d.st[0] >> 20 & 0x7), 0x0, 3))
+		d.st[0] = d.st[0]&^0x20 | ((v4)&0x1)<<5
+	}
+	{
+		v5 := uint64(bit((d.st[0] >> 20 & 0x7), 0x1, 3))
+		d.st[0] = d.st[0]&^0x40 | ((v5)&0x1)<<6
+	}
+	{
+		v6 := uint64(bit((d.st[0] >> 20 & 0x7), 0x2, 3))
+		d.st[0] = d.st[0]&^0x80 | ((v6)&0x1)<<7
+	}
+	{
+		v7 := uint64(0x1)
+		d.st[0] = d.st[0]&^0x20000 | ((v7)&0x1)<<17
+	}
+}
+
+func (d *Model) proc0() {
+	if (d.st[0] >> 1 & 0x1) != 0 {
+		d.nbv0 = 0x0
+		d.nbf0 = true
+		d.nbv1 = 0x0
+		d.nbf1 = true
+	} else {
+		if (d.st[0] >> 17 & 0x1) != 0 {
+			d.nbv2 = (d.st[0] >> 14 & 0x7)
+			d.nbf2 = true
+		}
+		if b2u((d.st[0]>>17&0x1) != 0 && bit((d.st[0]>>14&0x7), 0x0, 3) != 0) != 0 {
+			d.nbv3 = 0x1
+			d.nbf3 = true
+		}
+		if b2u((d.st[0]>>17&0x1) != 0 && bit((d.st[0]>>14&0x7), 0x1, 3) != 0) != 0 {
+			d.nbv4 = 0x2
+			d.nbf4 = true
+		}
+		if b2u((d.st[0]>>17&0x1) != 0 && bit((d.st[0]>>14&0x7), 0x2, 3) != 0) != 0 {
+			d.nbv5 = 0x0
+			d.nbf5 = true
+		}
+	}
+}
+
+// Apply the nonblocking assignments of the fired processes
+func (d *Model) commit() {
+	if d.nbf0 {
+		d.nbf0 = false
+		d.st[0] = d.st[0]&^0x700000 | ((d.nbv0)&0x7)<<20
+	}
+	if d.nbf1 {
+		d.nbf1 = false
+		d.st[0] = d.st[0]&^0xc0000 | ((d.nbv1)&0x3)<<18
+	}
+	if d.nbf2 {
+		d.nbf2 = false
+		d.st[0] = d.st[0]&^0x700000 | ((d.nbv2)&0x7)<<20
+	}
+	if d.nbf3 {
+		d.nbf3 = false
+		d.st[0] = d.st[0]&^0xc0000 | ((d.nbv3)&0x3)<<18
+	}
+	if d.nbf4 {
+		d.nbf4 = false
+		d.st[0] = d.st[0]&^0xc0000 | ((d.nbv4)&0x3)<<18
+	}
+	if d.nbf5 {
+		d.nbf5 = false
+		d.st[0] = d.st[0]&^0xc0000 | ((d.nbv5)&0x3)<<18
+	}
+}
+
+func (d *Model) Propagate() {
+	for delta := 0; ; delta++ {
+		if delta > 1000 {
+			panic("simulator: clock edges keep triggering at one time step")
+		}
+		d.settle()
+		now0 := (d.st[0] & 0x1) & 1
+		rise0 := d.last0 == 0 && now0 == 1
+		d.last0 = now0
+		fire0 := rise0
+		if !(fire0) {
+			return
+		}
+		if fire0 {
+			d.proc0()
+		}
+		d.commit()
+	}
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func mux(cond, a, b uint64) uint64 {
+	if cond != 0 {
+		return a
+	}
+	return b
+}
+
+func load(mem []uint64, addr uint64) uint64 {
+	if addr >= uint64(len(mem)) {
+		return 0
+	}
+	return mem[addr]
+}
+
+func bit(v, i uint64, width int) uint64 {
+	if i >= uint64(width) {
+		return 0
+	}
+	return v >> i & 1
+}
+
+func parity(v uint64) uint64 {
+	return uint64(bits.OnesCount64(v) & 1)
+}
+
+func shl(v, n uint64) uint64 {
+	if n >= 64 {
+		return 0
+	}
+	return v << n
+}
+
+func shr(v, n uint64) uint64 {
+	if n >= 64 {
+		return 0
+	}
+	return v >> n
+}
+
+func pow(base, exp uint64) uint64 {
+	result := uint64(1)
+	for ; exp > 0; exp-- {
+		result *= base
+	}
+	return result
+}
+
+func div(a, b uint64) uint64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func mod(a, b uint64) uint64 {
+	if b == 0 {
+		return 0
+	}
+	return a % b
+}
+
+func rep(v uint64, width, count int) uint64 {
+	r := v
+	for i := 1; i < count; i++ {
+		r = r<<uint(width) | v
+	}
+	return r
+}
@@ -0,0 +1,25 @@
+// Package testdesigns holds the small designs the tests of several
+// packages share, so each fixture is written once
+package testdesigns
+
+import (
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// 8-bit counter in domain sys, clocked by clk and reset by rst, counting
+// while en is high
+func Counter() *hdl.Module {
+	m := core.NewModule("Counter")
+	m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	m.Input("en", 1)
+	m.Output("count", 8)
+	m.Reg("count_r", 8)
+	m.AssignName("count", "count_r")
+	m.Always = append(m.Always,
+		"always @(posedge clk) begin",
+		"  if (rst) count_r <= 8'h0;",
+		"  else if (en) count_r <= count_r + 8'h1;",
+		"end")
+	return m
+}
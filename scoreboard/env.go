@@ -0,0 +1,256 @@
+package scoreboard
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Ready/valid interface of the design: a transfer happens on a rising
+// clock edge when valid and ready are both high
+type Interface struct {
+	Name   string
+	Valid  string            // flat net name
+	Ready  string            // flat net name, empty when the receiver is always ready
+	Fields map[string]string // flat net name of each field
+}
+
+// Interface with fields named after the payload signals; ready may be nil
+func ReadyValid(name string, valid, ready *hdl.Signal, payload ...*hdl.Signal) *Interface {
+	iface := &Interface{Name: name, Valid: valid.Name, Fields: map[string]string{}}
+	if ready != nil {
+		iface.Ready = ready.Name
+	}
+	for _, p := range payload {
+		iface.Fields[p.Name] = p.Name
+	}
+	return iface
+}
+
+// Interface of a bundle with valid and, optionally, ready fields; the
+// other fields are the payload, named as in the bundle
+func FromBundle(b *hdl.Bundle) *Interface {
+	valid, ok := b.Fields["valid"]
+	if !ok {
+		panic(fmt.Sprintf("scoreboard: bundle %s has no valid field", b.Name))
+	}
+	iface := &Interface{Name: b.Name, Valid: valid.Name, Fields: map[string]string{}}
+	for name, sig := range b.Fields {
+		switch name {
+		case "valid":
+		case "ready":
+			iface.Ready = sig.Name
+		default:
+			iface.Fields[name] = sig.Name
+		}
+	}
+	return iface
+}
+
+func (iface *Interface) fieldNames() []string {
+	names := make([]string, 0, len(iface.Fields))
+	for name := range iface.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sends transactions into an input interface of the design, holding each
+// one until the design accepts it
+type Driver struct {
+	Iface *Interface
+	Sent  []*Transaction
+
+	queue []Fields
+	env   *Env
+}
+
+// Queue a transaction; fields left out are driven as 0
+func (d *Driver) Send(f Fields) {
+	for name := range f {
+		if _, ok := d.Iface.Fields[name]; !ok {
+			panic(fmt.Sprintf("scoreboard: interface %s has no field %s", d.Iface.Name, name))
+		}
+	}
+	d.queue = append(d.queue, f)
+}
+
+// Transactions queued and not yet accepted
+func (d *Driver) Queued() int {
+	return len(d.queue)
+}
+
+func (d *Driver) drive() {
+	sim := d.env.Sim
+	if len(d.queue) == 0 {
+		sim.Poke(d.Iface.Valid, 0)
+		return
+	}
+	sim.Poke(d.Iface.Valid, 1)
+	for name, net := range d.Iface.Fields {
+		sim.Poke(net, d.queue[0][name])
+	}
+}
+
+// Turns transfers on an interface into transactions. When the interface's
+// ready is an input of the design, the monitor drives it, high on a random
+// ReadyRate share of the cycles.
+type Monitor struct {
+	Iface     *Interface
+	Seen      []*Transaction
+	ReadyRate float64 // 1 by default
+
+	drivesReady bool
+	listeners   []func(*Transaction)
+	env         *Env
+}
+
+// Call fn with every transaction the monitor sees
+func (m *Monitor) Subscribe(fn func(*Transaction)) {
+	m.listeners = append(m.listeners, fn)
+}
+
+// Simulation with drivers, monitors and scoreboards, clocked by the
+// primary clock
+type Env struct {
+	Sim    *simulator.Simulator
+	Cycle  int // rising edges run so far
+	Boards []*Scoreboard
+
+	rng      *rand.Rand
+	drivers  []*Driver
+	monitors []*Monitor
+}
+
+// Environment around a simulator; random choices are reproducible from
+// the seed
+func NewEnv(sim *simulator.Simulator, seed int64) *Env {
+	clocks := sim.Clocks()
+	if len(clocks) == 0 {
+		panic(fmt.Sprintf("scoreboard: %s has no clock", sim.Netlist.Top.Name))
+	}
+	e := &Env{Sim: sim, rng: rand.New(rand.NewSource(seed))}
+	sim.OnClock(clocks[0], e.sample)
+	return e
+}
+
+// Drive transactions into an interface whose valid is an input
+func (e *Env) Driver(iface *Interface) *Driver {
+	if !e.isInput(iface.Valid) {
+		panic(fmt.Sprintf("scoreboard: valid %s of %s is not an input to drive", iface.Valid, iface.Name))
+	}
+	d := &Driver{Iface: iface, env: e}
+	e.drivers = append(e.drivers, d)
+	return d
+}
+
+// Watch an interface for transfers
+func (e *Env) Monitor(iface *Interface) *Monitor {
+	m := &Monitor{Iface: iface, ReadyRate: 1, env: e}
+	m.drivesReady = iface.Ready != "" && e.isInput(iface.Ready)
+	e.monitors = append(e.monitors, m)
+	return m
+}
+
+func (e *Env) isInput(name string) bool {
+	net, ok := e.Sim.Netlist.Nets[name]
+	return ok && net.Kind == "input" && net.Scope == ""
+}
+
+// Feed the transactions seen by in to the model and compare the
+// transactions it predicts with those seen by out, out of order by the key
+// fields
+func (e *Env) Check(in *Monitor, model Model, out *Monitor, key ...string) *Scoreboard {
+	sb := New(out.Iface.Name, key...)
+	in.Subscribe(func(t *Transaction) {
+		for _, p := range model.Transact(t) {
+			p.Interface, p.Cycle = out.Iface.Name, -1
+			sb.Expect(p)
+		}
+	})
+	out.Subscribe(sb.Actual)
+	e.Boards = append(e.Boards, sb)
+	return sb
+}
+
+// Record the transfers of the clock edge, from the values just before it
+func (e *Env) sample() {
+	sim := e.Sim
+	fire := func(iface *Interface) bool {
+		return sim.Peek(iface.Valid)&1 == 1 && (iface.Ready == "" || sim.Peek(iface.Ready)&1 == 1)
+	}
+	for _, d := range e.drivers {
+		if len(d.queue) > 0 && fire(d.Iface) {
+			d.Sent = append(d.Sent, &Transaction{Interface: d.Iface.Name, Cycle: e.Cycle, Fields: d.queue[0]})
+			d.queue = d.queue[1:]
+		}
+	}
+	for _, m := range e.monitors {
+		if !fire(m.Iface) {
+			continue
+		}
+		t := &Transaction{Interface: m.Iface.Name, Cycle: e.Cycle, Fields: Fields{}}
+		for _, name := range m.Iface.fieldNames() {
+			t.Fields[name] = sim.Peek(m.Iface.Fields[name])
+		}
+		m.Seen = append(m.Seen, t)
+		for _, fn := range m.listeners {
+			fn(t)
+		}
+	}
+}
+
+// Run for the given number of clock cycles
+func (e *Env) Run(cycles int) {
+	for i := 0; i < cycles; i++ {
+		for _, d := range e.drivers {
+			d.drive()
+		}
+		for _, m := range e.monitors {
+			if m.drivesReady {
+				ready := uint64(0)
+				if e.rng.Float64() < m.ReadyRate {
+					ready = 1
+				}
+				e.Sim.Poke(m.Iface.Ready, ready)
+			}
+		}
+		e.Sim.Cycle(1)
+		e.Cycle++
+	}
+}
+
+// Run until every driver has sent its transactions and every scoreboard
+// has seen all it expects, for at most max cycles
+func (e *Env) Drain(max int) error {
+	for i := 0; i <= max; i++ {
+		idle := true
+		for _, d := range e.drivers {
+			idle = idle && len(d.queue) == 0
+		}
+		for _, sb := range e.Boards {
+			idle = idle && len(sb.pending) == 0
+		}
+		if idle {
+			return nil
+		}
+		if i < max {
+			e.Run(1)
+		}
+	}
+	for _, d := range e.drivers {
+		if len(d.queue) > 0 {
+			return fmt.Errorf("scoreboard: %s accepted %d of %d transactions in %d cycles", d.Iface.Name, len(d.Sent), len(d.Sent)+len(d.queue), max)
+		}
+	}
+	for _, sb := range e.Boards {
+		if len(sb.pending) > 0 {
+			return fmt.Errorf("scoreboard: %s still expects %d transactions after %d cycles, next %s", sb.Name, len(sb.pending), max, sb.pending[0])
+		}
+	}
+	return nil
+}
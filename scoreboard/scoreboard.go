@@ -0,0 +1,192 @@
+// Package scoreboard checks a design against a Go reference model at the
+// transaction level. Drivers turn transactions into ready/valid activity on
+// the inputs, monitors turn activity on the ports back into transactions,
+// and a scoreboard compares what the design produced with what the model
+// predicted, in order or out of order.
+//
+//	env := scoreboard.NewEnv(sim, 1)
+//	in := scoreboard.ReadyValid("in", inValid, inReady, inData)
+//	out := scoreboard.ReadyValid("out", outValid, outReady, outData)
+//	drv := env.Driver(in)
+//	sb := env.Check(env.Monitor(in), model, env.Monitor(out))
+//	drv.Send(scoreboard.Fields{"in_data": 7})
+//	if err := env.Drain(1000); err != nil { t.Fatal(err) }
+//	if err := sb.Check(); err != nil { t.Error(err) }
+package scoreboard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Field values of a transaction by field name
+type Fields map[string]uint64
+
+func (f Fields) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%#x", name, f[name])
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// Transfer on an interface, or one predicted by a reference model
+type Transaction struct {
+	Interface string
+	Cycle     int // cycle of the transfer, -1 for predictions
+	Fields    Fields
+}
+
+func (t *Transaction) String() string {
+	if t.Cycle < 0 {
+		return t.Fields.String()
+	}
+	return fmt.Sprintf("%s on %s at cycle %d", t.Fields, t.Interface, t.Cycle)
+}
+
+// Go golden model: the output transactions an input transaction causes,
+// possibly none until later inputs arrive
+type Model interface {
+	Transact(in *Transaction) []*Transaction
+}
+
+// Function used as a Model
+type ModelFunc func(in *Transaction) []*Transaction
+
+func (f ModelFunc) Transact(in *Transaction) []*Transaction {
+	return f(in)
+}
+
+// Difference between the design and the model
+type Mismatch struct {
+	Kind     string       // "mismatch", "unexpected" or "missing"
+	Expected *Transaction // nil when unexpected
+	Actual   *Transaction // nil when missing
+	Differs  []string     // fields that differ, for a mismatch
+}
+
+func (m *Mismatch) String() string {
+	switch m.Kind {
+	case "unexpected":
+		return fmt.Sprintf("unexpected %s", m.Actual)
+	case "missing":
+		return fmt.Sprintf("missing %s, the design never produced it", m.Expected)
+	}
+	var diffs []string
+	for _, name := range m.Differs {
+		diffs = append(diffs, fmt.Sprintf("%s=%#x, expected %#x", name, m.Actual.Fields[name], m.Expected.Fields[name]))
+	}
+	return fmt.Sprintf("%s: %s (model predicted %s)", m.Actual, strings.Join(diffs, ", "), m.Expected.Fields)
+}
+
+// Compares actual transactions with expected ones. With Key set, an actual
+// transaction is matched with the oldest expected one with the same key
+// fields and then compared field by field; without it, with the oldest
+// identical one. InOrder compares each actual transaction with the oldest
+// expected one instead.
+type Scoreboard struct {
+	Name    string
+	Key     []string
+	InOrder bool
+
+	Matched    int
+	Mismatches []*Mismatch
+
+	pending []*Transaction
+}
+
+// Scoreboard comparing out of order by the given key fields
+func New(name string, key ...string) *Scoreboard {
+	return &Scoreboard{Name: name, Key: key}
+}
+
+// Record a transaction the design should produce
+func (sb *Scoreboard) Expect(t *Transaction) {
+	sb.pending = append(sb.pending, t)
+}
+
+// Transactions expected and not yet seen
+func (sb *Scoreboard) Pending() []*Transaction {
+	return append([]*Transaction{}, sb.pending...)
+}
+
+// Compare a transaction the design produced
+func (sb *Scoreboard) Actual(t *Transaction) {
+	match := -1
+	switch {
+	case sb.InOrder:
+		if len(sb.pending) > 0 {
+			match = 0
+		}
+	case len(sb.Key) > 0:
+		for i, e := range sb.pending {
+			if sameFields(e.Fields, t.Fields, sb.Key) {
+				match = i
+				break
+			}
+		}
+	default:
+		for i, e := range sb.pending {
+			if len(differs(e.Fields, t.Fields)) == 0 {
+				match = i
+				break
+			}
+		}
+	}
+	if match < 0 {
+		sb.Mismatches = append(sb.Mismatches, &Mismatch{Kind: "unexpected", Actual: t})
+		return
+	}
+	e := sb.pending[match]
+	sb.pending = append(sb.pending[:match], sb.pending[match+1:]...)
+	if d := differs(e.Fields, t.Fields); len(d) > 0 {
+		sb.Mismatches = append(sb.Mismatches, &Mismatch{Kind: "mismatch", Expected: e, Actual: t, Differs: d})
+		return
+	}
+	sb.Matched++
+}
+
+func sameFields(a, b Fields, names []string) bool {
+	for _, name := range names {
+		if a[name] != b[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Fields of the expected transaction the actual one gets wrong, sorted
+func differs(expected, actual Fields) []string {
+	var names []string
+	for name, v := range expected {
+		if got, ok := actual[name]; !ok || got != v {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Error listing every mismatch and every expected transaction still
+// missing, or nil when everything matched
+func (sb *Scoreboard) Check() error {
+	problems := append([]*Mismatch{}, sb.Mismatches...)
+	for _, e := range sb.pending {
+		problems = append(problems, &Mismatch{Kind: "missing", Expected: e})
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "scoreboard %s: %d matched, %d wrong", sb.Name, sb.Matched, len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(&b, "\n  %s", p)
+	}
+	return fmt.Errorf("%s", b.String())
+}
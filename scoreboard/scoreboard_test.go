@@ -0,0 +1,188 @@
+package scoreboard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Pipeline register adding one to the data of each transfer; the buggy
+// version adds two for id 5
+func newIncrementer(t *testing.T, buggy bool) (*simulator.Simulator, *hdl.Bundle, *Interface) {
+	m := core.NewModule("Incrementer")
+	clk := m.Input("clk", 1)
+	rst := m.Input("rst", 1)
+	in := &hdl.Bundle{Name: "in", Fields: map[string]*hdl.Signal{
+		"valid": m.Input("in_valid", 1),
+		"id":    m.Input("in_id", 4),
+		"data":  m.Input("in_data", 8),
+		"ready": m.Output("in_ready", 1),
+	}}
+	outReady := m.Input("out_ready", 1)
+	out := ReadyValid("out", m.Output("out_valid", 1), outReady, m.Output("out_id", 4), m.Output("out_data", 8))
+	m.Reg("full_r", 1)
+	m.Reg("id_r", 4)
+	m.Reg("data_r", 8)
+	m.AssignName("in_ready", "!full_r || out_ready")
+	m.AssignName("out_valid", "full_r")
+	m.AssignName("out_id", "id_r")
+	m.AssignName("out_data", "data_r")
+	step := "8'd1"
+	if buggy {
+		step = "(in_id == 4'd5 ? 8'd2 : 8'd1)"
+	}
+	m.Always = append(m.Always,
+		"always @(posedge clk) begin",
+		"  if (rst) full_r <= 1'b0;",
+		"  else if (in_valid && in_ready) begin",
+		"    full_r <= 1'b1;",
+		"    id_r <= in_id;",
+		"    data_r <= in_data + "+step+";",
+		"  end else if (out_ready) full_r <= 1'b0;",
+		"end")
+	m.NewClockDomain("sys", clk, rst)
+	sim, err := simulator.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim, in, out
+}
+
+var increment = ModelFunc(func(in *Transaction) []*Transaction {
+	return []*Transaction{{Fields: Fields{"out_id": in.Fields["id"], "out_data": (in.Fields["data"] + 1) & 0xff}}}
+})
+
+func runIncrementer(t *testing.T, buggy bool) (*Env, *Driver, *Monitor, *Scoreboard) {
+	sim, in, out := newIncrementer(t, buggy)
+	env := NewEnv(sim, 7)
+	drv := env.Driver(FromBundle(in))
+	inMon := env.Monitor(FromBundle(in))
+	outMon := env.Monitor(out)
+	outMon.ReadyRate = 0.5
+	sb := env.Check(inMon, increment, outMon, "out_id")
+
+	sim.Poke("rst", 1)
+	sim.Cycle(2)
+	sim.Poke("rst", 0)
+	for i := uint64(0); i < 16; i++ {
+		drv.Send(Fields{"id": i, "data": 0xf8 + i})
+	}
+	if err := env.Drain(200); err != nil {
+		t.Fatal(err)
+	}
+	return env, drv, inMon, sb
+}
+
+func TestEnvAgainstModel(t *testing.T) {
+	env, drv, inMon, sb := runIncrementer(t, false)
+	if err := sb.Check(); err != nil {
+		t.Error(err)
+	}
+	if sb.Matched != 16 || len(drv.Sent) != 16 || len(inMon.Seen) != 16 {
+		t.Errorf("Matched %d, sent %d and saw %d of 16 transactions", sb.Matched, len(drv.Sent), len(inMon.Seen))
+	}
+	// Backpressure stretches the run beyond one transfer per cycle
+	if env.Cycle <= 17 {
+		t.Errorf("Ran %d cycles, expected the random ready to stall the output", env.Cycle)
+	}
+	if got := inMon.Seen[3].Fields.String(); got != "{data=0xfb id=0x3}" {
+		t.Errorf("Input transaction %s", got)
+	}
+}
+
+func TestMismatchReport(t *testing.T) {
+	_, _, _, sb := runIncrementer(t, true)
+	err := sb.Check()
+	if err == nil {
+		t.Fatal("The buggy design should be caught")
+	}
+	for _, want := range []string{
+		"scoreboard out: 15 matched, 1 wrong",
+		"{out_data=0xff out_id=0x5} on out at cycle ",
+		": out_data=0xff, expected 0xfe (model predicted {out_data=0xfe out_id=0x5})",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Report lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestMatching(t *testing.T) {
+	tx := func(id, v uint64) *Transaction {
+		return &Transaction{Interface: "resp", Cycle: int(id), Fields: Fields{"id": id, "v": v}}
+	}
+
+	sb := New("keyed", "id")
+	sb.Expect(tx(1, 10))
+	sb.Expect(tx(2, 20))
+	sb.Expect(tx(3, 30))
+	sb.Actual(tx(2, 20))
+	sb.Actual(tx(1, 11))
+	sb.Actual(tx(4, 40))
+	if sb.Matched != 1 || len(sb.Mismatches) != 2 || len(sb.Pending()) != 1 {
+		t.Fatalf("Matched %d, mismatches %v, pending %v", sb.Matched, sb.Mismatches, sb.Pending())
+	}
+	err := sb.Check()
+	for _, want := range []string{
+		"scoreboard keyed: 1 matched, 3 wrong",
+		"{id=0x1 v=0xb} on resp at cycle 1: v=0xb, expected 0xa",
+		"unexpected {id=0x4 v=0x28} on resp at cycle 4",
+		"missing {id=0x3 v=0x1e} on resp at cycle 3, the design never produced it",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Report lacks %q:\n%v", want, err)
+		}
+	}
+
+	// Without a key any identical transaction matches
+	sb = New("any")
+	sb.Expect(tx(1, 10))
+	sb.Expect(tx(2, 20))
+	sb.Actual(tx(2, 20))
+	sb.Actual(tx(1, 10))
+	if err := sb.Check(); err != nil || sb.Matched != 2 {
+		t.Errorf("Out of order transactions should match: %v", err)
+	}
+
+	sb = New("ordered")
+	sb.InOrder = true
+	sb.Expect(tx(1, 10))
+	sb.Expect(tx(2, 20))
+	sb.Actual(tx(2, 20))
+	if len(sb.Mismatches) != 1 || sb.Mismatches[0].Kind != "mismatch" {
+		t.Errorf("In order, the second transaction first should mismatch: %v", sb.Mismatches)
+	}
+}
+
+func TestInterfaceErrors(t *testing.T) {
+	sim, in, out := newIncrementer(t, false)
+	env := NewEnv(sim, 0)
+	expectPanic := func(want string, fn func()) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			if r := recover(); r == nil || !strings.Contains(r.(string), want) {
+				t.Errorf("Expected a panic containing %q, got %v", want, r)
+			}
+		}()
+		fn()
+	}
+	expectPanic("valid out_valid of out is not an input", func() { env.Driver(out) })
+	expectPanic("bundle bad has no valid field", func() { FromBundle(&hdl.Bundle{Name: "bad"}) })
+	drv := env.Driver(FromBundle(in))
+	expectPanic("interface in has no field size", func() { drv.Send(Fields{"size": 1}) })
+
+	// With the output never ready the pipeline register fills up and
+	// stops accepting input
+	outMon := env.Monitor(out)
+	outMon.ReadyRate = 0
+	env.Check(env.Monitor(FromBundle(in)), increment, outMon)
+	drv.Send(Fields{"id": 1})
+	drv.Send(Fields{"id": 2})
+	if err := env.Drain(20); err == nil || !strings.Contains(err.Error(), "in accepted 1 of 2 transactions in 20 cycles") {
+		t.Errorf("Drain should time out, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// If or case statement of an always block and how often each of its arms
+// ran. An if has a then and an else arm, the else counted even when the
+// statement has none; a case has one arm per item, plus a final default
+// arm for selectors no item matches when it has no default item.
+type Branch struct {
+	Process *hdl.Process
+	Stmt    *hdl.Stmt
+	Arms    []string
+	Hits    []uint64
+}
+
+func (b *Branch) String() string {
+	kind := "if"
+	if b.Stmt.Kind == hdl.StmtCase {
+		kind = "case"
+	}
+	where := "always block"
+	if b.Process.Clock != "" {
+		where = fmt.Sprintf("always @(%s %s)", b.Process.Edge, b.Process.Clock)
+	}
+	if b.Process.Scope != "" {
+		where = b.Process.Scope + " " + where
+	}
+	return fmt.Sprintf("%s: %s (%s)", where, kind, b.Stmt.Cond)
+}
+
+// Branches of the design's always blocks in the order they appear within
+// each block. Compiled models have none.
+func (s *Simulator) Branches() []*Branch {
+	return append([]*Branch{}, s.branches...)
+}
+
+// Register a branch of the statement being compiled
+func (c *compiler) branch(st *hdl.Stmt) *Branch {
+	b := &Branch{Process: c.proc, Stmt: st}
+	if st.Kind == hdl.StmtIf {
+		b.Arms = []string{"then", "else"}
+	} else {
+		hasDefault := false
+		for _, item := range st.Items {
+			if item.Labels == nil {
+				b.Arms = append(b.Arms, "default")
+				hasDefault = true
+				continue
+			}
+			var labels []string
+			for _, label := range item.Labels {
+				labels = append(labels, label.String())
+			}
+			b.Arms = append(b.Arms, strings.Join(labels, ", "))
+		}
+		if !hasDefault {
+			b.Arms = append(b.Arms, "default")
+		}
+	}
+	b.Hits = make([]uint64, len(b.Arms))
+	c.s.branches = append(c.s.branches, b)
+	return b
+}
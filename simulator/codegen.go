@@ -0,0 +1,976 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/SoulPancake/HFT/types"
+	"go/format"
+)
+
+// Generate translates the module hierarchy into the Go source of a package
+// named pkg holding a compiled model of the design. The model packs every
+// signal into uint64 words, evaluates combinational logic as straight-line
+// code in dependency order, keeps memories as slices and runs clocked
+// processes with nonblocking semantics. Run it with
+//
+//	sim, err := simulator.NewCompiled(m, pkg.New())
+//
+// Cycle and CycleDomain let the model toggle the clock inputs itself while
+// no observer, clock hook or property needs the edges, which makes long
+// runs with held inputs over an order of magnitude faster than the
+// interpreter; the Run benchmarks measure it. Stepping edge by edge still
+// goes through the simulator and gains less.
+//
+// The model only matches the module it was generated from; NewCompiled
+// rejects it once the design's signals or clock frequencies change.
+func Generate(m *hdl.Module, pkg string) ([]byte, error) {
+	s, err := build(m)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{s: s, c: &compiler{s: s}, mems: map[string]int{}, indexNames: map[*hdl.Expr]string{}}
+	g.layoutSignals()
+	if err := g.module(m.Name, pkg); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code for %s does not parse: %v", m.Name, err)
+	}
+	return src, nil
+}
+
+// Position of a signal in the packed state
+type slotLayout struct {
+	word  int
+	shift int
+	width int
+}
+
+// Nonblocking assignment of a clocked process, applied after every fired
+// process has run
+type nonblocking struct {
+	lhs     *hdl.Expr
+	indices []*hdl.Expr
+}
+
+type generator struct {
+	s          *Simulator
+	c          *compiler
+	buf        bytes.Buffer
+	layout     []slotLayout
+	words      int
+	mems       map[string]int
+	memNames   []string
+	temps      int
+	nb         []nonblocking
+	indexNames map[*hdl.Expr]string // evaluated index of an assignment target
+	triggers   map[int]bool         // nets whose edges trigger processes
+	falls      map[int]bool         // nets whose falling edges trigger processes
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// Pack signals into words in declaration order without splitting any
+// signal across words
+func (g *generator) layoutSignals() {
+	used := 64
+	for _, w := range g.s.widths {
+		width := int(w)
+		if used+width > 64 {
+			g.words++
+			used = 0
+		}
+		g.layout = append(g.layout, slotLayout{word: g.words - 1, shift: used, width: width})
+		used += width
+	}
+	if g.words == 0 {
+		g.words = 1
+	}
+	for _, name := range sortedMemories(g.s.mems) {
+		g.mems[name] = len(g.memNames)
+		g.memNames = append(g.memNames, name)
+	}
+}
+
+func sortedMemories(mems map[string]*memory) []string {
+	set := map[string]bool{}
+	for name := range mems {
+		set[name] = true
+	}
+	return sortedKeys(set)
+}
+
+func (g *generator) temp(prefix string) string {
+	g.temps++
+	return fmt.Sprintf("%s%d", prefix, g.temps)
+}
+
+func (g *generator) read(slot int) string {
+	l := g.layout[slot]
+	switch {
+	case l.width == 64:
+		return fmt.Sprintf("d.st[%d]", l.word)
+	case l.shift == 0:
+		return fmt.Sprintf("(d.st[%d] & %#x)", l.word, mask(l.width))
+	}
+	return fmt.Sprintf("(d.st[%d] >> %d & %#x)", l.word, l.shift, mask(l.width))
+}
+
+func (g *generator) write(slot int, value string) {
+	l := g.layout[slot]
+	if l.width == 64 {
+		g.printf("d.st[%d] = %s\n", l.word, value)
+		return
+	}
+	m := mask(l.width)
+	g.printf("d.st[%d] = d.st[%d]&^%#x | ((%s)&%#x)<<%d\n", l.word, l.word, m<<uint(l.shift), value, m, l.shift)
+}
+
+func (g *generator) module(name, pkg string) error {
+	s := g.s
+	g.printf("// Code generated by simulator.Generate from module %s. DO NOT EDIT.\n\n", name)
+	g.printf("// Package %s is a compiled simulation model of module %s\n", pkg, name)
+	g.printf("package %s\n\n", pkg)
+	g.printf("import \"math/bits\"\n\n")
+
+	g.printf("var signals = []string{\n")
+	for _, n := range s.names {
+		g.printf("%q,\n", n)
+	}
+	g.printf("}\n\n")
+	g.printf("// Word, shift and mask of each signal in the packed state\n")
+	g.printf("var layout = [...]struct {\nword int\nshift uint\nmask uint64\n}{\n")
+	for i, l := range g.layout {
+		g.printf("{%d, %d, %#x}, // %s\n", l.word, l.shift, mask(l.width), s.names[i])
+	}
+	g.printf("}\n\n")
+
+	// Logic first: it decides the nonblocking slots the struct declares
+	header := append([]byte(nil), g.buf.Bytes()...)
+	g.buf.Reset()
+	if err := g.settle(); err != nil {
+		return err
+	}
+	triggers, err := g.propagate()
+	if err != nil {
+		return err
+	}
+	logic := append([]byte(nil), g.buf.Bytes()...)
+	g.buf.Reset()
+	g.buf.Write(header)
+
+	g.printf("// Compiled model of %s, run with simulator.NewCompiled\n", name)
+	g.printf("type Model struct {\nst [%d]uint64\n", g.words)
+	for i, mem := range g.memNames {
+		g.printf("mem%d []uint64 // %s\n", i, mem)
+	}
+	for _, slot := range triggers {
+		g.printf("last%d uint64 // %s\n", slot, s.names[slot])
+	}
+	for i, nb := range g.nb {
+		g.printf("nbf%d bool\nnbv%d uint64\n", i, i)
+		for j := range nb.indices {
+			g.printf("nbi%d_%d uint64\n", i, j)
+		}
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Model with every signal zero and combinational logic settled\n")
+	g.printf("func New() *Model {\nd := &Model{")
+	for i, mem := range g.memNames {
+		g.printf("mem%d: make([]uint64, %d), ", i, len(s.mems[mem].data))
+	}
+	g.printf("}\nd.settle()\n")
+	for _, slot := range triggers {
+		g.printf("d.last%d = %s & 1\n", slot, g.read(slot))
+	}
+	g.printf("return d\n}\n\n")
+
+	g.printf("func (d *Model) Signals() []string {\nreturn signals\n}\n\n")
+	g.printf("func (d *Model) Get(slot int) uint64 {\nl := &layout[slot]\nreturn d.st[l.word] >> l.shift & l.mask\n}\n\n")
+	g.printf("func (d *Model) Set(slot int, value uint64) {\nl := &layout[slot]\n")
+	g.printf("d.st[l.word] = d.st[l.word]&^(l.mask<<l.shift) | (value&l.mask)<<l.shift\n}\n\n")
+	g.printf("func (d *Model) Memory(name string) []uint64 {\nswitch name {\n")
+	for i, mem := range g.memNames {
+		g.printf("case %q:\nreturn d.mem%d\n", mem, i)
+	}
+	g.printf("}\nreturn nil\n}\n\n")
+
+	g.clocks()
+	g.buf.Write(logic)
+	g.printf("%s", helpers)
+	return nil
+}
+
+// Clock schedule and the loop stepping it, so Cycle runs inside the model
+// without going through the simulator at every edge
+func (g *generator) clocks() {
+	s := g.s
+	g.printf("// Clock inputs the model toggles, primary clock first\n")
+	g.printf("var clockSlots = []int{")
+	for _, clk := range s.clocks {
+		g.printf("%d, ", clk.net)
+	}
+	g.printf("}\n\n")
+	g.printf("// Half period of each clock in picoseconds\n")
+	g.printf("var halfPeriods = []uint64{")
+	for _, clk := range s.clocks {
+		g.printf("%d, ", clk.half)
+	}
+	g.printf("}\n\n")
+	g.printf("func (d *Model) ClockSlots() []int {\nreturn clockSlots\n}\n\n")
+	g.printf("func (d *Model) HalfPeriods() []uint64 {\nreturn halfPeriods\n}\n\n")
+
+	g.printf("// Advance by n rising edges of clock c, toggling each clock when its\n")
+	g.printf("// next toggle is due, and return the time of the last edge\n")
+	g.printf("func (d *Model) Cycle(c, n int, now uint64, next []uint64) uint64 {\n")
+	if len(s.clocks) == 0 {
+		g.printf("return now\n}\n\n")
+		return
+	}
+	// A falling clock that no logic reads and no process waits for
+	// changes nothing but the level its rising edge is detected from
+	read := map[int]bool{}
+	for _, item := range s.comb {
+		for _, name := range item.reads {
+			if slot, ok := s.index[name]; ok {
+				read[slot] = true
+			}
+		}
+	}
+	for i := range s.clocks {
+		g.printf("next%d := next[%d]\n", i, i)
+	}
+	g.printf("for rises := 0; rises < n; {\nnow = next0\n")
+	for i := 1; i < len(s.clocks); i++ {
+		g.printf("if next%d < now {\nnow = next%d\n}\n", i, i)
+	}
+	g.printf("settle := false\n")
+	for i, clk := range s.clocks {
+		l := g.layout[clk.net]
+		bit := uint64(1) << uint(l.shift)
+		g.printf("if next%d == now {\n", i)
+		g.printf("d.st[%d] ^= %#x\n", l.word, bit)
+		g.printf("next%d += %d\n", i, clk.half)
+		g.printf("if d.st[%d]&%#x != 0 {\nsettle = true\n", l.word, bit)
+		g.printf("if c == %d {\nrises++\n}\n", i)
+		switch {
+		case read[clk.net] || g.falls[clk.net]:
+			g.printf("} else {\nsettle = true\n}\n")
+		case g.triggers[clk.net]:
+			g.printf("} else {\nd.last%d = 0\n}\n", clk.net)
+		default:
+			g.printf("}\n")
+		}
+		g.printf("}\n")
+	}
+	g.printf("if settle {\nd.Propagate()\n}\n}\n")
+	for i := range s.clocks {
+		g.printf("next[%d] = next%d\n", i, i)
+	}
+	g.printf("return now\n}\n\n")
+}
+
+// Combinational logic in evaluation order, repeated until stable when the
+// design has loops
+func (g *generator) settle() error {
+	g.printf("func (d *Model) settle() {\n")
+	if g.s.cyclic {
+		g.printf("for pass := 0; ; pass++ {\nprev := d.st\n")
+	}
+	for _, item := range g.s.comb {
+		if a := item.assign; a != nil {
+			if err := g.assign(a.LHS, a.RHS, false); err != nil {
+				return fmt.Errorf("assign %s: %v", a.LHS, err)
+			}
+			continue
+		}
+		if err := g.stmt(item.proc.Body, false); err != nil {
+			return fmt.Errorf("always block in %q: %v", item.proc.Scope, err)
+		}
+	}
+	if g.s.cyclic {
+		g.printf("if d.st == prev {\nreturn\n}\n")
+		g.printf("if pass > %d {\npanic(\"simulator: combinational loop does not settle\")\n}\n}\n", maxDeltaCycles)
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+// Clocked processes and the delta loop firing them. Returns the nets
+// whose edges trigger processes.
+func (g *generator) propagate() ([]int, error) {
+	s := g.s
+	var triggers []int
+	seen, rises, falls := map[int]bool{}, map[int]bool{}, map[int]bool{}
+	for _, p := range s.procs {
+		for _, t := range p.triggers {
+			if !seen[t.net] {
+				seen[t.net] = true
+				triggers = append(triggers, t.net)
+			}
+			switch t.edge {
+			case "posedge":
+				rises[t.net] = true
+			case "negedge":
+				falls[t.net] = true
+			}
+		}
+	}
+
+	g.falls = falls
+	g.triggers = seen
+
+	for i, p := range s.procs {
+		g.printf("func (d *Model) proc%d() {\n", i)
+		if err := g.stmt(p.src.Body, true); err != nil {
+			return nil, fmt.Errorf("always block in %q: %v", p.src.Scope, err)
+		}
+		g.printf("}\n\n")
+	}
+
+	g.printf("// Apply the nonblocking assignments of the fired processes\n")
+	g.printf("func (d *Model) commit() {\n")
+	for i, nb := range g.nb {
+		g.printf("if d.nbf%d {\nd.nbf%d = false\n", i, i)
+		for j, idx := range nb.indices {
+			g.indexNames[idx] = fmt.Sprintf("d.nbi%d_%d", i, j)
+		}
+		if err := g.store(nb.lhs, fmt.Sprintf("d.nbv%d", i)); err != nil {
+			return nil, err
+		}
+		g.printf("}\n")
+	}
+	g.printf("}\n\n")
+
+	g.printf("func (d *Model) Propagate() {\n")
+	if len(s.procs) == 0 {
+		g.printf("d.settle()\n}\n\n")
+		return triggers, nil
+	}
+	g.printf("for delta := 0; ; delta++ {\n")
+	g.printf("if delta > %d {\npanic(\"simulator: clock edges keep triggering at one time step\")\n}\n", maxDeltaCycles)
+	g.printf("d.settle()\n")
+	for _, slot := range triggers {
+		g.printf("now%d := %s & 1\n", slot, g.read(slot))
+		if rises[slot] {
+			g.printf("rise%d := d.last%d == 0 && now%d == 1\n", slot, slot, slot)
+		}
+		if falls[slot] {
+			g.printf("fall%d := d.last%d == 1 && now%d == 0\n", slot, slot, slot)
+		}
+		g.printf("d.last%d = now%d\n", slot, slot)
+	}
+	var any []string
+	for i, p := range s.procs {
+		var edges []string
+		for _, t := range p.triggers {
+			switch t.edge {
+			case "posedge":
+				edges = append(edges, fmt.Sprintf("rise%d", t.net))
+			case "negedge":
+				edges = append(edges, fmt.Sprintf("fall%d", t.net))
+			}
+		}
+		if len(edges) == 0 {
+			edges = []string{"false"}
+		}
+		g.printf("fire%d := %s\n", i, join(edges, " || "))
+		any = append(any, fmt.Sprintf("fire%d", i))
+	}
+	g.printf("if !(%s) {\nreturn\n}\n", join(any, " || "))
+	for i := range s.procs {
+		g.printf("if fire%d {\nd.proc%d()\n}\n", i, i)
+	}
+	g.printf("d.commit()\n}\n}\n\n")
+	return triggers, nil
+}
+
+func join(parts []string, sep string) string {
+	var b bytes.Buffer
+	for i, p := range parts {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+func (g *generator) stmt(st *hdl.Stmt, clocked bool) error {
+	if st == nil {
+		return nil
+	}
+	switch st.Kind {
+	case hdl.StmtBlock:
+		for _, b := range st.Body {
+			if err := g.stmt(b, clocked); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case hdl.StmtIf:
+		cond, _, err := g.expr(st.Cond, 0)
+		if err != nil {
+			return err
+		}
+		g.printf("if %s != 0 {\n", cond)
+		if err := g.stmt(st.Then, clocked); err != nil {
+			return err
+		}
+		if st.Else != nil {
+			g.printf("} else {\n")
+			if err := g.stmt(st.Else, clocked); err != nil {
+				return err
+			}
+		}
+		g.printf("}\n")
+		return nil
+
+	case hdl.StmtCase:
+		return g.caseStmt(st, clocked)
+
+	case hdl.StmtBlocking, hdl.StmtNonblocking:
+		return g.assign(st.LHS, st.RHS, st.Kind == hdl.StmtNonblocking && clocked)
+	}
+	return fmt.Errorf("unsupported statement")
+}
+
+func (g *generator) caseStmt(st *hdl.Stmt, clocked bool) error {
+	// Selector and labels are sized to each other like an equality
+	w, err := g.c.width(st.Cond)
+	if err != nil {
+		return err
+	}
+	labeled := false
+	for _, item := range st.Items {
+		for _, label := range item.Labels {
+			lw, err := g.c.width(label)
+			if err != nil {
+				return err
+			}
+			if lw > w {
+				w = lw
+			}
+		}
+		labeled = labeled || item.Labels != nil
+	}
+	sel, _, err := g.expr(st.Cond, w)
+	if err != nil {
+		return err
+	}
+	if !labeled {
+		for _, item := range st.Items {
+			if err := g.stmt(item.Body, clocked); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	v := g.temp("sel")
+	g.printf("{\n%s := uint64(%s)\nswitch {\n", v, sel)
+	var fallback *hdl.Stmt
+	for _, item := range st.Items {
+		if item.Labels == nil {
+			fallback = item.Body
+			continue
+		}
+		var tests []string
+		for _, label := range item.Labels {
+			l, _, err := g.expr(label, w)
+			if err != nil {
+				return err
+			}
+			tests = append(tests, fmt.Sprintf("%s == %s", v, l))
+		}
+		g.printf("case %s:\n", join(tests, " || "))
+		if err := g.stmt(item.Body, clocked); err != nil {
+			return err
+		}
+	}
+	if fallback != nil {
+		g.printf("default:\n")
+		if err := g.stmt(fallback, clocked); err != nil {
+			return err
+		}
+	}
+	g.printf("}\n}\n")
+	return nil
+}
+
+// Index expressions of an assignment target, outermost last
+func targetIndices(e *hdl.Expr) []*hdl.Expr {
+	switch e.Kind {
+	case hdl.ExprIndex:
+		return append(targetIndices(e.Args[0]), e)
+	case hdl.ExprSlice:
+		return targetIndices(e.Args[0])
+	case hdl.ExprConcat:
+		var all []*hdl.Expr
+		for _, arg := range e.Args {
+			all = append(all, targetIndices(arg)...)
+		}
+		return all
+	}
+	return nil
+}
+
+func (g *generator) targetWidth(e *hdl.Expr) (int, error) {
+	switch e.Kind {
+	case hdl.ExprIdent:
+		slot, ok := g.s.index[e.Name]
+		if !ok {
+			return 0, fmt.Errorf("undeclared identifier %s", e.Name)
+		}
+		return int(g.s.widths[slot]), nil
+	case hdl.ExprIndex:
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if mem, ok := g.s.mems[base.Name]; ok {
+				return mem.width, nil
+			}
+		}
+		if _, err := g.targetWidth(e.Args[0]); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	case hdl.ExprSlice:
+		if _, err := g.targetWidth(e.Args[0]); err != nil {
+			return 0, err
+		}
+		return e.Hi - e.Lo + 1, nil
+	case hdl.ExprConcat:
+		total := 0
+		for _, arg := range e.Args {
+			w, err := g.targetWidth(arg)
+			if err != nil {
+				return 0, err
+			}
+			total += w
+		}
+		return total, nil
+	}
+	return 0, fmt.Errorf("%s is not assignable", e)
+}
+
+// Assignment, queued for commit when it is nonblocking
+func (g *generator) assign(lhs, rhs *hdl.Expr, nonblock bool) error {
+	w, err := g.targetWidth(lhs)
+	if err != nil {
+		return err
+	}
+	value, _, err := g.expr(rhs, w)
+	if err != nil {
+		return err
+	}
+	indices := targetIndices(lhs)
+	if nonblock {
+		i := len(g.nb)
+		g.nb = append(g.nb, nonblocking{lhs: lhs, indices: indices})
+		for j, idx := range indices {
+			code, _, err := g.expr(idx.Args[1], 0)
+			if err != nil {
+				return err
+			}
+			g.printf("d.nbi%d_%d = %s\n", i, j, code)
+		}
+		g.printf("d.nbv%d = %s\nd.nbf%d = true\n", i, value, i)
+		return nil
+	}
+	g.printf("{\n")
+	for _, idx := range indices {
+		code, _, err := g.expr(idx.Args[1], 0)
+		if err != nil {
+			return err
+		}
+		name := g.temp("i")
+		g.indexNames[idx] = name
+		g.printf("%s := uint64(%s)\n", name, code)
+	}
+	v := g.temp("v")
+	g.printf("%s := uint64(%s)\n", v, value)
+	if err := g.store(lhs, v); err != nil {
+		return err
+	}
+	g.printf("}\n")
+	return nil
+}
+
+// Write value to a target whose indices are already evaluated
+func (g *generator) store(e *hdl.Expr, value string) error {
+	switch e.Kind {
+	case hdl.ExprIdent:
+		g.write(g.s.index[e.Name], value)
+		return nil
+
+	case hdl.ExprIndex:
+		i := g.indexNames[e]
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if mem, ok := g.s.mems[base.Name]; ok {
+				g.printf("if %s < %d {\nd.mem%d[%s] = (%s) & %#x\n}\n", i, len(mem.data), g.mems[base.Name], i, value, mask(mem.width))
+				return nil
+			}
+		}
+		bw, err := g.targetWidth(e.Args[0])
+		if err != nil {
+			return err
+		}
+		old, err := g.load(e.Args[0])
+		if err != nil {
+			return err
+		}
+		g.printf("if %s < %d {\n", i, bw)
+		if err := g.store(e.Args[0], fmt.Sprintf("(%s &^ (1 << %s)) | ((%s & 1) << %s)", old, i, value, i)); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+
+	case hdl.ExprSlice:
+		old, err := g.load(e.Args[0])
+		if err != nil {
+			return err
+		}
+		m := mask(e.Hi - e.Lo + 1)
+		return g.store(e.Args[0], fmt.Sprintf("(%s &^ %#x) | ((%s & %#x) << %d)", old, m<<uint(e.Lo), value, m, e.Lo))
+
+	case hdl.ExprConcat:
+		shift := 0
+		for i := len(e.Args) - 1; i >= 0; i-- {
+			w, err := g.targetWidth(e.Args[i])
+			if err != nil {
+				return err
+			}
+			if err := g.store(e.Args[i], fmt.Sprintf("(%s >> %d & %#x)", value, shift, mask(w))); err != nil {
+				return err
+			}
+			shift += w
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not assignable", e)
+}
+
+// Current value of a target whose indices are already evaluated
+func (g *generator) load(e *hdl.Expr) (string, error) {
+	switch e.Kind {
+	case hdl.ExprIdent:
+		return g.read(g.s.index[e.Name]), nil
+	case hdl.ExprIndex:
+		i := g.indexNames[e]
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if _, ok := g.s.mems[base.Name]; ok {
+				return fmt.Sprintf("load(d.mem%d, %s)", g.mems[base.Name], i), nil
+			}
+		}
+		bw, err := g.targetWidth(e.Args[0])
+		if err != nil {
+			return "", err
+		}
+		old, err := g.load(e.Args[0])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("bit(%s, %s, %d)", old, i, bw), nil
+	case hdl.ExprSlice:
+		old, err := g.load(e.Args[0])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s >> %d & %#x)", old, e.Lo, mask(e.Hi-e.Lo+1)), nil
+	}
+	return "", fmt.Errorf("%s is not assignable", e)
+}
+
+// Go expression for e evaluated in a context of at least ctx bits, with
+// the same widths as the interpreter. Constant subexpressions are folded.
+func (g *generator) expr(e *hdl.Expr, ctx int) (string, int, error) {
+	self, err := g.c.width(e)
+	if err != nil {
+		return "", 0, err
+	}
+	w := self
+	if ctx > w {
+		w = ctx
+	}
+	if w > MaxWidth {
+		return "", 0, fmt.Errorf("%s is %d bits wide, the simulator supports up to %d", e, w, MaxWidth)
+	}
+	m := mask(w)
+	if len(e.Idents()) == 0 {
+		fn, _, err := g.c.expr(e, ctx)
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("%#x", fn()), w, nil
+	}
+
+	switch e.Kind {
+	case hdl.ExprIdent:
+		return g.read(g.s.index[e.Name]), w, nil
+
+	case hdl.ExprIndex:
+		idx, _, err := g.expr(e.Args[1], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if _, ok := g.s.mems[base.Name]; ok {
+				return fmt.Sprintf("load(d.mem%d, %s)", g.mems[base.Name], idx), w, nil
+			}
+		}
+		base, bw, err := g.expr(e.Args[0], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("bit(%s, %s, %d)", base, idx, bw), w, nil
+
+	case hdl.ExprSlice:
+		base, _, err := g.expr(e.Args[0], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("(%s >> %d & %#x)", base, e.Lo, mask(self)), w, nil
+
+	case hdl.ExprUnary:
+		return g.unary(e, w)
+
+	case hdl.ExprBinary:
+		return g.binary(e, w)
+
+	case hdl.ExprTernary:
+		cond, _, err := g.expr(e.Args[0], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		a, _, err := g.expr(e.Args[1], w)
+		if err != nil {
+			return "", 0, err
+		}
+		b, _, err := g.expr(e.Args[2], w)
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("mux(%s, %s, %s)", cond, a, b), w, nil
+
+	case hdl.ExprConcat, hdl.ExprRepeat:
+		var parts []string
+		partWidth := 0
+		for i := len(e.Args) - 1; i >= 0; i-- {
+			code, pw, err := g.expr(e.Args[i], 0)
+			if err != nil {
+				return "", 0, err
+			}
+			if partWidth == 0 {
+				parts = append(parts, code)
+			} else {
+				parts = append(parts, fmt.Sprintf("%s<<%d", code, partWidth))
+			}
+			partWidth += pw
+		}
+		one := "(" + join(parts, " | ") + ")"
+		if e.Kind == hdl.ExprRepeat && e.Count > 1 {
+			return fmt.Sprintf("(rep(%s, %d, %d) & %#x)", one, partWidth, e.Count, m), w, nil
+		}
+		return fmt.Sprintf("(%s & %#x)", one, m), w, nil
+	}
+	return "", 0, fmt.Errorf("unsupported expression %s", e)
+}
+
+func (g *generator) unary(e *hdl.Expr, w int) (string, int, error) {
+	m := mask(w)
+	switch e.Op {
+	case "~", "-", "+":
+		arg, _, err := g.expr(e.Args[0], w)
+		if err != nil {
+			return "", 0, err
+		}
+		switch e.Op {
+		case "~":
+			return fmt.Sprintf("(^%s & %#x)", arg, m), w, nil
+		case "-":
+			return fmt.Sprintf("(-%s & %#x)", arg, m), w, nil
+		}
+		return arg, w, nil
+	}
+	arg, aw, err := g.expr(e.Args[0], 0)
+	if err != nil {
+		return "", 0, err
+	}
+	am := mask(aw)
+	switch e.Op {
+	case "!", "~|":
+		return fmt.Sprintf("b2u(%s == 0)", arg), w, nil
+	case "&":
+		return fmt.Sprintf("b2u(%s == %#x)", arg, am), w, nil
+	case "~&":
+		return fmt.Sprintf("b2u(%s != %#x)", arg, am), w, nil
+	case "|":
+		return fmt.Sprintf("b2u(%s != 0)", arg), w, nil
+	case "^":
+		return fmt.Sprintf("parity(%s)", arg), w, nil
+	case "~^", "^~":
+		return fmt.Sprintf("(parity(%s) ^ 1)", arg), w, nil
+	}
+	return "", 0, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func (g *generator) binary(e *hdl.Expr, w int) (string, int, error) {
+	m := mask(w)
+	switch e.Op {
+	case "==", "!=", "===", "!==", "<", "<=", ">", ">=":
+		// Operands are sized to each other, not to the context
+		ow, err := g.c.maxWidth(e.Args[0], e.Args[1])
+		if err != nil {
+			return "", 0, err
+		}
+		a, _, err := g.expr(e.Args[0], ow)
+		if err != nil {
+			return "", 0, err
+		}
+		b, _, err := g.expr(e.Args[1], ow)
+		if err != nil {
+			return "", 0, err
+		}
+		op := e.Op
+		switch op {
+		case "===":
+			op = "=="
+		case "!==":
+			op = "!="
+		}
+		return fmt.Sprintf("b2u(%s %s %s)", a, op, b), w, nil
+
+	case "&&", "||":
+		a, _, err := g.expr(e.Args[0], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		b, _, err := g.expr(e.Args[1], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("b2u(%s != 0 %s %s != 0)", a, e.Op, b), w, nil
+
+	case "<<", ">>", "<<<", ">>>", "**":
+		a, _, err := g.expr(e.Args[0], w)
+		if err != nil {
+			return "", 0, err
+		}
+		b, _, err := g.expr(e.Args[1], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		switch e.Op {
+		case "<<", "<<<":
+			return fmt.Sprintf("(shl(%s, %s) & %#x)", a, b, m), w, nil
+		case ">>", ">>>":
+			return fmt.Sprintf("shr(%s, %s)", a, b), w, nil
+		}
+		return fmt.Sprintf("(pow(%s, %s) & %#x)", a, b, m), w, nil
+	}
+
+	a, _, err := g.expr(e.Args[0], w)
+	if err != nil {
+		return "", 0, err
+	}
+	b, _, err := g.expr(e.Args[1], w)
+	if err != nil {
+		return "", 0, err
+	}
+	switch e.Op {
+	case "+", "-", "*":
+		return fmt.Sprintf("((%s %s %s) & %#x)", a, e.Op, b, m), w, nil
+	case "/":
+		return fmt.Sprintf("div(%s, %s)", a, b), w, nil
+	case "%":
+		return fmt.Sprintf("mod(%s, %s)", a, b), w, nil
+	case "&", "|", "^":
+		return fmt.Sprintf("(%s %s %s)", a, e.Op, b), w, nil
+	case "~^", "^~":
+		return fmt.Sprintf("(^(%s ^ %s) & %#x)", a, b, m), w, nil
+	}
+	return "", 0, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+// Operators with Verilog semantics the generated code calls
+const helpers = `
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func mux(cond, a, b uint64) uint64 {
+	if cond != 0 {
+		return a
+	}
+	return b
+}
+
+func load(mem []uint64, addr uint64) uint64 {
+	if addr >= uint64(len(mem)) {
+		return 0
+	}
+	return mem[addr]
+}
+
+func bit(v, i uint64, width int) uint64 {
+	if i >= uint64(width) {
+		return 0
+	}
+	return v >> i & 1
+}
+
+func parity(v uint64) uint64 {
+	return uint64(bits.OnesCount64(v) & 1)
+}
+
+func shl(v, n uint64) uint64 {
+	if n >= 64 {
+		return 0
+	}
+	return v << n
+}
+
+func shr(v, n uint64) uint64 {
+	if n >= 64 {
+		return 0
+	}
+	return v >> n
+}
+
+func pow(base, exp uint64) uint64 {
+	result := uint64(1)
+	for ; exp > 0; exp-- {
+		result *= base
+	}
+	return result
+}
+
+func div(a, b uint64) uint64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func mod(a, b uint64) uint64 {
+	if b == 0 {
+		return 0
+	}
+	return a % b
+}
+
+func rep(v uint64, width, count int) uint64 {
+	r := v
+	for i := 1; i < count; i++ {
+		r = r<<uint(width) | v
+	}
+	return r
+}
+`
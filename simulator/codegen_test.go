@@ -0,0 +1,57 @@
+package simulator
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the generated models in internal/simmodels")
+
+// Designs compiled into internal/simmodels
+var generatedModels = []struct {
+	pkg    string
+	design func() *hdl.Module
+}{
+	{"counter", testdesigns.Counter},
+	{"memcase", newMemCase},
+	{"asyncfifo", func() *hdl.Module { m, _, _, _ := newAsyncFIFO(); return m }},
+	{"arbiter", func() *hdl.Module { m, _ := newArbiter(); return m }},
+}
+
+func TestGeneratedModels(t *testing.T) {
+	for _, model := range generatedModels {
+		src, err := Generate(model.design(), model.pkg)
+		if err != nil {
+			t.Fatalf("Generate %s: %v", model.pkg, err)
+		}
+		path := filepath.Join("..", "internal", "simmodels", model.pkg, "model.go")
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, src, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		have, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(have, src) {
+			t.Errorf("%s is out of date, regenerate with go test ./simulator -run TestGeneratedModels -update", path)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	m := core.NewModule("Undeclared")
+	m.AssignExpr(m.Output("y", 1), "missing")
+	if _, err := Generate(m, "undeclared"); err == nil {
+		t.Errorf("Undeclared identifiers should be rejected")
+	}
+}
@@ -0,0 +1,235 @@
+package simulator
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/SoulPancake/HFT/internal/simmodels/arbiter"
+	"github.com/SoulPancake/HFT/internal/simmodels/asyncfifo"
+	"github.com/SoulPancake/HFT/internal/simmodels/counter"
+	"github.com/SoulPancake/HFT/internal/simmodels/memcase"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newCompiled(t testing.TB, m *hdl.Module, e Engine) *Simulator {
+	s, err := NewCompiled(m, e)
+	if err != nil {
+		t.Fatalf("NewCompiled: %v", err)
+	}
+	return s
+}
+
+// Top-level inputs the testbench may drive
+func stimulusInputs(s *Simulator) []string {
+	clocks := map[string]bool{}
+	for _, clk := range s.Clocks() {
+		clocks[clk] = true
+	}
+	var names []string
+	for _, name := range s.Signals() {
+		net := s.Netlist.Nets[name]
+		if net.Scope == "" && net.Kind == "input" && !clocks[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestCompiledMatchesInterpreter(t *testing.T) {
+	models := []struct {
+		design func() *hdl.Module
+		engine func() Engine
+	}{
+		{testdesigns.Counter, func() Engine { return counter.New() }},
+		{newMemCase, func() Engine { return memcase.New() }},
+		{func() *hdl.Module { m, _, _, _ := newAsyncFIFO(); return m }, func() Engine { return asyncfifo.New() }},
+		{func() *hdl.Module { m, _ := newArbiter(); return m }, func() Engine { return arbiter.New() }},
+	}
+	for _, model := range models {
+		m := model.design()
+		interp := newSim(t, m)
+		compiled := newCompiled(t, m, model.engine())
+		inputs := stimulusInputs(interp)
+		rng := rand.New(rand.NewSource(1))
+		for step := 0; step < 2000; step++ {
+			// Keep resets mostly released so the logic does something
+			for _, in := range inputs {
+				v := rng.Uint64()
+				if step > 4 && (in == "rst" || in == "wr_rst" || in == "rd_rst") {
+					v = b2u(rng.Intn(50) == 0)
+				}
+				interp.Poke(in, v)
+				compiled.Poke(in, v)
+			}
+			interp.Step()
+			compiled.Step()
+			for _, name := range interp.Signals() {
+				if a, b := interp.Peek(name), compiled.Peek(name); a != b {
+					t.Fatalf("%s step %d (%d ps): %s = %#x interpreted, %#x compiled", m.Name, step, interp.Time(), name, a, b)
+				}
+			}
+		}
+		for name, mem := range interp.mems {
+			for addr := range mem.data {
+				if a, b := interp.PeekMem(name, addr), compiled.PeekMem(name, addr); a != b {
+					t.Errorf("%s: %s[%d] = %#x interpreted, %#x compiled", m.Name, name, addr, a, b)
+				}
+			}
+		}
+	}
+}
+
+func TestCompiledModelMismatch(t *testing.T) {
+	if _, err := NewCompiled(newMemCase(), counter.New()); err == nil {
+		t.Errorf("A model generated from another design should be rejected")
+	}
+	m := testdesigns.Counter()
+	m.Input("extra", 1)
+	if _, err := NewCompiled(m, counter.New()); err == nil {
+		t.Errorf("A model generated before the design changed should be rejected")
+	}
+}
+
+func TestCompiledCycleMatchesInterpreter(t *testing.T) {
+	models := []struct {
+		design func() *hdl.Module
+		engine func() Engine
+	}{
+		{testdesigns.Counter, func() Engine { return counter.New() }},
+		{func() *hdl.Module { m, _, _, _ := newAsyncFIFO(); return m }, func() Engine { return asyncfifo.New() }},
+	}
+	for _, model := range models {
+		m := model.design()
+		interp := newSim(t, m)
+		compiled := newCompiled(t, m, model.engine())
+		if compiled.clocked == nil {
+			t.Fatalf("%s: the generated model should step its own clocks", m.Name)
+		}
+		inputs := stimulusInputs(interp)
+		clocks := interp.Clocks()
+		rng := rand.New(rand.NewSource(1))
+		for step := 0; step < 500; step++ {
+			for _, in := range inputs {
+				v := rng.Uint64()
+				if step > 4 && (in == "rst" || in == "wr_rst" || in == "rd_rst") {
+					v = 0
+				}
+				interp.Poke(in, v)
+				compiled.Poke(in, v)
+			}
+			n := rng.Intn(5)
+			if cd := interp.Netlist.ClockDomainOf(clocks[rng.Intn(len(clocks))]); cd != nil {
+				interp.CycleDomain(cd, n)
+				compiled.CycleDomain(cd, n)
+			} else {
+				interp.Cycle(n)
+				compiled.Cycle(n)
+			}
+			if interp.Time() != compiled.Time() {
+				t.Fatalf("%s step %d: time %d interpreted, %d compiled", m.Name, step, interp.Time(), compiled.Time())
+			}
+			for _, name := range interp.Signals() {
+				if a, b := interp.Peek(name), compiled.Peek(name); a != b {
+					t.Fatalf("%s step %d (%d ps): %s = %#x interpreted, %#x compiled", m.Name, step, interp.Time(), name, a, b)
+				}
+			}
+		}
+	}
+
+	// Observers see every edge, so the model does not run the clocks
+	s := newCompiled(t, testdesigns.Counter(), counter.New())
+	s.Poke("en", 1)
+	edges := 0
+	s.Observe(func() { edges++ })
+	s.Cycle(3)
+	if edges != 6 || s.Peek("count") != 3 {
+		t.Errorf("Observer called %d times over 3 cycles, count %d, want 6 and 3", edges, s.Peek("count"))
+	}
+}
+
+func TestCompiledModelClockMismatch(t *testing.T) {
+	m, _, _, rd := newAsyncFIFO()
+	rd.SetFrequency(50000000)
+	if _, err := NewCompiled(m, asyncfifo.New()); err == nil {
+		t.Errorf("A model generated for another clock frequency should be rejected")
+	}
+}
+
+func benchmarkCounter(b *testing.B, s *Simulator) {
+	s.Poke("en", 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Cycle(1)
+	}
+}
+
+func BenchmarkCounterInterpreted(b *testing.B) {
+	s, err := New(testdesigns.Counter())
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkCounter(b, s)
+}
+
+func BenchmarkCounterCompiled(b *testing.B) {
+	benchmarkCounter(b, newCompiled(b, testdesigns.Counter(), counter.New()))
+}
+
+func BenchmarkFIFOInterpreted(b *testing.B) {
+	m, _, _, _ := newAsyncFIFO()
+	s, err := New(m)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkFIFO(b, s)
+}
+
+func BenchmarkFIFOCompiled(b *testing.B) {
+	m, _, _, _ := newAsyncFIFO()
+	benchmarkFIFO(b, newCompiled(b, m, asyncfifo.New()))
+}
+
+func benchmarkFIFO(b *testing.B, s *Simulator) {
+	inputs := stimulusInputs(s)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, in := range inputs {
+			s.Poke(in, uint64(i>>j)&1)
+		}
+		s.Step()
+	}
+}
+
+// One long run with the inputs held, where a compiled model steps its own
+// clocks: ns/op is the time per cycle
+func benchmarkRun(b *testing.B, s *Simulator, inputs map[string]uint64) {
+	for name, v := range inputs {
+		s.Poke(name, v)
+	}
+	s.Cycle(1)
+	b.ResetTimer()
+	s.Cycle(b.N)
+}
+
+func BenchmarkCounterRunInterpreted(b *testing.B) {
+	benchmarkRun(b, newSim(b, testdesigns.Counter()), map[string]uint64{"en": 1})
+}
+
+func BenchmarkCounterRunCompiled(b *testing.B) {
+	benchmarkRun(b, newCompiled(b, testdesigns.Counter(), counter.New()), map[string]uint64{"en": 1})
+}
+
+func fifoRunInputs(ports *hdl.AsyncFIFOPorts) map[string]uint64 {
+	return map[string]uint64{ports.WrEn.Name: 1, ports.RdEn.Name: 1, ports.WrData.Name: 0x5a}
+}
+
+func BenchmarkFIFORunInterpreted(b *testing.B) {
+	m, ports, _, _ := newAsyncFIFO()
+	benchmarkRun(b, newSim(b, m), fifoRunInputs(ports))
+}
+
+func BenchmarkFIFORunCompiled(b *testing.B) {
+	m, ports, _, _ := newAsyncFIFO()
+	benchmarkRun(b, newCompiled(b, m, asyncfifo.New()), fifoRunInputs(ports))
+}
@@ -0,0 +1,612 @@
+package simulator
+
+import (
+	"fmt"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Expressions and statements are compiled once into closures over the
+// simulator's value slots. Values are unsigned and at most 64 bits wide;
+// widths follow Verilog: arithmetic and bitwise operands are extended to
+// the width of their context, comparisons and reductions are one bit.
+
+type evalFn func() uint64
+type execFn func()
+
+// Read and write access to an assignment target
+type access struct {
+	read  func() uint64
+	write func(uint64)
+}
+
+type compiler struct {
+	s     *Simulator
+	check *check        // property whose condition is compiled, for $past and friends
+	proc  *hdl.Process // always block whose statements are compiled, for branch coverage
+}
+
+func mask(width int) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << uint(width)) - 1
+}
+
+// Self-determined width of an expression
+func (c *compiler) width(e *hdl.Expr) (int, error) {
+	return c.s.Netlist.ExprWidth(e)
+}
+
+func (c *compiler) maxWidth(a, b *hdl.Expr) (int, error) {
+	return c.s.Netlist.MaxExprWidth(a, b)
+}
+
+// Compile an expression evaluated in a context of at least ctx bits. The
+// result is masked to the returned width.
+func (c *compiler) expr(e *hdl.Expr, ctx int) (evalFn, int, error) {
+	self, err := c.width(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	w := self
+	if ctx > w {
+		w = ctx
+	}
+	if w > MaxWidth {
+		return nil, 0, fmt.Errorf("%s is %d bits wide, the simulator supports up to %d", e, w, MaxWidth)
+	}
+	m := mask(w)
+	values := c.s.values
+
+	switch e.Kind {
+	case hdl.ExprIdent:
+		slot := c.s.index[e.Name]
+		return func() uint64 { return values[slot] }, w, nil
+
+	case hdl.ExprConst:
+		v := e.Value & m
+		return func() uint64 { return v }, w, nil
+
+	case hdl.ExprIndex:
+		idx, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if mem, ok := c.s.mems[base.Name]; ok {
+				return func() uint64 {
+					addr := idx()
+					if addr >= uint64(len(mem.data)) {
+						return 0
+					}
+					return mem.data[addr]
+				}, w, nil
+			}
+		}
+		base, bw, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() uint64 {
+			i := idx()
+			if i >= uint64(bw) {
+				return 0
+			}
+			return base() >> i & 1
+		}, w, nil
+
+	case hdl.ExprSlice:
+		base, _, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		lo, sm := uint(e.Lo), mask(self)
+		return func() uint64 { return base() >> lo & sm }, w, nil
+
+	case hdl.ExprUnary:
+		return c.unary(e, w)
+
+	case hdl.ExprBinary:
+		return c.binary(e, w)
+
+	case hdl.ExprTernary:
+		cond, _, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		a, _, err := c.expr(e.Args[1], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[2], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() uint64 {
+			if cond() != 0 {
+				return a()
+			}
+			return b()
+		}, w, nil
+
+	case hdl.ExprConcat, hdl.ExprRepeat:
+		parts := make([]evalFn, len(e.Args))
+		shifts := make([]uint, len(e.Args))
+		partWidth := 0
+		for i := len(e.Args) - 1; i >= 0; i-- {
+			fn, pw, err := c.expr(e.Args[i], 0)
+			if err != nil {
+				return nil, 0, err
+			}
+			parts[i], shifts[i] = fn, uint(partWidth)
+			partWidth += pw
+		}
+		count := 1
+		if e.Kind == hdl.ExprRepeat {
+			count = e.Count
+		}
+		return func() uint64 {
+			var one uint64
+			for i, part := range parts {
+				one |= part() << shifts[i]
+			}
+			v := one
+			for r := 1; r < count; r++ {
+				v = v<<uint(partWidth) | one
+			}
+			return v & m
+		}, w, nil
+
+	case hdl.ExprCall:
+		f, err := c.call(e, func(arg *hdl.Expr) (eval4Fn, int, error) {
+			fn, aw, err := c.expr(arg, 0)
+			if err != nil {
+				return nil, 0, err
+			}
+			return func() (uint64, uint64) { return fn(), 0 }, aw, nil
+		}, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() uint64 {
+			v, _ := f()
+			return v & m
+		}, w, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported expression %s", e)
+}
+
+func (c *compiler) unary(e *hdl.Expr, w int) (evalFn, int, error) {
+	m := mask(w)
+	switch e.Op {
+	case "~", "-", "+":
+		arg, _, err := c.expr(e.Args[0], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch e.Op {
+		case "~":
+			return func() uint64 { return ^arg() & m }, w, nil
+		case "-":
+			return func() uint64 { return -arg() & m }, w, nil
+		}
+		return arg, w, nil
+	}
+	arg, aw, err := c.expr(e.Args[0], 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	am := mask(aw)
+	var fn evalFn
+	switch e.Op {
+	case "!":
+		fn = func() uint64 { return b2u(arg() == 0) }
+	case "&":
+		fn = func() uint64 { return b2u(arg() == am) }
+	case "~&":
+		fn = func() uint64 { return b2u(arg() != am) }
+	case "|":
+		fn = func() uint64 { return b2u(arg() != 0) }
+	case "~|":
+		fn = func() uint64 { return b2u(arg() == 0) }
+	case "^":
+		fn = func() uint64 { return parity(arg()) }
+	case "~^", "^~":
+		fn = func() uint64 { return parity(arg()) ^ 1 }
+	default:
+		return nil, 0, fmt.Errorf("unsupported operator %s", e.Op)
+	}
+	return fn, w, nil
+}
+
+func (c *compiler) binary(e *hdl.Expr, w int) (evalFn, int, error) {
+	m := mask(w)
+	switch e.Op {
+	case "==", "!=", "===", "!==", "<", "<=", ">", ">=":
+		// Operands are sized to each other, not to the context
+		ow, err := c.maxWidth(e.Args[0], e.Args[1])
+		if err != nil {
+			return nil, 0, err
+		}
+		a, _, err := c.expr(e.Args[0], ow)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[1], ow)
+		if err != nil {
+			return nil, 0, err
+		}
+		var fn evalFn
+		switch e.Op {
+		case "==", "===":
+			fn = func() uint64 { return b2u(a() == b()) }
+		case "!=", "!==":
+			fn = func() uint64 { return b2u(a() != b()) }
+		case "<":
+			fn = func() uint64 { return b2u(a() < b()) }
+		case "<=":
+			fn = func() uint64 { return b2u(a() <= b()) }
+		case ">":
+			fn = func() uint64 { return b2u(a() > b()) }
+		default:
+			fn = func() uint64 { return b2u(a() >= b()) }
+		}
+		return fn, w, nil
+
+	case "&&", "||":
+		a, _, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if e.Op == "&&" {
+			return func() uint64 { return b2u(a() != 0 && b() != 0) }, w, nil
+		}
+		return func() uint64 { return b2u(a() != 0 || b() != 0) }, w, nil
+
+	case "<<", ">>", "<<<", ">>>", "**":
+		a, _, err := c.expr(e.Args[0], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch e.Op {
+		case "<<", "<<<":
+			return func() uint64 { return shiftLeft(a(), b()) & m }, w, nil
+		case ">>", ">>>":
+			return func() uint64 { return shiftRight(a(), b()) }, w, nil
+		}
+		return func() uint64 { return power(a(), b()) & m }, w, nil
+	}
+
+	a, _, err := c.expr(e.Args[0], w)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, _, err := c.expr(e.Args[1], w)
+	if err != nil {
+		return nil, 0, err
+	}
+	var fn evalFn
+	switch e.Op {
+	case "+":
+		fn = func() uint64 { return (a() + b()) & m }
+	case "-":
+		fn = func() uint64 { return (a() - b()) & m }
+	case "*":
+		fn = func() uint64 { return (a() * b()) & m }
+	case "/":
+		fn = func() uint64 {
+			d := b()
+			if d == 0 {
+				return 0
+			}
+			return a() / d
+		}
+	case "%":
+		fn = func() uint64 {
+			d := b()
+			if d == 0 {
+				return 0
+			}
+			return a() % d
+		}
+	case "&":
+		fn = func() uint64 { return a() & b() }
+	case "|":
+		fn = func() uint64 { return a() | b() }
+	case "^":
+		fn = func() uint64 { return a() ^ b() }
+	case "~^", "^~":
+		fn = func() uint64 { return ^(a() ^ b()) & m }
+	default:
+		return nil, 0, fmt.Errorf("unsupported operator %s", e.Op)
+	}
+	return fn, w, nil
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func parity(v uint64) uint64 {
+	v ^= v >> 32
+	v ^= v >> 16
+	v ^= v >> 8
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return v & 1
+}
+
+func shiftLeft(v, n uint64) uint64 {
+	if n >= 64 {
+		return 0
+	}
+	return v << n
+}
+
+func shiftRight(v, n uint64) uint64 {
+	if n >= 64 {
+		return 0
+	}
+	return v >> n
+}
+
+func power(base, exp uint64) uint64 {
+	result := uint64(1)
+	for ; exp > 0; exp-- {
+		result *= base
+	}
+	return result
+}
+
+// Compile an assignment target. Index expressions are evaluated by bind
+// when the assignment executes.
+func (c *compiler) lvalue(e *hdl.Expr) (bind func() access, width int, err error) {
+	switch e.Kind {
+	case hdl.ExprIdent:
+		slot, ok := c.s.index[e.Name]
+		if !ok {
+			return nil, 0, fmt.Errorf("undeclared identifier %s", e.Name)
+		}
+		w := int(c.s.widths[slot])
+		m := mask(w)
+		values := c.s.values
+		a := access{
+			read:  func() uint64 { return values[slot] },
+			write: func(v uint64) { values[slot] = v & m },
+		}
+		return func() access { return a }, w, nil
+
+	case hdl.ExprIndex:
+		idx, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if mem, ok := c.s.mems[base.Name]; ok {
+				m := mask(mem.width)
+				return func() access {
+					addr := idx()
+					if addr >= uint64(len(mem.data)) {
+						return access{read: func() uint64 { return 0 }, write: func(uint64) {}}
+					}
+					return access{
+						read:  func() uint64 { return mem.data[addr] },
+						write: func(v uint64) { mem.data[addr] = v & m },
+					}
+				}, mem.width, nil
+			}
+		}
+		base, bw, err := c.lvalue(e.Args[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() access {
+			b, i := base(), idx()
+			if i >= uint64(bw) {
+				return access{read: func() uint64 { return 0 }, write: func(uint64) {}}
+			}
+			return access{
+				read:  func() uint64 { return b.read() >> i & 1 },
+				write: func(v uint64) { b.write(b.read()&^(1<<i) | (v&1)<<i) },
+			}
+		}, 1, nil
+
+	case hdl.ExprSlice:
+		base, _, err := c.lvalue(e.Args[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		w := e.Hi - e.Lo + 1
+		lo, m := uint(e.Lo), mask(w)
+		return func() access {
+			b := base()
+			return access{
+				read:  func() uint64 { return b.read() >> lo & m },
+				write: func(v uint64) { b.write(b.read()&^(m<<lo) | (v&m)<<lo) },
+			}
+		}, w, nil
+
+	case hdl.ExprConcat:
+		parts := make([]func() access, len(e.Args))
+		widths := make([]int, len(e.Args))
+		total := 0
+		for i, arg := range e.Args {
+			bind, w, err := c.lvalue(arg)
+			if err != nil {
+				return nil, 0, err
+			}
+			parts[i], widths[i] = bind, w
+			total += w
+		}
+		return func() access {
+			bound := make([]access, len(parts))
+			for i, part := range parts {
+				bound[i] = part()
+			}
+			return access{
+				read: func() uint64 {
+					var v uint64
+					for i, b := range bound {
+						v = v<<uint(widths[i]) | b.read()
+					}
+					return v
+				},
+				write: func(v uint64) {
+					shift := uint(0)
+					for i := len(bound) - 1; i >= 0; i-- {
+						bound[i].write(v >> shift & mask(widths[i]))
+						shift += uint(widths[i])
+					}
+				},
+			}
+		}, total, nil
+	}
+	return nil, 0, fmt.Errorf("%s is not assignable", e)
+}
+
+// Compile a statement. Nonblocking assignments in clocked processes are
+// queued and applied after every triggered process has run.
+func (c *compiler) stmt(st *hdl.Stmt, clocked bool) (execFn, error) {
+	if st == nil {
+		return func() {}, nil
+	}
+	switch st.Kind {
+	case hdl.StmtBlock:
+		body := make([]execFn, len(st.Body))
+		for i, b := range st.Body {
+			fn, err := c.stmt(b, clocked)
+			if err != nil {
+				return nil, err
+			}
+			body[i] = fn
+		}
+		return func() {
+			for _, fn := range body {
+				fn()
+			}
+		}, nil
+
+	case hdl.StmtIf:
+		cond, _, err := c.expr(st.Cond, 0)
+		if err != nil {
+			return nil, err
+		}
+		hits := c.branch(st).Hits
+		then, err := c.stmt(st.Then, clocked)
+		if err != nil {
+			return nil, err
+		}
+		els, err := c.stmt(st.Else, clocked)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			if cond() != 0 {
+				hits[0]++
+				then()
+			} else {
+				hits[1]++
+				els()
+			}
+		}, nil
+
+	case hdl.StmtCase:
+		return c.caseStmt(st, clocked)
+
+	case hdl.StmtBlocking, hdl.StmtNonblocking:
+		bind, w, err := c.lvalue(st.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, _, err := c.expr(st.RHS, w)
+		if err != nil {
+			return nil, err
+		}
+		if st.Kind == hdl.StmtNonblocking && clocked {
+			s := c.s
+			return func() {
+				target, v := bind(), rhs()
+				s.pending = append(s.pending, func() { target.write(v) })
+			}, nil
+		}
+		return func() { bind().write(rhs()) }, nil
+	}
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+func (c *compiler) caseStmt(st *hdl.Stmt, clocked bool) (execFn, error) {
+	// Selector and labels are sized to each other like an equality
+	w, err := c.width(st.Cond)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range st.Items {
+		for _, label := range item.Labels {
+			lw, err := c.width(label)
+			if err != nil {
+				return nil, err
+			}
+			if lw > w {
+				w = lw
+			}
+		}
+	}
+	sel, _, err := c.expr(st.Cond, w)
+	if err != nil {
+		return nil, err
+	}
+	type branch struct {
+		labels []evalFn
+		body   execFn
+		arm    int
+	}
+	var branches []branch
+	fallback := execFn(func() {})
+	hits := c.branch(st).Hits
+	fallbackArm := len(hits) - 1
+	for i, item := range st.Items {
+		body, err := c.stmt(item.Body, clocked)
+		if err != nil {
+			return nil, err
+		}
+		if item.Labels == nil {
+			fallback, fallbackArm = body, i
+			continue
+		}
+		b := branch{body: body, arm: i}
+		for _, label := range item.Labels {
+			fn, _, err := c.expr(label, w)
+			if err != nil {
+				return nil, err
+			}
+			b.labels = append(b.labels, fn)
+		}
+		branches = append(branches, b)
+	}
+	return func() {
+		v := sel()
+		for _, b := range branches {
+			for _, label := range b.labels {
+				if label() == v {
+					hits[b.arm]++
+					b.body()
+					return
+				}
+			}
+		}
+		hits[fallbackArm]++
+		fallback()
+	}, nil
+}
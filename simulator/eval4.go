@@ -0,0 +1,732 @@
+package simulator
+
+import (
+	"fmt"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Four-state evaluation, used by NewFourState. Every value carries a mask
+// of unknown bits next to its value bits; an unknown bit is x when its
+// value bit is 1 and z when it is 0. Operators follow Verilog: bitwise
+// operators resolve bits a known operand decides, arithmetic and relational
+// operators go entirely x on any unknown input, and z reads as x everywhere
+// except when copied unchanged.
+
+type eval4Fn func() (value, unknown uint64)
+
+type access4 struct {
+	read  func() (uint64, uint64)
+	write func(value, unknown uint64)
+}
+
+type compiler4 struct {
+	*compiler
+}
+
+func allX(m uint64) (uint64, uint64) {
+	return m, m
+}
+
+// Truth value of a condition: 1, 0 or x
+func truth(v, u uint64) (uint64, uint64) {
+	switch {
+	case v&^u != 0:
+		return 1, 0
+	case u == 0:
+		return 0, 0
+	}
+	return 1, 1
+}
+
+func not4(v, u uint64) (uint64, uint64) {
+	if u != 0 {
+		return 1, 1
+	}
+	return v ^ 1, 0
+}
+
+func (c *compiler4) expr(e *hdl.Expr, ctx int) (eval4Fn, int, error) {
+	self, err := c.width(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	w := self
+	if ctx > w {
+		w = ctx
+	}
+	if w > MaxWidth {
+		return nil, 0, fmt.Errorf("%s is %d bits wide, the simulator supports up to %d", e, w, MaxWidth)
+	}
+	m := mask(w)
+	values, unknown := c.s.values, c.s.unknown
+
+	switch e.Kind {
+	case hdl.ExprIdent:
+		slot := c.s.index[e.Name]
+		return func() (uint64, uint64) { return values[slot], unknown[slot] }, w, nil
+
+	case hdl.ExprConst:
+		v, u := (e.Value|e.XMask&^e.ZMask)&m, e.XMask&m
+		return func() (uint64, uint64) { return v, u }, w, nil
+
+	case hdl.ExprIndex:
+		idx, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if mem, ok := c.s.mems[base.Name]; ok {
+				wm := mask(mem.width)
+				return func() (uint64, uint64) {
+					addr, au := idx()
+					if au != 0 || addr >= uint64(len(mem.data)) {
+						return allX(wm)
+					}
+					return mem.data[addr], mem.unknown[addr]
+				}, w, nil
+			}
+		}
+		base, bw, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() (uint64, uint64) {
+			i, iu := idx()
+			if iu != 0 || i >= uint64(bw) {
+				return 1, 1
+			}
+			v, u := base()
+			return v >> i & 1, u >> i & 1
+		}, w, nil
+
+	case hdl.ExprSlice:
+		base, _, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		lo, sm := uint(e.Lo), mask(self)
+		return func() (uint64, uint64) {
+			v, u := base()
+			return v >> lo & sm, u >> lo & sm
+		}, w, nil
+
+	case hdl.ExprUnary:
+		return c.unary(e, w)
+
+	case hdl.ExprBinary:
+		return c.binary(e, w)
+
+	case hdl.ExprTernary:
+		cond, _, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		a, _, err := c.expr(e.Args[1], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[2], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() (uint64, uint64) {
+			t, tu := truth(cond())
+			switch {
+			case tu != 0:
+				// Bits both branches agree on stay known
+				av, au := a()
+				bv, bu := b()
+				diff := (av ^ bv) | au | bu
+				return av&^diff | diff, diff
+			case t != 0:
+				return a()
+			}
+			return b()
+		}, w, nil
+
+	case hdl.ExprConcat, hdl.ExprRepeat:
+		parts := make([]eval4Fn, len(e.Args))
+		shifts := make([]uint, len(e.Args))
+		partWidth := 0
+		for i := len(e.Args) - 1; i >= 0; i-- {
+			fn, pw, err := c.expr(e.Args[i], 0)
+			if err != nil {
+				return nil, 0, err
+			}
+			parts[i], shifts[i] = fn, uint(partWidth)
+			partWidth += pw
+		}
+		count := 1
+		if e.Kind == hdl.ExprRepeat {
+			count = e.Count
+		}
+		return func() (uint64, uint64) {
+			var one, oneU uint64
+			for i, part := range parts {
+				v, u := part()
+				one |= v << shifts[i]
+				oneU |= u << shifts[i]
+			}
+			v, u := one, oneU
+			for r := 1; r < count; r++ {
+				v = v<<uint(partWidth) | one
+				u = u<<uint(partWidth) | oneU
+			}
+			return v & m, u & m
+		}, w, nil
+
+	case hdl.ExprCall:
+		f, err := c.call(e, func(arg *hdl.Expr) (eval4Fn, int, error) { return c.expr(arg, 0) }, true)
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() (uint64, uint64) {
+			v, u := f()
+			return v & m, u & m
+		}, w, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported expression %s", e)
+}
+
+func (c *compiler4) unary(e *hdl.Expr, w int) (eval4Fn, int, error) {
+	m := mask(w)
+	switch e.Op {
+	case "~", "-", "+":
+		arg, _, err := c.expr(e.Args[0], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch e.Op {
+		case "~":
+			return func() (uint64, uint64) {
+				v, u := arg()
+				return (^v | u) & m, u
+			}, w, nil
+		case "-":
+			return func() (uint64, uint64) {
+				v, u := arg()
+				if u != 0 {
+					return allX(m)
+				}
+				return -v & m, 0
+			}, w, nil
+		}
+		return arg, w, nil
+	}
+	arg, aw, err := c.expr(e.Args[0], 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	am := mask(aw)
+	and := func() (uint64, uint64) {
+		v, u := arg()
+		switch {
+		case ^(v|u)&am != 0:
+			return 0, 0
+		case u == 0:
+			return 1, 0
+		}
+		return 1, 1
+	}
+	or := func() (uint64, uint64) { return truth(arg()) }
+	xor := func() (uint64, uint64) {
+		v, u := arg()
+		if u != 0 {
+			return 1, 1
+		}
+		return parity(v), 0
+	}
+	switch e.Op {
+	case "&":
+		return and, w, nil
+	case "|":
+		return or, w, nil
+	case "^":
+		return xor, w, nil
+	case "~&":
+		return func() (uint64, uint64) { return not4(and()) }, w, nil
+	case "!", "~|":
+		return func() (uint64, uint64) { return not4(or()) }, w, nil
+	case "~^", "^~":
+		return func() (uint64, uint64) { return not4(xor()) }, w, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func (c *compiler4) binary(e *hdl.Expr, w int) (eval4Fn, int, error) {
+	m := mask(w)
+	switch e.Op {
+	case "==", "!=", "===", "!==", "<", "<=", ">", ">=":
+		// Operands are sized to each other, not to the context
+		ow, err := c.maxWidth(e.Args[0], e.Args[1])
+		if err != nil {
+			return nil, 0, err
+		}
+		a, _, err := c.expr(e.Args[0], ow)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[1], ow)
+		if err != nil {
+			return nil, 0, err
+		}
+		eq := func() (uint64, uint64) {
+			av, au := a()
+			bv, bu := b()
+			switch {
+			case (av^bv)&^(au|bu) != 0:
+				return 0, 0
+			case au|bu != 0:
+				return 1, 1
+			}
+			return 1, 0
+		}
+		var cmp func(x, y uint64) bool
+		switch e.Op {
+		case "==":
+			return eq, w, nil
+		case "!=":
+			return func() (uint64, uint64) { return not4(eq()) }, w, nil
+		case "===", "!==":
+			want := e.Op == "==="
+			return func() (uint64, uint64) {
+				av, au := a()
+				bv, bu := b()
+				return b2u((av == bv && au == bu) == want), 0
+			}, w, nil
+		case "<":
+			cmp = func(x, y uint64) bool { return x < y }
+		case "<=":
+			cmp = func(x, y uint64) bool { return x <= y }
+		case ">":
+			cmp = func(x, y uint64) bool { return x > y }
+		default:
+			cmp = func(x, y uint64) bool { return x >= y }
+		}
+		return func() (uint64, uint64) {
+			av, au := a()
+			bv, bu := b()
+			if au|bu != 0 {
+				return 1, 1
+			}
+			return b2u(cmp(av, bv)), 0
+		}, w, nil
+
+	case "&&", "||":
+		a, _, err := c.expr(e.Args[0], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		// The known value that decides the result on its own
+		decides := uint64(0)
+		if e.Op == "||" {
+			decides = 1
+		}
+		return func() (uint64, uint64) {
+			av, au := truth(a())
+			bv, bu := truth(b())
+			switch {
+			case au == 0 && av == decides, bu == 0 && bv == decides:
+				return decides, 0
+			case au|bu != 0:
+				return 1, 1
+			}
+			return decides ^ 1, 0
+		}, w, nil
+
+	case "<<", ">>", "<<<", ">>>", "**":
+		a, _, err := c.expr(e.Args[0], w)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		left := e.Op == "<<" || e.Op == "<<<"
+		pow := e.Op == "**"
+		return func() (uint64, uint64) {
+			av, au := a()
+			n, nu := b()
+			switch {
+			case nu != 0, pow && au != 0:
+				return allX(m)
+			case pow:
+				return power(av, n) & m, 0
+			case left:
+				return shiftLeft(av, n) & m, shiftLeft(au, n) & m
+			}
+			return shiftRight(av, n), shiftRight(au, n)
+		}, w, nil
+	}
+
+	a, _, err := c.expr(e.Args[0], w)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, _, err := c.expr(e.Args[1], w)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch e.Op {
+	case "&":
+		return func() (uint64, uint64) {
+			av, au := a()
+			bv, bu := b()
+			zero := ^(av | au) | ^(bv | bu)
+			u := (au | bu) &^ zero & m
+			return (av & bv) | u, u
+		}, w, nil
+	case "|":
+		return func() (uint64, uint64) {
+			av, au := a()
+			bv, bu := b()
+			one := av&^au | bv&^bu
+			u := (au | bu) &^ one & m
+			return (av|bv)&m | u, u
+		}, w, nil
+	case "^", "~^", "^~":
+		invert := uint64(0)
+		if e.Op != "^" {
+			invert = m
+		}
+		return func() (uint64, uint64) {
+			av, au := a()
+			bv, bu := b()
+			u := au | bu
+			return (av^bv^invert)&m | u, u
+		}, w, nil
+	}
+	var fn func(x, y uint64) (uint64, bool)
+	switch e.Op {
+	case "+":
+		fn = func(x, y uint64) (uint64, bool) { return x + y, true }
+	case "-":
+		fn = func(x, y uint64) (uint64, bool) { return x - y, true }
+	case "*":
+		fn = func(x, y uint64) (uint64, bool) { return x * y, true }
+	case "/":
+		fn = func(x, y uint64) (uint64, bool) {
+			if y == 0 {
+				return 0, false
+			}
+			return x / y, true
+		}
+	case "%":
+		fn = func(x, y uint64) (uint64, bool) {
+			if y == 0 {
+				return 0, false
+			}
+			return x % y, true
+		}
+	default:
+		return nil, 0, fmt.Errorf("unsupported operator %s", e.Op)
+	}
+	return func() (uint64, uint64) {
+		av, au := a()
+		bv, bu := b()
+		if au|bu != 0 {
+			return allX(m)
+		}
+		// Division by zero is x
+		v, ok := fn(av, bv)
+		if !ok {
+			return allX(m)
+		}
+		return v & m, 0
+	}, w, nil
+}
+
+// Compile an assignment target. A target whose index is unknown or out of
+// range is not written.
+func (c *compiler4) lvalue(e *hdl.Expr) (bind func() access4, width int, err error) {
+	discard := access4{
+		read:  func() (uint64, uint64) { return 1, 1 },
+		write: func(uint64, uint64) {},
+	}
+	switch e.Kind {
+	case hdl.ExprIdent:
+		slot, ok := c.s.index[e.Name]
+		if !ok {
+			return nil, 0, fmt.Errorf("undeclared identifier %s", e.Name)
+		}
+		w := int(c.s.widths[slot])
+		m := mask(w)
+		values, unknown := c.s.values, c.s.unknown
+		a := access4{
+			read: func() (uint64, uint64) { return values[slot], unknown[slot] },
+			write: func(v, u uint64) {
+				values[slot] = v & m
+				unknown[slot] = u & m
+			},
+		}
+		return func() access4 { return a }, w, nil
+
+	case hdl.ExprIndex:
+		idx, _, err := c.expr(e.Args[1], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		text := e.String()
+		if base := e.Args[0]; base.Kind == hdl.ExprIdent {
+			if mem, ok := c.s.mems[base.Name]; ok {
+				m := mask(mem.width)
+				return func() access4 {
+					addr, au := idx()
+					if au != 0 {
+						c.s.controlX("address", text)
+						return discard
+					}
+					if addr >= uint64(len(mem.data)) {
+						return discard
+					}
+					return access4{
+						read: func() (uint64, uint64) { return mem.data[addr], mem.unknown[addr] },
+						write: func(v, u uint64) {
+							mem.data[addr] = v & m
+							mem.unknown[addr] = u & m
+						},
+					}
+				}, mem.width, nil
+			}
+		}
+		base, bw, err := c.lvalue(e.Args[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		return func() access4 {
+			b := base()
+			i, iu := idx()
+			if iu != 0 {
+				c.s.controlX("index", text)
+				return discard
+			}
+			if i >= uint64(bw) {
+				return discard
+			}
+			return access4{
+				read: func() (uint64, uint64) {
+					v, u := b.read()
+					return v >> i & 1, u >> i & 1
+				},
+				write: func(v, u uint64) {
+					bv, bu := b.read()
+					b.write(bv&^(1<<i)|(v&1)<<i, bu&^(1<<i)|(u&1)<<i)
+				},
+			}
+		}, 1, nil
+
+	case hdl.ExprSlice:
+		base, _, err := c.lvalue(e.Args[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		w := e.Hi - e.Lo + 1
+		lo, m := uint(e.Lo), mask(w)
+		return func() access4 {
+			b := base()
+			return access4{
+				read: func() (uint64, uint64) {
+					v, u := b.read()
+					return v >> lo & m, u >> lo & m
+				},
+				write: func(v, u uint64) {
+					bv, bu := b.read()
+					b.write(bv&^(m<<lo)|(v&m)<<lo, bu&^(m<<lo)|(u&m)<<lo)
+				},
+			}
+		}, w, nil
+
+	case hdl.ExprConcat:
+		parts := make([]func() access4, len(e.Args))
+		widths := make([]int, len(e.Args))
+		total := 0
+		for i, arg := range e.Args {
+			bind, w, err := c.lvalue(arg)
+			if err != nil {
+				return nil, 0, err
+			}
+			parts[i], widths[i] = bind, w
+			total += w
+		}
+		return func() access4 {
+			bound := make([]access4, len(parts))
+			for i, part := range parts {
+				bound[i] = part()
+			}
+			return access4{
+				read: func() (uint64, uint64) {
+					var v, u uint64
+					for i, b := range bound {
+						bv, bu := b.read()
+						v = v<<uint(widths[i]) | bv
+						u = u<<uint(widths[i]) | bu
+					}
+					return v, u
+				},
+				write: func(v, u uint64) {
+					shift := uint(0)
+					for i := len(bound) - 1; i >= 0; i-- {
+						m := mask(widths[i])
+						bound[i].write(v>>shift&m, u>>shift&m)
+						shift += uint(widths[i])
+					}
+				},
+			}
+		}, total, nil
+	}
+	return nil, 0, fmt.Errorf("%s is not assignable", e)
+}
+
+// Compile a statement. An if whose condition is unknown takes the else
+// branch and a case whose selector matches no label exactly takes the
+// default, as in Verilog; both report the unknown control.
+func (c *compiler4) stmt(st *hdl.Stmt, clocked bool) (execFn, error) {
+	if st == nil {
+		return func() {}, nil
+	}
+	switch st.Kind {
+	case hdl.StmtBlock:
+		body := make([]execFn, len(st.Body))
+		for i, b := range st.Body {
+			fn, err := c.stmt(b, clocked)
+			if err != nil {
+				return nil, err
+			}
+			body[i] = fn
+		}
+		return func() {
+			for _, fn := range body {
+				fn()
+			}
+		}, nil
+
+	case hdl.StmtIf:
+		cond, _, err := c.expr(st.Cond, 0)
+		if err != nil {
+			return nil, err
+		}
+		hits := c.branch(st).Hits
+		then, err := c.stmt(st.Then, clocked)
+		if err != nil {
+			return nil, err
+		}
+		els, err := c.stmt(st.Else, clocked)
+		if err != nil {
+			return nil, err
+		}
+		text := st.Cond.String()
+		return func() {
+			t, tu := truth(cond())
+			if tu != 0 {
+				c.s.controlX("condition", text)
+			}
+			if t != 0 && tu == 0 {
+				hits[0]++
+				then()
+			} else {
+				hits[1]++
+				els()
+			}
+		}, nil
+
+	case hdl.StmtCase:
+		return c.caseStmt(st, clocked)
+
+	case hdl.StmtBlocking, hdl.StmtNonblocking:
+		bind, w, err := c.lvalue(st.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, _, err := c.expr(st.RHS, w)
+		if err != nil {
+			return nil, err
+		}
+		if st.Kind == hdl.StmtNonblocking && clocked {
+			s := c.s
+			return func() {
+				target := bind()
+				v, u := rhs()
+				s.pending = append(s.pending, func() { target.write(v, u) })
+			}, nil
+		}
+		return func() {
+			target := bind()
+			target.write(rhs())
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+func (c *compiler4) caseStmt(st *hdl.Stmt, clocked bool) (execFn, error) {
+	// Selector and labels are sized to each other like an equality
+	w, err := c.width(st.Cond)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range st.Items {
+		for _, label := range item.Labels {
+			lw, err := c.width(label)
+			if err != nil {
+				return nil, err
+			}
+			if lw > w {
+				w = lw
+			}
+		}
+	}
+	sel, _, err := c.expr(st.Cond, w)
+	if err != nil {
+		return nil, err
+	}
+	type branch struct {
+		labels []eval4Fn
+		body   execFn
+		arm    int
+	}
+	var branches []branch
+	fallback := execFn(func() {})
+	hits := c.branch(st).Hits
+	fallbackArm := len(hits) - 1
+	for i, item := range st.Items {
+		body, err := c.stmt(item.Body, clocked)
+		if err != nil {
+			return nil, err
+		}
+		if item.Labels == nil {
+			fallback, fallbackArm = body, i
+			continue
+		}
+		b := branch{body: body, arm: i}
+		for _, label := range item.Labels {
+			fn, _, err := c.expr(label, w)
+			if err != nil {
+				return nil, err
+			}
+			b.labels = append(b.labels, fn)
+		}
+		branches = append(branches, b)
+	}
+	text := st.Cond.String()
+	return func() {
+		v, u := sel()
+		if u != 0 {
+			c.s.controlX("case selector", text)
+		}
+		for _, b := range branches {
+			for _, label := range b.labels {
+				if lv, lu := label(); lv == v && lu == u {
+					hits[b.arm]++
+					b.body()
+					return
+				}
+			}
+		}
+		hits[fallbackArm]++
+		fallback()
+	}, nil
+}
@@ -0,0 +1,255 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Level of a trigger net that is x or z
+const levelX = 2
+
+// Unknown value reaching a top-level output, a mutex grant, a FIFO flag, or
+// a signal that controls the design: a branch condition, case selector, memory
+// address, bit index or clock
+type XViolation struct {
+	Kind   string // "output", "grant", "FIFO flag", "condition", "case selector", "address", "index" or "clock"
+	Signal string // net name, or the expression for conditions and addresses
+	Time   uint64 // picoseconds
+	Value  string // bits of a net, most significant first, e.g. "1x0z"
+}
+
+func (v *XViolation) String() string {
+	s := fmt.Sprintf("%d ps: unknown %s %s", v.Time, v.Kind, v.Signal)
+	if v.Value != "" {
+		s += " = " + v.Value
+	}
+	return s
+}
+
+// Net whose value is checked after every time step
+type watch struct {
+	kind string
+	slot int
+}
+
+// Build a four-state simulator. Registers and memories start as x,
+// signals nothing drives as z, and x and z propagate through logic as in
+// Verilog. Top-level inputs start at 0. Call WatchX once the design is
+// out of reset to record X reaching outputs and control signals.
+func NewFourState(m *hdl.Module) (*Simulator, error) {
+	s, err := build(m)
+	if err != nil {
+		return nil, err
+	}
+	s.unknown = make([]uint64, len(s.names))
+	s.reported = map[string]bool{}
+	for slot, name := range s.names {
+		net := s.Netlist.Nets[name]
+		w := mask(int(s.widths[slot]))
+		switch {
+		case net.Kind == "reg":
+			s.values[slot], s.unknown[slot] = w, w
+		case net.Kind != "input" && !s.driven[slot]:
+			s.unknown[slot] = w
+		}
+	}
+	for _, mem := range s.mems {
+		mem.unknown = make([]uint64, len(mem.data))
+		w := mask(mem.width)
+		for i := range mem.data {
+			mem.data[i], mem.unknown[i] = w, w
+		}
+	}
+
+	c := &compiler4{&compiler{s: s}}
+	for _, item := range s.comb {
+		c.proc = item.proc
+		if a := item.assign; a != nil {
+			bind, w, err := c.lvalue(a.LHS)
+			if err != nil {
+				return nil, fmt.Errorf("assign %s: %v", a.LHS, err)
+			}
+			rhs, _, err := c.expr(a.RHS, w)
+			if err != nil {
+				return nil, fmt.Errorf("assign %s: %v", a.LHS, err)
+			}
+			item.eval = func() { bind().write(rhs()) }
+			continue
+		}
+		body, err := c.stmt(item.proc.Body, false)
+		if err != nil {
+			return nil, fmt.Errorf("always block in %q: %v", item.proc.Scope, err)
+		}
+		item.eval = body
+	}
+	for _, p := range s.procs {
+		c.proc = p.src
+		body, err := c.stmt(p.src.Body, true)
+		if err != nil {
+			return nil, fmt.Errorf("always block in %q: %v", p.src.Scope, err)
+		}
+		p.body = body
+	}
+	if err := s.addChecks(true); err != nil {
+		return nil, err
+	}
+	s.sample = s.values
+
+	for _, name := range s.names {
+		net := s.Netlist.Nets[name]
+		switch {
+		case net.Kind != "output":
+		case isFIFOFlag(name[strings.LastIndex(name, ".")+1:]):
+			s.watched = append(s.watched, &watch{kind: "FIFO flag", slot: s.index[name]})
+		case net.Scope == "":
+			s.watched = append(s.watched, &watch{kind: "output", slot: s.index[name]})
+		}
+	}
+	for scope, def := range s.Netlist.Scopes {
+		for _, mutex := range def.Mutexes {
+			for _, grant := range mutex.Grants {
+				if slot, ok := s.index[hdl.ScopedName(scope, grant.Name)]; ok {
+					s.watched = append(s.watched, &watch{kind: "grant", slot: slot})
+				}
+			}
+		}
+	}
+
+	s.settle()
+	s.initTriggers()
+	s.propagate()
+	return s, nil
+}
+
+// Full and empty outputs of the FIFO generators, at any level of hierarchy
+func isFIFOFlag(port string) bool {
+	for _, suffix := range []string{"full", "empty"} {
+		if strings.HasSuffix(port, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Simulator) level(slot int) uint64 {
+	if s.unknown != nil && s.unknown[slot]&1 != 0 {
+		return levelX
+	}
+	return s.get(slot) & 1
+}
+
+// Start recording X on outputs, mutex grants and control signals. Designs
+// are usually unknown until reset, so call this once reset is released.
+func (s *Simulator) WatchX() {
+	if s.unknown == nil {
+		return
+	}
+	s.flush()
+	s.watching = true
+	s.checkWatched()
+}
+
+// Unknown values seen since WatchX, the first occurrence of each
+func (s *Simulator) XViolations() []*XViolation {
+	return append([]*XViolation{}, s.violations...)
+}
+
+func (s *Simulator) report(v *XViolation) {
+	key := v.Kind + " " + v.Signal
+	if s.reported[key] {
+		return
+	}
+	s.reported[key] = true
+	s.violations = append(s.violations, v)
+}
+
+// Record an unknown used to steer the design
+func (s *Simulator) controlX(kind, signal string) {
+	if s.watching {
+		s.report(&XViolation{Kind: kind, Signal: signal, Time: s.time})
+	}
+}
+
+func (s *Simulator) checkWatched() {
+	if !s.watching {
+		return
+	}
+	for _, w := range s.watched {
+		if s.unknown[w.slot] != 0 {
+			s.report(&XViolation{Kind: w.kind, Signal: s.names[w.slot], Time: s.time, Value: s.bits(w.slot)})
+		}
+	}
+}
+
+// Value and unknown bits of a signal. Unknown bits are x where the value
+// bit is 1 and z where it is 0. Two-state simulations never have unknowns.
+func (s *Simulator) PeekX(name string) (value, unknown uint64) {
+	slot := s.slot(name)
+	s.flush()
+	if s.unknown == nil {
+		return s.get(slot), 0
+	}
+	return s.values[slot], s.unknown[slot]
+}
+
+// Signal value as a bit string, most significant bit first, e.g. "10xz"
+func (s *Simulator) PeekBits(name string) string {
+	slot := s.slot(name)
+	s.flush()
+	return s.bits(slot)
+}
+
+func (s *Simulator) bits(slot int) string {
+	v, u := s.get(slot), uint64(0)
+	if s.unknown != nil {
+		u = s.unknown[slot]
+	}
+	return FormatBits(v, u, int(s.widths[slot]))
+}
+
+// Bit string of a four-state value, most significant bit first
+func FormatBits(value, unknown uint64, width int) string {
+	b := make([]byte, width)
+	for i := 0; i < width; i++ {
+		bit := uint(width - 1 - i)
+		switch {
+		case unknown>>bit&1 == 0:
+			b[i] = byte('0' + value>>bit&1)
+		case value>>bit&1 == 1:
+			b[i] = 'x'
+		default:
+			b[i] = 'z'
+		}
+	}
+	return string(b)
+}
+
+// Drive a signal with a bit string of 0, 1, x and z, most significant bit
+// first; missing high bits are 0. Only four-state simulations take x and z.
+func (s *Simulator) PokeBits(name string, bits string) {
+	slot := s.slot(name)
+	var v, u uint64
+	for _, c := range strings.ToLower(bits) {
+		v, u = v<<1, u<<1
+		switch c {
+		case '0':
+		case '1':
+			v |= 1
+		case 'x':
+			v, u = v|1, u|1
+		case 'z':
+			u |= 1
+		default:
+			panic(fmt.Sprintf("simulator: bad bit %q poking %s", c, name))
+		}
+	}
+	if u != 0 && s.unknown == nil {
+		panic(fmt.Sprintf("simulator: cannot poke %s with unknowns in a two-state simulation", name))
+	}
+	s.Poke(name, v)
+	if s.unknown != nil {
+		s.unknown[slot] = u & mask(int(s.widths[slot]))
+	}
+}
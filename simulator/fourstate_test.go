@@ -0,0 +1,219 @@
+package simulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newFourState(t *testing.T, m *hdl.Module) *Simulator {
+	s, err := NewFourState(m)
+	if err != nil {
+		t.Fatalf("NewFourState: %v", err)
+	}
+	return s
+}
+
+func TestFourStateReset(t *testing.T) {
+	m := testdesigns.Counter()
+	m.Output("floating", 4)
+	s := newFourState(t, m)
+	if got := s.PeekBits("count"); got != "xxxxxxxx" {
+		t.Errorf("count = %s before reset, want all x", got)
+	}
+	if got := s.PeekBits("floating"); got != "zzzz" {
+		t.Errorf("undriven output = %s, want all z", got)
+	}
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	s.Poke("en", 1)
+	s.Cycle(3)
+	if v, u := s.PeekX("count"); v != 3 || u != 0 {
+		t.Errorf("count = %s after reset and 3 cycles, want 3", s.PeekBits("count"))
+	}
+}
+
+func TestFourStatePropagation(t *testing.T) {
+	m := core.NewModule("Prop")
+	a := m.Input("a", 4)
+	b := m.Input("b", 4)
+	m.Input("sel", 1)
+	m.Assign(m.Output("and", 4), a.And(b))
+	m.Assign(m.Output("or", 4), a.Or(b))
+	m.Assign(m.Output("sum", 4), a.Add(b))
+	m.Assign(m.Output("eq", 1), a.Eq(b))
+	m.AssignExpr(m.Output("pick", 4), "sel ? a : b")
+	m.AssignExpr(m.Output("same", 1), "a === b")
+	s := newFourState(t, m)
+
+	s.PokeBits("a", "01xz")
+	s.PokeBits("b", "0111")
+	expect := map[string]string{
+		"and":  "01xx",
+		"or":   "0111",
+		"sum":  "xxxx",
+		"eq":   "x",
+		"same": "0",
+	}
+	for name, want := range expect {
+		if got := s.PeekBits(name); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+
+	// Known bits that differ decide equality whatever the unknowns
+	s.PokeBits("b", "1011")
+	if got := s.PeekBits("eq"); got != "0" {
+		t.Errorf("eq = %s with a differing known bit, want 0", got)
+	}
+
+	// An unknown select keeps the bits both inputs agree on
+	s.PokeBits("sel", "x")
+	s.PokeBits("a", "1100")
+	s.PokeBits("b", "1010")
+	if got := s.PeekBits("pick"); got != "1xx0" {
+		t.Errorf("pick = %s with an unknown select, want 1xx0", got)
+	}
+}
+
+func TestFourStateMemory(t *testing.T) {
+	s := newFourState(t, newMemCase())
+	if got := s.PeekBits("rdata"); got != "xxxxxxxx" {
+		t.Errorf("rdata = %s from an unwritten word, want all x", got)
+	}
+	s.Poke("addr", 3)
+	s.Poke("wdata", 0x5a)
+	s.Poke("we", 1)
+	s.Cycle(1)
+	s.Poke("we", 0)
+	if v, u := s.PeekX("rdata"); v != 0x5a || u != 0 {
+		t.Errorf("rdata = %s after a write, want 01011010", s.PeekBits("rdata"))
+	}
+
+	// A write through an unknown address is dropped and reported
+	s.WatchX()
+	s.PokeBits("addr", "xx11")
+	s.Poke("we", 1)
+	s.Cycle(1)
+	if got := s.PeekMem("ram", 3); got != 0x5a {
+		t.Errorf("ram[3] = %#x after a write to an unknown address, want 0x5a", got)
+	}
+	if !hasViolation(s, "address", "") {
+		t.Errorf("The unknown write address should be reported, got %v", s.XViolations())
+	}
+}
+
+func hasViolation(s *Simulator, kind, signal string) bool {
+	for _, v := range s.XViolations() {
+		if v.Kind == kind && strings.Contains(v.Signal, signal) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestXViolations(t *testing.T) {
+	m := testdesigns.Counter()
+	m.Input("go", 1)
+	m.Reg("busy", 1)
+	m.Output("ready", 1)
+	m.AssignName("ready", "!busy")
+	m.Always = append(m.Always,
+		"always @(posedge clk) busy <= go;")
+	s := newFourState(t, m)
+
+	// Nothing is reported before WatchX, however unknown the design is
+	s.Cycle(2)
+	if v := s.XViolations(); len(v) != 0 {
+		t.Fatalf("Violations before WatchX: %v", v)
+	}
+
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	s.WatchX()
+	s.Cycle(1)
+	if v := s.XViolations(); len(v) != 0 {
+		t.Fatalf("Violations after reset: %v", v)
+	}
+
+	// An unknown if condition takes the else branch, as in Verilog, so
+	// count stays known but the condition is reported
+	s.PokeBits("en", "x")
+	s.PokeBits("go", "x")
+	s.Cycle(2)
+	if !hasViolation(s, "output", "ready") {
+		t.Errorf("ready going unknown should be reported, got %v", s.XViolations())
+	}
+	if !hasViolation(s, "condition", "en") {
+		t.Errorf("An unknown if condition should be reported, got %v", s.XViolations())
+	}
+	if hasViolation(s, "output", "count") {
+		t.Errorf("count should stay known, got %v", s.XViolations())
+	}
+	for _, v := range s.XViolations() {
+		if v.Kind == "output" && !strings.Contains(v.String(), "unknown output ready = x") {
+			t.Errorf("Violation reads %q", v)
+		}
+	}
+
+	n := len(s.XViolations())
+	s.Cycle(3)
+	if len(s.XViolations()) != n {
+		t.Errorf("Each violation should be reported once, got %v", s.XViolations())
+	}
+}
+
+func TestXMutexGrant(t *testing.T) {
+	m, mutex := newArbiter()
+	s := newFourState(t, m)
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	s.WatchX()
+	s.PokeBits(mutex.Requests[1].Name, "x")
+	s.Cycle(3)
+	if !hasViolation(s, "grant", "") {
+		t.Errorf("An unknown request should reach a grant, got %v", s.XViolations())
+	}
+}
+
+func TestXFIFOFlags(t *testing.T) {
+	m, ports, _, _ := newAsyncFIFO()
+	s := newFourState(t, m)
+	for _, rst := range []string{"wr_rst", "rd_rst"} {
+		s.Poke(rst, 1)
+	}
+	s.Run(100000)
+	for _, rst := range []string{"wr_rst", "rd_rst"} {
+		s.Poke(rst, 0)
+	}
+	s.WatchX()
+	s.Run(100000)
+	if v := s.XViolations(); len(v) != 0 {
+		t.Fatalf("Violations after reset: %v", v)
+	}
+	s.PokeBits(ports.WrEn.Name, "x")
+	s.Run(100000)
+	if !hasViolation(s, "FIFO flag", ports.RdEmpty.Name) {
+		t.Errorf("An unknown write enable should reach the empty flag, got %v", s.XViolations())
+	}
+}
+
+func TestPokeBitsTwoState(t *testing.T) {
+	s := newSim(t, testdesigns.Counter())
+	s.PokeBits("en", "1")
+	if got := s.PeekBits("en"); got != "1" {
+		t.Errorf("en = %s, want 1", got)
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "two-state") {
+			t.Errorf("Poking x into a two-state simulation should panic, got %v", r)
+		}
+	}()
+	s.PokeBits("en", "x")
+}
@@ -0,0 +1,228 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Temporal properties run as monitor state machines sampled on their
+// clock. Each sequence step keeps a bit mask of live delays: bit d of
+// live[i] is set when step i-1 matched d cycles ago, so step i matches when
+// a bit within its delay range is set and its condition holds. Delays are
+// at most 32 cycles, which keeps every mask in one word.
+
+// Argument of $past, $rose, $fell or $stable, sampled on every edge of the
+// property's clock
+type history struct {
+	arg  eval4Fn
+	past [][2]uint64 // value and unknown bits, most recent first
+}
+
+func (h *history) sample() {
+	copy(h.past[1:], h.past)
+	v, u := h.arg()
+	h.past[0] = [2]uint64{v, u}
+}
+
+// Compile a sampled-value function of a property condition
+func (c *compiler) call(e *hdl.Expr, compile func(*hdl.Expr) (eval4Fn, int, error), fourState bool) (eval4Fn, error) {
+	if c.check == nil {
+		return nil, fmt.Errorf("%s is only allowed in properties", e.Name)
+	}
+	depth := 1
+	switch e.Name {
+	case "$past":
+		if len(e.Args) == 2 {
+			n := e.Args[1]
+			if n.Kind != hdl.ExprConst || n.Value < 1 || n.Value > 63 {
+				return nil, fmt.Errorf("%s: cycles must be a constant from 1 to 63", e)
+			}
+			depth = int(n.Value)
+		} else if len(e.Args) != 1 {
+			return nil, fmt.Errorf("%s takes an expression and a cycle count", e)
+		}
+	case "$rose", "$fell", "$stable":
+		if len(e.Args) != 1 {
+			return nil, fmt.Errorf("%s takes one expression", e)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported function %s", e.Name)
+	}
+	arg, w, err := compile(e.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Before enough edges the past value is the initial one: x in four
+	// states, 0 otherwise
+	h := &history{arg: arg, past: make([][2]uint64, depth)}
+	if fourState {
+		for i := range h.past {
+			h.past[i] = [2]uint64{mask(w), mask(w)}
+		}
+	}
+	c.check.history = append(c.check.history, h)
+	oldest := &h.past[depth-1]
+
+	switch e.Name {
+	case "$past":
+		return func() (uint64, uint64) { return oldest[0], oldest[1] }, nil
+	case "$rose":
+		return func() (uint64, uint64) {
+			v, u := arg()
+			was := oldest[0]&^oldest[1]&1 == 1
+			return b2u(v&^u&1 == 1 && !was), 0
+		}, nil
+	case "$fell":
+		return func() (uint64, uint64) {
+			v, u := arg()
+			was := (oldest[0]|oldest[1])&1 == 0
+			return b2u((v|u)&1 == 0 && !was), 0
+		}, nil
+	}
+	return func() (uint64, uint64) {
+		v, u := arg()
+		return b2u(v == oldest[0] && u == oldest[1]), 0
+	}, nil
+}
+
+// Step of a sequence, min to max cycles after the previous one
+type monitorStep struct {
+	cond     eval4Fn
+	min, max int
+}
+
+// Matches of a sequence in progress
+type attempt struct {
+	start int // cycle the attempt began
+	live  []uint64
+}
+
+// Compiled temporal property. The antecedent starts a new attempt on every
+// cycle and its attempts are merged, since any match is enough to start
+// the consequent; consequent attempts each have to match on their own.
+type monitor struct {
+	antecedent  []*monitorStep
+	consequent  []*monitorStep
+	triggers    *attempt
+	obligations []*attempt
+}
+
+func newMonitor(p *hdl.NetProperty, compile func(*hdl.Expr) (eval4Fn, error)) (*monitor, error) {
+	t := p.Property.Temporal
+	steps := func(seq *hdl.Sequence, conds []*hdl.Expr) ([]*monitorStep, error) {
+		var out []*monitorStep
+		for i, step := range seq.Steps {
+			cond, err := compile(conds[i])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, &monitorStep{cond: cond, min: step.Min, max: step.Max})
+		}
+		return out, nil
+	}
+	m := &monitor{}
+	var err error
+	if m.consequent, err = steps(t.Consequent, p.Consequent); err != nil {
+		return nil, err
+	}
+	if t.Antecedent != nil {
+		if m.antecedent, err = steps(t.Antecedent, p.Antecedent); err != nil {
+			return nil, err
+		}
+		m.triggers = &attempt{live: make([]uint64, len(m.antecedent))}
+	}
+	if t.Antecedent != nil && !t.Overlap {
+		first := m.consequent[0]
+		m.consequent[0] = &monitorStep{cond: first.cond, min: first.min + 1, max: first.max + 1}
+	}
+	return m, nil
+}
+
+// Drop every attempt in progress, as reset does
+func (m *monitor) abort() {
+	if m.triggers != nil {
+		m.triggers.live = make([]uint64, len(m.triggers.live))
+	}
+	m.obligations = nil
+}
+
+// Advance every attempt by one cycle. Covers count the cycles the
+// consequent sequence matched; assertions return the start cycles of
+// attempts that can no longer match.
+func (m *monitor) step(cycle int, cover bool) (hits int, failed []int) {
+	for _, a := range m.obligations {
+		age(a)
+	}
+	if cover {
+		if m.triggers == nil {
+			m.triggers = &attempt{live: make([]uint64, len(m.consequent))}
+		}
+		age(m.triggers)
+		m.triggers.live[0] |= 1
+		if match(m.consequent, m.triggers) {
+			hits++
+		}
+		return hits, nil
+	}
+
+	start := true
+	if m.triggers != nil {
+		age(m.triggers)
+		m.triggers.live[0] |= 1
+		start = match(m.antecedent, m.triggers)
+	}
+	if start {
+		a := &attempt{start: cycle, live: make([]uint64, len(m.consequent))}
+		a.live[0] = 1
+		m.obligations = append(m.obligations, a)
+	}
+
+	pending := m.obligations[:0]
+	for _, a := range m.obligations {
+		switch {
+		case match(m.consequent, a):
+		case dead(a):
+			failed = append(failed, a.start)
+		default:
+			pending = append(pending, a)
+		}
+	}
+	m.obligations = pending
+	return 0, failed
+}
+
+func age(a *attempt) {
+	for i := range a.live {
+		a.live[i] <<= 1
+	}
+}
+
+// Evaluate the steps of an attempt on this cycle, reporting whether the
+// last one matched. Delays past a step's maximum are dropped afterwards.
+func match(steps []*monitorStep, a *attempt) bool {
+	matched := false
+	for i, st := range steps {
+		window := a.live[i] &^ mask(st.min) & mask(st.max+1)
+		if window != 0 && holds(st.cond) {
+			if i == len(steps)-1 {
+				matched = true
+			} else {
+				a.live[i+1] |= 1
+			}
+		}
+		a.live[i] &= mask(st.max)
+	}
+	return matched
+}
+
+// Attempt with no step left that could still match
+func dead(a *attempt) bool {
+	for _, live := range a.live {
+		if live != 0 {
+			return false
+		}
+	}
+	return true
+}
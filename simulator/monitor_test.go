@@ -0,0 +1,158 @@
+package simulator
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/simmodels/counter"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Module whose properties watch its inputs, which the test drives cycle
+// by cycle
+func newHandshake() (*hdl.Module, *hdl.ClockDomain) {
+	m := core.NewModule("Handshake")
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	for _, name := range []string{"valid", "ready", "req", "gnt"} {
+		m.Input(name, 1)
+	}
+	m.Input("data", 8)
+	return m, sys
+}
+
+// Drive one set of input values per rising edge
+func drive(s *Simulator, name string, values ...uint64) func(int) {
+	return func(cycle int) {
+		if cycle < len(values) {
+			s.Poke(name, values[cycle])
+		}
+	}
+}
+
+func run(s *Simulator, cycles int, drivers ...func(int)) {
+	for cycle := 0; cycle < cycles; cycle++ {
+		for _, d := range drivers {
+			d(cycle)
+		}
+		s.Cycle(1)
+	}
+}
+
+func failureCycles(s *Simulator) [][2]int {
+	var got [][2]int
+	for _, f := range s.PropertyFailures() {
+		got = append(got, [2]int{f.Start, f.Cycle})
+	}
+	return got
+}
+
+func TestDelayRange(t *testing.T) {
+	m, sys := newHandshake()
+	valid := &hdl.Signal{Name: "valid", Width: 1}
+	ready := &hdl.Signal{Name: "ready", Width: 1}
+	m.AssertProperty("ready_soon", hdl.Seq(valid).Implies(hdl.Delay(0, 2, ready)), sys)
+	s := newSim(t, m)
+
+	// Edges count from 1: ready two cycles after valid passes, three fails
+	run(s, 8,
+		drive(s, "valid", 1, 0, 0, 1, 0, 0, 0, 0),
+		drive(s, "ready", 0, 0, 1, 0, 0, 0, 0, 0))
+	got := failureCycles(s)
+	if len(got) != 1 || got[0] != [2]int{4, 6} {
+		t.Fatalf("Failures (start, cycle) = %v, want [[4 6]]", got)
+	}
+	want := "cycle 6 (55000 ps): assertion ready_soon failed for the attempt from cycle 4 (monitor_test.go:"
+	if f := s.PropertyFailures()[0].String(); !strings.HasPrefix(f, want) {
+		t.Errorf("Failure reads %q, want prefix %q", f, want)
+	}
+}
+
+func TestSampledFunctions(t *testing.T) {
+	m, sys := newHandshake()
+	req := &hdl.Signal{Name: "req", Width: 1}
+	gnt := &hdl.Signal{Name: "gnt", Width: 1}
+	data := &hdl.Signal{Name: "data", Width: 8}
+	m.AssertProperty("grant_follows", hdl.Seq(hdl.Rose(req)).ImpliesNext(hdl.Seq(gnt)), sys)
+	m.AssertProperty("data_held", hdl.Seq(gnt).ImpliesNext(hdl.Seq(hdl.Stable(data))), sys)
+	m.Assert("data_steps", &hdl.Signal{Name: "!gnt || data == $past(data, 2) + 8'd1", Width: 1}, sys)
+	m.CoverSequence("release", hdl.Seq(hdl.Fell(req)).Then(1, hdl.Fell(gnt)), sys)
+	s := newSim(t, m)
+
+	// Held requests only rise once; data holds for the cycle after a grant
+	// and has gone up by one over the two cycles before it
+	run(s, 10,
+		drive(s, "req", 0, 1, 1, 1, 0, 0, 1, 1, 0, 0),
+		drive(s, "gnt", 0, 0, 1, 0, 0, 0, 0, 0, 1, 0),
+		drive(s, "data", 5, 6, 6, 6, 7, 7, 7, 7, 8, 8))
+	got := failureCycles(s)
+	want := [][2]int{{7, 8}} // req rose at 7 without a grant at 8
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("Failures (start, cycle) = %v, want %v: %v", got, want, s.PropertyFailures())
+	}
+	if n := s.CoverCount("release"); n != 1 {
+		t.Errorf("release covered %d times, want 1", n)
+	}
+}
+
+func TestResetAbortsAttempts(t *testing.T) {
+	m, sys := newHandshake()
+	valid := &hdl.Signal{Name: "valid", Width: 1}
+	ready := &hdl.Signal{Name: "ready", Width: 1}
+	m.AssertProperty("ready_next", hdl.Seq(valid).ImpliesNext(hdl.Delay(1, 2, ready)), sys)
+	s := newSim(t, m)
+	run(s, 6,
+		drive(s, "valid", 1, 0, 0, 0, 0, 0),
+		drive(s, "rst", 0, 1, 0, 0, 0, 0))
+	if f := s.PropertyFailures(); len(f) != 0 {
+		t.Errorf("Reset should abort the pending attempt, got %v", f)
+	}
+	run(s, 4, drive(s, "valid", 1, 0, 0, 0))
+	if got := failureCycles(s); len(got) != 1 || got[0] != [2]int{7, 10} {
+		t.Errorf("Failures (start, cycle) = %v, want [[7 10]]", got)
+	}
+}
+
+func TestCompiledTemporal(t *testing.T) {
+	m := testdesigns.Counter()
+	sys := &hdl.ClockDomain{Name: "sys", Clock: m.Inputs[0], Reset: m.Inputs[1]}
+	en := &hdl.Signal{Name: "en", Width: 1}
+	m.AssertProperty("counts", hdl.Seq(en).ImpliesNext(hdl.Seq(&hdl.Signal{Name: "count_r == $past(count_r) + 8'd1", Width: 1})), sys)
+	m.AssertProperty("too_fast", hdl.Seq(en).ImpliesNext(hdl.Seq(&hdl.Signal{Name: "count_r == $past(count_r) + 8'd2", Width: 1})), sys)
+	m.CoverSequence("runs", hdl.Seq(en).Then(1, en).Then(1, en), sys)
+
+	interp := newSim(t, m)
+	compiled := newCompiled(t, m, counter.New())
+	rng := rand.New(rand.NewSource(1))
+	for cycle := 0; cycle < 500; cycle++ {
+		en, rst := uint64(rng.Intn(2)), b2u(cycle < 2 || rng.Intn(40) == 0)
+		for _, s := range []*Simulator{interp, compiled} {
+			s.Poke("en", en)
+			s.Poke("rst", rst)
+			s.Cycle(1)
+		}
+	}
+	a, b := interp.PropertyFailures(), compiled.PropertyFailures()
+	if len(a) == 0 || len(a) != len(b) {
+		t.Fatalf("%d failures interpreted, %d compiled", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].Name != "too_fast" || a[i].String() != b[i].String() {
+			t.Fatalf("Failure %d: %v interpreted, %v compiled", i, a[i], b[i])
+		}
+	}
+	if a, b := interp.CoverCount("runs"), compiled.CoverCount("runs"); a == 0 || a != b {
+		t.Errorf("runs covered %d times interpreted, %d compiled", a, b)
+	}
+}
+
+func TestSampledFunctionOutsideProperty(t *testing.T) {
+	m := core.NewModule("Bad")
+	m.Input("a", 1)
+	m.AssignExpr(m.Output("b", 1), "$rose(a)")
+	if _, err := New(m); err == nil {
+		t.Errorf("$rose outside a property should be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Assertion or assumption that did not hold on a clock edge
+type PropertyFailure struct {
+	Kind     string // "assert" or "assume"
+	Name     string // hierarchical name, e.g. "u_fifo.no_overflow"
+	Cycle    int    // rising edges of the property's clock so far
+	Start    int    // cycle the failing attempt of a temporal property began
+	Time     uint64 // picoseconds
+	Message  string
+	Location string // Go source that declared the property
+	Unknown  bool   // the condition was x or z rather than false
+}
+
+func (f *PropertyFailure) String() string {
+	what := "assertion"
+	if f.Kind == "assume" {
+		what = "assumption"
+	}
+	s := fmt.Sprintf("cycle %d (%d ps): %s %s failed", f.Cycle, f.Time, what, f.Name)
+	if f.Start != f.Cycle {
+		s += fmt.Sprintf(" for the attempt from cycle %d", f.Start)
+	}
+	if f.Unknown {
+		s += " with an unknown condition"
+	}
+	if f.Message != "" {
+		s += ": " + f.Message
+	}
+	if f.Location != "" {
+		s += " (" + f.Location + ")"
+	}
+	return s
+}
+
+// Property sampled on the rising edge of its clock, before the clocked
+// processes of that edge run
+type check struct {
+	prop   *hdl.NetProperty
+	clock  int
+	reset  int // -1 without a reset
+	last   uint64
+	cycles int
+	hits   int
+
+	cond    eval4Fn    // single-cycle condition
+	monitor *monitor   // temporal property
+	history []*history // arguments of sampled-value functions
+}
+
+// Compile the design's properties. Conditions read the value slots as
+// they are now, which compiled models fill from the engine on each edge.
+func (s *Simulator) addChecks(fourState bool) error {
+	for _, p := range s.Netlist.Properties {
+		c := &check{prop: p, reset: -1}
+		var ok bool
+		if c.clock, ok = s.index[p.Clock]; !ok {
+			return fmt.Errorf("%s %s: no clock %s", p.Property.Kind, p.Name, p.Clock)
+		}
+		if p.Reset != "" {
+			if c.reset, ok = s.index[p.Reset]; !ok {
+				return fmt.Errorf("%s %s: no reset %s", p.Property.Kind, p.Name, p.Reset)
+			}
+		}
+		compile := (&compiler{s: s, check: c}).condition
+		if fourState {
+			compile = (&compiler4{&compiler{s: s, check: c}}).condition
+		}
+		var err error
+		if p.Cond != nil {
+			c.cond, err = compile(p.Cond)
+		} else {
+			c.monitor, err = newMonitor(p, compile)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", p.Property.Kind, p.Name, err)
+		}
+		s.checks = append(s.checks, c)
+	}
+	return nil
+}
+
+// Two-state conditions never have unknown bits
+func (c *compiler) condition(e *hdl.Expr) (eval4Fn, error) {
+	f, _, err := c.expr(e, 0)
+	if err != nil {
+		return nil, err
+	}
+	return func() (uint64, uint64) { return f(), 0 }, nil
+}
+
+func (c *compiler4) condition(e *hdl.Expr) (eval4Fn, error) {
+	f, _, err := c.expr(e, 0)
+	return f, err
+}
+
+// Condition known to be true; x and z count as false, as in SVA
+func holds(cond eval4Fn) bool {
+	v, u := truth(cond())
+	return u == 0 && v == 1
+}
+
+// Evaluate the properties whose clock has just risen
+func (s *Simulator) sampleChecks() {
+	loaded := s.engine == nil
+	for _, c := range s.checks {
+		now := s.level(c.clock)
+		rose := c.last == 0 && now != 0 || c.last == levelX && now == 1
+		c.last = now
+		if !rose {
+			continue
+		}
+		c.cycles++
+		if !loaded {
+			for slot := range s.sample {
+				s.sample[slot] = s.engine.Get(slot)
+			}
+			loaded = true
+		}
+		if c.reset >= 0 && s.level(c.reset) == 1 {
+			if c.monitor != nil {
+				c.monitor.abort()
+			}
+		} else {
+			c.evaluate(s)
+		}
+		for _, h := range c.history {
+			h.sample()
+		}
+	}
+}
+
+func (c *check) evaluate(s *Simulator) {
+	p := c.prop.Property
+	if c.monitor != nil {
+		hits, failed := c.monitor.step(c.cycles, p.Kind == "cover")
+		c.hits += hits
+		for _, start := range failed {
+			s.failures = append(s.failures, c.failure(s, start, false))
+		}
+		return
+	}
+	v, u := truth(c.cond())
+	switch {
+	case p.Kind == "cover":
+		if u == 0 && v == 1 {
+			c.hits++
+		}
+	case u != 0 || v != 1:
+		s.failures = append(s.failures, c.failure(s, c.cycles, u != 0))
+	}
+}
+
+func (c *check) failure(s *Simulator, start int, unknown bool) *PropertyFailure {
+	p := c.prop.Property
+	return &PropertyFailure{
+		Kind:     p.Kind,
+		Name:     c.prop.Name,
+		Cycle:    c.cycles,
+		Start:    start,
+		Time:     s.time,
+		Message:  p.Message,
+		Location: p.Location,
+		Unknown:  unknown,
+	}
+}
+
+// Assertions and assumptions that failed so far, in the order they failed
+func (s *Simulator) PropertyFailures() []*PropertyFailure {
+	return append([]*PropertyFailure{}, s.failures...)
+}
+
+// Cycles on which a cover point held, by hierarchical name
+func (s *Simulator) CoverCount(name string) int {
+	s.flush()
+	for _, c := range s.checks {
+		if c.prop.Name == name && c.prop.Property.Kind == "cover" {
+			return c.hits
+		}
+	}
+	panic(fmt.Sprintf("simulator: no cover point %s", name))
+}
+
+// Hit counts of every cover point, by hierarchical name
+func (s *Simulator) Coverage() map[string]int {
+	s.flush()
+	hits := map[string]int{}
+	for _, c := range s.checks {
+		if c.prop.Property.Kind == "cover" {
+			hits[c.prop.Name] = c.hits
+		}
+	}
+	return hits
+}
@@ -0,0 +1,98 @@
+package simulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/simmodels/counter"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Counter that must stay below a limit, with a cover point on wrapping
+func newCheckedCounter() *hdl.Module {
+	m := testdesigns.Counter()
+	sys := &hdl.ClockDomain{Name: "sys", Clock: m.Inputs[0], Reset: m.Inputs[1]}
+	m.Assert("below_limit", &hdl.Signal{Name: "count_r < 8'd3", Width: 1}, sys).WithMessage("count too high")
+	m.Cover("at_two", &hdl.Signal{Name: "count == 8'd2", Width: 1}, sys)
+	return m
+}
+
+func TestAssertions(t *testing.T) {
+	s := newSim(t, newCheckedCounter())
+	s.Poke("rst", 1)
+	s.Cycle(2)
+	if f := s.PropertyFailures(); len(f) != 0 {
+		t.Fatalf("Properties should not be checked in reset, got %v", f)
+	}
+	s.Poke("rst", 0)
+	s.Poke("en", 1)
+	s.Cycle(3)
+	if f := s.PropertyFailures(); len(f) != 0 {
+		t.Fatalf("count reached 3 on the last edge, which samples 2, got %v", f)
+	}
+	s.Cycle(2)
+	failures := s.PropertyFailures()
+	if len(failures) != 2 {
+		t.Fatalf("Expected failures on 2 edges, got %v", failures)
+	}
+	f := failures[0]
+	if f.Kind != "assert" || f.Name != "below_limit" || f.Cycle != 6 || f.Time != 55000 {
+		t.Errorf("First failure = %+v", f)
+	}
+	want := "cycle 6 (55000 ps): assertion below_limit failed: count too high (property_test.go:"
+	if !strings.HasPrefix(f.String(), want) {
+		t.Errorf("Failure reads %q, want prefix %q", f, want)
+	}
+	if got := s.CoverCount("at_two"); got != 1 {
+		t.Errorf("at_two hit %d times, want 1", got)
+	}
+}
+
+func TestCompiledAssertions(t *testing.T) {
+	m := newCheckedCounter()
+	interp := newSim(t, m)
+	compiled := newCompiled(t, m, counter.New())
+	for _, s := range []*Simulator{interp, compiled} {
+		s.Poke("rst", 1)
+		s.Cycle(1)
+		s.Poke("rst", 0)
+		s.Poke("en", 1)
+		s.Cycle(300)
+	}
+	a, b := interp.PropertyFailures(), compiled.PropertyFailures()
+	if len(a) == 0 || len(a) != len(b) {
+		t.Fatalf("%d failures interpreted, %d compiled", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			t.Errorf("Failure %d: %v interpreted, %v compiled", i, a[i], b[i])
+		}
+	}
+	if a, b := interp.Coverage(), compiled.Coverage(); a["at_two"] != b["at_two"] || a["at_two"] == 0 {
+		t.Errorf("Coverage %v interpreted, %v compiled", a, b)
+	}
+}
+
+func TestChildAssertions(t *testing.T) {
+	child := core.NewModule("Child")
+	clk := child.Input("clk", 1)
+	child.SetClock(clk)
+	child.Input("a", 1)
+	child.Assume("a_high", &hdl.Signal{Name: "a", Width: 1}, nil)
+	top := core.NewModule("Top")
+	top.InstanceOf(child, "u_child").Connect("clk", top.Input("clk", 1)).Connect("a", top.Input("a", 1))
+
+	s := newFourState(t, top)
+	s.Cycle(1)
+	s.PokeBits("a", "x")
+	s.Cycle(1)
+	failures := s.PropertyFailures()
+	if len(failures) != 2 || failures[0].Name != "u_child.a_high" || failures[1].Cycle != 2 {
+		t.Fatalf("Failures = %v", failures)
+	}
+	if !failures[1].Unknown || !strings.Contains(failures[1].String(), "assumption u_child.a_high failed with an unknown condition") {
+		t.Errorf("Failure reads %q", failures[1])
+	}
+}
@@ -0,0 +1,797 @@
+// Package simulator runs hdl modules cycle by cycle in Go. The module
+// hierarchy is flattened and its logic parsed once into closures; clock
+// inputs are driven at their ClockDomain frequencies, combinational logic
+// is settled in dependency order and clocked processes fire on their edges
+// with Verilog nonblocking semantics. For long runs, Generate compiles a
+// design to Go source that NewCompiled drives through the same API, and
+// NewFourState models x and z to catch unknowns leaking out of a design.
+// Every value is held in one 64-bit word: designs with wider signals or
+// memories are rejected, see MaxWidth.
+package simulator
+
+import (
+	"fmt"
+	"github.com/SoulPancake/HFT/types"
+	"sort"
+	"strings"
+)
+
+// Widest signal, memory word or intermediate value the simulator holds.
+// Values are single uint64 words, so designs with wider buses are rejected
+// when the simulator or a compiled model is built.
+const MaxWidth = 64
+
+// Clocks of domains without a frequency run at 100 MHz
+const DefaultFrequency = 100000000
+
+const maxDeltaCycles = 1000
+
+// Steps a derived clock may stay idle before Cycle gives up on it
+const maxIdleSteps = 1 << 20
+
+type memory struct {
+	name    string
+	width   int
+	data    []uint64
+	unknown []uint64 // four-state only
+}
+
+// Clock input driven by the simulator
+type clock struct {
+	Domain *hdl.ClockDomain // nil for clocks no domain declares
+	net    int
+	half   uint64 // half period in picoseconds
+	next   uint64 // time of the next toggle
+}
+
+// Edge a clocked process waits for
+type trigger struct {
+	net  int
+	edge string
+	last uint64
+}
+
+type process struct {
+	src      *hdl.Process
+	triggers []*trigger
+	body     execFn
+}
+
+// Combinational assignment or always @(*) block
+type combItem struct {
+	assign  *hdl.ContinuousAssign // nil for always blocks
+	proc    *hdl.Process
+	eval    execFn
+	reads   []string
+	targets []int
+}
+
+// Simulation of a flattened module hierarchy
+type Simulator struct {
+	Netlist *hdl.Netlist
+
+	values []uint64
+	widths []hdl.Width
+	names  []string
+	index  map[string]int
+	mems   map[string]*memory
+	driven map[int]bool
+
+	comb    []*combItem
+	cyclic  bool
+	procs   []*process
+	pending []func()
+
+	engine  Engine        // generated logic replacing values, comb and procs
+	clocked ClockedEngine // engine stepping its own clocks, nil if it cannot
+	next    []uint64      // next toggle of each clock, passed to clocked
+
+	clocks    []*clock
+	time      uint64
+	dirty     bool
+	observers []func()
+	edgeHooks []*edgeHook
+	branches  []*Branch
+
+	// Four-state simulation, see NewFourState
+	unknown    []uint64
+	watching   bool
+	watched    []*watch
+	reported   map[string]bool
+	violations []*XViolation
+
+	// Properties, see Module.Assert
+	checks   []*check
+	sample   []uint64
+	failures []*PropertyFailure
+}
+
+// Build a simulator for the module and every instance with a Go
+// definition. All signals start at zero; clocks start low and rise half a
+// period into the simulation.
+func New(m *hdl.Module) (*Simulator, error) {
+	s, err := build(m)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{s: s}
+	for _, item := range s.comb {
+		c.proc = item.proc
+		if a := item.assign; a != nil {
+			bind, w, err := c.lvalue(a.LHS)
+			if err != nil {
+				return nil, fmt.Errorf("assign %s: %v", a.LHS, err)
+			}
+			rhs, _, err := c.expr(a.RHS, w)
+			if err != nil {
+				return nil, fmt.Errorf("assign %s: %v", a.LHS, err)
+			}
+			item.eval = func() { bind().write(rhs()) }
+			continue
+		}
+		body, err := c.stmt(item.proc.Body, false)
+		if err != nil {
+			return nil, fmt.Errorf("always block in %q: %v", item.proc.Scope, err)
+		}
+		item.eval = body
+	}
+	for _, p := range s.procs {
+		c.proc = p.src
+		body, err := c.stmt(p.src.Body, true)
+		if err != nil {
+			return nil, fmt.Errorf("always block in %q: %v", p.src.Scope, err)
+		}
+		p.body = body
+	}
+	if err := s.addChecks(false); err != nil {
+		return nil, err
+	}
+	s.sample = s.values
+
+	// Settle the initial state without firing any edges
+	s.settle()
+	s.initTriggers()
+	s.propagate()
+	return s, nil
+}
+
+func (s *Simulator) initTriggers() {
+	for _, p := range s.procs {
+		for _, t := range p.triggers {
+			t.last = s.level(t.net)
+		}
+	}
+	for _, c := range s.checks {
+		c.last = s.level(c.clock)
+	}
+}
+
+// Logic of a design compiled to Go by Generate. Slots follow the order of
+// Signals, which must match the simulator's.
+type Engine interface {
+	Signals() []string
+	Get(slot int) uint64
+	Set(slot int, value uint64)
+	Memory(name string) []uint64 // backing words, shared with the simulator
+	Propagate()                  // settle logic and fire clocked processes until no more edges occur
+}
+
+// Engine that toggles its clock inputs itself, so Cycle runs without
+// returning to the simulator at every edge. Models from Generate
+// implement it; the simulator uses it while nothing observes the edges.
+type ClockedEngine interface {
+	Engine
+	ClockSlots() []int     // clock inputs, in the order of Clocks
+	HalfPeriods() []uint64 // half period of each clock in picoseconds
+
+	// Run n rising edges of clock c from time now and return the time of
+	// the last one; next holds the time of each clock's next toggle
+	Cycle(c, n int, now uint64, next []uint64) uint64
+}
+
+// Build a simulator that runs a model generated from the module instead of
+// interpreting it. Poke, Peek, clocks and observers behave as with New.
+func NewCompiled(m *hdl.Module, e Engine) (*Simulator, error) {
+	s, err := build(m)
+	if err != nil {
+		return nil, err
+	}
+	signals := e.Signals()
+	for i, name := range s.names {
+		if i >= len(signals) || signals[i] != name {
+			return nil, fmt.Errorf("compiled model does not match module %s at signal %s, regenerate it", m.Name, name)
+		}
+	}
+	if len(signals) != len(s.names) {
+		return nil, fmt.Errorf("compiled model does not match module %s, regenerate it", m.Name)
+	}
+	for name, mem := range s.mems {
+		data := e.Memory(name)
+		if len(data) != len(mem.data) {
+			return nil, fmt.Errorf("compiled model does not match module %s at memory %s, regenerate it", m.Name, name)
+		}
+		mem.data = data
+	}
+	if ce, ok := e.(ClockedEngine); ok {
+		slots, halves := ce.ClockSlots(), ce.HalfPeriods()
+		if len(slots) != len(s.clocks) || len(halves) != len(s.clocks) {
+			return nil, fmt.Errorf("compiled model does not match the clocks of module %s, regenerate it", m.Name)
+		}
+		for i, clk := range s.clocks {
+			if slots[i] != clk.net || halves[i] != clk.half {
+				return nil, fmt.Errorf("compiled model does not match module %s at clock %s, regenerate it", m.Name, s.names[clk.net])
+			}
+		}
+		s.clocked = ce
+		s.next = make([]uint64, len(s.clocks))
+	}
+	if err := s.addChecks(false); err != nil {
+		return nil, err
+	}
+	s.sample = s.values
+	s.engine = e
+	s.values = nil
+	s.initTriggers()
+	s.propagate()
+	return s, nil
+}
+
+// Reject a design with signals or memories wider than MaxWidth, naming all
+// of them at once
+func checkWidths(n *hdl.Netlist) error {
+	var wide []string
+	for _, name := range n.NetOrder {
+		if w := n.Nets[name].Width; w > MaxWidth {
+			wide = append(wide, fmt.Sprintf("%s (%d bits)", name, w))
+		}
+	}
+	var mems []string
+	for name, nm := range n.Memories {
+		if w := nm.Memory.Width; w > MaxWidth {
+			mems = append(mems, fmt.Sprintf("memory %s (%d bits)", name, w))
+		}
+	}
+	sort.Strings(mems)
+	wide = append(wide, mems...)
+	if len(wide) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s cannot be simulated, values are limited to %d bits: %s; split wide buses into lanes of at most %d bits",
+		n.Top.Name, MaxWidth, strings.Join(wide, ", "), MaxWidth)
+}
+
+// Flatten the module and lay out its signals, memories, combinational
+// items in evaluation order, clocked processes and clocks, without
+// compiling any logic
+func build(m *hdl.Module) (*Simulator, error) {
+	n, err := m.Flatten()
+	if err != nil {
+		return nil, err
+	}
+	s := &Simulator{
+		Netlist: n,
+		index:   make(map[string]int),
+		mems:    make(map[string]*memory),
+		driven:  make(map[int]bool),
+	}
+	if err := checkWidths(n); err != nil {
+		return nil, err
+	}
+	for _, name := range n.NetOrder {
+		net := n.Nets[name]
+		s.index[name] = len(s.names)
+		s.names = append(s.names, name)
+		s.widths = append(s.widths, net.Width)
+	}
+	s.values = make([]uint64, len(s.names))
+	for name, nm := range n.Memories {
+		s.mems[name] = &memory{name: name, width: int(nm.Memory.Width), data: make([]uint64, nm.Memory.Depth)}
+	}
+
+	for _, a := range n.Assigns {
+		item := &combItem{
+			assign: a,
+			reads:  append(a.RHS.Idents(), a.LHS.TargetReads()...),
+		}
+		s.addTargets(item, a.LHS.Targets())
+		s.comb = append(s.comb, item)
+	}
+	for _, proc := range n.Processes {
+		if proc.Clock == "" {
+			item := &combItem{proc: proc}
+			targets := map[string]bool{}
+			walkAssignments(proc.Body, func(st *hdl.Stmt) {
+				item.reads = append(item.reads, st.RHS.Idents()...)
+				item.reads = append(item.reads, st.LHS.TargetReads()...)
+				for _, t := range st.LHS.Targets() {
+					targets[t] = true
+				}
+			}, func(cond *hdl.Expr) {
+				item.reads = append(item.reads, cond.Idents()...)
+			})
+			s.addTargets(item, sortedKeys(targets))
+			s.comb = append(s.comb, item)
+			continue
+		}
+		walkAssignments(proc.Body, func(st *hdl.Stmt) {
+			for _, t := range st.LHS.Targets() {
+				if slot, ok := s.index[t]; ok {
+					s.driven[slot] = true
+				}
+			}
+		}, func(*hdl.Expr) {})
+		p := &process{src: proc}
+		edges := append([]hdl.Sensitivity{{Edge: proc.Edge, Signal: proc.Clock}}, proc.Sensitivity...)
+		for _, e := range edges {
+			slot, ok := s.index[e.Signal]
+			if !ok {
+				return nil, fmt.Errorf("always block clocked by undeclared %s", e.Signal)
+			}
+			p.triggers = append(p.triggers, &trigger{net: slot, edge: e.Edge})
+		}
+		s.procs = append(s.procs, p)
+	}
+	s.orderComb()
+	s.findClocks()
+	return s, nil
+}
+
+func (s *Simulator) addTargets(item *combItem, targets []string) {
+	for _, t := range targets {
+		if slot, ok := s.index[t]; ok {
+			item.targets = append(item.targets, slot)
+			s.driven[slot] = true
+		}
+	}
+}
+
+// Call assign for every assignment and cond for every condition
+func walkAssignments(st *hdl.Stmt, assign func(*hdl.Stmt), cond func(*hdl.Expr)) {
+	if st == nil {
+		return
+	}
+	switch st.Kind {
+	case hdl.StmtBlock:
+		for _, b := range st.Body {
+			walkAssignments(b, assign, cond)
+		}
+	case hdl.StmtIf:
+		cond(st.Cond)
+		walkAssignments(st.Then, assign, cond)
+		walkAssignments(st.Else, assign, cond)
+	case hdl.StmtCase:
+		cond(st.Cond)
+		for _, item := range st.Items {
+			for _, label := range item.Labels {
+				cond(label)
+			}
+			walkAssignments(item.Body, assign, cond)
+		}
+	case hdl.StmtBlocking, hdl.StmtNonblocking:
+		assign(st)
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sort combinational items so every net is computed before it is read.
+// Loops are allowed but then settling iterates until nothing changes.
+func (s *Simulator) orderComb() {
+	writers := map[string][]int{}
+	for i, item := range s.comb {
+		for _, slot := range item.targets {
+			writers[s.names[slot]] = append(writers[s.names[slot]], i)
+		}
+	}
+	state := make([]int, len(s.comb)) // 0 new, 1 visiting, 2 done
+	order := make([]*combItem, 0, len(s.comb))
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = 1
+		for _, read := range s.comb[i].reads {
+			for _, w := range writers[read] {
+				switch {
+				case w == i:
+					// latches read and hold their own value
+				case state[w] == 1:
+					s.cyclic = true
+				case state[w] == 0:
+					visit(w)
+				}
+			}
+		}
+		state[i] = 2
+		order = append(order, s.comb[i])
+	}
+	for i := range s.comb {
+		if state[i] == 0 {
+			visit(i)
+		}
+	}
+	s.comb = order
+}
+
+// Top-level inputs clocking a process are driven by the simulator at the
+// frequency of their clock domain
+func (s *Simulator) findClocks() {
+	n := s.Netlist
+	seen := map[int]bool{}
+	addClock := func(name string) {
+		root := n.Resolve(name)
+		net, ok := n.Nets[root]
+		if !ok || net.Scope != "" || net.Kind != "input" {
+			return
+		}
+		slot := s.index[root]
+		if seen[slot] {
+			return
+		}
+		seen[slot] = true
+		clk := &clock{Domain: n.ClockDomainOf(root), net: slot}
+		freq := DefaultFrequency
+		if clk.Domain != nil && clk.Domain.Frequency > 0 {
+			freq = clk.Domain.Frequency
+		}
+		clk.half = uint64(1e12 / float64(freq) / 2)
+		if clk.half == 0 {
+			clk.half = 1
+		}
+		clk.next = clk.half
+		s.clocks = append(s.clocks, clk)
+		s.driven[slot] = true
+	}
+	// Declared domains first so the primary clock is the first domain's
+	for _, cd := range n.Top.ClockDomains {
+		if cd.Clock != nil {
+			addClock(cd.Clock.Name)
+		}
+	}
+	for _, proc := range n.Processes {
+		if proc.Clock != "" {
+			addClock(proc.Clock)
+		}
+	}
+	for _, p := range n.Properties {
+		addClock(p.Clock)
+	}
+}
+
+// Evaluate combinational logic until it is stable
+func (s *Simulator) settle() {
+	for pass := 0; ; pass++ {
+		changed := false
+		for _, item := range s.comb {
+			if !s.cyclic {
+				item.eval()
+				continue
+			}
+			before := make([]uint64, 2*len(item.targets))
+			for i, slot := range item.targets {
+				before[2*i] = s.values[slot]
+				if s.unknown != nil {
+					before[2*i+1] = s.unknown[slot]
+				}
+			}
+			item.eval()
+			for i, slot := range item.targets {
+				if s.values[slot] != before[2*i] || s.unknown != nil && s.unknown[slot] != before[2*i+1] {
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			return
+		}
+		if pass > maxDeltaCycles {
+			panic("simulator: combinational loop does not settle")
+		}
+	}
+}
+
+// Settle logic and fire clocked processes until no more edges occur
+func (s *Simulator) propagate() {
+	s.dirty = false
+	if s.engine != nil {
+		s.sampleChecks()
+		s.sampleEdges()
+		s.engine.Propagate()
+		return
+	}
+	for delta := 0; ; delta++ {
+		if delta > maxDeltaCycles {
+			panic("simulator: clock edges keep triggering at one time step")
+		}
+		s.settle()
+		s.sampleChecks()
+		s.sampleEdges()
+		var fired []*process
+		for _, p := range s.procs {
+			edge := false
+			for _, t := range p.triggers {
+				now := s.level(t.net)
+				if now == levelX && t.last != levelX && t.edge != "" {
+					s.controlX("clock", s.names[t.net])
+				}
+				// Edges to and from x count, as in Verilog
+				if (t.edge == "posedge" && (t.last == 0 && now != 0 || t.last == levelX && now == 1)) ||
+					(t.edge == "negedge" && (t.last == 1 && now != 1 || t.last == levelX && now == 0)) {
+					edge = true
+				}
+				t.last = now
+			}
+			if edge {
+				fired = append(fired, p)
+			}
+		}
+		if len(fired) == 0 {
+			s.checkWatched()
+			return
+		}
+		for _, p := range fired {
+			p.body()
+		}
+		for _, write := range s.pending {
+			write()
+		}
+		s.pending = s.pending[:0]
+	}
+}
+
+// Apply pending pokes at the current time
+func (s *Simulator) flush() {
+	if s.dirty {
+		s.propagate()
+		s.notify()
+	}
+}
+
+func (s *Simulator) notify() {
+	for _, fn := range s.observers {
+		fn()
+	}
+}
+
+func (s *Simulator) get(slot int) uint64 {
+	if s.engine != nil {
+		return s.engine.Get(slot)
+	}
+	return s.values[slot]
+}
+
+func (s *Simulator) set(slot int, value uint64) {
+	if s.engine != nil {
+		s.engine.Set(slot, value)
+		return
+	}
+	s.values[slot] = value
+}
+
+func (s *Simulator) slot(name string) int {
+	slot, ok := s.index[name]
+	if !ok {
+		panic(fmt.Sprintf("simulator: no signal %s", name))
+	}
+	return slot
+}
+
+// Drive an input or undriven signal; the design reacts on the next Peek
+// or Step
+func (s *Simulator) Poke(name string, value uint64) {
+	slot := s.slot(name)
+	if s.driven[slot] {
+		panic(fmt.Sprintf("simulator: cannot poke %s, it is driven by the design or the simulator", name))
+	}
+	s.set(slot, value&mask(int(s.widths[slot])))
+	if s.unknown != nil {
+		s.unknown[slot] = 0
+	}
+	s.dirty = true
+}
+
+// Overwrite the current value of a register, e.g. to start from a state a
+// model checker found. The design keeps or replaces it on the next edge.
+func (s *Simulator) Deposit(name string, value uint64) {
+	slot := s.slot(name)
+	s.set(slot, value&mask(int(s.widths[slot])))
+	if s.unknown != nil {
+		s.unknown[slot] = 0
+	}
+	s.dirty = true
+}
+
+// Current value of a signal, by flat name ("u_fifo.count" inside u_fifo).
+// Unknown bits of a four-state simulation read as 0.
+func (s *Simulator) Peek(name string) uint64 {
+	slot := s.slot(name)
+	s.flush()
+	if s.unknown != nil {
+		return s.values[slot] &^ s.unknown[slot]
+	}
+	return s.get(slot)
+}
+
+func (s *Simulator) memory(name string, addr int) *memory {
+	mem, ok := s.mems[name]
+	if !ok {
+		panic(fmt.Sprintf("simulator: no memory %s", name))
+	}
+	if addr < 0 || addr >= len(mem.data) {
+		panic(fmt.Sprintf("simulator: address %d out of range for memory %s", addr, name))
+	}
+	return mem
+}
+
+// Load a memory word
+func (s *Simulator) PokeMem(name string, addr int, value uint64) {
+	mem := s.memory(name, addr)
+	mem.data[addr] = value & mask(mem.width)
+	if mem.unknown != nil {
+		mem.unknown[addr] = 0
+	}
+	s.dirty = true
+}
+
+// Read a memory word
+func (s *Simulator) PeekMem(name string, addr int) uint64 {
+	mem := s.memory(name, addr)
+	s.flush()
+	if mem.unknown != nil {
+		return mem.data[addr] &^ mem.unknown[addr]
+	}
+	return mem.data[addr]
+}
+
+// Width of a signal
+func (s *Simulator) Width(name string) hdl.Width {
+	return s.widths[s.slot(name)]
+}
+
+// Flat names of all signals in declaration order
+func (s *Simulator) Signals() []string {
+	return append([]string{}, s.names...)
+}
+
+// Names of the clock inputs the simulator drives, primary clock first
+func (s *Simulator) Clocks() []string {
+	names := make([]string, len(s.clocks))
+	for i, clk := range s.clocks {
+		names[i] = s.names[clk.net]
+	}
+	return names
+}
+
+// Simulation time in picoseconds
+func (s *Simulator) Time() uint64 {
+	return s.time
+}
+
+// Call fn whenever the design has settled after a time step or after
+// pokes were applied
+func (s *Simulator) Observe(fn func()) {
+	s.observers = append(s.observers, fn)
+}
+
+// Function called on the rising edges of a clock
+type edgeHook struct {
+	clock int
+	last  uint64
+	fn    func()
+}
+
+// Call fn on each rising edge of a clock, before the processes it triggers
+// run, so Peek still gives the values the edge samples
+func (s *Simulator) OnClock(clock string, fn func()) {
+	slot := s.slot(clock)
+	s.edgeHooks = append(s.edgeHooks, &edgeHook{clock: slot, last: s.level(slot), fn: fn})
+}
+
+func (s *Simulator) sampleEdges() {
+	for _, h := range s.edgeHooks {
+		now := s.level(h.clock)
+		rose := h.last == 0 && now == 1
+		h.last = now
+		if rose {
+			h.fn()
+		}
+	}
+}
+
+// Advance to the next clock edge of any clock
+func (s *Simulator) Step() {
+	if len(s.clocks) == 0 {
+		panic("simulator: the design has no clock inputs to step")
+	}
+	s.flush()
+	next := s.clocks[0].next
+	for _, clk := range s.clocks[1:] {
+		if clk.next < next {
+			next = clk.next
+		}
+	}
+	s.time = next
+	for _, clk := range s.clocks {
+		if clk.next == next {
+			s.set(clk.net, s.get(clk.net)^1)
+			clk.next += clk.half
+		}
+	}
+	s.propagate()
+	s.notify()
+}
+
+// Advance by the given number of picoseconds
+func (s *Simulator) Run(ps uint64) {
+	s.flush()
+	end := s.time + ps
+	for len(s.clocks) > 0 {
+		next := s.clocks[0].next
+		for _, clk := range s.clocks[1:] {
+			if clk.next < next {
+				next = clk.next
+			}
+		}
+		if next > end {
+			break
+		}
+		s.Step()
+	}
+	s.time = end
+}
+
+// Advance by n rising edges of the primary clock, the clock of the first
+// clock domain or else the first clock found
+func (s *Simulator) Cycle(n int) {
+	if len(s.clocks) == 0 {
+		panic("simulator: the design has no clock inputs to step")
+	}
+	s.cycleNet(s.clocks[0].net, n)
+}
+
+// Advance by n rising edges of a domain's clock, which may be an input or
+// a clock derived inside the design
+func (s *Simulator) CycleDomain(cd *hdl.ClockDomain, n int) {
+	root := s.Netlist.Resolve(cd.Clock.Name)
+	slot, ok := s.index[root]
+	if !ok {
+		panic(fmt.Sprintf("simulator: clock %s of domain %s is not a top-level signal", cd.Clock.Name, cd.Name))
+	}
+	s.cycleNet(slot, n)
+}
+
+func (s *Simulator) cycleNet(slot int, n int) {
+	s.flush()
+	if s.clocked != nil && len(s.observers) == 0 && len(s.edgeHooks) == 0 && len(s.checks) == 0 {
+		// Nothing to call back between edges: let the model run the clocks
+		for c, clk := range s.clocks {
+			if clk.net != slot {
+				continue
+			}
+			for i, clk := range s.clocks {
+				s.next[i] = clk.next
+			}
+			s.time = s.clocked.Cycle(c, n, s.time, s.next)
+			for i, clk := range s.clocks {
+				clk.next = s.next[i]
+			}
+			return
+		}
+	}
+	idle := 0
+	for rises := 0; rises < n; {
+		before := s.get(slot) & 1
+		s.Step()
+		if before == 0 && s.get(slot)&1 == 1 {
+			rises++
+			idle = 0
+		} else if idle++; idle > maxIdleSteps {
+			panic(fmt.Sprintf("simulator: %s stopped toggling", s.names[slot]))
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newSim(t testing.TB, m *hdl.Module) *Simulator {
+	s, err := New(m)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func TestCombinationalWidths(t *testing.T) {
+	m := core.NewModule("Comb")
+	a := m.Input("a", 8)
+	b := m.Input("b", 8)
+	sum := m.Output("sum", 9)
+	m.Assign(sum, a.Add(b))
+	m.AssignExpr(m.Output("wrap", 8), "a + b")
+	m.AssignExpr(m.Output("parts", 8), "{a[3:0], b[7:4]}")
+	m.AssignExpr(m.Output("flags", 3), "{&a, |b, ^a}")
+	m.AssignExpr(m.Output("pick", 8), "(a > b) ? a - b : b - a")
+	
+	s := newSim(t, m)
+	s.Poke("a", 0xf0)
+	s.Poke("b", 0x31)
+	
+	expect := map[string]uint64{
+		"sum":   0x121,
+		"wrap":  0x21,
+		"parts": 0x03,
+		"flags": 0x2,
+		"pick":  0xbf,
+	}
+	for name, want := range expect {
+		if got := s.Peek(name); got != want {
+			t.Errorf("%s = %#x, want %#x", name, got, want)
+		}
+	}
+	
+	s.Poke("a", 0xff)
+	if got := s.Peek("flags"); got != 0x6 {
+		t.Errorf("flags = %#x, want 0x6", got)
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	s := newSim(t, testdesigns.Counter())
+	
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	s.Poke("en", 1)
+	s.Cycle(5)
+	if got := s.Peek("count"); got != 5 {
+		t.Errorf("count = %d after 5 cycles, want 5", got)
+	}
+	if s.Time() != 55000 {
+		t.Errorf("6 rising edges at 100 MHz should end at 55 ns, got %d ps", s.Time())
+	}
+	
+	s.Poke("en", 0)
+	s.Cycle(3)
+	if got := s.Peek("count"); got != 5 {
+		t.Errorf("count should hold while disabled, got %d", got)
+	}
+	
+	s.Poke("en", 1)
+	s.Cycle(251)
+	if got := s.Peek("count"); got != 0 {
+		t.Errorf("count should wrap at 8 bits, got %d", got)
+	}
+	
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Poking a register should panic")
+		}
+	}()
+	s.Poke("count_r", 1)
+}
+
+func TestNonblockingSwap(t *testing.T) {
+	m := core.NewModule("Swap")
+	m.Input("clk", 1)
+	m.Reg("x", 4)
+	m.Reg("y", 4)
+	m.Input("load", 1)
+	m.Always = append(m.Always,
+		"always @(posedge clk) begin",
+		"  if (load) begin",
+		"    x <= 4'h1;",
+		"    y <= 4'h2;",
+		"  end else begin",
+		"    x <= y;",
+		"    y <= x;",
+		"  end",
+		"end")
+	
+	s := newSim(t, m)
+	s.Poke("load", 1)
+	s.Cycle(1)
+	s.Poke("load", 0)
+	s.Cycle(1)
+	if s.Peek("x") != 2 || s.Peek("y") != 1 {
+		t.Errorf("Nonblocking assignments should swap, got x=%d y=%d", s.Peek("x"), s.Peek("y"))
+	}
+}
+
+func newMemCase() *hdl.Module {
+	m := core.NewModule("Mem")
+	m.Input("clk", 1)
+	addr := m.Input("addr", 4)
+	m.Input("wdata", 8)
+	m.Input("we", 1)
+	mem := m.SyncMem("ram", 8, 16)
+	m.Assign(m.Output("rdata", 8), mem.Read(addr))
+	m.Input("op", 2)
+	m.Reg("result", 8)
+	m.Always = append(m.Always,
+		"always @(posedge clk) "+mem.Write(addr, &hdl.Signal{Name: "wdata"}, &hdl.Signal{Name: "we"}),
+		"always @(*) begin",
+		"  case (op)",
+		"    2'd0: result = rdata;",
+		"    2'd1, 2'd2: result = ~rdata;",
+		"    default: result = 8'h00;",
+		"  endcase",
+		"end")
+	return m
+}
+
+func TestMemoryAndCase(t *testing.T) {
+	s := newSim(t, newMemCase())
+	s.Poke("addr", 3)
+	s.Poke("wdata", 0x5a)
+	s.Poke("we", 1)
+	s.Cycle(1)
+	s.Poke("we", 0)
+	if got := s.PeekMem("ram", 3); got != 0x5a {
+		t.Errorf("ram[3] = %#x, want 0x5a", got)
+	}
+	if got := s.Peek("rdata"); got != 0x5a {
+		t.Errorf("rdata = %#x, want 0x5a", got)
+	}
+	s.Poke("op", 2)
+	if got := s.Peek("result"); got != 0xa5 {
+		t.Errorf("result = %#x, want 0xa5", got)
+	}
+	s.PokeMem("ram", 7, 0x11)
+	s.Poke("addr", 7)
+	s.Poke("op", 0)
+	if got := s.Peek("result"); got != 0x11 {
+		t.Errorf("result = %#x after loading ram[7], want 0x11", got)
+	}
+}
+
+func TestChildInstances(t *testing.T) {
+	child := testdesigns.Counter()
+	top := core.NewModule("Top")
+	clk := top.Input("clk", 1)
+	rst := top.Input("rst", 1)
+	en := top.Input("en", 1)
+	for _, name := range []string{"u_a", "u_b"} {
+		top.InstanceOf(child, name).
+			Connect("clk", clk).
+			Connect("rst", rst).
+			Connect("en", en).
+			Connect("count", top.Wire(name+"_count", 8))
+	}
+	top.AssignExpr(top.Output("total", 9), "u_a_count + u_b_count")
+	
+	s := newSim(t, top)
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	s.Poke("en", 1)
+	s.Cycle(4)
+	if got := s.Peek("u_a.count_r"); got != 4 {
+		t.Errorf("u_a.count_r = %d, want 4", got)
+	}
+	if got := s.Peek("total"); got != 8 {
+		t.Errorf("total = %d, want 8", got)
+	}
+}
+
+func TestClockDomainRatios(t *testing.T) {
+	m := core.NewModule("TwoClocks")
+	fast := m.NewClockDomain("fast", m.Input("fast_clk", 1), m.Input("fast_rst", 1)).SetFrequency(200000000)
+	slow := m.NewClockDomain("slow", m.Input("slow_clk", 1), m.Input("slow_rst", 1)).SetFrequency(50000000)
+	m.Reg("fast_count", 16).WithClockDomain(fast)
+	m.Reg("slow_count", 16).WithClockDomain(slow)
+	m.Always = append(m.Always,
+		"always @(posedge fast_clk) fast_count <= fast_count + 16'h1;",
+		"always @(posedge slow_clk) slow_count <= slow_count + 16'h1;")
+	div := m.DividedClockDomain("div", fast, 4)
+	m.Reg("div_count", 16).WithClockDomain(div)
+	m.Always = append(m.Always, "always @(posedge div_clk) div_count <= div_count + 16'h1;")
+	
+	s := newSim(t, m)
+	s.CycleDomain(slow, 10)
+	if got := s.Peek("slow_count"); got != 10 {
+		t.Errorf("slow_count = %d, want 10", got)
+	}
+	// Both clocks rise half a period in: the 10th slow edge is at 190 ns,
+	// after 38 fast edges
+	if got := s.Peek("fast_count"); got != 38 {
+		t.Errorf("fast_count = %d after 10 slow cycles, want 38", got)
+	}
+	if got := s.Peek("div_count"); got != 10 {
+		t.Errorf("div_count = %d, want 10", got)
+	}
+	s.CycleDomain(div, 2)
+	if got := s.Peek("div_count"); got != 12 {
+		t.Errorf("div_count = %d, want 12", got)
+	}
+	if got := s.Peek("fast_count"); got != 44 {
+		t.Errorf("fast_count = %d after 2 divided cycles, want 44", got)
+	}
+}
+
+func newAsyncFIFO() (*hdl.Module, *hdl.AsyncFIFOPorts, *hdl.ClockDomain, *hdl.ClockDomain) {
+	m := core.NewModule("FIFO")
+	wr := m.NewClockDomain("wr", m.Input("wr_clk", 1), m.Input("wr_rst", 1)).SetFrequency(100000000)
+	rd := m.NewClockDomain("rd", m.Input("rd_clk", 1), m.Input("rd_rst", 1)).SetFrequency(37000000)
+	ports := m.AsyncFIFOWithConfig("f", 8, 4, wr, rd, hdl.AsyncFIFOConfig{})
+	return m, ports, wr, rd
+}
+
+func TestAsyncFIFO(t *testing.T) {
+	m, ports, wr, rd := newAsyncFIFO()
+	s := newSim(t, m)
+	s.Poke("wr_rst", 1)
+	s.Poke("rd_rst", 1)
+	s.CycleDomain(rd, 2)
+	s.Poke("wr_rst", 0)
+	s.Poke("rd_rst", 0)
+	
+	// Fill until full
+	var written []uint64
+	for i := uint64(1); s.Peek(ports.WrFull.Name) == 0; i++ {
+		s.Poke(ports.WrData.Name, i*11)
+		s.Poke(ports.WrEn.Name, 1)
+		s.CycleDomain(wr, 1)
+		written = append(written, i*11)
+	}
+	s.Poke(ports.WrEn.Name, 0)
+	if len(written) != 4 {
+		t.Fatalf("FIFO of depth 4 accepted %d writes", len(written))
+	}
+	
+	// Drain and compare
+	s.CycleDomain(rd, 3)
+	var read []uint64
+	for s.Peek(ports.RdEmpty.Name) == 0 {
+		s.Poke(ports.RdEn.Name, 1)
+		s.CycleDomain(rd, 1)
+		read = append(read, s.Peek(ports.RdData.Name))
+	}
+	if len(read) != 4 {
+		t.Fatalf("Read %d words, want 4", len(read))
+	}
+	for i := range read {
+		if read[i] != written[i] {
+			t.Errorf("Word %d: read %d, wrote %d", i, read[i], written[i])
+		}
+	}
+}
+
+func newArbiter() (*hdl.Module, *hdl.Mutex) {
+	m := core.NewModule("Arbiter")
+	clk := m.Input("clk", 1)
+	m.SetReset(m.Input("rst", 1))
+	mutex := m.Mutex("bus", 3, "round_robin")
+	mutex.GenerateRoundRobin(m, clk)
+	return m, mutex
+}
+
+// The destination valid of a data crossing is high exactly when the new
+// data is on the output
+func TestCDCValidAlignsWithData(t *testing.T) {
+	for _, kind := range []string{"handshake", "mux"} {
+		m := core.NewModule("Cross")
+		src := m.NewClockDomain("src", m.Input("src_clk", 1), m.Input("src_rst", 1)).SetFrequency(100000000)
+		dest := m.NewClockDomain("dest", m.Input("dest_clk", 1), m.Input("dest_rst", 1)).SetFrequency(37000000)
+		data := m.Input("data", 8).WithClockDomain(src)
+		load := m.Input("load", 1).WithClockDomain(src)
+		var destData, destValid *hdl.Signal
+		if kind == "handshake" {
+			destData, destValid, _ = m.HandshakeSynchronizer("x", data, load, dest)
+		} else {
+			destData, destValid = m.MuxSynchronizer("x", data, load, dest)
+		}
+		sim, err := New(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.Poke("src_rst", 1)
+		sim.Poke("dest_rst", 1)
+		sim.CycleDomain(dest, 2)
+		sim.Poke("src_rst", 0)
+		sim.Poke("dest_rst", 0)
+		sim.Cycle(1)
+		
+		sim.Poke("data", 0x5a)
+		sim.Poke("load", 1)
+		sim.Cycle(1)
+		sim.Poke("data", 0)
+		sim.Poke("load", 0)
+		pulses := 0
+		for i := 0; i < 20; i++ {
+			sim.CycleDomain(dest, 1)
+			if sim.Peek(destValid.Name) == 1 {
+				pulses++
+				if got := sim.Peek(destData.Name); got != 0x5a {
+					t.Errorf("%s: dest_data = %#x while valid is high, want 0x5a", kind, got)
+				}
+			}
+		}
+		if pulses != 1 {
+			t.Errorf("%s: valid was high for %d cycles, want 1", kind, pulses)
+		}
+		if got := sim.Peek(destData.Name); got != 0x5a {
+			t.Errorf("%s: dest_data = %#x after the transfer, want 0x5a", kind, got)
+		}
+	}
+}
+
+func TestMutexRoundRobin(t *testing.T) {
+	m, mutex := newArbiter()
+	s := newSim(t, m)
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	for _, req := range mutex.Requests {
+		s.Poke(req.Name, 1)
+	}
+	
+	seen := map[int]int{}
+	for cycle := 0; cycle < 9; cycle++ {
+		s.Cycle(1)
+		granted := 0
+		for i, g := range mutex.Grants {
+			if s.Peek(g.Name) == 1 {
+				granted++
+				seen[i]++
+			}
+		}
+		if granted > 1 {
+			t.Fatalf("Cycle %d: %d grants at once", cycle, granted)
+		}
+	}
+	for i := range mutex.Grants {
+		if seen[i] == 0 {
+			t.Errorf("Requester %d was never granted", i)
+		}
+	}
+}
+
+func TestUnsupportedDesigns(t *testing.T) {
+	// A 256-bit market-data word is beyond the simulator's single-word values
+	m := core.NewModule("Wide")
+	m.Input("md_word", 256)
+	m.Input("price", 64)
+	m.SyncMem("book", 128, 4)
+	want := "Wide cannot be simulated, values are limited to 64 bits: md_word (256 bits), memory book (128 bits)"
+	if _, err := New(m); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Signals wider than 64 bits should be rejected, got %v", err)
+	}
+	if _, err := NewFourState(m); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Four-state simulation should reject signals wider than 64 bits, got %v", err)
+	}
+	if _, err := Generate(m, "wide"); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Compiled models should reject signals wider than 64 bits, got %v", err)
+	}
+	
+	m = core.NewModule("WideExpr")
+	m.Input("a", 40)
+	m.Input("b", 40)
+	m.AssignExpr(m.Output("y", 8), "{a, b} >> 72")
+	if _, err := New(m); err == nil || !strings.Contains(err.Error(), "is 80 bits wide, the simulator supports up to 64") {
+		t.Errorf("Intermediate values wider than 64 bits should be rejected, got %v", err)
+	}
+	
+	m = core.NewModule("Undeclared")
+	m.AssignExpr(m.Output("y", 1), "missing")
+	if _, err := New(m); err == nil {
+		t.Errorf("Undeclared identifiers should be rejected")
+	}
+}
+
+func TestFIFOTemplate(t *testing.T) {
+	top := core.NewModule("Top")
+	m := top.InstantiateTemplate(hdl.FIFOTemplate(), "fifo", map[string]interface{}{
+		"DATA_WIDTH": hdl.Width(8),
+		"DEPTH":      4,
+		"FWFT":       true,
+	})
+	
+	s := newSim(t, m)
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	for _, v := range []uint64{7, 8, 9} {
+		s.Poke("wr_data", v)
+		s.Poke("wr_en", 1)
+		s.Cycle(1)
+	}
+	s.Poke("wr_en", 0)
+	if got := s.Peek("count"); got != 3 {
+		t.Errorf("count = %d, want 3", got)
+	}
+	for _, want := range []uint64{7, 8, 9} {
+		if s.Peek("rd_empty") == 1 {
+			t.Fatalf("FIFO empty before reading %d", want)
+		}
+		if got := s.Peek("rd_data"); got != want {
+			t.Errorf("rd_data = %d, want %d", got, want)
+		}
+		s.Poke("rd_en", 1)
+		s.Cycle(1)
+	}
+	if s.Peek("rd_empty") != 1 {
+		t.Errorf("FIFO should be empty after three reads")
+	}
+}
+
+func TestDeposit(t *testing.T) {
+	s := newSim(t, testdesigns.Counter())
+	s.Deposit("count_r", 0x1f0)
+	if got := s.Peek("count"); got != 0xf0 {
+		t.Errorf("count = %#x after depositing count_r, want 0xf0", got)
+	}
+	s.Poke("en", 1)
+	s.Cycle(1)
+	if got := s.Peek("count"); got != 0xf1 {
+		t.Errorf("count = %#x, want the deposited value plus one", got)
+	}
+}
+
+func TestOnClock(t *testing.T) {
+	s := newSim(t, testdesigns.Counter())
+	var seen []uint64
+	s.OnClock("clk", func() { seen = append(seen, s.Peek("count")) })
+	s.Poke("en", 1)
+	s.Cycle(3)
+	s.Run(1000)
+	// Values from before each edge
+	if fmt.Sprint(seen) != fmt.Sprint([]uint64{0, 1, 2}) {
+		t.Errorf("Sampled %v before the first three edges, want [0 1 2]", seen)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	for _, build := range []func(*hdl.Module) (*Simulator, error){New, NewFourState} {
+		s, err := build(newMemCase())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, op := range []uint64{1, 2, 3, 3} {
+			s.Poke("op", op)
+			s.Peek("result")
+		}
+		branches := s.Branches()
+		if len(branches) != 2 {
+			t.Fatalf("Expected the write enable and the case statement, got %d branches", len(branches))
+		}
+		b := branches[0]
+		if b.String() != "always block: case (op)" || fmt.Sprint(b.Arms) != "[2'h0 2'h1, 2'h2 default]" {
+			t.Errorf("Branch %s with arms %q", b, b.Arms)
+		}
+		// The initial settle ran the 2'd0 arm
+		if b.Hits[0] == 0 || b.Hits[1] == 0 || b.Hits[2] == 0 {
+			t.Errorf("Every arm should have run, got %v", b.Hits)
+		}
+	}
+}
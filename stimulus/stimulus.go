@@ -0,0 +1,369 @@
+// Package stimulus generates constrained-random input sequences for a
+// module's ports and drives them into the simulator.
+//
+//	g := stimulus.New(m, 42)
+//	g.Set(op, stimulus.Weighted(stimulus.Weight{Lo: 0, Hi: 0, Weight: 1}, stimulus.Weight{Lo: 1, Hi: 3, Weight: 3}))
+//	g.Set(length, stimulus.Range(1, 16))
+//	g.Constrain(func(v stimulus.Values) bool { return v["op"] != 0 || v["len"] <= 4 })
+//	g.Handshake(valid, ready, op, length)
+//	g.Run(sim, 1000)
+//
+// Every input except clocks and resets gets a random value each cycle,
+// uniform over its width unless Set says otherwise. The same seed and
+// constraints give the same sequence.
+package stimulus
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Values of the randomized ports for one cycle, by port name
+type Values map[string]uint64
+
+// Range of values and its share of the draws; a value in the range is then
+// chosen uniformly
+type Weight struct {
+	Lo, Hi uint64
+	Weight int
+}
+
+// Distribution of the values of one port
+type Dist struct {
+	weights []Weight
+	total   int
+}
+
+// Values from lo to hi inclusive, equally likely
+func Range(lo, hi uint64) Dist {
+	return Weighted(Weight{Lo: lo, Hi: hi, Weight: 1})
+}
+
+// A single value
+func Const(v uint64) Dist {
+	return Range(v, v)
+}
+
+// Ranges drawn in proportion to their weights
+func Weighted(weights ...Weight) Dist {
+	d := Dist{weights: weights}
+	for _, w := range weights {
+		if w.Lo > w.Hi {
+			panic(fmt.Sprintf("stimulus: range %d..%d is empty", w.Lo, w.Hi))
+		}
+		if w.Weight < 0 {
+			panic(fmt.Sprintf("stimulus: range %d..%d has negative weight %d", w.Lo, w.Hi, w.Weight))
+		}
+		d.total += w.Weight
+	}
+	if d.total == 0 {
+		panic("stimulus: distribution has no weight")
+	}
+	return d
+}
+
+func (d Dist) draw(rng *rand.Rand) uint64 {
+	pick := rng.Intn(d.total)
+	for _, w := range d.weights {
+		if pick < w.Weight {
+			return w.Lo + uniform(rng, w.Hi-w.Lo+1)
+		}
+		pick -= w.Weight
+	}
+	panic("unreachable")
+}
+
+// Uniform below n, where n of 0 stands for 2^64
+func uniform(rng *rand.Rand, n uint64) uint64 {
+	switch {
+	case n == 0:
+		return rng.Uint64()
+	case n <= 1<<62:
+		return uint64(rng.Int63n(int64(n)))
+	}
+	for {
+		if x := rng.Uint64(); x < n {
+			return x
+		}
+	}
+}
+
+func (d Dist) max() uint64 {
+	var max uint64
+	for _, w := range d.weights {
+		if w.Weight > 0 && w.Hi > max {
+			max = w.Hi
+		}
+	}
+	return max
+}
+
+// Port whose distribution depends on values drawn before it in the cycle
+type derived struct {
+	port string
+	fn   func(Values) Dist
+}
+
+// Valid/ready source rule: valid is raised at random, and once raised it
+// and the payload hold until ready is seen high on a clock edge
+type Handshake struct {
+	Valid   string
+	Ready   string
+	Payload []string
+	Rate    float64 // chance of raising valid on an idle cycle, 0.5 by default
+	Sent    int     // transfers completed so far
+
+	waiting bool // valid is up and ready has not been seen
+}
+
+// Constrained-random generator for the inputs of a module
+type Generator struct {
+	Module   *hdl.Module
+	MaxTries int // draws per cycle before the constraints are deemed unsatisfiable, 1000 by default
+
+	rng         *rand.Rand
+	ports       []*hdl.Signal // randomized inputs in declaration order, then resets asked for
+	inputs      map[string]*hdl.Signal
+	dists       map[string]Dist
+	derived     []derived
+	constraints []func(Values) bool
+	handshakes  []*Handshake
+	last        Values
+}
+
+// Generator for the module's inputs, reproducible from the seed
+func New(m *hdl.Module, seed int64) *Generator {
+	g := &Generator{
+		Module:   m,
+		MaxTries: 1000,
+		rng:      rand.New(rand.NewSource(seed)),
+		inputs:   make(map[string]*hdl.Signal),
+		dists:    make(map[string]Dist),
+	}
+	skip := map[*hdl.Signal]bool{m.Clock: true, m.Reset: true}
+	for _, cd := range m.ClockDomains {
+		skip[cd.Clock], skip[cd.Reset], skip[cd.RawReset] = true, true, true
+	}
+	for _, in := range m.Inputs {
+		g.inputs[in.Name] = in
+		if !skip[in] {
+			g.ports = append(g.ports, in)
+		}
+	}
+	return g
+}
+
+// Input port a constraint names, which must not be a clock
+func (g *Generator) port(sig *hdl.Signal) *hdl.Signal {
+	in, ok := g.inputs[sig.Name]
+	if !ok {
+		panic(fmt.Sprintf("stimulus: %s is not an input of %s", sig.Name, g.Module.Name))
+	}
+	for _, p := range g.ports {
+		if p == in {
+			return in
+		}
+	}
+	for _, cd := range g.Module.ClockDomains {
+		if cd.Clock == in {
+			panic(fmt.Sprintf("stimulus: %s is the clock of domain %s and cannot be randomized", in.Name, cd.Name))
+		}
+	}
+	if in == g.Module.Clock {
+		panic(fmt.Sprintf("stimulus: %s is the clock of %s and cannot be randomized", in.Name, g.Module.Name))
+	}
+	// A reset, randomized only when asked for
+	g.ports = append(g.ports, in)
+	return in
+}
+
+// Draw the port's values from a distribution
+func (g *Generator) Set(sig *hdl.Signal, d Dist) {
+	in := g.port(sig)
+	if max := d.max(); max > mask(in.Width) {
+		panic(fmt.Sprintf("stimulus: %d does not fit the %d bits of %s", max, int(in.Width), in.Name))
+	}
+	g.dists[in.Name] = d
+}
+
+// Choose the port's distribution from the values drawn before it in the
+// same cycle: ports with a fixed distribution first, then those set with
+// SetFunc in the order of the calls
+func (g *Generator) SetFunc(sig *hdl.Signal, fn func(Values) Dist) {
+	in := g.port(sig)
+	g.derived = append(g.derived, derived{port: in.Name, fn: fn})
+}
+
+// Require a relation between the values of a cycle; draws that break it
+// are thrown away
+func (g *Generator) Constrain(fn func(Values) bool) {
+	g.constraints = append(g.constraints, fn)
+}
+
+// Require a relation between the fields of a bundle, given to fn by field
+// name. The fields are the inputs named after them, e.g. pkt_len for the
+// len field of bundle pkt.
+func (g *Generator) ConstrainBundle(b *hdl.Bundle, fn func(Values) bool) {
+	names := map[string]string{}
+	for _, field := range Fields(b) {
+		g.port(field)
+		for name, sig := range b.Fields {
+			if sig == field {
+				names[name] = field.Name
+			}
+		}
+	}
+	g.Constrain(func(v Values) bool {
+		fields := Values{}
+		for name, port := range names {
+			fields[name] = v[port]
+		}
+		return fn(fields)
+	})
+}
+
+// Fields of a bundle sorted by name, to pass as a handshake payload
+func Fields(b *hdl.Bundle) []*hdl.Signal {
+	names := make([]string, 0, len(b.Fields))
+	for name := range b.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]*hdl.Signal, len(names))
+	for i, name := range names {
+		fields[i] = b.Fields[name]
+	}
+	return fields
+}
+
+// Drive valid and the payload as a valid/ready source. Ready is an output
+// of the module, sampled by Drive after the inputs are applied.
+func (g *Generator) Handshake(valid, ready *hdl.Signal, payload ...*hdl.Signal) *Handshake {
+	g.port(valid)
+	if _, ok := g.inputs[ready.Name]; ok {
+		panic(fmt.Sprintf("stimulus: ready %s is an input; randomize it with Set to act as a sink", ready.Name))
+	}
+	h := &Handshake{Valid: valid.Name, Ready: ready.Name, Rate: 0.5}
+	for _, p := range payload {
+		h.Payload = append(h.Payload, g.port(p).Name)
+	}
+	g.handshakes = append(g.handshakes, h)
+	return h
+}
+
+// Values for the next cycle
+func (g *Generator) Next() Values {
+	held := Values{}
+	for _, h := range g.handshakes {
+		if h.waiting {
+			held[h.Valid] = 1
+			for _, p := range h.Payload {
+				held[p] = g.last[p]
+			}
+		}
+	}
+
+	for try := 0; try < g.MaxTries; try++ {
+		v := Values{}
+		for _, in := range g.ports {
+			if value, ok := held[in.Name]; ok {
+				v[in.Name] = value
+				continue
+			}
+			if d, ok := g.dists[in.Name]; ok {
+				v[in.Name] = d.draw(g.rng)
+			} else if g.isDerived(in.Name) {
+				continue
+			} else if g.isReset(in) {
+				v[in.Name] = 0
+			} else {
+				v[in.Name] = g.rng.Uint64() & mask(in.Width)
+			}
+		}
+		for _, h := range g.handshakes {
+			if _, ok := held[h.Valid]; !ok {
+				v[h.Valid] = 0
+				if g.rng.Float64() < h.Rate {
+					v[h.Valid] = 1
+				}
+			}
+		}
+		for _, d := range g.derived {
+			if _, ok := held[d.port]; !ok {
+				v[d.port] = d.fn(v).draw(g.rng) & mask(g.inputs[d.port].Width)
+			}
+		}
+		if g.satisfied(v) {
+			g.last = v
+			return v
+		}
+	}
+	panic(fmt.Sprintf("stimulus: no values for %s meet the constraints after %d tries", g.Module.Name, g.MaxTries))
+}
+
+func (g *Generator) isDerived(name string) bool {
+	for _, d := range g.derived {
+		if d.port == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Resets stay inactive unless given a distribution
+func (g *Generator) isReset(in *hdl.Signal) bool {
+	if in == g.Module.Reset {
+		return true
+	}
+	for _, cd := range g.Module.ClockDomains {
+		if in == cd.Reset || in == cd.RawReset {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) satisfied(v Values) bool {
+	for _, c := range g.constraints {
+		if !c(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply the next cycle's values to the simulator and sample the ready
+// signals of the handshakes, ahead of the clock edge the caller steps
+func (g *Generator) Drive(sim *simulator.Simulator) Values {
+	v := g.Next()
+	for _, in := range g.ports {
+		sim.Poke(in.Name, v[in.Name])
+	}
+	for _, h := range g.handshakes {
+		fired := v[h.Valid] == 1 && sim.Peek(h.Ready)&1 == 1
+		if fired {
+			h.Sent++
+		}
+		h.waiting = v[h.Valid] == 1 && !fired
+	}
+	return v
+}
+
+// Drive random values for the given number of primary clock cycles
+func (g *Generator) Run(sim *simulator.Simulator, cycles int) {
+	for i := 0; i < cycles; i++ {
+		g.Drive(sim)
+		sim.Cycle(1)
+	}
+}
+
+func mask(width hdl.Width) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << uint(width)) - 1
+}
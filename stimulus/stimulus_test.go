@@ -0,0 +1,194 @@
+package stimulus
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Packet sink that is ready every other cycle and counts transfers
+func newSink() (*hdl.Module, *hdl.Bundle) {
+	m := core.NewModule("Sink")
+	clk := m.Input("clk", 1)
+	rst := m.Input("rst", 1)
+	m.Input("in_valid", 1)
+	pkt := &hdl.Bundle{Name: "pkt", Fields: map[string]*hdl.Signal{
+		"op":  m.Input("pkt_op", 2),
+		"len": m.Input("pkt_len", 5),
+	}}
+	m.Input("mode", 8)
+	m.Output("in_ready", 1)
+	m.Output("received", 8)
+	m.Reg("phase_r", 1)
+	m.Reg("count_r", 8)
+	m.AssignName("in_ready", "phase_r")
+	m.AssignName("received", "count_r")
+	m.Always = append(m.Always,
+		"always @(posedge clk) begin",
+		"  if (rst) begin",
+		"    phase_r <= 1'b0;",
+		"    count_r <= 8'h0;",
+		"  end else begin",
+		"    phase_r <= ~phase_r;",
+		"    if (in_valid && in_ready) count_r <= count_r + 8'h1;",
+		"  end",
+		"end")
+	m.NewClockDomain("sys", clk, rst)
+	return m, pkt
+}
+
+func expectPanic(t *testing.T, want string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), want) {
+			t.Errorf("Expected a panic containing %q, got %v", want, r)
+		}
+	}()
+	fn()
+}
+
+func TestDistributions(t *testing.T) {
+	m, pkt := newSink()
+	g := New(m, 1)
+	mode := m.Inputs[5]
+	g.Set(mode, Weighted(Weight{Lo: 0, Hi: 0, Weight: 3}, Weight{Lo: 10, Hi: 19, Weight: 1}))
+	g.Set(pkt.Fields["op"], Range(1, 2))
+	g.Set(pkt.Fields["len"], Const(7))
+
+	zeros := 0
+	for i := 0; i < 4000; i++ {
+		v := g.Next()
+		if _, ok := v["clk"]; ok {
+			t.Fatalf("The clock should not be randomized")
+		}
+		if v["rst"] != 0 {
+			t.Fatalf("The reset should stay inactive")
+		}
+		if v["mode"] == 0 {
+			zeros++
+		} else if v["mode"] < 10 || v["mode"] > 19 {
+			t.Fatalf("mode %d is outside its ranges", v["mode"])
+		}
+		if v["pkt_op"] < 1 || v["pkt_op"] > 2 || v["pkt_len"] != 7 {
+			t.Fatalf("Bundle fields out of range: %v", v)
+		}
+	}
+	// Three quarters of the draws should be 0
+	if zeros < 2800 || zeros > 3200 {
+		t.Errorf("mode was 0 in %d of 4000 draws, expected about 3000", zeros)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	m, pkt := newSink()
+	g := New(m, 2)
+	// Short packets for op 0, and op 3 only with even lengths
+	g.SetFunc(pkt.Fields["len"], func(v Values) Dist {
+		if v["pkt_op"] == 0 {
+			return Range(1, 4)
+		}
+		return Range(0, 31)
+	})
+	g.ConstrainBundle(pkt, func(f Values) bool {
+		return f["op"] != 3 || f["len"]%2 == 0
+	})
+	seen := map[uint64]bool{}
+	for i := 0; i < 2000; i++ {
+		v := g.Next()
+		seen[v["pkt_op"]] = true
+		if v["pkt_op"] == 0 && (v["pkt_len"] < 1 || v["pkt_len"] > 4) {
+			t.Fatalf("op 0 with length %d", v["pkt_len"])
+		}
+		if v["pkt_op"] == 3 && v["pkt_len"]%2 == 1 {
+			t.Fatalf("op 3 with odd length %d", v["pkt_len"])
+		}
+	}
+	if len(seen) != 4 {
+		t.Errorf("Every op should occur, saw %v", seen)
+	}
+
+	g.Constrain(func(v Values) bool { return v["mode"] > 255 })
+	expectPanic(t, "no values for Sink meet the constraints after 1000 tries", func() { g.Next() })
+}
+
+func TestSeed(t *testing.T) {
+	run := func(seed int64) []Values {
+		m, _ := newSink()
+		g := New(m, seed)
+		var out []Values
+		for i := 0; i < 50; i++ {
+			out = append(out, g.Next())
+		}
+		return out
+	}
+	if !reflect.DeepEqual(run(9), run(9)) {
+		t.Errorf("The same seed should give the same sequence")
+	}
+	if reflect.DeepEqual(run(9), run(10)) {
+		t.Errorf("Different seeds should give different sequences")
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	m, pkt := newSink()
+	sim, err := simulator.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := New(m, 3)
+	h := g.Handshake(m.Inputs[2], m.Outputs[0], Fields(pkt)...)
+	if !reflect.DeepEqual(h.Payload, []string{"pkt_len", "pkt_op"}) {
+		t.Errorf("Payload is %v", h.Payload)
+	}
+
+	sim.Poke("rst", 1)
+	sim.Cycle(2)
+	sim.Poke("rst", 0)
+	var prev Values
+	prevReady := uint64(1)
+	for i := 0; i < 500; i++ {
+		v := g.Drive(sim)
+		if prev != nil && prev["in_valid"] == 1 && prevReady == 0 {
+			if v["in_valid"] != 1 || v["pkt_op"] != prev["pkt_op"] || v["pkt_len"] != prev["pkt_len"] {
+				t.Fatalf("Cycle %d: valid or payload changed before ready: %v then %v", i, prev, v)
+			}
+		}
+		prev, prevReady = v, sim.Peek("in_ready")
+		sim.Cycle(1)
+	}
+	if h.Sent == 0 || uint64(h.Sent)%256 != sim.Peek("received") {
+		t.Errorf("Generator counted %d transfers, the sink %d", h.Sent, sim.Peek("received"))
+	}
+
+	g.Run(sim, 100)
+	if uint64(h.Sent)%256 != sim.Peek("received") {
+		t.Errorf("Run: generator counted %d transfers, the sink %d", h.Sent, sim.Peek("received"))
+	}
+}
+
+func TestInvalidConstraints(t *testing.T) {
+	m, pkt := newSink()
+	g := New(m, 0)
+	expectPanic(t, "8 does not fit the 2 bits of pkt_op", func() { g.Set(pkt.Fields["op"], Range(0, 8)) })
+	expectPanic(t, "range 5..4 is empty", func() { Range(5, 4) })
+	expectPanic(t, "distribution has no weight", func() { Weighted(Weight{Lo: 1, Hi: 2}) })
+	expectPanic(t, "clk is the clock of domain sys", func() { g.Set(m.Inputs[0], Const(1)) })
+	expectPanic(t, "received is not an input of Sink", func() { g.Set(m.Outputs[1], Const(1)) })
+	expectPanic(t, "ready in_valid is an input", func() { g.Handshake(m.Inputs[2], m.Inputs[2]) })
+
+	// Resets can be randomized when asked for
+	g.Set(m.Inputs[1], Weighted(Weight{Lo: 0, Hi: 0, Weight: 1}, Weight{Lo: 1, Hi: 1, Weight: 1}))
+	resets := 0
+	for i := 0; i < 100; i++ {
+		resets += int(g.Next()["rst"])
+	}
+	if resets == 0 || resets == 100 {
+		t.Errorf("rst was high in %d of 100 cycles", resets)
+	}
+}
@@ -0,0 +1,394 @@
+// Package testbench drives simulated modules from Go tests: poke inputs,
+// peek and expect outputs, step clocks and fork concurrent driver threads.
+//
+//	tb := testbench.New(t, m)
+//	tb.Reset(2)
+//	tb.Poke(en, 1)
+//	tb.Step(4)
+//	tb.Expect(count, 4)
+//
+// Forked threads run one at a time in fork order and advance together:
+// the clock only moves once every live thread is waiting in Step or Join.
+//
+// Assertions and assumptions of the design fail the test as they fail.
+// NewFourState simulates x and z as well: Expect fails on unknown bits, and
+// X reaching an output or control signal after Reset fails the test.
+//
+// Verilog turns vectors, written by hand or recorded from a test with
+// Record, into a self-checking testbench for an external simulator.
+package testbench
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+	"github.com/SoulPancake/HFT/vcd"
+)
+
+// Simulated module under test
+type Tester struct {
+	T      testing.TB
+	Sim    *simulator.Simulator
+	Module *hdl.Module
+
+	primary  string
+	cycles   int
+	threads  []*Thread
+	current  *Thread
+	failures int // property failures reported so far
+}
+
+// Concurrent driver or monitor started with Fork
+type Thread struct {
+	tb        *Tester
+	fn        func()
+	wake      chan struct{}
+	clock     string // clock net the thread waits on
+	remaining int    // rising edges left to wait for
+	joining   *Thread
+	started   bool
+	done      bool
+}
+
+// Build the simulator for the module, failing the test if it cannot be
+// simulated
+func New(t testing.TB, m *hdl.Module) *Tester {
+	t.Helper()
+	sim, err := simulator.New(m)
+	if err != nil {
+		t.Fatalf("testbench: cannot simulate %s: %v", m.Name, err)
+	}
+	return newTester(t, m, sim)
+}
+
+// Drive a model generated from the module by simulator.Generate instead of
+// interpreting the design
+func NewCompiled(t testing.TB, m *hdl.Module, e simulator.Engine) *Tester {
+	t.Helper()
+	sim, err := simulator.NewCompiled(m, e)
+	if err != nil {
+		t.Fatalf("testbench: cannot simulate %s: %v", m.Name, err)
+	}
+	return newTester(t, m, sim)
+}
+
+// Simulate in four states: registers start unknown and X reaching an
+// output, a mutex grant or a control signal after Reset fails the test
+func NewFourState(t testing.TB, m *hdl.Module) *Tester {
+	t.Helper()
+	sim, err := simulator.NewFourState(m)
+	if err != nil {
+		t.Fatalf("testbench: cannot simulate %s: %v", m.Name, err)
+	}
+	tb := newTester(t, m, sim)
+	t.Cleanup(func() {
+		for _, v := range sim.XViolations() {
+			t.Errorf("testbench: %v", v)
+		}
+	})
+	return tb
+}
+
+func newTester(t testing.TB, m *hdl.Module, sim *simulator.Simulator) *Tester {
+	tb := &Tester{T: t, Sim: sim, Module: m}
+	if clocks := sim.Clocks(); len(clocks) > 0 {
+		tb.primary = clocks[0]
+	}
+	main := &Thread{tb: tb, wake: make(chan struct{}), started: true}
+	tb.threads = []*Thread{main}
+	tb.current = main
+	t.Cleanup(tb.reportFailures)
+	return tb
+}
+
+// Fail the test for assertions and assumptions that failed since the last
+// report
+func (tb *Tester) reportFailures() {
+	failures := tb.Sim.PropertyFailures()
+	for _, f := range failures[tb.failures:] {
+		tb.T.Errorf("testbench: %v", f)
+	}
+	tb.failures = len(failures)
+}
+
+// Drive an input
+func (tb *Tester) Poke(sig *hdl.Signal, value uint64) {
+	tb.PokePath(sig.Name, value)
+}
+
+// Drive a signal by flat name, e.g. "u_core.enable"
+func (tb *Tester) PokePath(name string, value uint64) {
+	tb.Sim.Poke(name, value)
+}
+
+// Current value of a signal
+func (tb *Tester) Peek(sig *hdl.Signal) uint64 {
+	return tb.PeekPath(sig.Name)
+}
+
+// Current value of a signal by flat name
+func (tb *Tester) PeekPath(name string) uint64 {
+	return tb.Sim.Peek(name)
+}
+
+// Check a signal's value, reporting the cycle and time on mismatch
+func (tb *Tester) Expect(sig *hdl.Signal, want uint64) bool {
+	tb.T.Helper()
+	return tb.ExpectPath(sig.Name, want)
+}
+
+// Check a signal's value by flat name
+func (tb *Tester) ExpectPath(name string, want uint64) bool {
+	tb.T.Helper()
+	if _, unknown := tb.Sim.PeekX(name); unknown != 0 {
+		tb.T.Errorf("%s: %s = %s, want %s", tb.location(), name, tb.Sim.PeekBits(name), formatValue(want))
+		return false
+	}
+	got := tb.Sim.Peek(name)
+	if got != want {
+		tb.T.Errorf("%s: %s = %s, want %s", tb.location(), name, formatValue(got), formatValue(want))
+		return false
+	}
+	return true
+}
+
+func formatValue(v uint64) string {
+	return fmt.Sprintf("%#x (%d)", v, v)
+}
+
+func (tb *Tester) location() string {
+	return fmt.Sprintf("cycle %d (%d ps)", tb.cycles, tb.Sim.Time())
+}
+
+// Rising edges of the primary clock so far
+func (tb *Tester) Cycle() int {
+	return tb.cycles
+}
+
+// Advance the calling thread by n cycles of the primary clock
+func (tb *Tester) Step(n int) {
+	if tb.primary == "" {
+		panic("testbench: the design has no clock to step")
+	}
+	tb.wait(tb.primary, n)
+}
+
+// Advance the calling thread by n cycles of a domain's clock
+func (tb *Tester) StepDomain(cd *hdl.ClockDomain, n int) {
+	tb.wait(tb.Sim.Netlist.Resolve(cd.Clock.Name), n)
+}
+
+// Hold the module's resets for the given number of primary clock cycles,
+// then release them. Resets are the module reset and the external reset of
+// every clock domain. Four-state simulations check for X from then on.
+func (tb *Tester) Reset(cycles int) {
+	resets := tb.resets()
+	for _, rst := range resets {
+		tb.PokePath(rst, 1)
+	}
+	tb.Step(cycles)
+	for _, rst := range resets {
+		tb.PokePath(rst, 0)
+	}
+	tb.Sim.WatchX()
+}
+
+func (tb *Tester) resets() []string {
+	var names []string
+	for _, rst := range resetInputs(tb.Module, tb.Sim) {
+		names = append(names, rst.name)
+	}
+	return names
+}
+
+// Reset input and the clock it is released on
+type resetInput struct {
+	name  string
+	clock string // empty when the design has no clock
+}
+
+// Active-high reset inputs of the module: the module reset, released on
+// the primary clock, and the external reset of every clock domain, released
+// on the domain's clock when the simulator drives it
+func resetInputs(m *hdl.Module, sim *simulator.Simulator) []resetInput {
+	var resets []resetInput
+	clocks := sim.Clocks()
+	primary := ""
+	if len(clocks) > 0 {
+		primary = clocks[0]
+	}
+	seen := map[string]bool{}
+	add := func(sig *hdl.Signal, clock string) {
+		if sig != nil && !seen[sig.Name] {
+			if net, ok := sim.Netlist.Nets[sig.Name]; ok && net.Kind == "input" {
+				seen[sig.Name] = true
+				resets = append(resets, resetInput{name: sig.Name, clock: clock})
+			}
+		}
+	}
+	add(m.Reset, primary)
+	for _, cd := range m.ClockDomains {
+		clock := primary
+		if cd.Clock != nil {
+			root := sim.Netlist.Resolve(cd.Clock.Name)
+			for _, c := range clocks {
+				if c == root {
+					clock = c
+				}
+			}
+		}
+		if cd.RawReset != nil {
+			add(cd.RawReset, clock)
+		} else {
+			add(cd.Reset, clock)
+		}
+	}
+	return resets
+}
+
+// Dump the simulation to a VCD file from now until the test ends
+func (tb *Tester) WriteVCD(path string, opts vcd.Options) *vcd.Writer {
+	tb.T.Helper()
+	w, err := vcd.Create(path, tb.Sim, opts)
+	if err != nil {
+		tb.T.Fatalf("testbench: %v", err)
+	}
+	tb.T.Cleanup(func() {
+		if err := w.Close(); err != nil {
+			tb.T.Errorf("testbench: writing %s: %v", path, err)
+		}
+	})
+	return w
+}
+
+// Start fn as a thread running alongside the caller. It first runs when
+// the caller next waits.
+func (tb *Tester) Fork(fn func()) *Thread {
+	th := &Thread{tb: tb, fn: fn, wake: make(chan struct{})}
+	tb.threads = append(tb.threads, th)
+	return th
+}
+
+// Wait for the thread to finish
+func (th *Thread) Join() {
+	tb := th.tb
+	self := tb.current
+	if self == th {
+		panic("testbench: a thread cannot join itself")
+	}
+	if th.done {
+		return
+	}
+	self.joining = th
+	tb.schedule(self)
+	self.joining = nil
+}
+
+// Whether the thread has finished
+func (th *Thread) Done() bool {
+	return th.done
+}
+
+func (tb *Tester) wait(clock string, n int) {
+	if n <= 0 {
+		return
+	}
+	self := tb.current
+	self.clock = clock
+	self.remaining = n
+	tb.schedule(self)
+}
+
+func (th *Thread) runnable() bool {
+	if th.done {
+		return false
+	}
+	if th.remaining > 0 {
+		return false
+	}
+	return th.joining == nil || th.joining.done
+}
+
+// Hand control to the next runnable thread, advancing the clocks while
+// every thread is waiting. Returns once from may run again.
+func (tb *Tester) schedule(from *Thread) {
+	next := tb.nextRunnable()
+	for next == nil {
+		if !tb.advance() {
+			panic("testbench: every thread is blocked joining another")
+		}
+		next = tb.nextRunnable()
+	}
+	if next == from {
+		return
+	}
+	tb.current = next
+	if next.started {
+		next.wake <- struct{}{}
+	} else {
+		next.started = true
+		go next.run()
+	}
+	if from.done {
+		return
+	}
+	<-from.wake
+}
+
+func (tb *Tester) nextRunnable() *Thread {
+	for _, th := range tb.threads {
+		if th.runnable() {
+			return th
+		}
+	}
+	return nil
+}
+
+// Step the simulator to the next clock edge and count down the waits of
+// threads whose clock rose. False if no thread is waiting on a clock.
+func (tb *Tester) advance() bool {
+	clocks := map[string]uint64{}
+	for _, th := range tb.threads {
+		if !th.done && th.remaining > 0 {
+			clocks[th.clock] = 0
+		}
+	}
+	if len(clocks) == 0 {
+		return false
+	}
+	if tb.primary != "" {
+		clocks[tb.primary] = 0
+	}
+	for name := range clocks {
+		clocks[name] = tb.Sim.Peek(name)
+	}
+	tb.Sim.Step()
+	tb.reportFailures()
+	rose := map[string]bool{}
+	for name, before := range clocks {
+		rose[name] = before == 0 && tb.Sim.Peek(name) == 1
+	}
+	if rose[tb.primary] {
+		tb.cycles++
+	}
+	for _, th := range tb.threads {
+		if !th.done && th.remaining > 0 && rose[th.clock] {
+			th.remaining--
+		}
+	}
+	return true
+}
+
+func (th *Thread) run() {
+	tb := th.tb
+	defer func() {
+		if r := recover(); r != nil {
+			tb.T.Errorf("%s: forked thread failed: %v", tb.location(), r)
+		}
+		th.done = true
+		tb.schedule(th)
+	}()
+	th.fn()
+}
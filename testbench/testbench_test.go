@@ -0,0 +1,248 @@
+package testbench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/simmodels/counter"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/types"
+	"github.com/SoulPancake/HFT/vcd"
+)
+
+// Records failures instead of failing the enclosing test
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func newCounter() (*hdl.Module, *hdl.Signal, *hdl.Signal) {
+	m := testdesigns.Counter()
+	m.SetReset(m.Inputs[1])
+	return m, m.Inputs[2], m.Outputs[0]
+}
+
+func TestPokePeekStep(t *testing.T) {
+	m, en, count := newCounter()
+	tb := New(t, m)
+	
+	tb.Poke(en, 1)
+	tb.Reset(2)
+	tb.Expect(count, 0)
+	tb.Step(3)
+	tb.Expect(count, 3)
+	tb.ExpectPath("count_r", 3)
+	if tb.Cycle() != 5 {
+		t.Errorf("Cycle() = %d, want 5", tb.Cycle())
+	}
+	tb.Poke(en, 0)
+	tb.Step(2)
+	if tb.Peek(count) != 3 {
+		t.Errorf("Counter should hold while disabled")
+	}
+}
+
+func TestCompiledModel(t *testing.T) {
+	m, en, count := newCounter()
+	tb := NewCompiled(t, m, counter.New())
+	
+	tb.Poke(en, 1)
+	tb.Reset(2)
+	tb.Step(300)
+	tb.Expect(count, 300%256)
+	if tb.Cycle() != 302 {
+		t.Errorf("Cycle() = %d, want 302", tb.Cycle())
+	}
+}
+
+func TestExpectMessage(t *testing.T) {
+	m, en, count := newCounter()
+	rec := &recorder{TB: t}
+	tb := New(rec, m)
+	
+	tb.Poke(en, 1)
+	tb.Step(4)
+	if tb.Expect(count, 5) {
+		t.Errorf("Expect should report the mismatch")
+	}
+	if len(rec.errors) != 1 {
+		t.Fatalf("Expected one failure, got %v", rec.errors)
+	}
+	want := "cycle 4 (35000 ps): count = 0x4 (4), want 0x5 (5)"
+	if rec.errors[0] != want {
+		t.Errorf("Failure message = %q, want %q", rec.errors[0], want)
+	}
+}
+
+func TestFourState(t *testing.T) {
+	m, en, count := newCounter()
+	rec := &recorder{TB: t}
+	// The unknown enable is reported when the test ends; cleanups run last
+	// registered first, so this sees the testbench's report
+	t.Cleanup(func() {
+		if len(rec.errors) != 2 || !strings.Contains(rec.errors[1], "unknown condition en") {
+			t.Errorf("Failures after the test = %q", rec.errors)
+		}
+	})
+	tb := NewFourState(rec, m)
+
+	if tb.Expect(count, 0) {
+		t.Errorf("Expect should fail on a register that was never reset")
+	}
+	tb.Reset(1)
+	tb.Poke(en, 1)
+	tb.Step(2)
+	tb.Expect(count, 2)
+	tb.Sim.PokeBits(en.Name, "x")
+	tb.Step(1)
+	tb.Sim.PokeBits(en.Name, "1")
+	tb.Step(1)
+	tb.Expect(count, 3)
+
+	want := []string{
+		"cycle 0 (0 ps): count = xxxxxxxx, want 0x0 (0)",
+	}
+	if fmt.Sprint(rec.errors) != fmt.Sprint(want) {
+		t.Errorf("Failures = %q, want %q", rec.errors, want)
+	}
+}
+
+func TestAssertionFailure(t *testing.T) {
+	m, en, _ := newCounter()
+	m.SetClock(m.Inputs[0])
+	m.Assert("small", &hdl.Signal{Name: "count_r != 8'd2", Width: 1}, nil)
+	rec := &recorder{TB: t}
+	tb := New(rec, m)
+
+	tb.Poke(en, 1)
+	tb.Reset(1)
+	tb.Step(2)
+	if len(rec.errors) != 0 {
+		t.Fatalf("Unexpected failures %v", rec.errors)
+	}
+	tb.Step(1)
+	if len(rec.errors) != 1 || !strings.HasPrefix(rec.errors[0], "testbench: cycle 4 (35000 ps): assertion small failed (testbench_test.go:") {
+		t.Errorf("Failures = %q", rec.errors)
+	}
+}
+
+func TestForkedDrivers(t *testing.T) {
+	top := core.NewModule("Top")
+	fifo := top.InstantiateTemplate(hdl.FIFOTemplate(), "fifo", map[string]interface{}{
+		"DATA_WIDTH": hdl.Width(8),
+		"DEPTH":      4,
+		"FWFT":       true,
+	})
+	tb := New(t, fifo)
+	tb.Reset(1)
+	
+	// Producer pushes more words than the FIFO holds while the consumer
+	// drains it at half rate
+	var received []uint64
+	producer := tb.Fork(func() {
+		for v := uint64(1); v <= 10; {
+			if tb.PeekPath("wr_full") == 0 {
+				tb.PokePath("wr_data", v)
+				tb.PokePath("wr_en", 1)
+				v++
+			} else {
+				tb.PokePath("wr_en", 0)
+			}
+			tb.Step(1)
+		}
+		tb.PokePath("wr_en", 0)
+	})
+	consumer := tb.Fork(func() {
+		for len(received) < 10 {
+			if tb.PeekPath("rd_empty") == 0 {
+				received = append(received, tb.PeekPath("rd_data"))
+				tb.PokePath("rd_en", 1)
+				tb.Step(1)
+				tb.PokePath("rd_en", 0)
+			}
+			tb.Step(1)
+		}
+	})
+	producer.Join()
+	consumer.Join()
+	
+	if !producer.Done() || !consumer.Done() {
+		t.Fatalf("Threads should be done after Join")
+	}
+	if len(received) != 10 {
+		t.Fatalf("Received %d words, want 10", len(received))
+	}
+	for i, v := range received {
+		if v != uint64(i+1) {
+			t.Errorf("Word %d = %d, want %d", i, v, i+1)
+		}
+	}
+}
+
+func TestForkAcrossDomains(t *testing.T) {
+	m := core.NewModule("TwoClocks")
+	fast := m.NewClockDomain("fast", m.Input("fast_clk", 1), m.Input("fast_rst", 1)).SetFrequency(200000000)
+	slow := m.NewClockDomain("slow", m.Input("slow_clk", 1), m.Input("slow_rst", 1)).SetFrequency(50000000)
+	
+	tb := New(t, m)
+	var events []string
+	done := tb.Fork(func() {
+		for i := 0; i < 2; i++ {
+			tb.StepDomain(slow, 1)
+			events = append(events, fmt.Sprintf("slow@%d", tb.Sim.Time()))
+		}
+	})
+	for i := 0; i < 4; i++ {
+		tb.StepDomain(fast, 2)
+		events = append(events, fmt.Sprintf("fast@%d", tb.Sim.Time()))
+	}
+	done.Join()
+	
+	got := strings.Join(events, " ")
+	want := "fast@7500 slow@10000 fast@17500 fast@27500 slow@30000 fast@37500"
+	if got != want {
+		t.Errorf("Thread interleaving = %q, want %q", got, want)
+	}
+}
+
+func TestForkedThreadFailure(t *testing.T) {
+	m, _, _ := newCounter()
+	rec := &recorder{TB: t}
+	tb := New(rec, m)
+	
+	th := tb.Fork(func() {
+		tb.Step(1)
+		tb.PokePath("no_such_signal", 1)
+	})
+	th.Join()
+	if len(rec.errors) != 1 || !strings.Contains(rec.errors[0], "forked thread failed: simulator: no signal no_such_signal") {
+		t.Errorf("Thread panic should be reported, got %v", rec.errors)
+	}
+}
+
+func TestWriteVCD(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.vcd")
+	t.Run("dump", func(t *testing.T) {
+		m, en, _ := newCounter()
+		tb := New(t, m)
+		tb.WriteVCD(path, vcd.Options{Signals: []string{"clk", "count"}})
+		tb.Poke(en, 1)
+		tb.Reset(1)
+		tb.Step(2)
+	})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("The dump should be written when the test ends: %v", err)
+	}
+	if !strings.Contains(string(data), "b10 \"\n") {
+		t.Errorf("The dump should record count reaching 2:\n%s", data)
+	}
+}
@@ -0,0 +1,280 @@
+package testbench
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// One cycle of a generated testbench: the inputs are applied before a
+// rising edge of the primary clock and the outputs are checked on the
+// falling edge after it. Inputs left out keep their value, outputs left
+// out are not checked. Designs without a clock wait 10 ns instead.
+type Vector struct {
+	Inputs map[string]uint64
+	Expect map[string]uint64
+}
+
+// Options of a generated Verilog testbench
+type VerilogOptions struct {
+	Name        string // testbench module, "testbench" by default
+	ResetCycles int    // cycles the resets are held for before the vectors, none when 0
+	VCD         string // waveform file, no dump when empty
+}
+
+// Self-checking Verilog testbench applying the vectors to the module. Every
+// clock input is generated at its domain's frequency, as the native
+// simulator does. With ResetCycles set, the resets are held that many
+// cycles of their domain's clock and released one domain after the other.
+// The testbench reports each mismatch and ends printing PASS or FAIL.
+func Verilog(m *hdl.Module, vectors []Vector, opts VerilogOptions) (string, error) {
+	sim, err := simulator.New(m)
+	if err != nil {
+		return "", fmt.Errorf("testbench: cannot simulate %s: %v", m.Name, err)
+	}
+	clocks := sim.Clocks()
+	isClock := map[string]bool{}
+	for _, c := range clocks {
+		isClock[c] = true
+	}
+	inputs := map[string]*hdl.Signal{}
+	for _, sig := range m.Inputs {
+		inputs[sig.Name] = sig
+	}
+	outputs := map[string]*hdl.Signal{}
+	for _, sig := range m.Outputs {
+		outputs[sig.Name] = sig
+	}
+	for i, v := range vectors {
+		for name := range v.Inputs {
+			if inputs[name] == nil {
+				return "", fmt.Errorf("testbench: vector %d drives %s, which is not an input of %s", i, name, m.Name)
+			}
+			if isClock[name] {
+				return "", fmt.Errorf("testbench: vector %d drives clock %s, which the testbench generates", i, name)
+			}
+		}
+		for name := range v.Expect {
+			if outputs[name] == nil {
+				return "", fmt.Errorf("testbench: vector %d expects %s, which is not an output of %s", i, name, m.Name)
+			}
+		}
+	}
+	name := opts.Name
+	if name == "" {
+		name = "testbench"
+	}
+	resets := resetInputs(m, sim)
+	isReset := map[string]bool{}
+	for _, rst := range resets {
+		isReset[rst.name] = opts.ResetCycles > 0
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "`timescale 1ns/1ps\n\n")
+	fmt.Fprintf(&b, "// Self-checking testbench for %s\n\n", m.Name)
+	fmt.Fprintf(&b, "module %s;\n\n", name)
+	for _, sig := range m.Inputs {
+		fmt.Fprintf(&b, "  reg %s;\n", declaration(sig))
+	}
+	for _, sig := range m.Outputs {
+		fmt.Fprintf(&b, "  wire %s;\n", declaration(sig))
+	}
+	fmt.Fprintf(&b, "  integer errors;\n\n")
+
+	fmt.Fprintf(&b, "  // Device under test\n")
+	fmt.Fprintf(&b, "  %s dut (\n", m.Name)
+	var ports []string
+	for _, sig := range append(append([]*hdl.Signal{}, m.Inputs...), m.Outputs...) {
+		ports = append(ports, fmt.Sprintf("    .%s(%s)", sig.Name, sig.Name))
+	}
+	fmt.Fprintf(&b, "%s\n  );\n\n", strings.Join(ports, ",\n"))
+
+	if len(clocks) > 0 {
+		fmt.Fprintf(&b, "  // Clocks\n")
+		for _, c := range clocks {
+			fmt.Fprintf(&b, "  initial %s = 1'b0;\n", c)
+			fmt.Fprintf(&b, "  always #%s %s = ~%s;\n", halfPeriod(sim, c), c, c)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	if opts.VCD != "" {
+		fmt.Fprintf(&b, "  initial begin\n")
+		fmt.Fprintf(&b, "    $dumpfile(%q);\n", opts.VCD)
+		fmt.Fprintf(&b, "    $dumpvars(0, %s);\n", name)
+		fmt.Fprintf(&b, "  end\n\n")
+	}
+
+	fmt.Fprintf(&b, "  initial begin\n")
+	fmt.Fprintf(&b, "    errors = 0;\n")
+	for _, sig := range m.Inputs {
+		if isClock[sig.Name] {
+			continue
+		}
+		v := uint64(0)
+		if isReset[sig.Name] {
+			v = 1
+		}
+		fmt.Fprintf(&b, "    %s = %s;\n", sig.Name, literal(sig, v))
+	}
+	if opts.ResetCycles > 0 && len(resets) > 0 {
+		fmt.Fprintf(&b, "\n    // Reset sequence\n")
+		for _, rst := range resets {
+			if rst.clock == "" {
+				fmt.Fprintf(&b, "    #%d %s = 1'b0;\n", 10*opts.ResetCycles, rst.name)
+				continue
+			}
+			fmt.Fprintf(&b, "    repeat (%d) @(posedge %s);\n", opts.ResetCycles, rst.clock)
+			fmt.Fprintf(&b, "    @(negedge %s) %s = 1'b0;\n", rst.clock, rst.name)
+		}
+	}
+
+	for i, v := range vectors {
+		fmt.Fprintf(&b, "\n    // Vector %d\n", i)
+		for _, sig := range m.Inputs {
+			if value, ok := v.Inputs[sig.Name]; ok {
+				fmt.Fprintf(&b, "    %s = %s;\n", sig.Name, literal(sig, value))
+			}
+		}
+		if len(clocks) > 0 {
+			fmt.Fprintf(&b, "    @(posedge %s);\n", clocks[0])
+			fmt.Fprintf(&b, "    @(negedge %s);\n", clocks[0])
+		} else {
+			fmt.Fprintf(&b, "    #10;\n")
+		}
+		for _, sig := range m.Outputs {
+			value, ok := v.Expect[sig.Name]
+			if !ok {
+				continue
+			}
+			want := literal(sig, value)
+			fmt.Fprintf(&b, "    if (%s !== %s) begin\n", sig.Name, want)
+			fmt.Fprintf(&b, "      $display(\"FAIL vector %d at %%0t: %s = %%h, expected %%h\", $time, %s, %s);\n", i, sig.Name, sig.Name, want)
+			fmt.Fprintf(&b, "      errors = errors + 1;\n")
+			fmt.Fprintf(&b, "    end\n")
+		}
+	}
+
+	fmt.Fprintf(&b, "\n    if (errors == 0)\n")
+	fmt.Fprintf(&b, "      $display(\"PASS: %d vectors\");\n", len(vectors))
+	fmt.Fprintf(&b, "    else\n")
+	fmt.Fprintf(&b, "      $display(\"FAIL: %%0d mismatches in %d vectors\", errors);\n", len(vectors))
+	fmt.Fprintf(&b, "    $finish;\n")
+	fmt.Fprintf(&b, "  end\n\n")
+	fmt.Fprintf(&b, "endmodule\n")
+	return b.String(), nil
+}
+
+// Write the testbench generated by Verilog to a file
+func WriteVerilog(path string, m *hdl.Module, vectors []Vector, opts VerilogOptions) error {
+	text, err := Verilog(m, vectors, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(text), 0644)
+}
+
+func declaration(sig *hdl.Signal) string {
+	if sig.Width <= 1 {
+		return sig.Name
+	}
+	return fmt.Sprintf("[%d:0] %s", int(sig.Width)-1, sig.Name)
+}
+
+// Sized hexadecimal literal, e.g. 8'h1e
+func literal(sig *hdl.Signal, v uint64) string {
+	width := int(sig.Width)
+	if width < 1 {
+		width = 1
+	}
+	return fmt.Sprintf("%d'h%x", width, v)
+}
+
+// Half period of a clock in nanoseconds, rounded to picoseconds like the
+// native simulator
+func halfPeriod(sim *simulator.Simulator, clock string) string {
+	freq := simulator.DefaultFrequency
+	if cd := sim.Netlist.ClockDomainOf(clock); cd != nil && cd.Frequency > 0 {
+		freq = cd.Frequency
+	}
+	ps := uint64(1e12 / float64(freq) / 2)
+	if ps == 0 {
+		ps = 1
+	}
+	ns := fmt.Sprintf("%d.%03d", ps/1000, ps%1000)
+	return strings.TrimSuffix(strings.TrimRight(ns, "0"), ".")
+}
+
+// Records a native simulation as vectors for a generated testbench: the
+// inputs at each rising edge of the primary clock and the outputs once the
+// edge has settled. Inputs are recorded when they change, outputs every
+// cycle except bits the simulation does not know. Start recording before
+// the design is reset so the testbench resets it too.
+type Recorder struct {
+	Vectors []Vector
+
+	sim     *simulator.Simulator
+	module  *hdl.Module
+	inputs  map[string]uint64 // values of the last vector
+	pending *Vector           // inputs recorded, outputs not yet settled
+}
+
+// Record the simulation of the module from now on
+func Record(m *hdl.Module, sim *simulator.Simulator) *Recorder {
+	clocks := sim.Clocks()
+	if len(clocks) == 0 {
+		panic(fmt.Sprintf("testbench: %s has no clock to record vectors on", m.Name))
+	}
+	r := &Recorder{sim: sim, module: m}
+	isClock := map[string]bool{}
+	for _, c := range clocks {
+		isClock[c] = true
+	}
+	sim.OnClock(clocks[0], func() {
+		v := &Vector{Inputs: map[string]uint64{}, Expect: map[string]uint64{}}
+		for _, sig := range m.Inputs {
+			if isClock[sig.Name] {
+				continue
+			}
+			value := sim.Peek(sig.Name)
+			if old, ok := r.inputs[sig.Name]; !ok || old != value {
+				v.Inputs[sig.Name] = value
+			}
+		}
+		if r.inputs == nil {
+			r.inputs = map[string]uint64{}
+		}
+		for name, value := range v.Inputs {
+			r.inputs[name] = value
+		}
+		r.pending = v
+	})
+	sim.Observe(func() {
+		v := r.pending
+		if v == nil {
+			return
+		}
+		r.pending = nil
+		for _, sig := range m.Outputs {
+			value, unknown := sim.PeekX(sig.Name)
+			if unknown == 0 {
+				v.Expect[sig.Name] = value
+			}
+		}
+		r.Vectors = append(r.Vectors, *v)
+	})
+	return r
+}
+
+// Record the vectors of the test from now on
+func (tb *Tester) Record() *Recorder {
+	return Record(tb.Module, tb.Sim)
+}
+
+// Testbench replaying the recorded vectors
+func (r *Recorder) Verilog(opts VerilogOptions) (string, error) {
+	return Verilog(r.module, r.Vectors, opts)
+}
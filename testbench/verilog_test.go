@@ -0,0 +1,148 @@
+package testbench
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+)
+
+func TestVerilogCombinational(t *testing.T) {
+	m := core.NewModule("Adder")
+	m.Input("a", 8)
+	m.Input("b", 8)
+	m.Output("sum", 8)
+	m.AssignName("sum", "a + b")
+
+	vectors := []Vector{
+		{Inputs: map[string]uint64{"a": 10, "b": 20}, Expect: map[string]uint64{"sum": 30}},
+		{Inputs: map[string]uint64{"a": 100, "b": 27}, Expect: map[string]uint64{"sum": 127}},
+	}
+	path := filepath.Join(t.TempDir(), "testbench.v")
+	if err := WriteVerilog(path, m, vectors, VerilogOptions{VCD: "dump.vcd"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"`timescale 1ns/1ps\n",
+		"module testbench;\n",
+		"  reg [7:0] a;\n  reg [7:0] b;\n  wire [7:0] sum;\n",
+		"  Adder dut (\n    .a(a),\n    .b(b),\n    .sum(sum)\n  );\n",
+		"    $dumpfile(\"dump.vcd\");\n    $dumpvars(0, testbench);\n",
+		"    // Vector 0\n    a = 8'ha;\n    b = 8'h14;\n    #10;\n    if (sum !== 8'h1e) begin\n",
+		"$display(\"FAIL vector 1 at %0t: sum = %h, expected %h\", $time, sum, 8'h7f);",
+		"$display(\"PASS: 2 vectors\");",
+		"$display(\"FAIL: %0d mismatches in 2 vectors\", errors);",
+		"    $finish;\n  end\n\nendmodule\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Testbench lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "always #") {
+		t.Errorf("A combinational design needs no clock:\n%s", text)
+	}
+
+	bad := []Vector{{Inputs: map[string]uint64{"sum": 1}}}
+	if _, err := Verilog(m, bad, VerilogOptions{}); err == nil || !strings.Contains(err.Error(), "vector 0 drives sum, which is not an input of Adder") {
+		t.Errorf("Driving an output should fail, got %v", err)
+	}
+	bad = []Vector{{Expect: map[string]uint64{"a": 1}}}
+	if _, err := Verilog(m, bad, VerilogOptions{}); err == nil || !strings.Contains(err.Error(), "vector 0 expects a, which is not an output of Adder") {
+		t.Errorf("Expecting an input should fail, got %v", err)
+	}
+}
+
+func TestVerilogClocksAndResets(t *testing.T) {
+	m := core.NewModule("TwoClocks")
+	m.NewClockDomain("fast", m.Input("fast_clk", 1), m.Input("fast_rst", 1)).SetFrequency(200000000)
+	m.NewClockDomain("slow", m.Input("slow_clk", 1), m.Input("slow_rst", 1)).SetFrequency(30000000)
+	m.Input("go", 1)
+	m.Output("busy", 1)
+	m.Reg("busy_r", 1)
+	m.AssignName("busy", "busy_r")
+	m.Always = append(m.Always,
+		"always @(posedge fast_clk) begin",
+		"  if (fast_rst) busy_r <= 1'b0;",
+		"  else busy_r <= go;",
+		"end")
+
+	vectors := []Vector{{Inputs: map[string]uint64{"go": 1}, Expect: map[string]uint64{"busy": 1}}}
+	text, err := Verilog(m, vectors, VerilogOptions{Name: "tb_two", ResetCycles: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"module tb_two;\n",
+		"  initial fast_clk = 1'b0;\n  always #2.5 fast_clk = ~fast_clk;\n",
+		"  always #16.666 slow_clk = ~slow_clk;\n",
+		"    fast_rst = 1'h1;\n    slow_rst = 1'h1;\n    go = 1'h0;\n",
+		"    // Reset sequence\n" +
+			"    repeat (3) @(posedge fast_clk);\n    @(negedge fast_clk) fast_rst = 1'b0;\n" +
+			"    repeat (3) @(posedge slow_clk);\n    @(negedge slow_clk) slow_rst = 1'b0;\n",
+		"    go = 1'h1;\n    @(posedge fast_clk);\n    @(negedge fast_clk);\n    if (busy !== 1'h1) begin\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Testbench lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "$dumpfile") {
+		t.Errorf("No waveform was asked for:\n%s", text)
+	}
+	if _, err := Verilog(m, []Vector{{Inputs: map[string]uint64{"slow_clk": 1}}}, VerilogOptions{}); err == nil || !strings.Contains(err.Error(), "drives clock slow_clk") {
+		t.Errorf("Driving a clock should fail, got %v", err)
+	}
+}
+
+func TestRecordVectors(t *testing.T) {
+	m, en, count := newCounter()
+	tb := New(t, m)
+	rec := tb.Record()
+	tb.Reset(2)
+	tb.Poke(en, 1)
+	tb.Step(3)
+	tb.Poke(en, 0)
+	tb.Step(1)
+	tb.Expect(count, 3)
+
+	if len(rec.Vectors) != 6 {
+		t.Fatalf("Recorded %d vectors, want 6: %+v", len(rec.Vectors), rec.Vectors)
+	}
+	first := rec.Vectors[0]
+	if first.Inputs["rst"] != 1 || first.Inputs["en"] != 0 || len(first.Inputs) != 2 {
+		t.Errorf("The first vector should hold every input, got %v", first.Inputs)
+	}
+	if len(rec.Vectors[1].Inputs) != 0 {
+		t.Errorf("Inputs that did not change should not be recorded again, got %v", rec.Vectors[1].Inputs)
+	}
+	var counts []uint64
+	for _, v := range rec.Vectors {
+		counts = append(counts, v.Expect["count"])
+	}
+	if got := counts; len(got) != 6 || got[2] != 1 || got[4] != 3 || got[5] != 3 {
+		t.Errorf("Recorded counts %v, want [0 0 1 2 3 3]", got)
+	}
+
+	text, err := rec.Verilog(VerilogOptions{VCD: "counter.vcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    // Vector 2\n    rst = 1'h0;\n    en = 1'h1;\n    @(posedge clk);\n    @(negedge clk);\n    if (count !== 8'h1) begin\n",
+		"$display(\"PASS: 6 vectors\");",
+		"  always #5 clk = ~clk;\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Testbench lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Reset sequence") {
+		t.Errorf("A recording resets the design through its vectors:\n%s", text)
+	}
+}
@@ -137,6 +137,90 @@ func TestAsyncFIFO(t *testing.T) {
 	}
 }
 
+func TestAsyncFIFOGrayPointers(t *testing.T) {
+	m := &Module{Name: "AsyncFIFOGrayTest"}
+	
+	wrDomain := m.NewClockDomain("wr", &Signal{Name: "wr_clk", Width: 1, Kind: "input"}, &Signal{Name: "wr_rst", Width: 1, Kind: "input"})
+	rdDomain := m.NewClockDomain("rd", &Signal{Name: "rd_clk", Width: 1, Kind: "input"}, &Signal{Name: "rd_rst", Width: 1, Kind: "input"})
+	
+	// Non power-of-two depth is rounded up
+	ports := m.AsyncFIFOWithConfig("f", 8, 12, wrDomain, rdDomain, AsyncFIFOConfig{})
+	
+	if ports.Memory.Depth != 16 {
+		t.Errorf("Expected memory depth rounded up to 16, got %d", ports.Memory.Depth)
+	}
+	if ports.WrLevel.Width != 5 || ports.RdLevel.Width != 5 {
+		t.Errorf("Expected 5-bit fill levels, got %d and %d", ports.WrLevel.Width, ports.RdLevel.Width)
+	}
+	if ports.WrAlmostFull != nil || ports.RdAlmostEmpty != nil {
+		t.Errorf("Almost flags should not be created without thresholds")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign f_wr_gray_next = (f_wr_bin_next >> 1) ^ f_wr_bin_next;",
+		"assign f_rd_ptr_sync_bin = {^f_rd_ptr_sync_sync_stage1[4], ^f_rd_ptr_sync_sync_stage1[4:3]",
+		"f_wr_full_r <= (f_wr_gray_next == {~f_rd_ptr_sync_sync_stage1[4:3], f_rd_ptr_sync_sync_stage1[2:0]});",
+		"f_rd_empty_r <= (f_rd_gray_next == f_wr_ptr_sync_sync_stage1);",
+		"if (f_wr_push) f_mem[f_wr_bin[3:0]] <= f_wr_data;",
+		"if (f_rd_pop) f_rd_data_r <= f_mem[f_rd_bin[3:0]];",
+		"assign f_wr_full = f_wr_full_r;",
+		"assign f_rd_empty = f_rd_empty_r;",
+		"assign f_rd_data = f_rd_data_r;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing async FIFO logic: %s", check)
+		}
+	}
+}
+
+func TestAsyncFIFOWithoutResets(t *testing.T) {
+	m := &Module{Name: "AsyncFIFONoReset"}
+	
+	wrDomain := m.NewClockDomain("wr", &Signal{Name: "wr_clk", Width: 1, Kind: "input"}, nil)
+	rdDomain := m.NewClockDomain("rd", &Signal{Name: "rd_clk", Width: 1, Kind: "input"}, nil)
+	m.AsyncFIFOWithConfig("f", 8, 4, wrDomain, rdDomain, AsyncFIFOConfig{})
+	
+	logic := strings.Join(m.Always, "\n")
+	if strings.Contains(logic, "if (") && strings.Contains(logic, "_rst") {
+		t.Errorf("Domains without a reset should get no reset branch:\n%s", logic)
+	}
+	for _, check := range []string{
+		"always @(posedge wr_clk) begin\n  f_wr_bin <= f_wr_bin_next;",
+		"always @(posedge wr_clk) if (f_wr_push) f_mem[f_wr_bin[1:0]] <= f_wr_data;",
+		"always @(posedge rd_clk) begin\n  f_rd_bin <= f_rd_bin_next;",
+	} {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing async FIFO logic %q in:\n%s", check, logic)
+		}
+	}
+}
+
+func TestAsyncFIFOThresholds(t *testing.T) {
+	m := &Module{Name: "AsyncFIFOThresholdTest"}
+	
+	wrDomain := m.NewClockDomain("wr", &Signal{Name: "wr_clk", Width: 1, Kind: "input"}, &Signal{Name: "wr_rst", Width: 1, Kind: "input"})
+	rdDomain := m.NewClockDomain("rd", &Signal{Name: "rd_clk", Width: 1, Kind: "input"}, &Signal{Name: "rd_rst", Width: 1, Kind: "input"})
+	
+	ports := m.AsyncFIFOWithConfig("f", 8, 16, wrDomain, rdDomain, AsyncFIFOConfig{AlmostFull: 14, AlmostEmpty: 2})
+	
+	if ports.WrAlmostFull == nil || ports.WrAlmostFull.ClockDomain != wrDomain {
+		t.Fatalf("Expected almost-full output in write domain")
+	}
+	if ports.RdAlmostEmpty == nil || ports.RdAlmostEmpty.ClockDomain != rdDomain {
+		t.Fatalf("Expected almost-empty output in read domain")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n")
+	if !strings.Contains(logic, "assign f_wr_almost_full = f_wr_level >= 5'he;") {
+		t.Errorf("Almost-full comparison not found")
+	}
+	if !strings.Contains(logic, "assign f_rd_almost_empty = f_rd_level <= 5'h2;") {
+		t.Errorf("Almost-empty comparison not found")
+	}
+}
+
 // === MUTEX TESTS ===
 
 func TestMutexCreation(t *testing.T) {
@@ -217,6 +301,170 @@ func TestMutexPriority(t *testing.T) {
 	}
 }
 
+func TestMutexRotatingPriority(t *testing.T) {
+	m := &Module{Name: "RotatingPriorityTest"}
+	clk := m.Input("clk", 1)
+	rst := m.Input("rst", 1)
+	
+	mutex := m.Mutex("rr", 4, "round_robin")
+	mutex.Generate(m, clk, rst)
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign rr_req_vec = {rr_req_3, rr_req_2, rr_req_1, rr_req_0};",
+		"assign rr_masked_req = rr_req_vec & {(rr_counter <= 3), (rr_counter <= 2), (rr_counter <= 1), (rr_counter <= 0)};",
+		"(rr_masked_req & (~rr_masked_req + 4'h1))",
+		"assign rr_grant_2 = rr_grant_r[2];",
+		"assign rr_arb = 1'b1;",
+		"if (rr_arb && rr_next_grant[3]) rr_counter <= 0;",
+		"if (rst) begin",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing round-robin logic: %s", check)
+		}
+	}
+}
+
+func TestMutexFIFOArbitration(t *testing.T) {
+	m := &Module{Name: "FIFOArbiterTest"}
+	clk := m.Input("clk", 1)
+	
+	mutex := m.Mutex("age", 3, "fifo")
+	mutex.Generate(m, clk, nil)
+	
+	// One age bit per pair of requesters
+	olderRegs := 0
+	for _, reg := range m.Regs {
+		if strings.HasPrefix(reg.Name, "age_older_") {
+			olderRegs++
+		}
+	}
+	if olderRegs != 3 {
+		t.Errorf("Expected 3 age matrix registers, got %d", olderRegs)
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign age_age_0_1 = !age_waiting_1 || (age_waiting_0 && age_older_0_1);",
+		"(age_req_1 && (!age_req_0 || !age_age_0_1) && (!age_req_2 || age_age_1_2))",
+		"age_waiting_2 <= age_req_2 && !(age_arb && age_next_grant[2]);",
+		"age_older_1_2 <= age_age_1_2;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing FIFO arbitration logic: %s", check)
+		}
+	}
+}
+
+func TestMutexHoldAndLock(t *testing.T) {
+	m := &Module{Name: "HoldLockTest"}
+	clk := m.Input("clk", 1)
+	
+	mutex := m.Mutex("bus", 2, "priority").SetHold(true)
+	locks := mutex.AddLocks(m)
+	mutex.Generate(m, clk, nil)
+	
+	if len(locks) != 2 || locks[1].Name != "bus_lock_1" {
+		t.Fatalf("Expected lock inputs bus_lock_0 and bus_lock_1")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n")
+	if !strings.Contains(logic, "assign bus_arb = !((bus_grant_r[0] && (bus_req_0 || bus_lock_0)) || (bus_grant_r[1] && (bus_req_1 || bus_lock_1)));") {
+		t.Errorf("Ownership hold condition not found")
+	}
+	if !strings.Contains(logic, "assign bus_next_grant = {(bus_req_1), (bus_req_0 && !bus_req_1)};") {
+		t.Errorf("Registered priority encoder not found")
+	}
+}
+
+func TestMutexWeightedRoundRobin(t *testing.T) {
+	m := &Module{Name: "WeightedTest"}
+	clk := m.Input("clk", 1)
+	rst := m.Input("rst", 1)
+	
+	mutex := m.Mutex("egress", 3, "weighted_round_robin")
+	weights := mutex.AddWeights(m, 4)
+	mutex.Generate(m, clk, rst)
+	
+	if len(weights) != 3 || weights[2].Name != "egress_weight_2" || weights[2].Width != 4 {
+		t.Fatalf("Expected 4-bit weight inputs egress_weight_0..2")
+	}
+	if mutex.GrantIdx == nil || mutex.GrantIdx.Width != 2 {
+		t.Fatalf("Expected 2-bit grant index output")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"(egress_req_0 && (egress_weight_0 != 0))",
+		"assign egress_arb = !(((egress_grant_r & egress_req_vec) != 0 && egress_credit != 0));",
+		"if (egress_arb && egress_next_grant[1]) egress_credit <= egress_weight_1 - 1;",
+		"if (!egress_arb && egress_credit != 0) egress_credit <= egress_credit - 1;",
+		"assign egress_grant_idx = {(egress_grant_2), (egress_grant_1)};",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing weighted round-robin logic: %s", check)
+		}
+	}
+}
+
+func TestMutexMatrix(t *testing.T) {
+	m := &Module{Name: "MatrixTest"}
+	clk := m.Input("clk", 1)
+	rst := m.Input("rst", 1)
+	
+	mutex := m.Mutex("lrg", 3, "matrix")
+	mutex.Generate(m, clk, rst)
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"(lrg_req_2 && (!lrg_req_0 || !lrg_prio_0_2) && (!lrg_req_1 || !lrg_prio_1_2))",
+		"lrg_prio_0_1 <= 1;",
+		"if (lrg_arb && lrg_next_grant[0]) lrg_prio_0_1 <= 0;",
+		"if (lrg_arb && lrg_next_grant[2]) lrg_prio_1_2 <= 1;",
+		"assign lrg_grant_idx = {(lrg_grant_2), (lrg_grant_1)};",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing matrix arbitration logic: %s", check)
+		}
+	}
+}
+
+func TestMutexGrantIndex(t *testing.T) {
+	m := &Module{Name: "GrantIndexTest"}
+	mutex := m.Mutex("arb", 5, "priority")
+	mutex.GeneratePriority(m)
+	idx := mutex.AddGrantIndex(m)
+	
+	if idx.Width != 3 {
+		t.Errorf("Expected 3-bit grant index, got %d", idx.Width)
+	}
+	if mutex.AddGrantIndex(m) != idx {
+		t.Errorf("Grant index should only be created once")
+	}
+	
+	expected := "assign arb_grant_idx = {(arb_grant_4), (arb_grant_2 || arb_grant_3), (arb_grant_1 || arb_grant_3)};"
+	if m.Assigns[len(m.Assigns)-1] != expected {
+		t.Errorf("Expected %q, got %q", expected, m.Assigns[len(m.Assigns)-1])
+	}
+}
+
+func TestMutexUnknownArbitration(t *testing.T) {
+	m := &Module{Name: "UnknownTest"}
+	clk := m.Input("clk", 1)
+	mutex := m.Mutex("bad", 2, "lottery")
+	
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for unknown arbitration")
+		}
+	}()
+	mutex.Generate(m, clk, nil)
+}
+
 // === POLYMORPHISM TESTS ===
 
 func TestModuleTemplateCreation(t *testing.T) {
@@ -317,8 +565,8 @@ func TestFIFOTemplate(t *testing.T) {
 		t.Errorf("Expected template name 'GenericFIFO', got '%s'", template.Name)
 	}
 	
-	if len(template.TypeParams) != 2 {
-		t.Errorf("Expected 2 type parameters, got %d", len(template.TypeParams))
+	if len(template.TypeParams) != 7 {
+		t.Errorf("Expected 7 type parameters, got %d", len(template.TypeParams))
 	}
 	
 	// Test instantiation
@@ -334,7 +582,7 @@ func TestFIFOTemplate(t *testing.T) {
 	
 	// Check FIFO interface
 	expectedInputs := 5  // clk, rst, wr_data, wr_en, rd_en
-	expectedOutputs := 3 // wr_full, rd_data, rd_empty
+	expectedOutputs := 4 // wr_full, rd_data, rd_empty, count
 	
 	if len(instance.Inputs) != expectedInputs {
 		t.Errorf("Expected %d inputs, got %d", expectedInputs, len(instance.Inputs))
@@ -349,6 +597,114 @@ func TestFIFOTemplate(t *testing.T) {
 	}
 }
 
+func TestFIFOTemplateLogic(t *testing.T) {
+	hostModule := &Module{Name: "Host"}
+	instance := hostModule.InstantiateTemplate(FIFOTemplate(), "fifo_8x16", map[string]interface{}{
+		"DATA_WIDTH": Width(8),
+		"DEPTH":      16,
+	})
+	
+	logic := strings.Join(instance.Assigns, "\n") + "\n" + strings.Join(instance.Always, "\n")
+	checks := []string{
+		"assign wr_full = count == 5'h10;",
+		"assign rd_empty = mem_count == 5'h0;",
+		"assign rd_data = dout;",
+		"if (push) fifo_mem[wr_ptr] <= wr_data;",
+		"if (mem_rd) dout <= fifo_mem[rd_ptr];",
+		"if (push) wr_ptr <= wr_ptr + 1;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing FIFO logic: %s", check)
+		}
+	}
+}
+
+func TestFIFOTemplateOptions(t *testing.T) {
+	hostModule := &Module{Name: "Host"}
+	instance := hostModule.InstantiateTemplate(FIFOTemplate(), "fifo_fwft", map[string]interface{}{
+		"DATA_WIDTH":   Width(8),
+		"DEPTH":        12,
+		"ALMOST_FULL":  10,
+		"ALMOST_EMPTY": 2,
+		"FWFT":         true,
+		"ERROR_FLAGS":  true,
+	})
+	
+	// wr_full, rd_data, rd_empty, count, almost_full, almost_empty, overflow, underflow
+	if len(instance.Outputs) != 8 {
+		t.Errorf("Expected 8 outputs, got %d", len(instance.Outputs))
+	}
+	
+	logic := strings.Join(instance.Assigns, "\n") + "\n" + strings.Join(instance.Always, "\n")
+	checks := []string{
+		"assign rd_data = fifo_mem[rd_ptr];",
+		"assign almost_full = count >= 4'ha;",
+		"assign almost_empty = count <= 4'h2;",
+		"if (push) wr_ptr <= (wr_ptr == 11) ? 0 : wr_ptr + 1;",
+		"overflow_r <= wr_en && wr_full;",
+		"underflow_r <= rd_en && rd_empty;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing FIFO logic: %s", check)
+		}
+	}
+	
+	// FWFT with an output register prefetches the head word
+	prefetch := hostModule.InstantiateTemplate(FIFOTemplate(), "fifo_prefetch", map[string]interface{}{
+		"DATA_WIDTH": Width(8),
+		"DEPTH":      16,
+		"FWFT":       true,
+		"OUTPUT_REG": true,
+	})
+	logic = strings.Join(prefetch.Assigns, "\n")
+	if !strings.Contains(logic, "assign rd_empty = !dout_valid;") {
+		t.Errorf("Prefetch FIFO should derive empty from the output register")
+	}
+	if !strings.Contains(logic, "assign count = mem_count + {4'b0, dout_valid};") {
+		t.Errorf("Prefetch FIFO count should include the output register")
+	}
+	
+	// A one-word count has no upper bits to zero-extend
+	single := hostModule.InstantiateTemplate(FIFOTemplate(), "fifo_single", map[string]interface{}{
+		"DATA_WIDTH": Width(8),
+		"DEPTH":      1,
+		"FWFT":       true,
+		"OUTPUT_REG": true,
+	})
+	logic = strings.Join(single.Assigns, "\n")
+	if !strings.Contains(logic, "assign count = mem_count + dout_valid;") || strings.Contains(logic, "0'b0") {
+		t.Errorf("Depth-1 prefetch FIFO count should add the output register directly:\n%s", logic)
+	}
+}
+
+func TestTemplateDefaults(t *testing.T) {
+	template := NewModuleTemplate("Test", []string{"WIDTH", "SIGNED"})
+	template.AddConstraint("WIDTH", Width(0))
+	template.AddConstraint("SIGNED", false).AddDefault("SIGNED", true)
+	
+	var got map[string]interface{}
+	template.SetGenerator(func(params map[string]interface{}) *Module {
+		got = params
+		return &Module{Name: "Test", Parameters: make(map[string]interface{})}
+	})
+	
+	hostModule := &Module{Name: "Host"}
+	hostModule.InstantiateTemplate(template, "test", map[string]interface{}{"WIDTH": Width(4)})
+	
+	if got["SIGNED"] != true {
+		t.Errorf("Expected default SIGNED=true, got %v", got["SIGNED"])
+	}
+	
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for wrongly typed optional argument")
+		}
+	}()
+	hostModule.InstantiateTemplate(template, "test", map[string]interface{}{"WIDTH": Width(4), "SIGNED": 1})
+}
+
 func TestRegisterFileTemplate(t *testing.T) {
 	template := RegisterFileTemplate()
 	
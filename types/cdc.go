@@ -0,0 +1,224 @@
+package hdl
+
+import (
+	"fmt"
+)
+
+// Characteristics of a signal that decide how it crosses clock domains
+type CDCTraits struct {
+	Pulse   bool    // single-cycle event rather than a level
+	Counter bool    // value changes by at most one per source cycle
+	Valid   *Signal // qualifier for multi-bit data, pulsed when Data is loaded
+	Held    bool    // data stays stable long enough for the destination to sample it
+}
+
+// Signals produced by a clock domain crossing
+type CDCCrossing struct {
+	Kind  string  // "direct", "flop", "pulse", "gray", "handshake", "mux"
+	Data  *Signal // data (or pulse/level) in the destination domain
+	Valid *Signal // destination-domain strobe, high for the cycle Data first holds a new value
+	Ready *Signal // source-domain ready, for handshake crossings
+}
+
+// Pick and build the crossing that suits the signal:
+//   - domains derived from the same source clock need no synchronizer
+//   - single-bit levels use a flop synchronizer
+//   - single-bit pulses use a toggle pulse synchronizer
+//   - counters are Gray coded before crossing
+//   - multi-bit data qualified by Valid uses a mux (MCP) synchronizer when
+//     the source holds it stable, otherwise a four-phase handshake
+func (m *Module) CrossDomain(name string, src *Signal, destDomain *ClockDomain, traits CDCTraits) *CDCCrossing {
+	switch {
+	case src.ClockDomain != nil && src.ClockDomain.SynchronousWith(destDomain):
+		return &CDCCrossing{Kind: "direct", Data: src, Valid: traits.Valid}
+	case src.Width == 1 && traits.Pulse:
+		return &CDCCrossing{Kind: "pulse", Data: m.PulseSynchronizer(name, src, destDomain)}
+	case traits.Counter:
+		return &CDCCrossing{Kind: "gray", Data: m.GrayCounterSynchronizer(name, src, destDomain)}
+	case src.Width == 1 && traits.Valid == nil:
+		return &CDCCrossing{Kind: "flop", Data: m.CDCSynchronizer(name, src, destDomain, 2)}
+	case traits.Valid != nil && traits.Held:
+		data, valid := m.MuxSynchronizer(name, src, traits.Valid, destDomain)
+		return &CDCCrossing{Kind: "mux", Data: data, Valid: valid}
+	case traits.Valid != nil:
+		data, valid, ready := m.HandshakeSynchronizer(name, src, traits.Valid, destDomain)
+		return &CDCCrossing{Kind: "handshake", Data: data, Valid: valid, Ready: ready}
+	default:
+		panic(fmt.Sprintf("Multi-bit signal %s needs a Valid qualifier or the Counter trait to cross clock domains", src.Name))
+	}
+}
+
+// Toggle-based pulse synchronizer. Each source pulse flips a toggle flop;
+// the destination detects edges of the synchronized toggle. Source pulses
+// must be separated by at least two destination clock cycles.
+func (m *Module) PulseSynchronizer(name string, pulse *Signal, destDomain *ClockDomain) *Signal {
+	srcDomain := sourceDomain(pulse)
+	
+	toggle := m.Reg(name+"_toggle", 1).WithClockDomain(srcDomain)
+	m.clockedBlock(srcDomain,
+		[]string{fmt.Sprintf("%s <= 0;", toggle.Name)},
+		[]string{fmt.Sprintf("if (%s) %s <= ~%s;", pulse.Name, toggle.Name, toggle.Name)})
+	
+	toggleSync := m.CDCSynchronizer(name+"_toggle", toggle, destDomain, 2)
+	
+	prev := m.Reg(name+"_toggle_prev", 1).WithClockDomain(destDomain)
+	m.clockedBlock(destDomain,
+		[]string{fmt.Sprintf("%s <= 0;", prev.Name)},
+		[]string{fmt.Sprintf("%s <= %s;", prev.Name, toggleSync.Name)})
+	
+	out := m.Wire(name+"_pulse", 1).WithClockDomain(destDomain)
+	m.Assign(out, toggleSync.Xor(prev))
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name: name, Kind: "pulse", SrcDomain: srcDomain, DestDomain: destDomain, Output: out,
+	})
+	return out
+}
+
+// Four-phase req/ack handshake for multi-bit data. valid loads data when
+// the returned ready is high; the destination gets the data with a
+// one-cycle valid strobe, registered so it rises together with destData.
+// Returns (destData, destValid, srcReady).
+func (m *Module) HandshakeSynchronizer(name string, data *Signal, valid *Signal, destDomain *ClockDomain) (*Signal, *Signal, *Signal) {
+	srcDomain := sourceDomain(data)
+	
+	// Source side: hold the data and raise req until ack returns
+	hold := m.Reg(name+"_hold", data.Width).WithClockDomain(srcDomain)
+	req := m.Reg(name+"_req", 1).WithClockDomain(srcDomain)
+	ready := m.Wire(name+"_ready", 1).WithClockDomain(srcDomain)
+	
+	// Destination side: capture on the rising edge of the synchronized req
+	ack := m.Reg(name+"_ack", 1).WithClockDomain(destDomain)
+	load := m.Wire(name+"_load", 1).WithClockDomain(destDomain)
+	destData := m.Reg(name+"_dest_data", data.Width).WithClockDomain(destDomain)
+	destValid := m.Reg(name+"_dest_valid", 1).WithClockDomain(destDomain)
+	
+	reqSync := m.CDCSynchronizer(name+"_req", req, destDomain, 2)
+	ackSync := m.CDCSynchronizer(name+"_ack", ack, srcDomain, 2)
+	
+	m.Assign(ready, req.LogicNot().LogicAnd(ackSync.LogicNot()))
+	m.Assign(load, reqSync.LogicAnd(ack.LogicNot()))
+	
+	m.clockedBlock(srcDomain,
+		[]string{
+			fmt.Sprintf("%s <= 0;", req.Name),
+			fmt.Sprintf("%s <= 0;", hold.Name),
+		},
+		[]string{
+			fmt.Sprintf("if (%s && %s) begin", ready.Name, valid.Name),
+			fmt.Sprintf("  %s <= %s;", hold.Name, data.Name),
+			fmt.Sprintf("  %s <= 1;", req.Name),
+			fmt.Sprintf("end else if (%s && %s) begin", req.Name, ackSync.Name),
+			fmt.Sprintf("  %s <= 0;", req.Name),
+			"end",
+		})
+	m.clockedBlock(destDomain,
+		[]string{
+			fmt.Sprintf("%s <= 0;", ack.Name),
+			fmt.Sprintf("%s <= 0;", destData.Name),
+			fmt.Sprintf("%s <= 0;", destValid.Name),
+		},
+		[]string{
+			fmt.Sprintf("%s <= %s;", ack.Name, reqSync.Name),
+			fmt.Sprintf("if (%s) %s <= %s;", load.Name, destData.Name, hold.Name),
+			fmt.Sprintf("%s <= %s;", destValid.Name, load.Name),
+		})
+	
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name: name, Kind: "handshake", SrcDomain: srcDomain, DestDomain: destDomain,
+		Captures: []*Signal{destData}, Output: destData,
+	})
+	return destData, destValid, ready
+}
+
+// Mux-recirculation (MCP) synchronizer. load captures data into a source
+// register and its pulse crosses through a pulse synchronizer; the
+// destination register recirculates its value until the synchronized load
+// arrives, and a registered valid strobe rises with the new value. The
+// source must not load again until the destination has sampled (at least
+// three destination cycles). Returns (destData, destValid).
+func (m *Module) MuxSynchronizer(name string, data *Signal, load *Signal, destDomain *ClockDomain) (*Signal, *Signal) {
+	srcDomain := sourceDomain(data)
+	
+	hold := m.Reg(name+"_hold", data.Width).WithClockDomain(srcDomain)
+	m.clockedBlock(srcDomain,
+		[]string{fmt.Sprintf("%s <= 0;", hold.Name)},
+		[]string{fmt.Sprintf("if (%s) %s <= %s;", load.Name, hold.Name, data.Name)})
+	
+	// Delay the load by one source cycle so hold is stable when it crosses
+	loaded := m.Reg(name+"_loaded", 1).WithClockDomain(srcDomain)
+	m.clockedBlock(srcDomain,
+		[]string{fmt.Sprintf("%s <= 0;", loaded.Name)},
+		[]string{fmt.Sprintf("%s <= %s;", loaded.Name, load.Name)})
+	
+	enable := m.PulseSynchronizer(name+"_en", loaded, destDomain)
+	
+	destData := m.Reg(name+"_dest_data", data.Width).WithClockDomain(destDomain)
+	destValid := m.Reg(name+"_dest_valid", 1).WithClockDomain(destDomain)
+	m.clockedBlock(destDomain,
+		[]string{
+			fmt.Sprintf("%s <= 0;", destData.Name),
+			fmt.Sprintf("%s <= 0;", destValid.Name),
+		},
+		[]string{
+			fmt.Sprintf("%s <= %s ? %s : %s;", destData.Name, enable.Name, hold.Name, destData.Name),
+			fmt.Sprintf("%s <= %s;", destValid.Name, enable.Name),
+		})
+	
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name: name, Kind: "mux", SrcDomain: srcDomain, DestDomain: destDomain,
+		Captures: []*Signal{destData}, Output: destData,
+	})
+	return destData, destValid
+}
+
+// Gray-coded counter crossing. The counter is converted to Gray code in a
+// source register, synchronized, and converted back to binary, so a
+// sample taken mid-transition is off by at most one count. The counter
+// must change by at most one per source cycle.
+func (m *Module) GrayCounterSynchronizer(name string, count *Signal, destDomain *ClockDomain) *Signal {
+	srcDomain := sourceDomain(count)
+	
+	gray := m.Reg(name+"_gray", count.Width).WithClockDomain(srcDomain)
+	m.clockedBlock(srcDomain,
+		[]string{fmt.Sprintf("%s <= 0;", gray.Name)},
+		[]string{fmt.Sprintf("%s <= %s;", gray.Name, binToGray(count))})
+	
+	graySync := m.CDCSynchronizer(name+"_gray", gray, destDomain, 2)
+	
+	bin := m.Wire(name+"_bin", count.Width).WithClockDomain(destDomain)
+	m.AssignExpr(bin, grayToBin(graySync))
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name: name, Kind: "gray", SrcDomain: srcDomain, DestDomain: destDomain, Output: bin,
+	})
+	return bin
+}
+
+// Clock domain a crossing starts from
+func sourceDomain(src *Signal) *ClockDomain {
+	if src.ClockDomain == nil {
+		panic(fmt.Sprintf("Signal %s has no clock domain to cross from", src.Name))
+	}
+	return src.ClockDomain
+}
+
+// Append a clocked always block for a domain, with a reset branch when the
+// domain has a reset
+func (m *Module) clockedBlock(cd *ClockDomain, resets []string, body []string) {
+	m.Always = append(m.Always, fmt.Sprintf("always @(posedge %s) begin", cd.Clock.Name))
+	indent := "  "
+	if cd.Reset != nil {
+		m.Always = append(m.Always, fmt.Sprintf("  if (%s) begin", cd.Reset.Name))
+		for _, line := range resets {
+			m.Always = append(m.Always, "    "+line)
+		}
+		m.Always = append(m.Always, "  end else begin")
+		indent = "    "
+	}
+	for _, line := range body {
+		m.Always = append(m.Always, indent+line)
+	}
+	if cd.Reset != nil {
+		m.Always = append(m.Always, "  end")
+	}
+	m.Always = append(m.Always, "end")
+}
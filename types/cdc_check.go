@@ -0,0 +1,455 @@
+package hdl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// === STATIC CLOCK DOMAIN CROSSING ANALYSIS ===
+
+// Clock domain crossing problem found by CheckCDC
+type CDCViolation struct {
+	Kind    string   // "unsynchronized", "reconvergence" or "mismatch"
+	Signal  string   // flat name of the net consuming the crossing
+	Sources []string // flat names of the nets the crossing comes from
+	From    *ClockDomain
+	To      *ClockDomain
+}
+
+func (v *CDCViolation) String() string {
+	from, to := "?", "?"
+	if v.From != nil {
+		from = v.From.Name
+	}
+	if v.To != nil {
+		to = v.To.Name
+	}
+	switch v.Kind {
+	case "reconvergence":
+		return fmt.Sprintf("reconvergence: %s (%s) combines separately synchronized %s",
+			v.Signal, to, strings.Join(v.Sources, ", "))
+	case "mismatch":
+		return fmt.Sprintf("mismatch: %s is declared in %s but clocked by %s", v.Signal, to, from)
+	}
+	return fmt.Sprintf("unsynchronized: %s (%s) samples %s (%s)",
+		v.Signal, to, strings.Join(v.Sources, ", "), from)
+}
+
+type cdcAnalysis struct {
+	n         *Netlist
+	combDeps  map[string][]string       // net -> nets read by its combinational drivers
+	clocked   map[string]*ClockDomain   // net or memory -> domain of the process writing it
+	regDeps   map[string][]string       // clocked net -> nets read when it is written
+	declared  map[string]*ClockDomain   // net -> domain it was declared with
+	captures  map[string]bool           // registers allowed to sample foreign domains
+	syncOut   map[string]string         // synchronizer output net -> synchronizer name
+	syncRegs  map[string]string         // register -> synchronizer output it feeds
+	ignored   map[string]bool           // clock and reset nets
+	pseudo    map[string]*ClockDomain   // domains made up for undeclared clocks
+	origins   map[string][]string
+	visiting  map[string]bool
+}
+
+// Check the module hierarchy for signals crossing clock domains without a
+// recognized synchronizer. Domains propagate from the clock driving each
+// register, through continuous assigns and combinational blocks, and across
+// instance connections. Registers built by CDCSynchronizer, AsyncFIFO and
+// the other CDC helpers may sample foreign signals; everything else that
+// consumes a signal from an unrelated domain is reported. Logic combining
+// the outputs of separately synchronized bits is reported as reconvergence.
+func (m *Module) CheckCDC() ([]*CDCViolation, error) {
+	n, err := m.Flatten()
+	if err != nil {
+		return nil, err
+	}
+	a := &cdcAnalysis{
+		n:        n,
+		combDeps: make(map[string][]string),
+		clocked:  make(map[string]*ClockDomain),
+		regDeps:  make(map[string][]string),
+		declared: make(map[string]*ClockDomain),
+		captures: make(map[string]bool),
+		syncOut:  make(map[string]string),
+		ignored:  make(map[string]bool),
+		pseudo:   make(map[string]*ClockDomain),
+		origins:  make(map[string][]string),
+		visiting: make(map[string]bool),
+	}
+	a.collect()
+
+	var violations []*CDCViolation
+	violations = append(violations, a.checkBlackboxes()...)
+	for _, name := range n.NetOrder {
+		violations = append(violations, a.checkNet(name)...)
+	}
+	memories := make([]string, 0, len(n.Memories))
+	for name := range n.Memories {
+		memories = append(memories, name)
+	}
+	sort.Strings(memories)
+	for _, name := range memories {
+		if to := a.clocked[name]; to != nil {
+			violations = append(violations, a.checkSink(name, to, a.regDeps[name])...)
+		}
+	}
+	return violations, nil
+}
+
+// Gather drivers, register domains and synchronizers of the flat netlist
+func (a *cdcAnalysis) collect() {
+	n := a.n
+	for _, name := range n.NetOrder {
+		net := n.Nets[name]
+		if net.Signal == nil || net.Signal.ClockDomain == nil {
+			continue
+		}
+		// A child's domain is the parent domain its clock is connected to
+		cd := net.Signal.ClockDomain
+		if cd.Clock != nil {
+			if top := n.ClockDomainOf(ScopedName(net.Scope, cd.Clock.Name)); top != nil {
+				cd = top
+			}
+		}
+		a.declared[name] = cd
+	}
+	for _, scope := range n.scopeOrder() {
+		mod := n.Scopes[scope]
+		for _, cd := range mod.ClockDomains {
+			if cd.Clock != nil {
+				a.ignored[n.Resolve(ScopedName(scope, cd.Clock.Name))] = true
+			}
+			if cd.Reset != nil {
+				a.ignored[n.Resolve(ScopedName(scope, cd.Reset.Name))] = true
+			}
+		}
+		for _, sync := range mod.Synchronizers {
+			for _, c := range sync.Captures {
+				a.captures[ScopedName(scope, c.Name)] = true
+			}
+			if sync.Output != nil {
+				a.syncOut[ScopedName(scope, sync.Output.Name)] = ScopedName(scope, sync.Name)
+			}
+		}
+	}
+
+	for _, as := range n.Assigns {
+		deps := append(as.RHS.Idents(), as.LHS.TargetReads()...)
+		for _, t := range as.LHS.Targets() {
+			a.combDeps[t] = append(a.combDeps[t], deps...)
+		}
+	}
+	for _, proc := range n.Processes {
+		if proc.Clock == "" {
+			a.walk(proc.Body, nil, func(target string, deps []string) {
+				a.combDeps[target] = append(a.combDeps[target], deps...)
+			})
+			continue
+		}
+		a.ignored[n.Resolve(proc.Clock)] = true
+		for _, s := range proc.Sensitivity {
+			a.ignored[n.Resolve(s.Signal)] = true
+		}
+		cd := a.domainOfClock(proc.Clock)
+		a.walk(proc.Body, nil, func(target string, deps []string) {
+			a.clocked[target] = cd
+			a.regDeps[target] = append(a.regDeps[target], deps...)
+		})
+	}
+}
+
+// Domain of a process clock, inventing one for clocks no domain declares
+func (a *cdcAnalysis) domainOfClock(clock string) *ClockDomain {
+	if cd := a.n.ClockDomainOf(clock); cd != nil {
+		return cd
+	}
+	root := a.n.Resolve(clock)
+	if cd, ok := a.pseudo[root]; ok {
+		return cd
+	}
+	cd := &ClockDomain{Name: root, Clock: &Signal{Name: root, Width: 1, Kind: "input"}}
+	a.pseudo[root] = cd
+	return cd
+}
+
+// Call fn for every assignment with the nets it depends on, including
+// the conditions it is nested in
+func (a *cdcAnalysis) walk(s *Stmt, control []string, fn func(target string, deps []string)) {
+	if s == nil {
+		return
+	}
+	switch s.Kind {
+	case StmtBlock:
+		for _, b := range s.Body {
+			a.walk(b, control, fn)
+		}
+	case StmtIf:
+		inner := append(append([]string{}, control...), s.Cond.Idents()...)
+		a.walk(s.Then, inner, fn)
+		a.walk(s.Else, inner, fn)
+	case StmtCase:
+		inner := append(append([]string{}, control...), s.Cond.Idents()...)
+		for _, item := range s.Items {
+			for _, label := range item.Labels {
+				inner = append(inner, label.Idents()...)
+			}
+		}
+		for _, item := range s.Items {
+			a.walk(item.Body, inner, fn)
+		}
+	case StmtBlocking, StmtNonblocking:
+		deps := append(append(s.RHS.Idents(), s.LHS.TargetReads()...), control...)
+		for _, t := range s.LHS.Targets() {
+			fn(t, deps)
+		}
+	}
+}
+
+// Registers, memories and undriven nets a net is computed from
+func (a *cdcAnalysis) originsOf(name string) []string {
+	if o, ok := a.origins[name]; ok {
+		return o
+	}
+	if a.ignored[name] || a.visiting[name] {
+		return nil
+	}
+	if _, isReg := a.clocked[name]; isReg {
+		return []string{name}
+	}
+	deps, driven := a.combDeps[name]
+	if !driven {
+		return []string{name}
+	}
+	a.visiting[name] = true
+	seen := map[string]bool{}
+	var o []string
+	for _, d := range deps {
+		for _, src := range a.originsOf(d) {
+			if !seen[src] {
+				seen[src] = true
+				o = append(o, src)
+			}
+		}
+	}
+	delete(a.visiting, name)
+	a.origins[name] = o
+	return o
+}
+
+// Domain a register, memory or undriven net belongs to
+func (a *cdcAnalysis) domainOf(name string) *ClockDomain {
+	if cd, ok := a.clocked[name]; ok {
+		return cd
+	}
+	return a.declared[name]
+}
+
+// Check one net: registers against their sources, combinational nets
+// against the domain they were declared in
+func (a *cdcAnalysis) checkNet(name string) []*CDCViolation {
+	if to, isReg := a.clocked[name]; isReg {
+		var violations []*CDCViolation
+		if declared := a.declared[name]; declared != nil && declared != to {
+			violations = append(violations, &CDCViolation{Kind: "mismatch", Signal: name, From: to, To: declared})
+		}
+		return append(violations, a.checkSink(name, to, a.regDeps[name])...)
+	}
+	to := a.declared[name]
+	if to == nil {
+		return nil
+	}
+	if _, driven := a.combDeps[name]; !driven {
+		return nil
+	}
+	return a.checkSink(name, to, a.combDeps[name])
+}
+
+// Report sources of a sink in domain to that come from unrelated domains,
+// and separately synchronized signals that reconverge in it
+func (a *cdcAnalysis) checkSink(sink string, to *ClockDomain, deps []string) []*CDCViolation {
+	var violations []*CDCViolation
+	byDomain := map[*ClockDomain][]string{}
+	var domains []*ClockDomain
+	var synced []string
+	seen := map[string]bool{}
+	for _, d := range deps {
+		for _, src := range a.originsOf(d) {
+			if seen[src] {
+				continue
+			}
+			seen[src] = true
+			if out, ok := a.syncedBy(src); ok && src != sink {
+				synced = append(synced, out)
+			}
+			from := a.domainOf(src)
+			if from == nil || from.SynchronousWith(to) || a.captures[sink] {
+				continue
+			}
+			if _, ok := byDomain[from]; !ok {
+				domains = append(domains, from)
+			}
+			byDomain[from] = append(byDomain[from], src)
+		}
+	}
+	for _, from := range domains {
+		violations = append(violations, &CDCViolation{
+			Kind: "unsynchronized", Signal: sink, Sources: byDomain[from], From: from, To: to,
+		})
+	}
+	if !a.captures[sink] {
+		synced = uniqueStrings(synced)
+		if len(synced) > 1 && !a.sameSynchronizer(synced) {
+			violations = append(violations, &CDCViolation{Kind: "reconvergence", Signal: sink, Sources: synced, To: to})
+		}
+	}
+	return violations
+}
+
+// Synchronizer output a register belongs to. Outputs computed
+// combinationally from synchronizer flops, such as the binary value of a
+// synchronized Gray count or a synchronized pulse, take precedence over
+// the flop stages inside them.
+func (a *cdcAnalysis) syncedBy(src string) (string, bool) {
+	if a.syncRegs == nil {
+		a.syncRegs = make(map[string]string)
+		outputs := make([]string, 0, len(a.syncOut))
+		for out := range a.syncOut {
+			outputs = append(outputs, out)
+		}
+		sort.Strings(outputs)
+		for _, out := range outputs {
+			if _, isReg := a.clocked[out]; isReg {
+				if _, taken := a.syncRegs[out]; !taken {
+					a.syncRegs[out] = out
+				}
+				continue
+			}
+			for _, reg := range a.originsOf(out) {
+				a.syncRegs[reg] = out
+			}
+		}
+	}
+	out, ok := a.syncRegs[src]
+	return out, ok
+}
+
+func (a *cdcAnalysis) sameSynchronizer(outputs []string) bool {
+	for _, out := range outputs[1:] {
+		if a.syncOut[out] != a.syncOut[outputs[0]] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueStrings(names []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Instances without a Go definition are assumed to run in the single
+// clock domain connected to them: driven connections are consumed in that
+// domain and undriven ones are produced in it
+func (a *cdcAnalysis) checkBlackboxes() []*CDCViolation {
+	paths := make([]string, 0, len(a.n.Blackboxes))
+	for path := range a.n.Blackboxes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	type port struct {
+		name   string
+		domain *ClockDomain
+		nets   []string
+	}
+	var consumed []port
+	for _, path := range paths {
+		inst := a.n.Blackboxes[path]
+		scope := ""
+		if i := strings.LastIndex(path, "."); i >= 0 {
+			scope = path[:i]
+		}
+		names := make([]string, 0, len(inst.Connections))
+		for p := range inst.Connections {
+			names = append(names, p)
+		}
+		sort.Strings(names)
+
+		var cd *ClockDomain
+		conns := map[string][]string{}
+		for _, p := range names {
+			e, err := ParseExpr(inst.Connections[p].Name)
+			if err != nil {
+				continue
+			}
+			var nets []string
+			for _, id := range e.Idents() {
+				nets = append(nets, ScopedName(scope, id))
+			}
+			if len(nets) == 1 && a.isClock(nets[0]) {
+				d := a.domainOfClock(nets[0])
+				if cd != nil && cd != d {
+					cd = nil
+					break
+				}
+				cd = d
+				continue
+			}
+			conns[p] = nets
+		}
+		if cd == nil {
+			continue
+		}
+		for _, p := range names {
+			var inputs []string
+			for _, net := range conns[p] {
+				if a.ignored[a.n.Resolve(net)] {
+					continue
+				}
+				if a.driven(net) {
+					inputs = append(inputs, net)
+				} else if a.declared[net] == nil {
+					a.declared[net] = cd
+				}
+			}
+			if len(inputs) > 0 {
+				consumed = append(consumed, port{name: path + "." + p, domain: cd, nets: inputs})
+			}
+		}
+	}
+	var violations []*CDCViolation
+	for _, p := range consumed {
+		violations = append(violations, a.checkSink(p.name, p.domain, p.nets)...)
+	}
+	return violations
+}
+
+// Whether a net carries a clock of some domain or process
+func (a *cdcAnalysis) isClock(net string) bool {
+	root := a.n.Resolve(net)
+	if _, ok := a.pseudo[root]; ok {
+		return true
+	}
+	cd := a.n.ClockDomainOf(net)
+	return cd != nil
+}
+
+// Whether a net is driven inside the netlist or is a primary input
+func (a *cdcAnalysis) driven(net string) bool {
+	if _, ok := a.combDeps[net]; ok {
+		return true
+	}
+	if _, ok := a.clocked[net]; ok {
+		return true
+	}
+	n := a.n.Nets[net]
+	return n != nil && n.Scope == "" && n.Kind == "input"
+}
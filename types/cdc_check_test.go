@@ -0,0 +1,133 @@
+package hdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func violationsOf(t *testing.T, m *Module) []string {
+	violations, err := m.CheckCDC()
+	if err != nil {
+		t.Fatalf("CheckCDC: %v", err)
+	}
+	var out []string
+	for _, v := range violations {
+		out = append(out, v.String())
+	}
+	return out
+}
+
+func TestCheckCDCUnsynchronized(t *testing.T) {
+	m, src, _ := newCDCTestModule()
+	flag := m.Reg("flag", 1).WithClockDomain(src)
+	m.Reg("seen", 1)
+	m.Always = append(m.Always,
+		"always @(posedge src_clk) flag <= !flag;",
+		"always @(posedge dest_clk) seen <= flag;")
+	
+	violations, err := m.CheckCDC()
+	if err != nil {
+		t.Fatalf("CheckCDC: %v", err)
+	}
+	if len(violations) != 1 {
+		t.Fatalf("Expected one violation, got %v", violationsOf(t, m))
+	}
+	v := violations[0]
+	if v.Kind != "unsynchronized" || v.Signal != "seen" || v.Sources[0] != flag.Name || v.From.Name != "src" || v.To.Name != "dest" {
+		t.Errorf("Unexpected violation: %s", v)
+	}
+}
+
+func TestCheckCDCSynchronized(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	flag := m.Reg("flag", 1).WithClockDomain(src)
+	m.Always = append(m.Always, "always @(posedge src_clk) flag <= !flag;")
+	synced := m.CDCSynchronizer("flag_sync", flag, dest, 2)
+	m.Reg("seen", 1)
+	m.Always = append(m.Always, "always @(posedge dest_clk) seen <= "+synced.Name+";")
+	
+	count := m.Reg("count", 4).WithClockDomain(src)
+	m.Always = append(m.Always, "always @(posedge src_clk) count <= count + 4'h1;")
+	m.GrayCounterSynchronizer("count_sync", count, dest)
+	event := m.Wire("event", 1).WithClockDomain(src)
+	m.PulseSynchronizer("ev", event, dest)
+	m.HandshakeSynchronizer("hs", m.Wire("cmd", 8).WithClockDomain(src), m.Wire("cmd_valid", 1).WithClockDomain(src), dest)
+	m.MuxSynchronizer("mux", count, m.Wire("load", 1).WithClockDomain(src), dest)
+	m.AsyncFIFO("fifo", 8, 16, src, dest)
+	
+	if violations := violationsOf(t, m); len(violations) != 0 {
+		t.Errorf("Synchronized crossings should not be reported:\n%s", strings.Join(violations, "\n"))
+	}
+}
+
+func TestCheckCDCReconvergence(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	a := m.Reg("a", 1).WithClockDomain(src)
+	b := m.Reg("b", 1).WithClockDomain(src)
+	m.Always = append(m.Always, "always @(posedge src_clk) begin", "  a <= !a;", "  b <= a;", "end")
+	aSync := m.CDCSynchronizer("a_sync", a, dest, 2)
+	bSync := m.CDCSynchronizer("b_sync", b, dest, 2)
+	both := m.Wire("both", 1)
+	m.Assign(both, aSync.And(bSync))
+	m.Reg("both_r", 1)
+	m.Always = append(m.Always, "always @(posedge dest_clk) both_r <= both;")
+	
+	violations, err := m.CheckCDC()
+	if err != nil {
+		t.Fatalf("CheckCDC: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Kind != "reconvergence" || violations[0].Signal != "both_r" {
+		t.Fatalf("Expected reconvergence at both_r, got %v", violationsOf(t, m))
+	}
+	if len(violations[0].Sources) != 2 {
+		t.Errorf("Reconvergence should name both synchronizers: %s", violations[0])
+	}
+}
+
+func TestCheckCDCThroughInstances(t *testing.T) {
+	child := &Module{Name: "Capture"}
+	clk := child.Input("clk", 1)
+	child.NewClockDomain("local", clk, child.Input("rst", 1))
+	child.Input("d", 1)
+	child.Output("q", 1)
+	child.Reg("q_r", 1)
+	child.Always = append(child.Always, "always @(posedge clk) q_r <= d;")
+	child.AssignName("q", "q_r")
+	
+	m, src, dest := newCDCTestModule()
+	flag := m.Reg("flag", 1).WithClockDomain(src)
+	m.Always = append(m.Always, "always @(posedge src_clk) flag <= !flag;")
+	m.InstanceOf(child, "u_cap").
+		Connect("clk", dest.Clock).
+		Connect("rst", dest.Reset).
+		Connect("d", flag).
+		Connect("q", m.Wire("captured", 1))
+	
+	violations, err := m.CheckCDC()
+	if err != nil {
+		t.Fatalf("CheckCDC: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Signal != "u_cap.q_r" || violations[0].To != dest {
+		t.Fatalf("Expected crossing into u_cap.q_r, got %v", violationsOf(t, m))
+	}
+	
+	// Blackbox inputs are consumed in the domain of the connected clock
+	m, src, dest = newCDCTestModule()
+	flag = m.Reg("flag", 1).WithClockDomain(src)
+	m.Always = append(m.Always, "always @(posedge src_clk) flag <= !flag;")
+	m.Instance("VendorCore", "u_ip").Connect("clk", dest.Clock).Connect("start", flag)
+	if violations := violationsOf(t, m); len(violations) != 1 || !strings.Contains(violations[0], "u_ip.start") {
+		t.Errorf("Expected crossing into blackbox port, got %v", violations)
+	}
+}
+
+func TestCheckCDCDomainMismatch(t *testing.T) {
+	m, src, _ := newCDCTestModule()
+	m.Reg("misplaced", 1).WithClockDomain(src)
+	m.Always = append(m.Always, "always @(posedge dest_clk) misplaced <= 1'b1;")
+	
+	violations := violationsOf(t, m)
+	if len(violations) != 1 || !strings.HasPrefix(violations[0], "mismatch: misplaced") {
+		t.Errorf("Expected domain mismatch, got %v", violations)
+	}
+}
@@ -0,0 +1,154 @@
+package hdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func newCDCTestModule() (*Module, *ClockDomain, *ClockDomain) {
+	m := &Module{Name: "CDCTest"}
+	src := m.NewClockDomain("src", m.Input("src_clk", 1), m.Input("src_rst", 1))
+	dest := m.NewClockDomain("dest", m.Input("dest_clk", 1), m.Input("dest_rst", 1))
+	return m, src, dest
+}
+
+func TestPulseSynchronizer(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	pulse := m.Wire("event", 1).WithClockDomain(src)
+	
+	out := m.PulseSynchronizer("ev", pulse, dest)
+	
+	if out.ClockDomain != dest {
+		t.Errorf("Synchronized pulse should be in the destination domain")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"if (event) ev_toggle <= ~ev_toggle;",
+		"always @(posedge dest_clk) ev_toggle_sync_stage0 <= ev_toggle;",
+		"ev_toggle_prev <= ev_toggle_sync_stage1;",
+		"assign ev_pulse = ev_toggle_sync_stage1 ^ ev_toggle_prev;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing pulse synchronizer logic: %s", check)
+		}
+	}
+}
+
+func TestHandshakeSynchronizer(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	data := m.Wire("cmd", 16).WithClockDomain(src)
+	valid := m.Wire("cmd_valid", 1).WithClockDomain(src)
+	
+	destData, destValid, ready := m.HandshakeSynchronizer("hs", data, valid, dest)
+	
+	if destData.Width != 16 || destData.ClockDomain != dest {
+		t.Errorf("Destination data should be 16 bits in the destination domain")
+	}
+	if destValid.ClockDomain != dest || ready.ClockDomain != src {
+		t.Errorf("Valid and ready should be in the destination and source domains")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign hs_ready = !hs_req && !hs_ack_sync_stage1;",
+		"assign hs_load = hs_req_sync_stage1 && !hs_ack;",
+		"if (hs_ready && cmd_valid) begin",
+		"end else if (hs_req && hs_ack_sync_stage1) begin",
+		"hs_ack <= hs_req_sync_stage1;",
+		"if (hs_load) hs_dest_data <= hs_hold;",
+		"hs_dest_valid <= hs_load;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing handshake logic: %s", check)
+		}
+	}
+}
+
+func TestMuxSynchronizer(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	data := m.Wire("cfg", 32).WithClockDomain(src)
+	load := m.Wire("cfg_load", 1).WithClockDomain(src)
+	
+	destData, destValid := m.MuxSynchronizer("mcp", data, load, dest)
+	
+	if destData.Width != 32 || destValid.Width != 1 {
+		t.Errorf("Unexpected MCP output widths %d and %d", destData.Width, destValid.Width)
+	}
+	
+	logic := strings.Join(m.Always, "\n")
+	checks := []string{
+		"if (cfg_load) mcp_hold <= cfg;",
+		"if (mcp_loaded) mcp_en_toggle <= ~mcp_en_toggle;",
+		"mcp_dest_data <= mcp_en_pulse ? mcp_hold : mcp_dest_data;",
+		"mcp_dest_valid <= mcp_en_pulse;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing MCP logic: %s", check)
+		}
+	}
+}
+
+func TestGrayCounterSynchronizer(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	count := m.Reg("wr_count", 3).WithClockDomain(src)
+	
+	out := m.GrayCounterSynchronizer("cnt", count, dest)
+	
+	if out.Width != 3 || out.ClockDomain != dest {
+		t.Errorf("Synchronized counter should be 3 bits in the destination domain")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"cnt_gray <= (wr_count >> 1) ^ wr_count;",
+		"assign cnt_bin = {^cnt_gray_sync_stage1[2], ^cnt_gray_sync_stage1[2:1], ^cnt_gray_sync_stage1[2:0]};",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing Gray counter logic: %s", check)
+		}
+	}
+}
+
+func TestCrossDomainSelection(t *testing.T) {
+	m, src, dest := newCDCTestModule()
+	
+	level := m.Wire("link_up", 1).WithClockDomain(src)
+	pulse := m.Wire("pkt_done", 1).WithClockDomain(src)
+	count := m.Reg("pkt_count", 8).WithClockDomain(src)
+	data := m.Wire("order", 64).WithClockDomain(src)
+	valid := m.Wire("order_valid", 1).WithClockDomain(src)
+	
+	cases := []struct {
+		name   string
+		src    *Signal
+		traits CDCTraits
+		kind   string
+	}{
+		{"level", level, CDCTraits{}, "flop"},
+		{"pulse", pulse, CDCTraits{Pulse: true}, "pulse"},
+		{"count", count, CDCTraits{Counter: true}, "gray"},
+		{"held", data, CDCTraits{Valid: valid, Held: true}, "mux"},
+		{"order", data, CDCTraits{Valid: valid}, "handshake"},
+	}
+	for _, c := range cases {
+		crossing := m.CrossDomain(c.name, c.src, dest, c.traits)
+		if crossing.Kind != c.kind {
+			t.Errorf("%s: expected %s crossing, got %s", c.name, c.kind, crossing.Kind)
+		}
+		if crossing.Data.Width != c.src.Width {
+			t.Errorf("%s: crossing changed width from %d to %d", c.name, c.src.Width, crossing.Data.Width)
+		}
+	}
+	
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for unqualified multi-bit crossing")
+		}
+	}()
+	m.CrossDomain("bad", data, dest, CDCTraits{})
+}
@@ -0,0 +1,190 @@
+package hdl
+
+import (
+	"fmt"
+)
+
+// === DERIVED CLOCK DOMAINS ===
+
+// Clock domain with a divide-by-N clock generated from the parent clock by
+// a counter. The divided clock is driven from a flop so it is glitch free;
+// for odd N the high phase is one parent cycle shorter than the low phase.
+func (m *Module) DividedClockDomain(name string, parent *ClockDomain, divide int) *ClockDomain {
+	if divide < 2 {
+		panic(fmt.Sprintf("Clock domain %s: divide ratio must be at least 2, got %d", name, divide))
+	}
+	count := m.Reg(name+"_div_count", WidthOf(divide-1)).WithClockDomain(parent)
+	next := m.Wire(name+"_div_next", count.Width).WithClockDomain(parent)
+	clkReg := m.Reg(name+"_clk_r", 1).WithClockDomain(parent)
+	clk := m.Wire(name+"_clk", 1)
+	
+	m.AssignExpr(next, fmt.Sprintf("(%s == %s) ? %s : %s + %s",
+		count.Name, Lit(divide-1, count.Width).Name, Lit(0, count.Width).Name, count.Name, Lit(1, count.Width).Name))
+	m.clockedBlock(parent,
+		[]string{fmt.Sprintf("%s <= 0;", count.Name), fmt.Sprintf("%s <= 1'b0;", clkReg.Name)},
+		[]string{
+			fmt.Sprintf("%s <= %s;", count.Name, next.Name),
+			fmt.Sprintf("%s <= (%s < %s);", clkReg.Name, next.Name, Lit(divide/2, count.Width).Name),
+		})
+	m.Assign(clk, clkReg)
+	
+	cd := m.NewClockDomain(name, clk, parent.Reset)
+	cd.Parent = parent
+	cd.Derivation = "divider"
+	cd.Multiply = 1
+	cd.Divide = divide
+	cd.Frequency = parent.Frequency / divide
+	clk.ClockDomain = cd
+	return cd
+}
+
+// Slow domain that shares the parent clock and advances only on cycles
+// where its Enable strobe is high, once every divide parent cycles.
+// Registers of the domain must be written under "if (Enable)".
+func (m *Module) EnableClockDomain(name string, parent *ClockDomain, divide int) *ClockDomain {
+	if divide < 1 {
+		panic(fmt.Sprintf("Clock domain %s: divide ratio must be at least 1, got %d", name, divide))
+	}
+	enable := m.Wire(name+"_ce", 1).WithClockDomain(parent)
+	if divide == 1 {
+		m.AssignExpr(enable, "1'b1")
+	} else {
+		count := m.Reg(name+"_ce_count", WidthOf(divide-1)).WithClockDomain(parent)
+		m.AssignExpr(enable, fmt.Sprintf("%s == %s", count.Name, Lit(divide-1, count.Width).Name))
+		m.clockedBlock(parent,
+			[]string{fmt.Sprintf("%s <= 0;", count.Name)},
+			[]string{fmt.Sprintf("%s <= %s ? %s : %s + %s;",
+				count.Name, enable.Name, Lit(0, count.Width).Name, count.Name, Lit(1, count.Width).Name)})
+	}
+	
+	cd := m.NewClockDomain(name, parent.Clock, parent.Reset)
+	cd.Parent = parent
+	cd.Derivation = "enable"
+	cd.Multiply = 1
+	cd.Divide = divide
+	cd.Enable = enable
+	// The clock itself runs at the parent rate
+	cd.Frequency = parent.Frequency
+	return cd
+}
+
+// Clock domain whose clock is produced by a PLL or MMCM from the parent
+// clock at parent * multiply / divide. The clock signal is the primitive's
+// output, which the caller instantiates and connects.
+func (m *Module) GeneratedClockDomain(name string, parent *ClockDomain, clk *Signal, rst *Signal, multiply, divide int) *ClockDomain {
+	if multiply < 1 || divide < 1 {
+		panic(fmt.Sprintf("Clock domain %s: invalid ratio %d/%d", name, multiply, divide))
+	}
+	cd := m.NewClockDomain(name, clk, rst)
+	cd.Parent = parent
+	cd.Derivation = "generated"
+	cd.Multiply = multiply
+	cd.Divide = divide
+	cd.Frequency = int(int64(parent.Frequency) * int64(multiply) / int64(divide))
+	clk.ClockDomain = cd
+	return cd
+}
+
+// Domain clocked by the parent clock gated with enable, built as a
+// latch-based integrated clock gate: the enable is latched while the clock
+// is low so the gated clock never glitches. The behavioral logic doubles as
+// the simulation model; synthesis maps it onto the library's ICG cell.
+// Enable must come from the parent domain.
+func (m *Module) ClockGate(name string, parent *ClockDomain, enable *Signal) *ClockDomain {
+	latch := m.Reg(name+"_en_latch", 1).WithClockDomain(parent)
+	clk := m.Wire(name+"_clk", 1)
+	m.Always = append(m.Always,
+		fmt.Sprintf("always @(*) if (!%s) %s = %s;", parent.Clock.Name, latch.Name, enable.Name))
+	m.AssignExpr(clk, fmt.Sprintf("%s & %s", parent.Clock.Name, latch.Name))
+	
+	cd := m.NewClockDomain(name, clk, parent.Reset)
+	cd.Parent = parent
+	cd.Derivation = "gated"
+	cd.Multiply = 1
+	cd.Divide = 1
+	cd.Enable = enable
+	cd.Frequency = parent.Frequency
+	return cd
+}
+
+// Glitch-free multiplexer between two clocks, selecting clk1 when sel is
+// high. Each side has an enable flop pair clocked by its own clock that is
+// only set once the other side's enable has dropped, so the output never
+// sees a shortened pulse. The enables cross between the clocks through two
+// flops (rising then falling edge), which makes it safe for unrelated
+// clocks. reset, when not nil, disables both clocks. The behavioral logic is
+// the simulation model.
+func (m *Module) ClockMux(name string, clk0, clk1 *ClockDomain, sel *Signal, reset *Signal) *ClockDomain {
+	clk := m.Wire(name+"_clk", 1)
+	sides := []*ClockDomain{clk0, clk1}
+	enables := make([]*Signal, 2)
+	for i := range sides {
+		enables[i] = m.Reg(fmt.Sprintf("%s_en%d", name, i), 1).WithClockDomain(sides[i])
+	}
+	for i, side := range sides {
+		want := m.Wire(fmt.Sprintf("%s_sel%d", name, i), 1)
+		selected := sel.Name
+		if i == 0 {
+			selected = "!" + sel.Name
+		}
+		m.AssignExpr(want, fmt.Sprintf("%s && !%s", selected, enables[1-i].Name))
+		
+		meta := m.Reg(fmt.Sprintf("%s_en%d_meta", name, i), 1).WithClockDomain(side)
+		edges := []string{"posedge", "negedge"}
+		stages := []*Signal{meta, enables[i]}
+		inputs := []*Signal{want, meta}
+		for s := range stages {
+			if reset == nil {
+				m.Always = append(m.Always, fmt.Sprintf("always @(%s %s) %s <= %s;",
+					edges[s], side.Clock.Name, stages[s].Name, inputs[s].Name))
+				continue
+			}
+			m.Always = append(m.Always,
+				fmt.Sprintf("always @(%s %s or posedge %s) begin", edges[s], side.Clock.Name, reset.Name),
+				fmt.Sprintf("  if (%s) %s <= 1'b0;", reset.Name, stages[s].Name),
+				fmt.Sprintf("  else %s <= %s;", stages[s].Name, inputs[s].Name),
+				"end")
+		}
+		m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+			Name:       fmt.Sprintf("%s_en%d", name, i),
+			Kind:       "flop",
+			SrcDomain:  sides[1-i],
+			DestDomain: side,
+			Stages:     stages,
+			Captures:   stages[:1],
+			Output:     enables[i],
+		})
+	}
+	m.AssignExpr(clk, fmt.Sprintf("(%s & %s) | (%s & %s)",
+		clk0.Clock.Name, enables[0].Name, clk1.Clock.Name, enables[1].Name))
+	
+	cd := m.NewClockDomain(name, clk, reset)
+	cd.Derivation = "mux"
+	cd.Sources = sides
+	// Only clocks from a common source keep a fixed relation through the mux
+	if clk0.SynchronousWith(clk1) {
+		cd.Parent = clk0
+		cd.Multiply = 1
+		cd.Divide = 1
+	}
+	cd.Frequency = clk0.Frequency
+	if clk1.Frequency > cd.Frequency {
+		cd.Frequency = clk1.Frequency
+	}
+	return cd
+}
+
+// Source domain of a chain of derived domains
+func (cd *ClockDomain) Root() *ClockDomain {
+	for cd.Parent != nil {
+		cd = cd.Parent
+	}
+	return cd
+}
+
+// Whether signals can pass between the two domains without a synchronizer:
+// domains derived from the same source clock have a fixed phase relation
+// and their crossings are timed like any synchronous path
+func (cd *ClockDomain) SynchronousWith(other *ClockDomain) bool {
+	return cd == other || (cd != nil && other != nil && cd.Root() == other.Root())
+}
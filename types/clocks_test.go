@@ -0,0 +1,162 @@
+package hdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDividedClockDomain(t *testing.T) {
+	m := &Module{Name: "DividerTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1)).SetFrequency(100000000)
+	
+	slow := m.DividedClockDomain("slow", sys, 4)
+	
+	if slow.Parent != sys || slow.Derivation != "divider" || slow.Divide != 4 {
+		t.Errorf("Divided domain should record its relation to sys")
+	}
+	if slow.Frequency != 25000000 || slow.Clock.Name != "slow_clk" || slow.Reset != sys.Reset {
+		t.Errorf("Divided domain should run at 25 MHz from slow_clk with the sys reset")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign slow_div_next = (slow_div_count == 2'h3) ? 2'h0 : slow_div_count + 2'h1;",
+		"slow_clk_r <= (slow_div_next < 2'h2);",
+		"assign slow_clk = slow_clk_r;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing divider logic: %s", check)
+		}
+	}
+	
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Divide by 1 should panic")
+		}
+	}()
+	m.DividedClockDomain("bad", sys, 1)
+}
+
+func TestEnableAndGeneratedClockDomains(t *testing.T) {
+	m := &Module{Name: "DerivedTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1)).SetFrequency(100000000)
+	
+	slow := m.EnableClockDomain("slow", sys, 3)
+	if slow.Clock != sys.Clock || slow.Enable == nil || slow.Enable.Name != "slow_ce" {
+		t.Errorf("Enable domain should share the sys clock and expose slow_ce")
+	}
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	if !strings.Contains(logic, "assign slow_ce = slow_ce_count == 2'h2;") ||
+		!strings.Contains(logic, "slow_ce_count <= slow_ce ? 2'h0 : slow_ce_count + 2'h1;") {
+		t.Errorf("Missing clock enable counter:\n%s", logic)
+	}
+	
+	fast := m.GeneratedClockDomain("fast", sys, m.Wire("mmcm_clk", 1), m.Wire("mmcm_rst", 1), 5, 2)
+	if fast.Frequency != 250000000 || fast.Root() != sys {
+		t.Errorf("Generated domain should run at 250 MHz derived from sys")
+	}
+	
+	other := m.NewClockDomain("other", m.Input("other_clk", 1), m.Input("other_rst", 1))
+	if !fast.SynchronousWith(slow) || fast.SynchronousWith(other) {
+		t.Errorf("Only domains with a common source should be synchronous")
+	}
+	
+	data := m.Wire("data", 8).WithClockDomain(sys)
+	if crossing := m.CrossDomain("d", data, fast, CDCTraits{}); crossing.Kind != "direct" || crossing.Data != data {
+		t.Errorf("Crossing into a derived domain should not need a synchronizer")
+	}
+}
+
+func TestCheckCDCDerivedDomains(t *testing.T) {
+	m := &Module{Name: "DerivedCDC"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	m.DividedClockDomain("slow", sys, 2)
+	other := m.NewClockDomain("other", m.Input("other_clk", 1), m.Input("other_rst", 1))
+	
+	m.Reg("count", 8).WithClockDomain(sys)
+	m.Reg("slow_copy", 8)
+	m.Reg("other_copy", 8).WithClockDomain(other)
+	m.Always = append(m.Always,
+		"always @(posedge clk) count <= count + 8'h1;",
+		"always @(posedge slow_clk) slow_copy <= count;",
+		"always @(posedge other_clk) other_copy <= slow_copy;")
+	
+	violations, err := m.CheckCDC()
+	if err != nil {
+		t.Fatalf("CheckCDC: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Signal != "other_copy" || violations[0].From.Name != "slow" {
+		t.Errorf("Only the crossing into the unrelated domain should be reported, got %v", violations)
+	}
+}
+
+func TestClockGate(t *testing.T) {
+	m := &Module{Name: "ClockGateTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	enable := m.Input("gate_en", 1).WithClockDomain(sys)
+	
+	gated := m.ClockGate("core", sys, enable)
+	
+	if gated.Derivation != "gated" || gated.Parent != sys || gated.Enable != enable || !gated.SynchronousWith(sys) {
+		t.Errorf("Gated domain should be derived from sys")
+	}
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	if !strings.Contains(logic, "always @(*) if (!clk) core_en_latch = gate_en;") ||
+		!strings.Contains(logic, "assign core_clk = clk & core_en_latch;") {
+		t.Errorf("Missing clock gate logic:\n%s", logic)
+	}
+	
+	m.Reg("gated_count", 8)
+	m.Reg("sys_copy", 8).WithClockDomain(sys)
+	m.Always = append(m.Always,
+		"always @(posedge core_clk) gated_count <= gated_count + 8'h1;",
+		"always @(posedge clk) sys_copy <= gated_count;")
+	if violations, err := m.CheckCDC(); err != nil || len(violations) != 0 {
+		t.Errorf("Gated domain is synchronous with its parent: %v %v", violations, err)
+	}
+}
+
+func TestClockMux(t *testing.T) {
+	m := &Module{Name: "ClockMuxTest"}
+	rec := m.NewClockDomain("recovered", m.Input("rx_clk", 1), m.Input("rx_rst", 1)).SetFrequency(156250000)
+	ref := m.NewClockDomain("reference", m.Input("ref_clk", 1), m.Input("ref_rst", 1)).SetFrequency(125000000)
+	sel := m.Input("use_ref", 1)
+	
+	mux := m.ClockMux("line", rec, ref, sel, m.Input("mux_rst", 1))
+	
+	if mux.Derivation != "mux" || mux.Parent != nil || len(mux.Sources) != 2 || mux.Frequency != 156250000 {
+		t.Errorf("Mux of unrelated clocks should be its own domain at the faster rate")
+	}
+	if mux.SynchronousWith(rec) || mux.SynchronousWith(ref) {
+		t.Errorf("Mux output should be asynchronous to unrelated inputs")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign line_sel0 = !use_ref && !line_en1;",
+		"assign line_sel1 = use_ref && !line_en0;",
+		"always @(posedge rx_clk or posedge mux_rst) begin",
+		"  else line_en0_meta <= line_sel0;",
+		"always @(negedge rx_clk or posedge mux_rst) begin",
+		"  else line_en0 <= line_en0_meta;",
+		"assign line_clk = (rx_clk & line_en0) | (ref_clk & line_en1);",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing clock mux logic: %s", check)
+		}
+	}
+	
+	m.Reg("line_count", 8)
+	m.Always = append(m.Always, "always @(posedge line_clk) line_count <= line_count + 8'h1;")
+	m.Reg("rx_copy", 8).WithClockDomain(rec)
+	m.Always = append(m.Always, "always @(posedge rx_clk) rx_copy <= line_count;")
+	violations, err := m.CheckCDC()
+	if err != nil {
+		t.Fatalf("CheckCDC: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Signal != "rx_copy" || violations[0].From != mux {
+		t.Errorf("Only the crossing out of the mux domain should be reported, got %v", violations)
+	}
+}
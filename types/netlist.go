@@ -0,0 +1,479 @@
+package hdl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Signal of a flattened module hierarchy
+type Net struct {
+	Name   string // hierarchical name, e.g. "u_fifo.wr_ptr" inside instance u_fifo
+	Width  Width
+	Kind   string // "input", "output", "wire", "reg"
+	Signal *Signal
+	Scope  string // instance path, "" at the top
+}
+
+// Memory of a flattened module hierarchy
+type NetMemory struct {
+	Name   string
+	Memory *Memory
+	Scope  string
+}
+
+// Property of a flattened module hierarchy
+type NetProperty struct {
+	Name       string // hierarchical name, e.g. "u_fifo.no_overflow"
+	Property   *Property
+	Antecedent []*Expr // step conditions of a temporal property
+	Consequent []*Expr
+	Cond       *Expr // nil for a temporal property
+	Clock      string
+	Reset      string // "" when the domain has no reset
+	Scope      string
+}
+
+// Module hierarchy flattened into nets, continuous assignments and
+// processes. Names inside instances are prefixed with the instance path,
+// and port connections become continuous assignments between the parent
+// and child nets.
+type Netlist struct {
+	Top        *Module
+	Nets       map[string]*Net
+	NetOrder   []string // nets in declaration order
+	Memories   map[string]*NetMemory
+	Assigns    []*ContinuousAssign
+	Processes  []*Process
+	Properties []*NetProperty
+	Scopes     map[string]*Module         // module definition of each instance path
+	Blackboxes map[string]*ModuleInstance // instances without a Go definition
+
+	aliases map[string]string
+}
+
+// Set the module definition of an instance so the hierarchy can be
+// flattened for analysis and simulation
+func (inst *ModuleInstance) SetModule(def *Module) *ModuleInstance {
+	inst.Module = def
+	return inst
+}
+
+// Instantiate a module built in Go, keeping its definition with the instance
+func (m *Module) InstanceOf(def *Module, instanceName string) *ModuleInstance {
+	return m.Instance(def.Name, instanceName).SetModule(def)
+}
+
+// Flatten the module and every instance with a known definition
+func (m *Module) Flatten() (*Netlist, error) {
+	n := &Netlist{
+		Top:        m,
+		Nets:       make(map[string]*Net),
+		Memories:   make(map[string]*NetMemory),
+		Scopes:     make(map[string]*Module),
+		Blackboxes: make(map[string]*ModuleInstance),
+	}
+	if err := n.add(m, "", m.Parameters); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Flat name of a signal declared in the given scope
+func ScopedName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (n *Netlist) add(m *Module, scope string, params map[string]interface{}) error {
+	n.Scopes[scope] = m
+	n.declare(m, scope)
+
+	logic, err := m.ParseLogic()
+	if err != nil {
+		return err
+	}
+	for _, a := range logic.Assigns {
+		n.Assigns = append(n.Assigns, &ContinuousAssign{
+			LHS:   n.rewrite(a.LHS, scope, params),
+			RHS:   n.rewrite(a.RHS, scope, params),
+			Scope: scope,
+		})
+	}
+	for _, proc := range logic.Processes {
+		flat := &Process{
+			Clock: n.rewriteName(proc.Clock, scope),
+			Edge:  proc.Edge,
+			Body:  n.rewriteStmt(proc.Body, scope, params),
+			Scope: scope,
+		}
+		for _, s := range proc.Sensitivity {
+			flat.Sensitivity = append(flat.Sensitivity, Sensitivity{Edge: s.Edge, Signal: n.rewriteName(s.Signal, scope)})
+		}
+		n.Processes = append(n.Processes, flat)
+	}
+	for _, p := range m.Properties {
+		flat := &NetProperty{
+			Name:     ScopedName(scope, p.Name),
+			Property: p,
+			Clock:    n.rewriteName(p.Domain.Clock.Name, scope),
+			Scope:    scope,
+		}
+		steps := func(seq *Sequence) ([]*Expr, error) {
+			var conds []*Expr
+			if seq == nil {
+				return nil, nil
+			}
+			for _, step := range seq.Steps {
+				cond, err := ParseExpr(step.Cond.Name)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %v", p.Kind, p.Name, err)
+				}
+				conds = append(conds, n.rewrite(cond, scope, params))
+			}
+			return conds, nil
+		}
+		if t := p.Temporal; t != nil {
+			if flat.Antecedent, err = steps(t.Antecedent); err != nil {
+				return err
+			}
+			if flat.Consequent, err = steps(t.Consequent); err != nil {
+				return err
+			}
+		} else {
+			cond, err := ParseExpr(p.Cond.Name)
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", p.Kind, p.Name, err)
+			}
+			flat.Cond = n.rewrite(cond, scope, params)
+		}
+		if p.Domain.Reset != nil {
+			flat.Reset = n.rewriteName(p.Domain.Reset.Name, scope)
+		}
+		n.Properties = append(n.Properties, flat)
+	}
+
+	for _, inst := range m.Instances {
+		childScope := ScopedName(scope, inst.InstanceName)
+		if inst.Module == nil {
+			n.Blackboxes[childScope] = inst
+			continue
+		}
+		child := inst.Module
+		childParams := make(map[string]interface{})
+		for k, v := range child.Parameters {
+			childParams[k] = v
+		}
+		for k, v := range inst.Parameters {
+			childParams[k] = v
+		}
+		if err := n.add(child, childScope, childParams); err != nil {
+			return fmt.Errorf("instance %s: %v", childScope, err)
+		}
+
+		// Port connections become assignments across the boundary
+		ports := make([]string, 0, len(inst.Connections))
+		for port := range inst.Connections {
+			ports = append(ports, port)
+		}
+		sort.Strings(ports)
+		for _, port := range ports {
+			sig := inst.Connections[port]
+			conn, err := ParseExpr(sig.Name)
+			if err != nil {
+				return fmt.Errorf("instance %s port %s: %v", childScope, port, err)
+			}
+			conn = n.rewrite(conn, scope, params)
+			portNet := &Expr{Kind: ExprIdent, Name: ScopedName(childScope, port)}
+			switch {
+			case hasSignal(child.Inputs, port):
+				n.Assigns = append(n.Assigns, &ContinuousAssign{LHS: portNet, RHS: conn, Scope: childScope})
+			case hasSignal(child.Outputs, port):
+				if !isLvalue(conn) {
+					return fmt.Errorf("instance %s output %s connected to non-assignable %s", childScope, port, sig.Name)
+				}
+				n.Assigns = append(n.Assigns, &ContinuousAssign{LHS: conn, RHS: portNet, Scope: scope})
+			default:
+				return fmt.Errorf("instance %s has no port %s", childScope, port)
+			}
+		}
+	}
+	return nil
+}
+
+// Declare the signals and memories of a module in the given scope
+func (n *Netlist) declare(m *Module, scope string) {
+	declare := func(sig *Signal) {
+		name := ScopedName(scope, sig.Name)
+		if _, exists := n.Nets[name]; exists {
+			return
+		}
+		n.Nets[name] = &Net{Name: name, Width: sig.Width, Kind: sig.Kind, Signal: sig, Scope: scope}
+		n.NetOrder = append(n.NetOrder, name)
+	}
+	for _, sig := range m.Inputs {
+		declare(sig)
+	}
+	for _, sig := range m.Outputs {
+		declare(sig)
+	}
+	for _, sig := range m.Wires {
+		declare(sig)
+	}
+	for _, sig := range m.Regs {
+		declare(sig)
+	}
+	for _, bundle := range m.Bundles {
+		for _, field := range bundle.Fields {
+			declare(field)
+		}
+	}
+	for _, vec := range m.Vecs {
+		for _, element := range vec.Elements {
+			declare(element)
+		}
+	}
+	for _, mem := range m.Memories {
+		name := ScopedName(scope, mem.Name)
+		n.Memories[name] = &NetMemory{Name: name, Memory: mem, Scope: scope}
+	}
+}
+
+func hasSignal(signals []*Signal, name string) bool {
+	for _, sig := range signals {
+		if sig.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Netlist) rewriteName(name, scope string) string {
+	if name == "" {
+		return ""
+	}
+	return ScopedName(scope, name)
+}
+
+// Move an expression into the flat namespace: prefix identifiers with the
+// scope, replace parameters by constants and resolve Vec elements, whose
+// signals are named like "v[2]"
+func (n *Netlist) rewrite(e *Expr, scope string, params map[string]interface{}) *Expr {
+	switch e.Kind {
+	case ExprIdent:
+		name := ScopedName(scope, e.Name)
+		if _, isNet := n.Nets[name]; !isNet {
+			if _, isMem := n.Memories[name]; !isMem {
+				if v, ok := paramValue(params[e.Name]); ok {
+					return &Expr{Kind: ExprConst, Value: v}
+				}
+			}
+		}
+		return &Expr{Kind: ExprIdent, Name: name}
+	case ExprIndex:
+		if e.Args[0].Kind == ExprIdent && e.Args[1].Kind == ExprConst {
+			element := ScopedName(scope, fmt.Sprintf("%s[%d]", e.Args[0].Name, e.Args[1].Value))
+			if _, ok := n.Nets[element]; ok {
+				return &Expr{Kind: ExprIdent, Name: element}
+			}
+		}
+	}
+	out := *e
+	out.Args = make([]*Expr, len(e.Args))
+	for i, arg := range e.Args {
+		out.Args[i] = n.rewrite(arg, scope, params)
+	}
+	return &out
+}
+
+func (n *Netlist) rewriteStmt(s *Stmt, scope string, params map[string]interface{}) *Stmt {
+	if s == nil {
+		return nil
+	}
+	out := &Stmt{Kind: s.Kind}
+	if s.Cond != nil {
+		out.Cond = n.rewrite(s.Cond, scope, params)
+	}
+	if s.LHS != nil {
+		out.LHS = n.rewrite(s.LHS, scope, params)
+	}
+	if s.RHS != nil {
+		out.RHS = n.rewrite(s.RHS, scope, params)
+	}
+	out.Then = n.rewriteStmt(s.Then, scope, params)
+	out.Else = n.rewriteStmt(s.Else, scope, params)
+	for _, b := range s.Body {
+		out.Body = append(out.Body, n.rewriteStmt(b, scope, params))
+	}
+	for _, item := range s.Items {
+		flat := &CaseItem{Body: n.rewriteStmt(item.Body, scope, params)}
+		for _, label := range item.Labels {
+			flat.Labels = append(flat.Labels, n.rewrite(label, scope, params))
+		}
+		out.Items = append(out.Items, flat)
+	}
+	return out
+}
+
+// Integer value of a module parameter
+func paramValue(v interface{}) (uint64, bool) {
+	switch p := v.(type) {
+	case int:
+		return uint64(p), true
+	case Width:
+		return uint64(p), true
+	case bool:
+		if p {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Follow plain net-to-net assignments (port connections and aliases) back
+// to the net that actually drives a signal
+func (n *Netlist) Resolve(name string) string {
+	if n.aliases == nil {
+		n.aliases = make(map[string]string)
+		for _, a := range n.Assigns {
+			if a.LHS.Kind == ExprIdent && a.RHS.Kind == ExprIdent {
+				n.aliases[a.LHS.Name] = a.RHS.Name
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for !seen[name] {
+		seen[name] = true
+		next, ok := n.aliases[name]
+		if !ok {
+			break
+		}
+		name = next
+	}
+	return name
+}
+
+// Self-determined width of an expression over the flat names of the
+// netlist, by the Verilog sizing rules the simulator and formal export
+// share. $past has the width of its argument; other calls are 1 bit.
+func (n *Netlist) ExprWidth(e *Expr) (int, error) {
+	switch e.Kind {
+	case ExprIdent:
+		net, ok := n.Nets[e.Name]
+		if !ok {
+			if _, isMem := n.Memories[e.Name]; isMem {
+				return 0, fmt.Errorf("memory %s used without an address", e.Name)
+			}
+			return 0, fmt.Errorf("undeclared identifier %s", e.Name)
+		}
+		return int(net.Width), nil
+	case ExprConst:
+		if e.Width == 0 {
+			return 32, nil
+		}
+		return int(e.Width), nil
+	case ExprIndex:
+		if base := e.Args[0]; base.Kind == ExprIdent {
+			if mem, ok := n.Memories[base.Name]; ok {
+				return int(mem.Memory.Width), nil
+			}
+		}
+		return 1, nil
+	case ExprSlice:
+		return e.Hi - e.Lo + 1, nil
+	case ExprUnary:
+		switch e.Op {
+		case "~", "-", "+":
+			return n.ExprWidth(e.Args[0])
+		}
+		return 1, nil
+	case ExprBinary:
+		switch e.Op {
+		case "==", "!=", "===", "!==", "<", "<=", ">", ">=", "&&", "||":
+			return 1, nil
+		case "<<", ">>", "<<<", ">>>", "**":
+			return n.ExprWidth(e.Args[0])
+		}
+		return n.MaxExprWidth(e.Args[0], e.Args[1])
+	case ExprTernary:
+		return n.MaxExprWidth(e.Args[1], e.Args[2])
+	case ExprConcat, ExprRepeat:
+		total := 0
+		for _, arg := range e.Args {
+			w, err := n.ExprWidth(arg)
+			if err != nil {
+				return 0, err
+			}
+			total += w
+		}
+		if e.Kind == ExprRepeat {
+			total *= e.Count
+		}
+		return total, nil
+	case ExprCall:
+		if e.Name == "$past" && len(e.Args) > 0 {
+			return n.ExprWidth(e.Args[0])
+		}
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unsupported expression %s", e)
+}
+
+// Width of the wider of two expressions, as operands of a binary operator
+// or the branches of a ternary
+func (n *Netlist) MaxExprWidth(a, b *Expr) (int, error) {
+	wa, err := n.ExprWidth(a)
+	if err != nil {
+		return 0, err
+	}
+	wb, err := n.ExprWidth(b)
+	if err != nil {
+		return 0, err
+	}
+	if wa > wb {
+		return wa, nil
+	}
+	return wb, nil
+}
+
+// Clock domain whose clock drives the given clock net. Domains declared in
+// any scope of the hierarchy are considered, so a child's domain maps onto
+// the parent domain its clock port is connected to.
+func (n *Netlist) ClockDomainOf(clock string) *ClockDomain {
+	root := n.Resolve(clock)
+	for _, scope := range n.scopeOrder() {
+		for _, cd := range n.Scopes[scope].ClockDomains {
+			if cd.Clock != nil && n.Resolve(ScopedName(scope, cd.Clock.Name)) == root {
+				return cd
+			}
+		}
+	}
+	return nil
+}
+
+// Instance paths ordered from the top down
+func (n *Netlist) scopeOrder() []string {
+	scopes := make([]string, 0, len(n.Scopes))
+	for scope := range n.Scopes {
+		scopes = append(scopes, scope)
+	}
+	// Shallower scopes first, then by name for a stable order
+	sort.Slice(scopes, func(i, j int) bool {
+		di, dj := scopeDepth(scopes[i]), scopeDepth(scopes[j])
+		if di != dj {
+			return di < dj
+		}
+		return scopes[i] < scopes[j]
+	})
+	return scopes
+}
+
+func scopeDepth(scope string) int {
+	if scope == "" {
+		return 0
+	}
+	return strings.Count(scope, ".") + 1
+}
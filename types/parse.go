@@ -0,0 +1,917 @@
+package hdl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The module's logic is held as Verilog text in Assigns and Always. The
+// parser below turns that text back into expression and statement trees
+// so it can be analyzed and simulated. It accepts the subset of Verilog
+// the builders emit: continuous assigns, always blocks with begin/end,
+// if/else, case and blocking/nonblocking assignments.
+
+type ExprKind int
+
+const (
+	ExprIdent   ExprKind = iota // Name
+	ExprConst                   // Value (with XMask/ZMask), Width 0 when unsized
+	ExprIndex                   // Args[0][Args[1]]
+	ExprSlice                   // Args[0][Hi:Lo]
+	ExprUnary                   // Op Args[0]
+	ExprBinary                  // Args[0] Op Args[1]
+	ExprTernary                 // Args[0] ? Args[1] : Args[2]
+	ExprConcat                  // {Args...}
+	ExprRepeat                  // {Count{Args...}}
+	ExprCall                    // Name(Args...), a system function such as $past
+)
+
+// Expression node of the parsed logic
+type Expr struct {
+	Kind  ExprKind
+	Op    string
+	Name  string
+	Value uint64
+	XMask uint64 // bits written as x in a literal
+	ZMask uint64 // bits written as z in a literal
+	Width Width
+	Hi    int
+	Lo    int
+	Count int
+	Args  []*Expr
+}
+
+type StmtKind int
+
+const (
+	StmtBlock       StmtKind = iota // begin Body end
+	StmtIf                          // if (Cond) Then else Else
+	StmtCase                        // case (Cond) Items endcase
+	StmtBlocking                    // LHS = RHS
+	StmtNonblocking                 // LHS <= RHS
+)
+
+// Statement node of the parsed logic
+type Stmt struct {
+	Kind  StmtKind
+	Cond  *Expr
+	Then  *Stmt
+	Else  *Stmt
+	Body  []*Stmt
+	Items []*CaseItem
+	LHS   *Expr
+	RHS   *Expr
+}
+
+// Case branch; nil Labels marks the default branch
+type CaseItem struct {
+	Labels []*Expr
+	Body   *Stmt
+}
+
+// Edge in an always block's sensitivity list
+type Sensitivity struct {
+	Edge   string // "posedge", "negedge" or "" for level
+	Signal string
+}
+
+// Parsed always block. Clock and Edge are empty for combinational blocks;
+// any further edges in the sensitivity list (asynchronous resets) follow
+// in Sensitivity.
+type Process struct {
+	Clock       string
+	Edge        string
+	Sensitivity []Sensitivity
+	Body        *Stmt
+	Scope       string // instance path once flattened
+}
+
+// Parsed continuous assignment
+type ContinuousAssign struct {
+	LHS   *Expr
+	RHS   *Expr
+	Scope string // instance path once flattened
+}
+
+// Parsed logic of a single module
+type Logic struct {
+	Assigns   []*ContinuousAssign
+	Processes []*Process
+}
+
+// Parse the module's Assigns and Always text
+func (m *Module) ParseLogic() (*Logic, error) {
+	logic := &Logic{}
+	if err := parseItems(strings.Join(m.Assigns, "\n"), logic); err != nil {
+		return nil, fmt.Errorf("module %s assigns: %v", m.Name, err)
+	}
+	if err := parseItems(strings.Join(m.Always, "\n"), logic); err != nil {
+		return nil, fmt.Errorf("module %s always blocks: %v", m.Name, err)
+	}
+	return logic, nil
+}
+
+// Parse a single Verilog expression
+func ParseExpr(src string) (*Expr, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %q after expression", p.peek().text)
+	}
+	return e, nil
+}
+
+func parseItems(src string, logic *Logic) error {
+	p, err := newParser(src)
+	if err != nil {
+		return err
+	}
+	for p.peek().kind != tokEOF {
+		switch {
+		case p.accept("assign"):
+			lhs, err := p.lvalue()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("="); err != nil {
+				return err
+			}
+			rhs, err := p.expr()
+			if err != nil {
+				return err
+			}
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+			logic.Assigns = append(logic.Assigns, &ContinuousAssign{LHS: lhs, RHS: rhs})
+		case p.accept("always"):
+			proc, err := p.process()
+			if err != nil {
+				return err
+			}
+			logic.Processes = append(logic.Processes, proc)
+		case p.accept(";"):
+		default:
+			return p.errorf("unexpected %q, expected assign or always", p.peek().text)
+		}
+	}
+	return nil
+}
+
+// === LEXER ===
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+// Operators, longest first so greedy matching works
+var operators = []string{
+	"<<<", ">>>", "===", "!==",
+	"<=", ">=", "==", "!=", "&&", "||", "<<", ">>", "~&", "~|", "~^", "^~", "**",
+	"+", "-", "*", "/", "%", "&", "|", "^", "~", "!", "<", ">", "?", ":",
+	"(", ")", "[", "]", "{", "}", ",", ";", "=", "@", "#",
+}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case isIdentStart(c) || c == '$':
+			start := i
+			i++
+			for i < len(src) && isIdentChar(src[i]) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case c >= '0' && c <= '9' || c == '\'':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '_') {
+				i++
+			}
+			if i < len(src) && src[i] == '\'' {
+				i++
+				if i < len(src) && (src[i] == 's' || src[i] == 'S') {
+					i++
+				}
+				if i < len(src) && strings.ContainsRune("bBhHdDoO", rune(src[i])) {
+					i++
+				}
+				for i < len(src) && (isHexDigit(src[i]) || strings.ContainsRune("xXzZ?_", rune(src[i]))) {
+					i++
+				}
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at %s", c, location(src, i))
+			}
+		}
+	}
+	toks = append(toks, token{tokEOF, "end of input", len(src)})
+	return toks, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '$'
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// Line number and text of a source position, for error messages
+func location(src string, pos int) string {
+	line := strings.Count(src[:pos], "\n") + 1
+	start := strings.LastIndex(src[:pos], "\n") + 1
+	end := strings.Index(src[pos:], "\n")
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += pos
+	}
+	return fmt.Sprintf("line %d: %s", line, strings.TrimSpace(src[start:end]))
+}
+
+// Parse a Verilog number literal such as 8'hff, 1'b1, 'd3 or 42
+func parseNumber(text string) (*Expr, error) {
+	text = strings.ReplaceAll(text, "_", "")
+	quote := strings.IndexByte(text, '\'')
+	if quote < 0 {
+		v, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", text)
+		}
+		return &Expr{Kind: ExprConst, Value: v}, nil
+	}
+
+	width := 0
+	if quote > 0 {
+		w, err := strconv.Atoi(text[:quote])
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("bad width in %q", text)
+		}
+		if w > 64 {
+			return nil, fmt.Errorf("literal %q wider than 64 bits", text)
+		}
+		width = w
+	}
+	rest := text[quote+1:]
+	if rest != "" && (rest[0] == 's' || rest[0] == 'S') {
+		rest = rest[1:]
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("bad number %q", text)
+	}
+	base := strings.ToLower(rest[:1])
+	digits := strings.ToLower(rest[1:])
+	if digits == "" {
+		return nil, fmt.Errorf("bad number %q", text)
+	}
+
+	e := &Expr{Kind: ExprConst, Width: Width(width)}
+	if base == "d" {
+		if digits == "x" || digits == "z" {
+			e.XMask = ^uint64(0)
+			if digits == "z" {
+				e.ZMask = ^uint64(0)
+			}
+		} else {
+			v, err := strconv.ParseUint(digits, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %q", text)
+			}
+			e.Value = v
+		}
+	} else {
+		bits := map[string]uint{"b": 1, "o": 3, "h": 4}[base]
+		if bits == 0 {
+			return nil, fmt.Errorf("bad base in %q", text)
+		}
+		if uint(len(strings.TrimLeft(digits, "0")))*bits > 64 {
+			return nil, fmt.Errorf("literal %q wider than 64 bits", text)
+		}
+		digitMask := uint64(1)<<bits - 1
+		for _, d := range digits {
+			e.Value <<= bits
+			e.XMask <<= bits
+			e.ZMask <<= bits
+			switch d {
+			case 'x':
+				e.XMask |= digitMask
+			case 'z', '?':
+				e.XMask |= digitMask
+				e.ZMask |= digitMask
+			default:
+				v, err := strconv.ParseUint(string(d), 16, 8)
+				if err != nil || v > digitMask {
+					return nil, fmt.Errorf("bad digit %q in %q", d, text)
+				}
+				e.Value |= v
+			}
+		}
+		// An unknown leading digit extends to the full width
+		lead := digits[0]
+		if width > 0 && (lead == 'x' || lead == 'z' || lead == '?') {
+			used := uint(len(digits)) * bits
+			if used < uint(width) {
+				ext := (uint64(1)<<uint(width) - 1) &^ (uint64(1)<<used - 1)
+				e.XMask |= ext
+				if lead != 'x' {
+					e.ZMask |= ext
+				}
+			}
+		}
+	}
+	if width > 0 && width < 64 {
+		mask := uint64(1)<<uint(width) - 1
+		e.Value &= mask
+		e.XMask &= mask
+		e.ZMask &= mask
+	}
+	e.Value &^= e.XMask
+	return e, nil
+}
+
+// === PARSER ===
+
+type parser struct {
+	src  string
+	toks []token
+	pos  int
+}
+
+func newParser(src string) (*parser, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{src: src, toks: toks}, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q, found %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s (%s)", fmt.Sprintf(format, args...), location(p.src, p.peek().pos))
+}
+
+func (p *parser) process() (*Process, error) {
+	proc := &Process{}
+	if err := p.expect("@"); err != nil {
+		return nil, err
+	}
+	if p.accept("*") {
+		body, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		proc.Body = body
+		return proc, nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if !p.accept("*") {
+		for {
+			item := Sensitivity{}
+			if p.accept("posedge") {
+				item.Edge = "posedge"
+			} else if p.accept("negedge") {
+				item.Edge = "negedge"
+			}
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, p.errorf("expected signal in sensitivity list, found %q", t.text)
+			}
+			item.Signal = t.text
+			if item.Edge != "" {
+				if proc.Clock == "" {
+					proc.Clock = item.Signal
+					proc.Edge = item.Edge
+				} else {
+					proc.Sensitivity = append(proc.Sensitivity, item)
+				}
+			}
+			if !p.accept("or") && !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.stmt()
+	if err != nil {
+		return nil, err
+	}
+	proc.Body = body
+	return proc, nil
+}
+
+func (p *parser) stmt() (*Stmt, error) {
+	switch {
+	case p.accept("begin"):
+		block := &Stmt{Kind: StmtBlock}
+		for !p.accept("end") {
+			if p.peek().kind == tokEOF {
+				return nil, p.errorf("missing end")
+			}
+			s, err := p.stmt()
+			if err != nil {
+				return nil, err
+			}
+			block.Body = append(block.Body, s)
+		}
+		return block, nil
+	case p.accept("if"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		then, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		s := &Stmt{Kind: StmtIf, Cond: cond, Then: then}
+		if p.accept("else") {
+			if s.Else, err = p.stmt(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case p.accept("case"), p.accept("casez"), p.accept("casex"):
+		return p.caseStmt()
+	case p.accept(";"):
+		return &Stmt{Kind: StmtBlock}, nil
+	}
+
+	lhs, err := p.lvalue()
+	if err != nil {
+		return nil, err
+	}
+	s := &Stmt{LHS: lhs}
+	if p.accept("<=") {
+		s.Kind = StmtNonblocking
+	} else if p.accept("=") {
+		s.Kind = StmtBlocking
+	} else {
+		return nil, p.errorf("expected assignment, found %q", p.peek().text)
+	}
+	if s.RHS, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *parser) caseStmt() (*Stmt, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	subject, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	s := &Stmt{Kind: StmtCase, Cond: subject}
+	for !p.accept("endcase") {
+		if p.peek().kind == tokEOF {
+			return nil, p.errorf("missing endcase")
+		}
+		item := &CaseItem{}
+		if p.accept("default") {
+			p.accept(":")
+		} else {
+			for {
+				label, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				item.Labels = append(item.Labels, label)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+		}
+		body, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		item.Body = body
+		s.Items = append(s.Items, item)
+	}
+	return s, nil
+}
+
+// Assignment target: identifier with optional selects, or a concatenation of them
+func (p *parser) lvalue() (*Expr, error) {
+	e, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if !isLvalue(e) {
+		return nil, p.errorf("invalid assignment target %s", e)
+	}
+	return e, nil
+}
+
+func isLvalue(e *Expr) bool {
+	switch e.Kind {
+	case ExprIdent:
+		return true
+	case ExprIndex, ExprSlice:
+		return isLvalue(e.Args[0])
+	case ExprConcat:
+		for _, arg := range e.Args {
+			if !isLvalue(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Binary operator precedence, higher binds tighter
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4, "~^": 4, "^~": 4,
+	"&":  5,
+	"==": 6, "!=": 6, "===": 6, "!==": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8, "<<<": 8, ">>>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+	"**": 11,
+}
+
+func (p *parser) expr() (*Expr, error) {
+	cond, err := p.binary(1)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	a, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{Kind: ExprTernary, Args: []*Expr{cond, a, b}}, nil
+}
+
+func (p *parser) binary(minPrec int) (*Expr, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := binaryPrecedence[t.text]
+		if t.kind != tokOp || !ok || prec < minPrec {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.binary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Expr{Kind: ExprBinary, Op: t.text, Args: []*Expr{lhs, rhs}}
+	}
+}
+
+var unaryOperators = map[string]bool{
+	"+": true, "-": true, "!": true, "~": true,
+	"&": true, "~&": true, "|": true, "~|": true, "^": true, "~^": true, "^~": true,
+}
+
+func (p *parser) unary() (*Expr, error) {
+	t := p.peek()
+	if t.kind == tokOp && unaryOperators[t.text] {
+		p.next()
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprUnary, Op: t.text, Args: []*Expr{arg}}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (*Expr, error) {
+	t := p.next()
+	var e *Expr
+	switch {
+	case t.kind == tokIdent && t.text[0] == '$' && p.accept("("):
+		e = &Expr{Kind: ExprCall, Name: t.text}
+		for !p.accept(")") {
+			if len(e.Args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			e.Args = append(e.Args, arg)
+		}
+	case t.kind == tokIdent:
+		e = &Expr{Kind: ExprIdent, Name: t.text}
+	case t.kind == tokNumber:
+		n, err := parseNumber(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("%v (%s)", err, location(p.src, t.pos))
+		}
+		e = n
+	case t.text == "(":
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		e = inner
+	case t.text == "{":
+		concat, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		e = concat
+	default:
+		p.pos--
+		return nil, p.errorf("unexpected %q in expression", t.text)
+	}
+
+	// Bit and part selects
+	for p.accept("[") {
+		idx, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(":") {
+			lo, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if idx.Kind != ExprConst || lo.Kind != ExprConst {
+				return nil, p.errorf("part select bounds must be constants")
+			}
+			e = &Expr{Kind: ExprSlice, Hi: int(idx.Value), Lo: int(lo.Value), Args: []*Expr{e}}
+		} else {
+			e = &Expr{Kind: ExprIndex, Args: []*Expr{e, idx}}
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Concatenation or replication after the opening brace
+func (p *parser) concat() (*Expr, error) {
+	first, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("{") {
+		if first.Kind != ExprConst {
+			return nil, p.errorf("replication count must be a constant")
+		}
+		inner, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprRepeat, Count: int(first.Value), Args: inner.Args}, nil
+	}
+	e := &Expr{Kind: ExprConcat, Args: []*Expr{first}}
+	for p.accept(",") {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		e.Args = append(e.Args, arg)
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// === PRINTING AND TRAVERSAL ===
+
+// Verilog text of the expression, fully parenthesized
+func (e *Expr) String() string {
+	switch e.Kind {
+	case ExprIdent:
+		return e.Name
+	case ExprConst:
+		if e.XMask != 0 {
+			var b strings.Builder
+			w := int(e.Width)
+			if w == 0 {
+				w = 32
+			}
+			for i := w - 1; i >= 0; i-- {
+				switch {
+				case e.ZMask>>uint(i)&1 == 1:
+					b.WriteByte('z')
+				case e.XMask>>uint(i)&1 == 1:
+					b.WriteByte('x')
+				default:
+					b.WriteByte(byte('0' + e.Value>>uint(i)&1))
+				}
+			}
+			return fmt.Sprintf("%d'b%s", w, b.String())
+		}
+		if e.Width == 0 {
+			return fmt.Sprintf("%d", e.Value)
+		}
+		return fmt.Sprintf("%d'h%x", e.Width, e.Value)
+	case ExprIndex:
+		return fmt.Sprintf("%s[%s]", e.Args[0], e.Args[1])
+	case ExprSlice:
+		return fmt.Sprintf("%s[%d:%d]", e.Args[0], e.Hi, e.Lo)
+	case ExprUnary:
+		return fmt.Sprintf("(%s%s)", e.Op, e.Args[0])
+	case ExprBinary:
+		return fmt.Sprintf("(%s %s %s)", e.Args[0], e.Op, e.Args[1])
+	case ExprTernary:
+		return fmt.Sprintf("(%s ? %s : %s)", e.Args[0], e.Args[1], e.Args[2])
+	case ExprConcat:
+		parts := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			parts[i] = arg.String()
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case ExprRepeat:
+		parts := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			parts[i] = arg.String()
+		}
+		return fmt.Sprintf("{%d{%s}}", e.Count, strings.Join(parts, ", "))
+	case ExprCall:
+		parts := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			parts[i] = arg.String()
+		}
+		return fmt.Sprintf("%s(%s)", e.Name, strings.Join(parts, ", "))
+	}
+	return "?"
+}
+
+// Names of all identifiers the expression reads
+func (e *Expr) Idents() []string {
+	var names []string
+	e.Walk(func(x *Expr) {
+		if x.Kind == ExprIdent {
+			names = append(names, x.Name)
+		}
+	})
+	return names
+}
+
+// Call fn for the expression and every subexpression
+func (e *Expr) Walk(fn func(*Expr)) {
+	fn(e)
+	for _, arg := range e.Args {
+		arg.Walk(fn)
+	}
+}
+
+// Base identifier an assignment target writes, e.g. mem for mem[addr]
+func (e *Expr) Target() string {
+	switch e.Kind {
+	case ExprIdent:
+		return e.Name
+	case ExprIndex, ExprSlice:
+		return e.Args[0].Target()
+	}
+	return ""
+}
+
+// Base identifiers of all assignment targets, expanding concatenations
+func (e *Expr) Targets() []string {
+	if e.Kind == ExprConcat {
+		var names []string
+		for _, arg := range e.Args {
+			names = append(names, arg.Targets()...)
+		}
+		return names
+	}
+	return []string{e.Target()}
+}
+
+// Names an assignment target reads without writing them, such as the
+// address of mem[addr]
+func (e *Expr) TargetReads() []string {
+	switch e.Kind {
+	case ExprIndex:
+		return append(e.Args[0].TargetReads(), e.Args[1].Idents()...)
+	case ExprSlice:
+		return e.Args[0].TargetReads()
+	case ExprConcat:
+		var names []string
+		for _, arg := range e.Args {
+			names = append(names, arg.TargetReads()...)
+		}
+		return names
+	}
+	return nil
+}
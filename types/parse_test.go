@@ -0,0 +1,167 @@
+package hdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	cases := map[string]string{
+		"a + b * c":            "(a + (b * c))",
+		"a && !b || c":         "((a && (!b)) || c)",
+		"sel ? x[3:0] : 4'h0":  "(sel ? x[3:0] : 4'h0)",
+		"{2{a}} ^ {b, c[1]}":   "({2{a}} ^ {b, c[1]})",
+		"~x & (y >> 1)":        "((~x) & (y >> 1))",
+		"^g[3:2]":              "(^g[3:2])",
+		"8'bxxxx0000":          "8'bxxxx0000",
+	}
+	for src, want := range cases {
+		e, err := ParseExpr(src)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", src, err)
+			continue
+		}
+		if got := e.String(); got != want {
+			t.Errorf("ParseExpr(%q) = %s, want %s", src, got, want)
+		}
+	}
+	
+	if _, err := ParseExpr("a + "); err == nil {
+		t.Errorf("Incomplete expression should fail to parse")
+	}
+}
+
+func TestParseLogic(t *testing.T) {
+	m := &Module{Name: "ParseTest"}
+	m.Input("clk", 1)
+	m.Input("rst", 1)
+	m.AssignName("y", "a & b")
+	m.Always = append(m.Always,
+		"always @(posedge clk or posedge rst) begin",
+		"  if (rst) q <= 1'b0;",
+		"  else begin",
+		"    case (state)",
+		"      2'd0: q <= d;",
+		"      default: ;",
+		"    endcase",
+		"  end",
+		"end",
+		"always @(*) z = q ? 8'hff : 8'h00;")
+	
+	logic, err := m.ParseLogic()
+	if err != nil {
+		t.Fatalf("ParseLogic: %v", err)
+	}
+	if len(logic.Assigns) != 1 || logic.Assigns[0].LHS.Name != "y" {
+		t.Errorf("Expected one assign to y")
+	}
+	if len(logic.Processes) != 2 {
+		t.Fatalf("Expected two processes, got %d", len(logic.Processes))
+	}
+	seq := logic.Processes[0]
+	if seq.Clock != "clk" || seq.Edge != "posedge" || len(seq.Sensitivity) != 1 || seq.Sensitivity[0].Signal != "rst" {
+		t.Errorf("Clocked process should use clk with asynchronous rst")
+	}
+	if logic.Processes[1].Clock != "" {
+		t.Errorf("always @(*) should be combinational")
+	}
+	
+	m.Always = append(m.Always, "always @(posedge clk) q <= ;")
+	if _, err := m.ParseLogic(); err == nil || !strings.Contains(err.Error(), "ParseTest") {
+		t.Errorf("Malformed always block should report the module, got %v", err)
+	}
+}
+
+func TestFlattenInstances(t *testing.T) {
+	child := &Module{Name: "Child"}
+	child.Input("clk", 1)
+	child.Input("d", 8)
+	child.Output("q", 8)
+	child.Reg("q_r", 8)
+	child.Always = append(child.Always, "always @(posedge clk) q_r <= d + WIDTH;")
+	child.AssignName("q", "q_r")
+	child.SetParameter("WIDTH", 1)
+	
+	top := &Module{Name: "Top"}
+	clk := top.Input("clk", 1)
+	in := top.Input("in", 8)
+	out := top.Output("out", 8)
+	top.InstanceOf(child, "u_child").
+		SetParameter("WIDTH", 3).
+		Connect("clk", clk).
+		Connect("d", in).
+		Connect("q", out)
+	top.Instance("Vendor", "u_ip").Connect("clk", clk)
+	
+	n, err := top.Flatten()
+	if err != nil {
+		t.Fatalf("Flatten: %v", err)
+	}
+	if n.Nets["u_child.q_r"] == nil || n.Nets["u_child.q_r"].Scope != "u_child" {
+		t.Errorf("Child register should be flattened under u_child")
+	}
+	if n.Blackboxes["u_ip"] == nil {
+		t.Errorf("Instance without a definition should be a blackbox")
+	}
+	if n.Resolve("u_child.clk") != "clk" || n.Resolve("out") != "u_child.q_r" {
+		t.Errorf("Port connections should resolve across the boundary")
+	}
+	body := n.Processes[0].Body
+	if body.LHS.Name != "u_child.q_r" || body.RHS.String() != "(u_child.d + 3)" {
+		t.Errorf("Child logic should be renamed and parameterized, got %s <= %s", body.LHS, body.RHS)
+	}
+}
+
+func TestExprWidth(t *testing.T) {
+	m := &Module{Name: "Widths"}
+	m.Input("a", 8)
+	m.Input("b", 12)
+	m.Input("sel", 1)
+	m.AsyncMem("mem", 16, 4)
+	n, err := m.Flatten()
+	if err != nil {
+		t.Fatalf("Flatten: %v", err)
+	}
+	for src, want := range map[string]int{
+		"a + b":        12,
+		"a == b":       1,
+		"a << b":       8,
+		"sel ? a : b":  12,
+		"{a, b, 4'h0}": 24,
+		"{3{a}}":       24,
+		"b[9:2]":       8,
+		"mem[a]":       16,
+		"~a":           8,
+		"&b":           1,
+		"$past(b)":     12,
+		"$rose(sel)":   1,
+		"5":            32,
+	} {
+		e, err := ParseExpr(src)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q): %v", src, err)
+		}
+		if w, err := n.ExprWidth(e); err != nil || w != want {
+			t.Errorf("Width of %s = %d, %v, want %d", src, w, err, want)
+		}
+	}
+	for src, msg := range map[string]string{
+		"missing + a": "undeclared identifier missing",
+		"mem + a":     "memory mem used without an address",
+	} {
+		e, _ := ParseExpr(src)
+		if _, err := n.ExprWidth(e); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("Width of %s should fail with %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestTargetReads(t *testing.T) {
+	e, err := ParseExpr("{mem[addr + 1], v[3:0], x}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.TargetReads(), " "); got != "addr" {
+		t.Errorf("Target reads %q, want addr", got)
+	}
+}
@@ -0,0 +1,224 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Assertion, assumption or cover point sampled on the rising edge of a
+// clock and ignored while the domain's reset is asserted
+type Property struct {
+	Kind     string // "assert", "assume" or "cover"
+	Name     string
+	Cond     *Signal   // 1-bit condition, or the SVA text of Temporal
+	Temporal *Temporal // nil for a single-cycle condition
+	Domain   *ClockDomain
+	Message  string // reported when an assertion or assumption fails
+	Location string // Go source that declared the property, e.g. "fifo.go:42"
+
+	module *Module // declaring module, for the widths of sampled values
+}
+
+// Check that a condition holds on every cycle of the domain. Without a
+// domain the module clock and reset are used.
+func (m *Module) Assert(name string, cond *Signal, domain *ClockDomain) *Property {
+	return m.addProperty("assert", name, cond, domain)
+}
+
+// Constrain the environment: formal tools take the condition as given and
+// simulation reports stimulus that breaks it
+func (m *Module) Assume(name string, cond *Signal, domain *ClockDomain) *Property {
+	return m.addProperty("assume", name, cond, domain)
+}
+
+// Count the cycles where a condition holds, to show a scenario was reached
+func (m *Module) Cover(name string, cond *Signal, domain *ClockDomain) *Property {
+	return m.addProperty("cover", name, cond, domain)
+}
+
+func (m *Module) addProperty(kind, name string, cond *Signal, domain *ClockDomain) *Property {
+	if cond.Width != 1 {
+		panic(fmt.Sprintf("%s %s: condition %s is %d bits wide, want 1", kind, name, cond.Name, cond.Width))
+	}
+	if domain == nil {
+		if m.Clock == nil {
+			panic(fmt.Sprintf("%s %s: module %s has no clock, pass a clock domain", kind, name, m.Name))
+		}
+		domain = &ClockDomain{Name: m.Clock.Name, Clock: m.Clock, Reset: m.Reset}
+	}
+	for _, p := range m.Properties {
+		if p.Name == name {
+			panic(fmt.Sprintf("%s %s: module %s already has a property named %s", kind, name, m.Name, name))
+		}
+	}
+	p := &Property{Kind: kind, Name: name, Cond: cond, Domain: domain, module: m}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		p.Location = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	m.Properties = append(m.Properties, p)
+	return p
+}
+
+// Set the message reported when the property fails
+func (p *Property) WithMessage(msg string) *Property {
+	p.Message = msg
+	return p
+}
+
+// Statement label, prefixed so it cannot clash with a signal name
+func (p *Property) Label() string {
+	return p.Kind + "_" + p.Name
+}
+
+func (p *Property) failure() string {
+	what := "assertion"
+	if p.Kind == "assume" {
+		what = "assumption"
+	}
+	msg := fmt.Sprintf("%s %s failed", what, p.Name)
+	if p.Message != "" {
+		msg += ": " + p.Message
+	}
+	if p.Location != "" {
+		msg += " (" + p.Location + ")"
+	}
+	return strconv.Quote(msg)
+}
+
+// SystemVerilog concurrent assertion
+func (p *Property) SVA() string {
+	expr := fmt.Sprintf("@(posedge %s)", p.Domain.Clock.Name)
+	if p.Domain.Reset != nil {
+		expr += fmt.Sprintf(" disable iff (%s)", p.Domain.Reset.Name)
+	}
+	expr += " " + p.Cond.Name
+	if p.Kind == "cover" {
+		return fmt.Sprintf("%s: cover property (%s);", p.Label(), expr)
+	}
+	return fmt.Sprintf("%s: %s property (%s)\n    else $error(%s);", p.Label(), p.Kind, expr, p.failure())
+}
+
+// Clocked Verilog check for tools without SVA. The sampled-value
+// functions $past, $rose, $fell and $stable are SystemVerilog, so they are
+// lowered to registers holding the previous values, declared before the
+// check. Temporal properties need SVA.
+func (p *Property) Verilog() string {
+	if p.Temporal != nil {
+		panic(fmt.Sprintf("%s %s is temporal and can only be emitted as SVA", p.Kind, p.Name))
+	}
+	cond, history := p.Cond.Name, ""
+	if e, err := ParseExpr(cond); err == nil && hasSampledValues(e) {
+		cond, history = p.lowerSampledValues(e)
+	}
+	guard := ""
+	if p.Domain.Reset != nil {
+		guard = fmt.Sprintf("!(%s) && ", p.Domain.Reset.Name)
+	}
+	if p.Kind == "cover" {
+		return fmt.Sprintf("%salways @(posedge %s) // %s\n    if (%s(%s)) $display(\"cover %s hit at %%0t\", $time);",
+			history, p.Domain.Clock.Name, p.Label(), guard, cond, p.Name)
+	}
+	return fmt.Sprintf("%salways @(posedge %s) // %s\n    if (%s!(%s)) $error(%s);",
+		history, p.Domain.Clock.Name, p.Label(), guard, cond, p.failure())
+}
+
+func isSampledValue(e *Expr) bool {
+	if e.Kind != ExprCall {
+		return false
+	}
+	switch e.Name {
+	case "$past", "$rose", "$fell", "$stable":
+		return true
+	}
+	return false
+}
+
+func hasSampledValues(e *Expr) bool {
+	found := false
+	e.Walk(func(x *Expr) {
+		found = found || isSampledValue(x)
+	})
+	return found
+}
+
+// Replace the sampled-value functions of a condition by registers of the
+// previous values. Returns the condition and the Verilog declaring and
+// updating the registers, one line each.
+func (p *Property) lowerSampledValues(cond *Expr) (string, string) {
+	// Widths of the module's signals, and of the registers as they are added
+	widths := &Netlist{Nets: map[string]*Net{}, Memories: map[string]*NetMemory{}}
+	if p.module != nil {
+		widths.declare(p.module, "")
+	}
+	width := func(e *Expr) int {
+		w, err := widths.ExprWidth(e)
+		if err != nil {
+			panic(fmt.Sprintf("%s %s: %v", p.Kind, p.Name, err))
+		}
+		return w
+	}
+	var b strings.Builder
+	regs := 0
+	var lower func(e *Expr) *Expr
+	lower = func(e *Expr) *Expr {
+		out := *e
+		out.Args = make([]*Expr, len(e.Args))
+		for i, arg := range e.Args {
+			out.Args[i] = lower(arg)
+		}
+		if !isSampledValue(e) {
+			return &out
+		}
+		if len(out.Args) == 0 {
+			panic(fmt.Sprintf("%s %s: %s needs an argument", p.Kind, p.Name, e))
+		}
+		arg := out.Args[0]
+		depth := 1
+		if e.Name == "$past" && len(out.Args) == 2 {
+			if n := out.Args[1]; n.Kind != ExprConst || n.Value < 1 || n.Value > 63 {
+				panic(fmt.Sprintf("%s %s: %s: cycles must be a constant from 1 to 63", p.Kind, p.Name, e))
+			}
+			depth = int(out.Args[1].Value)
+		}
+
+		// $rose and $fell only look at the least significant bit
+		sampled := arg
+		if e.Name == "$rose" || e.Name == "$fell" {
+			switch w := width(arg); {
+			case w == 1:
+			case arg.Kind == ExprIdent:
+				sampled = &Expr{Kind: ExprIndex, Args: []*Expr{arg, {Kind: ExprConst, Value: 0}}}
+			default:
+				sampled = &Expr{Kind: ExprBinary, Op: "&", Args: []*Expr{arg, {Kind: ExprConst, Value: 1, Width: 1}}}
+			}
+		}
+		w := width(sampled)
+		name := fmt.Sprintf("%s_past%d", p.Label(), regs)
+		regs++
+		src := sampled
+		for i := 1; i <= depth; i++ {
+			reg := name
+			if depth > 1 {
+				reg = fmt.Sprintf("%s_%d", name, i)
+			}
+			fmt.Fprintf(&b, "reg [%d:0] %s;\n  ", w-1, reg)
+			fmt.Fprintf(&b, "always @(posedge %s) %s <= %s;\n  ", p.Domain.Clock.Name, reg, src)
+			widths.Nets[reg] = &Net{Name: reg, Width: Width(w), Kind: "reg"}
+			src = &Expr{Kind: ExprIdent, Name: reg}
+		}
+		past := src
+		switch e.Name {
+		case "$rose":
+			return &Expr{Kind: ExprBinary, Op: "&&", Args: []*Expr{sampled, {Kind: ExprUnary, Op: "!", Args: []*Expr{past}}}}
+		case "$fell":
+			return &Expr{Kind: ExprBinary, Op: "&&", Args: []*Expr{{Kind: ExprUnary, Op: "!", Args: []*Expr{sampled}}, past}}
+		case "$stable":
+			return &Expr{Kind: ExprBinary, Op: "==", Args: []*Expr{arg, past}}
+		}
+		return past
+	}
+	return lower(cond).String(), b.String()
+}
@@ -0,0 +1,124 @@
+package hdl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPropertyEmission(t *testing.T) {
+	m := &Module{Name: "PropTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	full := m.Output("full", 1)
+	wrEn := m.Input("wr_en", 1)
+
+	p := m.Assert("no_overflow", &Signal{Name: "!(full && wr_en)", Width: 1}, sys).WithMessage("write while full")
+	if !strings.HasPrefix(p.Location, "property_test.go:") {
+		t.Errorf("Location = %q, want this file", p.Location)
+	}
+	want := "assert_no_overflow: assert property (@(posedge clk) disable iff (rst) !(full && wr_en))\n" +
+		"    else $error(\"assertion no_overflow failed: write while full (" + p.Location + ")\");"
+	if got := p.SVA(); got != want {
+		t.Errorf("SVA:\n%s\nwant:\n%s", got, want)
+	}
+	want = "always @(posedge clk) // assert_no_overflow\n" +
+		"    if (!(rst) && !(!(full && wr_en))) $error(\"assertion no_overflow failed: write while full (" + p.Location + ")\");"
+	if got := p.Verilog(); got != want {
+		t.Errorf("Verilog:\n%s\nwant:\n%s", got, want)
+	}
+
+	c := m.Cover("full_seen", full, sys)
+	if got := c.SVA(); got != "cover_full_seen: cover property (@(posedge clk) disable iff (rst) full);" {
+		t.Errorf("Cover SVA = %q", got)
+	}
+	if got := c.Verilog(); !strings.Contains(got, "if (!(rst) && (full)) $display(\"cover full_seen hit at %0t\", $time);") {
+		t.Errorf("Cover Verilog = %q", got)
+	}
+	if got := m.Assume("one_hot", wrEn, sys).SVA(); !strings.Contains(got, "assume_one_hot: assume property") ||
+		!strings.Contains(got, "assumption one_hot failed") {
+		t.Errorf("Assume SVA = %q", got)
+	}
+	if len(m.Properties) != 3 {
+		t.Errorf("Module has %d properties, want 3", len(m.Properties))
+	}
+}
+
+func TestPropertyDefaults(t *testing.T) {
+	m := &Module{Name: "PropTest"}
+	m.SetClock(m.Input("clk", 1))
+	p := m.Assert("always_ready", m.Input("ready", 1), nil)
+	if got := p.SVA(); !strings.Contains(got, "(@(posedge clk) ready)") {
+		t.Errorf("Without a domain or reset the module clock should be used, got %q", got)
+	}
+
+	expectPanic := func(what, want string, fn func()) {
+		t.Helper()
+		defer func() {
+			r := recover()
+			if r == nil || !strings.Contains(r.(string), want) {
+				t.Errorf("%s: panic %v, want %q", what, r, want)
+			}
+		}()
+		fn()
+	}
+	expectPanic("Wide condition", "is 8 bits wide", func() {
+		m.Assert("wide", m.Input("data", 8), nil)
+	})
+	expectPanic("Duplicate name", "already has a property named always_ready", func() {
+		m.Cover("always_ready", m.Input("valid", 1), nil)
+	})
+	expectPanic("No clock", "has no clock", func() {
+		(&Module{Name: "NoClock"}).Assert("x", &Signal{Name: "x", Width: 1}, nil)
+	})
+}
+
+func TestPropertySampledValuesInVerilog(t *testing.T) {
+	m := &Module{Name: "PropTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	count := m.Reg("count", 8)
+	valid := m.Input("valid", 1)
+	cond := &Signal{Name: fmt.Sprintf("%s || %s != 8'hff || %s", Rose(valid).Name, Past(count, 2).Name, Stable(count).Name), Width: 1}
+	p := m.Assert("history", cond, sys)
+	got := p.Verilog()
+	for _, want := range []string{
+		"reg [0:0] assert_history_past0;\n  always @(posedge clk) assert_history_past0 <= valid;\n",
+		"reg [7:0] assert_history_past1_1;\n  always @(posedge clk) assert_history_past1_1 <= count;\n",
+		"  always @(posedge clk) assert_history_past1_2 <= assert_history_past1_1;\n",
+		"reg [7:0] assert_history_past2;\n  always @(posedge clk) assert_history_past2 <= count;\n",
+		"  always @(posedge clk) // assert_history\n    if (!(rst) && !((((valid && (!assert_history_past0)) || (assert_history_past1_2 != 8'hff)) || (count == assert_history_past2)))) $error(",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Verilog lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "$past") || strings.Contains(got, "$rose") || strings.Contains(got, "$stable") {
+		t.Errorf("Sampled-value functions should be lowered to registers:\n%s", got)
+	}
+
+	// Only the least significant bit of a wider signal rises or falls
+	c := m.Cover("count_fell", Fell(count), sys)
+	if got := c.Verilog(); !strings.Contains(got, "reg [0:0] cover_count_fell_past0;\n  always @(posedge clk) cover_count_fell_past0 <= count[0];") ||
+		!strings.Contains(got, "if (!(rst) && (((!count[0]) && cover_count_fell_past0))) $display(") {
+		t.Errorf("Cover Verilog = %q", got)
+	}
+}
+
+func TestFlattenProperties(t *testing.T) {
+	child := &Module{Name: "Child"}
+	cd := child.NewClockDomain("sys", child.Input("clk", 1), child.Input("rst", 1))
+	child.Assert("ok", child.Input("a", 1).Eq(child.Input("b", 1)), cd)
+	top := &Module{Name: "Top"}
+	top.InstanceOf(child, "u_child")
+
+	n, err := top.Flatten()
+	if err != nil {
+		t.Fatalf("Flatten: %v", err)
+	}
+	if len(n.Properties) != 1 {
+		t.Fatalf("Netlist has %d properties, want 1", len(n.Properties))
+	}
+	p := n.Properties[0]
+	if p.Name != "u_child.ok" || p.Clock != "u_child.clk" || p.Reset != "u_child.rst" || p.Cond.String() != "(u_child.a == u_child.b)" {
+		t.Errorf("Flattened property %s on %s reset by %s: %s", p.Name, p.Clock, p.Reset, p.Cond)
+	}
+}
@@ -0,0 +1,120 @@
+package hdl
+
+import (
+	"fmt"
+)
+
+// === RESET TREES ===
+
+// Reset synchronizer options
+type ResetConfig struct {
+	Stages  int // synchronizer flops, 2 when zero
+	Stretch int // cycles the reset stays asserted after the synchronizer releases it
+}
+
+// Build a reset synchronizer for the domain: the reset asserts
+// asynchronously and is released synchronously to the domain clock. The
+// synchronized reset replaces cd.Reset, so registers built for the domain
+// afterwards use it; the external reset is kept in cd.RawReset. Clock-enable
+// domains sharing the clock and reset follow along.
+func (cd *ClockDomain) SynchronizeReset(m *Module, cfg ResetConfig) *Signal {
+	return cd.synchronizeReset(m, cfg, nil)
+}
+
+// Synchronize the resets of several domains and release them in the given
+// order: each domain leaves reset only after the previous one has. With no
+// domains, every domain of the module with its own clock and a reset is
+// sequenced in declaration order.
+func (m *Module) ResetSequence(cfg ResetConfig, order ...*ClockDomain) {
+	if len(order) == 0 {
+		for _, cd := range m.ClockDomains {
+			if cd.Derivation != "enable" && cd.Reset != nil {
+				order = append(order, cd)
+			}
+		}
+	}
+	var prev *Signal
+	for _, cd := range order {
+		prev = cd.synchronizeReset(m, cfg, prev)
+	}
+}
+
+func (cd *ClockDomain) synchronizeReset(m *Module, cfg ResetConfig, after *Signal) *Signal {
+	if cd.Reset == nil {
+		panic(fmt.Sprintf("Clock domain %s has no reset to synchronize", cd.Name))
+	}
+	if cd.RawReset != nil {
+		panic(fmt.Sprintf("Reset of clock domain %s is already synchronized", cd.Name))
+	}
+	stages := cfg.Stages
+	if stages == 0 {
+		stages = 2
+	}
+	if stages < 2 {
+		panic(fmt.Sprintf("Reset synchronizer for %s needs at least 2 stages, got %d", cd.Name, stages))
+	}
+	name := cd.Name + "_rst"
+	raw := cd.Reset
+	
+	// Held in reset while the preceding domain is
+	in := raw
+	if after != nil {
+		in = m.Wire(name+"_in", 1)
+		m.Assign(in, raw.Or(after))
+	}
+	
+	syncStages := make([]*Signal, stages)
+	for i := range syncStages {
+		syncStages[i] = m.Reg(fmt.Sprintf("%s_stage%d", name, i), 1).WithClockDomain(cd)
+	}
+	m.Always = append(m.Always,
+		fmt.Sprintf("always @(posedge %s or posedge %s) begin", cd.Clock.Name, in.Name),
+		fmt.Sprintf("  if (%s) begin", in.Name))
+	for _, stage := range syncStages {
+		m.Always = append(m.Always, fmt.Sprintf("    %s <= 1'b1;", stage.Name))
+	}
+	m.Always = append(m.Always, "  end else begin")
+	for i, stage := range syncStages {
+		prev := "1'b0"
+		if i > 0 {
+			prev = syncStages[i-1].Name
+		}
+		m.Always = append(m.Always, fmt.Sprintf("    %s <= %s;", stage.Name, prev))
+	}
+	m.Always = append(m.Always, "  end", "end")
+	released := syncStages[stages-1]
+	
+	// Optional stretching keeps reset asserted for Stretch more cycles
+	if cfg.Stretch > 0 {
+		count := m.Reg(name+"_count", WidthOf(cfg.Stretch-1)).WithClockDomain(cd)
+		held := m.Reg(name+"_stretch", 1).WithClockDomain(cd)
+		m.Always = append(m.Always,
+			fmt.Sprintf("always @(posedge %s or posedge %s) begin", cd.Clock.Name, in.Name),
+			fmt.Sprintf("  if (%s || %s) begin", in.Name, released.Name),
+			fmt.Sprintf("    %s <= 0;", count.Name),
+			fmt.Sprintf("    %s <= 1'b1;", held.Name),
+			fmt.Sprintf("  end else if (%s == %s) begin", count.Name, Lit(cfg.Stretch-1, count.Width).Name),
+			fmt.Sprintf("    %s <= 1'b0;", held.Name),
+			"  end else begin",
+			fmt.Sprintf("    %s <= %s + %s;", count.Name, count.Name, Lit(1, count.Width).Name),
+			"  end",
+			"end")
+		released = held
+	}
+	
+	rst := m.Wire(name+"_sync", 1).WithClockDomain(cd)
+	m.Assign(rst, released)
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name: name, Kind: "reset", DestDomain: cd, Stages: syncStages, Output: rst,
+	})
+	
+	for _, other := range m.ClockDomains {
+		if other.Derivation == "enable" && other.Clock == cd.Clock && other.Reset == raw {
+			other.RawReset = raw
+			other.Reset = rst
+		}
+	}
+	cd.RawReset = raw
+	cd.Reset = rst
+	return rst
+}
@@ -0,0 +1,96 @@
+package hdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSynchronizeReset(t *testing.T) {
+	m := &Module{Name: "ResetTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	slow := m.EnableClockDomain("slow", sys, 4)
+	raw := sys.Reset
+	
+	rst := sys.SynchronizeReset(m, ResetConfig{Stages: 3})
+	
+	if sys.Reset != rst || sys.RawReset != raw || rst.Name != "sys_rst_sync" {
+		t.Errorf("Domain should switch to the synchronized reset and keep the raw one")
+	}
+	if slow.Reset != rst {
+		t.Errorf("Clock-enable domain should follow its parent's synchronized reset")
+	}
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"always @(posedge clk or posedge rst) begin",
+		"    sys_rst_stage2 <= 1'b1;",
+		"    sys_rst_stage0 <= 1'b0;",
+		"    sys_rst_stage2 <= sys_rst_stage1;",
+		"assign sys_rst_sync = sys_rst_stage2;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing reset synchronizer logic: %s", check)
+		}
+	}
+	
+	// Registers built afterwards use the synchronized reset
+	m.GrayCounterSynchronizer("cnt", m.Reg("cnt_src", 4).WithClockDomain(sys), slow)
+	if !strings.Contains(strings.Join(m.Always, "\n"), "if (sys_rst_sync) begin") {
+		t.Errorf("Domain logic should be reset by the synchronized reset")
+	}
+	
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Synchronizing a reset twice should panic")
+		}
+	}()
+	sys.SynchronizeReset(m, ResetConfig{})
+}
+
+func TestResetSequence(t *testing.T) {
+	m := &Module{Name: "ResetSequenceTest"}
+	a := m.NewClockDomain("a", m.Input("a_clk", 1), m.Input("a_rst", 1))
+	b := m.NewClockDomain("b", m.Input("b_clk", 1), m.Input("b_rst", 1))
+	
+	m.ResetSequence(ResetConfig{Stretch: 8}, b, a)
+	
+	logic := strings.Join(m.Assigns, "\n") + "\n" + strings.Join(m.Always, "\n")
+	checks := []string{
+		"assign a_rst_in = a_rst | b_rst_sync;",
+		"always @(posedge a_clk or posedge a_rst_in) begin",
+		"  if (b_rst || b_rst_stage1) begin",
+		"  end else if (b_rst_count == 3'h7) begin",
+		"assign b_rst_sync = b_rst_stretch;",
+	}
+	for _, check := range checks {
+		if !strings.Contains(logic, check) {
+			t.Errorf("Missing sequenced reset logic: %s", check)
+		}
+	}
+	
+	if violations, err := m.CheckCDC(); err != nil || len(violations) != 0 {
+		t.Errorf("Reset tree should pass CDC analysis: %v %v", violations, err)
+	}
+}
+
+func TestResetSequenceSkipsDomainsWithoutReset(t *testing.T) {
+	m := &Module{Name: "ResetSequenceDefault"}
+	a := m.NewClockDomain("a", m.Input("a_clk", 1), m.Input("a_rst", 1))
+	b := m.NewClockDomain("b", m.Input("b_clk", 1), nil)
+	m.ClockMux("mx", a, b, m.Input("sel", 1), nil)
+	c := m.NewClockDomain("c", m.Input("c_clk", 1), m.Input("c_rst", 1))
+	
+	m.ResetSequence(ResetConfig{})
+	
+	if a.RawReset == nil || c.RawReset == nil {
+		t.Fatalf("Domains with a reset should be synchronized")
+	}
+	logic := strings.Join(m.Assigns, "\n")
+	if !strings.Contains(logic, "assign c_rst_in = c_rst | a_rst_sync;") {
+		t.Errorf("c should be released after a:\n%s", logic)
+	}
+	if b.Reset != nil || strings.Contains(logic, "mx_rst") {
+		t.Errorf("Domains without a reset should be left alone:\n%s", logic)
+	}
+}
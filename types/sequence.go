@@ -0,0 +1,184 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Longest delay between the steps of a sequence
+const MaxDelay = 32
+
+// Conditions spread over clock cycles, as in an SVA sequence. Build one
+// with Seq and extend it with Then and Within:
+//
+//	Seq(req).Within(1, 4, gnt) // req ##[1:4] gnt
+type Sequence struct {
+	Steps []*SeqStep
+}
+
+// Condition of a sequence, Min to Max cycles after the previous step or,
+// for the first step, after the sequence starts
+type SeqStep struct {
+	Min  int
+	Max  int
+	Cond *Signal
+}
+
+// Temporal property checked on every cycle. Without an antecedent the
+// consequent must match starting on each cycle; with one, every match of
+// the antecedent starts the consequent on the cycle it ended (Overlap, |->)
+// or the cycle after (|=>).
+type Temporal struct {
+	Antecedent *Sequence
+	Consequent *Sequence
+	Overlap    bool
+}
+
+// Sequence starting with a condition
+func Seq(cond *Signal) *Sequence {
+	checkCondition(cond)
+	return &Sequence{Steps: []*SeqStep{{Cond: cond}}}
+}
+
+// Sequence starting with a condition min to max cycles after it starts
+// (##[min:max] cond), e.g. the consequent of "valid |-> ##[0:4] ready"
+func Delay(min, max int, cond *Signal) *Sequence {
+	checkDelay(min, max, cond)
+	return &Sequence{Steps: []*SeqStep{{Min: min, Max: max, Cond: cond}}}
+}
+
+// Extend the sequence with a condition exactly cycles later (##cycles)
+func (s *Sequence) Then(cycles int, cond *Signal) *Sequence {
+	return s.Within(cycles, cycles, cond)
+}
+
+// Extend the sequence with a condition min to max cycles later
+// (##[min:max])
+func (s *Sequence) Within(min, max int, cond *Signal) *Sequence {
+	checkDelay(min, max, cond)
+	steps := append(append([]*SeqStep{}, s.Steps...), &SeqStep{Min: min, Max: max, Cond: cond})
+	return &Sequence{Steps: steps}
+}
+
+// Whenever the sequence matches, the consequent must match starting on
+// the same cycle (|->)
+func (s *Sequence) Implies(consequent *Sequence) *Temporal {
+	return &Temporal{Antecedent: s, Consequent: consequent, Overlap: true}
+}
+
+// Whenever the sequence matches, the consequent must match starting on
+// the next cycle (|=>)
+func (s *Sequence) ImpliesNext(consequent *Sequence) *Temporal {
+	return &Temporal{Antecedent: s, Consequent: consequent}
+}
+
+// Property that the sequence matches starting on every cycle
+func (s *Sequence) Always() *Temporal {
+	return &Temporal{Consequent: s}
+}
+
+func checkDelay(min, max int, cond *Signal) {
+	checkCondition(cond)
+	if min < 0 || max < min {
+		panic(fmt.Sprintf("Bad delay range [%d:%d] before %s", min, max, cond.Name))
+	}
+	if max > MaxDelay {
+		panic(fmt.Sprintf("Delay of %d cycles before %s is too long, the limit is %d", max, cond.Name, MaxDelay))
+	}
+}
+
+func checkCondition(cond *Signal) {
+	if cond.Width != 1 {
+		panic(fmt.Sprintf("Sequence condition %s is %d bits wide, want 1", cond.Name, cond.Width))
+	}
+}
+
+func (s *Sequence) String() string {
+	var b strings.Builder
+	for i, step := range s.Steps {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch {
+		case i == 0 && step.Max == 0:
+		case step.Min == step.Max:
+			fmt.Fprintf(&b, "##%d ", step.Min)
+		default:
+			fmt.Fprintf(&b, "##[%d:%d] ", step.Min, step.Max)
+		}
+		b.WriteString(operand(step.Cond.Name))
+	}
+	return b.String()
+}
+
+func (t *Temporal) String() string {
+	if t.Antecedent == nil {
+		return t.Consequent.String()
+	}
+	op := "|=>"
+	if t.Overlap {
+		op = "|->"
+	}
+	return fmt.Sprintf("%s %s %s", t.Antecedent, op, t.Consequent)
+}
+
+// Parenthesize a condition unless it is a single operand
+func operand(expr string) string {
+	e, err := ParseExpr(expr)
+	if err == nil {
+		switch e.Kind {
+		case ExprIdent, ExprConst, ExprIndex, ExprSlice, ExprCall:
+			return expr
+		}
+	}
+	return "(" + expr + ")"
+}
+
+// Value of a signal the given number of cycles ago ($past)
+func Past(sig *Signal, cycles int) *Signal {
+	if cycles < 1 || cycles > 63 {
+		panic(fmt.Sprintf("Past of %s by %d cycles, want 1 to 63", sig.Name, cycles))
+	}
+	return &Signal{Name: fmt.Sprintf("$past(%s, %d)", sig.Name, cycles), Width: sig.Width, Kind: "wire"}
+}
+
+// Least significant bit went from 0 to 1 since the previous cycle ($rose)
+func Rose(sig *Signal) *Signal {
+	return &Signal{Name: fmt.Sprintf("$rose(%s)", sig.Name), Width: 1, Kind: "wire"}
+}
+
+// Least significant bit went from 1 to 0 since the previous cycle ($fell)
+func Fell(sig *Signal) *Signal {
+	return &Signal{Name: fmt.Sprintf("$fell(%s)", sig.Name), Width: 1, Kind: "wire"}
+}
+
+// Value unchanged since the previous cycle ($stable)
+func Stable(sig *Signal) *Signal {
+	return &Signal{Name: fmt.Sprintf("$stable(%s)", sig.Name), Width: 1, Kind: "wire"}
+}
+
+// Check a temporal property on every cycle of the domain
+func (m *Module) AssertProperty(name string, t *Temporal, domain *ClockDomain) *Property {
+	return m.addTemporal("assert", name, t, domain)
+}
+
+// Constrain the environment with a temporal property
+func (m *Module) AssumeProperty(name string, t *Temporal, domain *ClockDomain) *Property {
+	return m.addTemporal("assume", name, t, domain)
+}
+
+// Count the matches of a sequence
+func (m *Module) CoverSequence(name string, s *Sequence, domain *ClockDomain) *Property {
+	return m.addTemporal("cover", name, s.Always(), domain)
+}
+
+func (m *Module) addTemporal(kind, name string, t *Temporal, domain *ClockDomain) *Property {
+	p := m.addProperty(kind, name, &Signal{Name: t.String(), Width: 1}, domain)
+	p.Temporal = t
+	if _, file, line, ok := runtime.Caller(2); ok {
+		p.Location = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	return p
+}
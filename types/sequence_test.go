@@ -0,0 +1,72 @@
+package hdl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSequenceText(t *testing.T) {
+	m := &Module{Name: "SeqTest"}
+	sys := m.NewClockDomain("sys", m.Input("clk", 1), m.Input("rst", 1))
+	valid := m.Input("valid", 1)
+	ready := m.Input("ready", 1)
+	req := m.Input("req", 1)
+	gnt := m.Output("gnt", 1)
+	data := m.Input("data", 8)
+
+	checks := []struct {
+		temporal *Temporal
+		want     string
+	}{
+		{Seq(valid).Implies(Delay(0, 4, ready)), "valid |-> ##[0:4] ready"},
+		{Seq(Rose(req)).ImpliesNext(Seq(gnt)), "$rose(req) |=> gnt"},
+		{Seq(valid).Then(1, ready).Within(1, 3, &Signal{Name: "req && gnt", Width: 1}).Always(), "valid ##1 ready ##[1:3] (req && gnt)"},
+		{Seq(&Signal{Name: "valid && !ready", Width: 1}).ImpliesNext(Seq(Stable(data)).Then(2, Fell(valid))), "(valid && !ready) |=> $stable(data) ##2 $fell(valid)"},
+	}
+	for _, check := range checks {
+		if got := check.temporal.String(); got != check.want {
+			t.Errorf("Property text %q, want %q", got, check.want)
+		}
+	}
+
+	p := m.AssertProperty("handshake", checks[0].temporal, sys)
+	want := "assert_handshake: assert property (@(posedge clk) disable iff (rst) valid |-> ##[0:4] ready)"
+	if got := p.SVA(); !strings.HasPrefix(got, want) || !strings.Contains(got, "(sequence_test.go:") {
+		t.Errorf("SVA = %q, want prefix %q and the declaring line", got, want)
+	}
+	c := m.CoverSequence("req_gnt", Seq(req).Then(1, gnt), sys)
+	if got := c.SVA(); got != "cover_req_gnt: cover property (@(posedge clk) disable iff (rst) req ##1 gnt);" {
+		t.Errorf("Cover SVA = %q", got)
+	}
+	if past := Past(data, 2); past.Name != "$past(data, 2)" || past.Width != 8 {
+		t.Errorf("Past = %s, %d bits", past.Name, past.Width)
+	}
+
+	expectPanic := func(what, want string, fn func()) {
+		t.Helper()
+		defer func() {
+			r := recover()
+			if r == nil || !strings.Contains(r.(string), want) {
+				t.Errorf("%s: panic %v, want %q", what, r, want)
+			}
+		}()
+		fn()
+	}
+	expectPanic("Long delay", "the limit is 32", func() { Seq(req).Within(1, 40, gnt) })
+	expectPanic("Reversed range", "Bad delay range [3:1]", func() { Delay(3, 1, gnt) })
+	expectPanic("Wide condition", "is 8 bits wide", func() { Seq(data) })
+	expectPanic("Verilog style", "can only be emitted as SVA", func() { p.Verilog() })
+}
+
+func TestParseSystemFunctions(t *testing.T) {
+	e, err := ParseExpr("$past(a[3:0], 2) == b && $rose(c)")
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+	if got := e.String(); got != "(($past(a[3:0], 2) == b) && $rose(c))" {
+		t.Errorf("Parsed %s", got)
+	}
+	if _, err := ParseExpr("$past(a, )"); err == nil {
+		t.Errorf("A missing argument should be rejected")
+	}
+}
@@ -48,6 +48,27 @@ type ClockDomain struct {
 	Clock    *Signal
 	Reset    *Signal
 	Frequency int // in Hz, optional for documentation
+	
+	// Derived domains record how they relate to their source
+	Parent     *ClockDomain
+	Derivation string  // "divider", "enable", "generated", "gated" or "mux"
+	Multiply   int
+	Divide     int
+	Enable     *Signal // clock enable of an "enable" or "gated" domain
+	Sources    []*ClockDomain // selectable clocks of a "mux" domain
+	
+	RawReset   *Signal // external reset, once Reset has been synchronized
+}
+
+// Clock domain crossing built by one of the CDC helpers
+type Synchronizer struct {
+	Name       string
+	Kind       string    // "flop", "pulse", "gray", "handshake", "mux", "async_fifo", "reset"
+	SrcDomain  *ClockDomain // nil when the source signal has no domain
+	DestDomain *ClockDomain
+	Stages     []*Signal // synchronizer flop chain; the first stage samples the source
+	Captures   []*Signal // destination registers allowed to sample source-domain signals
+	Output     *Signal
 }
 
 // Hardware Mutex for resource arbitration
@@ -56,7 +77,11 @@ type Mutex struct {
 	Width    Width // Number of requesters
 	Requests []*Signal
 	Grants   []*Signal
-	Arbitration string // "round_robin", "priority", "fifo"
+	Arbitration string // "round_robin", "priority", "fifo", "weighted_round_robin", "matrix"
+	Hold     bool      // Owner keeps the grant while its request stays asserted
+	Locks    []*Signal // Optional per-requester lock inputs
+	Weights  []*Signal // Per-requester credit weights for "weighted_round_robin"
+	GrantIdx *Signal   // Binary index of the granted requester, if requested
 }
 
 // Generic/Polymorphic module template
@@ -64,6 +89,7 @@ type ModuleTemplate struct {
 	Name       string
 	TypeParams []string // Type parameter names
 	Params     map[string]interface{} // Parameter constraints
+	Defaults   map[string]interface{} // Values used when an optional type argument is omitted
 	Generator  func(params map[string]interface{}) *Module
 }
 
@@ -91,6 +117,7 @@ type ModuleInstance struct {
 	InstanceName string
 	Parameters   map[string]interface{}
 	Connections  map[string]*Signal
+	Module       *Module // Definition, when the instantiated module is built in Go
 }
 
 // Bundle represents a collection of related signals
@@ -134,6 +161,9 @@ type Module struct {
 	ClockDomains []*ClockDomain // Multiple clock domains
 	Mutexes    []*Mutex        // Hardware mutexes
 	Templates  []*ModuleTemplate // Polymorphic templates
+	Synchronizers []*Synchronizer // Clock domain crossings built by the CDC helpers
+	Properties []*Property // Assertions, assumptions and cover points
+	PropertyStyle string // "sva" (default) or "verilog" for $error checks without SVA
 }
 
 func (m *Module) Input(name string, width Width) *Signal {
@@ -662,12 +692,20 @@ func (m *Module) NewClockDomain(name string, clk *Signal, rst *Signal) *ClockDom
 	return cd
 }
 
-// Set frequency for documentation purposes
+// Set frequency, used for timing constraints
 func (cd *ClockDomain) SetFrequency(freq int) *ClockDomain {
 	cd.Frequency = freq
 	return cd
 }
 
+// Clock period in nanoseconds, 0 when the frequency is not set
+func (cd *ClockDomain) Period() float64 {
+	if cd.Frequency <= 0 {
+		return 0
+	}
+	return 1e9 / float64(cd.Frequency)
+}
+
 // Associate a signal with a clock domain
 func (s *Signal) WithClockDomain(cd *ClockDomain) *Signal {
 	s.ClockDomain = cd
@@ -698,11 +736,50 @@ func (m *Module) CDCSynchronizer(name string, srcSignal *Signal, destDomain *Clo
 		}
 	}
 	
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name:       name,
+		Kind:       "flop",
+		SrcDomain:  srcSignal.ClockDomain,
+		DestDomain: destDomain,
+		Stages:     syncStages,
+		Captures:   syncStages[:1],
+		Output:     syncStages[stages-1],
+	})
+	
 	return syncStages[stages-1]
 }
 
+// Optional features of an asynchronous FIFO
+type AsyncFIFOConfig struct {
+	AlmostFull  int // wr_almost_full asserts when the write-side level reaches this value (0 disables)
+	AlmostEmpty int // rd_almost_empty asserts when the read-side level drops to this value (0 disables)
+}
+
+// Port signals of a generated asynchronous FIFO
+type AsyncFIFOPorts struct {
+	Memory        *Memory
+	WrData        *Signal
+	WrEn          *Signal
+	WrFull        *Signal
+	WrAlmostFull  *Signal // nil unless AsyncFIFOConfig.AlmostFull is set
+	WrLevel       *Signal // fill level as seen from the write domain
+	RdData        *Signal
+	RdEn          *Signal
+	RdEmpty       *Signal
+	RdAlmostEmpty *Signal // nil unless AsyncFIFOConfig.AlmostEmpty is set
+	RdLevel       *Signal // fill level as seen from the read domain
+}
+
 // Asynchronous FIFO for CDC
 func (m *Module) AsyncFIFO(name string, width Width, depth int, wrDomain, rdDomain *ClockDomain) (*Signal, *Signal, *Signal, *Signal) {
+	ports := m.AsyncFIFOWithConfig(name, width, depth, wrDomain, rdDomain, AsyncFIFOConfig{})
+	return ports.WrData, ports.RdData, ports.WrFull, ports.RdEmpty
+}
+
+// Asynchronous FIFO with Gray-coded pointers, registered read data and
+// optional almost-full/almost-empty thresholds. The depth is rounded up
+// to a power of two so the Gray pointers wrap correctly.
+func (m *Module) AsyncFIFOWithConfig(name string, width Width, depth int, wrDomain, rdDomain *ClockDomain, cfg AsyncFIFOConfig) *AsyncFIFOPorts {
 	// Calculate address width
 	addrWidth := Width(0)
 	for d := depth - 1; d > 0; d >>= 1 {
@@ -711,37 +788,157 @@ func (m *Module) AsyncFIFO(name string, width Width, depth int, wrDomain, rdDoma
 	if addrWidth == 0 {
 		addrWidth = 1
 	}
+	ptrWidth := addrWidth + 1
 	
 	// Create FIFO memory
-	mem := m.SyncMem(name+"_mem", width, depth)
+	mem := m.SyncMem(name+"_mem", width, 1<<addrWidth)
 	
 	// Write domain signals
 	wrData := m.Input(name+"_wr_data", width).WithClockDomain(wrDomain)
 	wrEn := m.Input(name+"_wr_en", 1).WithClockDomain(wrDomain)
 	wrFull := m.Output(name+"_wr_full", 1).WithClockDomain(wrDomain)
+	wrLevel := m.Output(name+"_wr_level", ptrWidth).WithClockDomain(wrDomain)
 	
 	// Read domain signals
 	rdData := m.Output(name+"_rd_data", width).WithClockDomain(rdDomain)
 	rdEn := m.Input(name+"_rd_en", 1).WithClockDomain(rdDomain)
 	rdEmpty := m.Output(name+"_rd_empty", 1).WithClockDomain(rdDomain)
+	rdLevel := m.Output(name+"_rd_level", ptrWidth).WithClockDomain(rdDomain)
+	
+	// Binary and Gray code pointers for CDC
+	wrBin := m.Reg(name+"_wr_bin", ptrWidth).WithClockDomain(wrDomain)
+	wrPtr := m.Reg(name+"_wr_ptr", ptrWidth).WithClockDomain(wrDomain)
+	rdBin := m.Reg(name+"_rd_bin", ptrWidth).WithClockDomain(rdDomain)
+	rdPtr := m.Reg(name+"_rd_ptr", ptrWidth).WithClockDomain(rdDomain)
 	
-	// Gray code pointers for CDC
-	wrPtr := m.Reg(name+"_wr_ptr", addrWidth+1).WithClockDomain(wrDomain)
-	rdPtr := m.Reg(name+"_rd_ptr", addrWidth+1).WithClockDomain(rdDomain)
+	// Registered status flags and read data
+	wrFullReg := m.Reg(name+"_wr_full_r", 1).WithClockDomain(wrDomain)
+	rdEmptyReg := m.Reg(name+"_rd_empty_r", 1).WithClockDomain(rdDomain)
+	rdDataReg := m.Reg(name+"_rd_data_r", width).WithClockDomain(rdDomain)
 	
-	// Cross-domain synchronizers
+	// Cross-domain synchronizers (only Gray-coded pointers cross)
 	wrPtrSync := m.CDCSynchronizer(name+"_wr_ptr_sync", wrPtr, rdDomain, 2)
 	rdPtrSync := m.CDCSynchronizer(name+"_rd_ptr_sync", rdPtr, wrDomain, 2)
 	
-	// FIFO logic would be added here (simplified for brevity)
+	// Next-pointer logic
+	wrPush := m.Wire(name+"_wr_push", 1).WithClockDomain(wrDomain)
+	rdPop := m.Wire(name+"_rd_pop", 1).WithClockDomain(rdDomain)
+	wrBinNext := m.Wire(name+"_wr_bin_next", ptrWidth).WithClockDomain(wrDomain)
+	wrGrayNext := m.Wire(name+"_wr_gray_next", ptrWidth).WithClockDomain(wrDomain)
+	rdBinNext := m.Wire(name+"_rd_bin_next", ptrWidth).WithClockDomain(rdDomain)
+	rdGrayNext := m.Wire(name+"_rd_gray_next", ptrWidth).WithClockDomain(rdDomain)
+	
+	m.Assign(wrPush, wrEn.LogicAnd(wrFullReg.LogicNot()))
+	m.Assign(rdPop, rdEn.LogicAnd(rdEmptyReg.LogicNot()))
+	m.AssignExpr(wrBinNext, fmt.Sprintf("%s + {%d'b0, %s}", wrBin.Name, ptrWidth-1, wrPush.Name))
+	m.AssignExpr(wrGrayNext, binToGray(wrBinNext))
+	m.AssignExpr(rdBinNext, fmt.Sprintf("%s + {%d'b0, %s}", rdBin.Name, ptrWidth-1, rdPop.Name))
+	m.AssignExpr(rdGrayNext, binToGray(rdBinNext))
+	
+	// Full when the next write pointer equals the synchronized read pointer
+	// with its two MSBs inverted; empty when the pointers match exactly
+	var fullCompare string
+	if addrWidth == 1 {
+		fullCompare = fmt.Sprintf("~%s", rdPtrSync.Name)
+	} else {
+		fullCompare = fmt.Sprintf("{~%s, %s}", rdPtrSync.Bits(int(addrWidth), int(addrWidth)-1).Name,
+			rdPtrSync.Bits(int(addrWidth)-2, 0).Name)
+	}
+	
+	// Fill levels from the synchronized pointers converted back to binary
+	rdPtrSyncBin := m.Wire(name+"_rd_ptr_sync_bin", ptrWidth).WithClockDomain(wrDomain)
+	wrPtrSyncBin := m.Wire(name+"_wr_ptr_sync_bin", ptrWidth).WithClockDomain(rdDomain)
+	m.AssignExpr(rdPtrSyncBin, grayToBin(rdPtrSync))
+	m.AssignExpr(wrPtrSyncBin, grayToBin(wrPtrSync))
+	m.Assign(wrLevel, wrBin.Sub(rdPtrSyncBin))
+	m.Assign(rdLevel, wrPtrSyncBin.Sub(rdBin))
+	
+	m.Assign(wrFull, wrFullReg)
+	m.Assign(rdEmpty, rdEmptyReg)
+	m.Assign(rdData, rdDataReg)
+	
+	ports := &AsyncFIFOPorts{
+		Memory:  mem,
+		WrData:  wrData,
+		WrEn:    wrEn,
+		WrFull:  wrFull,
+		WrLevel: wrLevel,
+		RdData:  rdData,
+		RdEn:    rdEn,
+		RdEmpty: rdEmpty,
+		RdLevel: rdLevel,
+	}
+	
+	if cfg.AlmostFull > 0 {
+		ports.WrAlmostFull = m.Output(name+"_wr_almost_full", 1).WithClockDomain(wrDomain)
+		m.Assign(ports.WrAlmostFull, wrLevel.Gte(Lit(cfg.AlmostFull, ptrWidth)))
+	}
+	if cfg.AlmostEmpty > 0 {
+		ports.RdAlmostEmpty = m.Output(name+"_rd_almost_empty", 1).WithClockDomain(rdDomain)
+		m.Assign(ports.RdAlmostEmpty, rdLevel.Lte(Lit(cfg.AlmostEmpty, ptrWidth)))
+	}
+	
+	wrAddr := wrBin.Bits(int(addrWidth)-1, 0)
+	rdAddr := rdBin.Bits(int(addrWidth)-1, 0)
+	
 	m.Always = append(m.Always, fmt.Sprintf("// AsyncFIFO %s implementation", name))
-	m.Always = append(m.Always, fmt.Sprintf("// Memory: %s", mem.Name))
-	m.Always = append(m.Always, fmt.Sprintf("// Write enable: %s", wrEn.Name))
-	m.Always = append(m.Always, fmt.Sprintf("// Read enable: %s", rdEn.Name))
-	m.Always = append(m.Always, fmt.Sprintf("// Write pointer sync: %s", wrPtrSync.Name))
-	m.Always = append(m.Always, fmt.Sprintf("// Read pointer sync: %s", rdPtrSync.Name))
 	
-	return wrData, rdData, wrFull, rdEmpty
+	// Write domain: pointers, full flag and memory write
+	m.clockedBlock(wrDomain,
+		[]string{
+			fmt.Sprintf("%s <= 0;", wrBin.Name),
+			fmt.Sprintf("%s <= 0;", wrPtr.Name),
+			fmt.Sprintf("%s <= 0;", wrFullReg.Name),
+		},
+		[]string{
+			fmt.Sprintf("%s <= %s;", wrBin.Name, wrBinNext.Name),
+			fmt.Sprintf("%s <= %s;", wrPtr.Name, wrGrayNext.Name),
+			fmt.Sprintf("%s <= (%s == %s);", wrFullReg.Name, wrGrayNext.Name, fullCompare),
+		})
+	m.Always = append(m.Always, fmt.Sprintf("always @(posedge %s) %s", wrDomain.Clock.Name, mem.Write(wrAddr, wrData, wrPush)))
+	
+	// Read domain: pointers, empty flag and registered read data
+	m.clockedBlock(rdDomain,
+		[]string{
+			fmt.Sprintf("%s <= 0;", rdBin.Name),
+			fmt.Sprintf("%s <= 0;", rdPtr.Name),
+			fmt.Sprintf("%s <= 1;", rdEmptyReg.Name),
+			fmt.Sprintf("%s <= 0;", rdDataReg.Name),
+		},
+		[]string{
+			fmt.Sprintf("%s <= %s;", rdBin.Name, rdBinNext.Name),
+			fmt.Sprintf("%s <= %s;", rdPtr.Name, rdGrayNext.Name),
+			fmt.Sprintf("%s <= (%s == %s);", rdEmptyReg.Name, rdGrayNext.Name, wrPtrSync.Name),
+			fmt.Sprintf("if (%s) %s <= %s;", rdPop.Name, rdDataReg.Name, mem.Read(rdAddr).Name),
+		})
+	
+	// The read data register samples memory written in the write domain;
+	// the Gray pointers guarantee the entry is stable when it is read
+	m.Synchronizers = append(m.Synchronizers, &Synchronizer{
+		Name:       name,
+		Kind:       "async_fifo",
+		SrcDomain:  wrDomain,
+		DestDomain: rdDomain,
+		Captures:   []*Signal{rdDataReg},
+		Output:     rdData,
+	})
+	
+	return ports
+}
+
+// Binary to Gray code conversion expression
+func binToGray(bin *Signal) string {
+	return fmt.Sprintf("(%s >> 1) ^ %s", bin.Name, bin.Name)
+}
+
+// Gray to binary conversion expression: bit i is the XOR of all Gray bits at or above i
+func grayToBin(gray *Signal) string {
+	msb := int(gray.Width) - 1
+	bits := make([]string, 0, gray.Width)
+	for i := msb; i >= 0; i-- {
+		bits = append(bits, "^"+gray.Bits(msb, i).Name)
+	}
+	return "{" + strings.Join(bits, ", ") + "}"
 }
 
 // === MUTEX METHODS ===
@@ -770,35 +967,389 @@ func (m *Module) Mutex(name string, numRequesters int, arbitration string) *Mute
 	return mutex
 }
 
+// Keep the grant while the owner's request stays asserted
+func (mutex *Mutex) SetHold(hold bool) *Mutex {
+	mutex.Hold = hold
+	return mutex
+}
+
+// Create per-requester lock inputs; the owner keeps the grant while its
+// lock is asserted, even if its request drops
+func (mutex *Mutex) AddLocks(m *Module) []*Signal {
+	if mutex.Locks == nil {
+		for i := range mutex.Requests {
+			mutex.Locks = append(mutex.Locks, m.Input(fmt.Sprintf("%s_lock_%d", mutex.Name, i), 1))
+		}
+	}
+	return mutex.Locks
+}
+
+// Generate the arbiter selected by mutex.Arbitration. rst may be nil, in
+// which case the module reset (if any) is used for the arbiter state.
+func (mutex *Mutex) Generate(m *Module, clk *Signal, rst *Signal) {
+	if rst == nil {
+		rst = m.Reset
+	}
+	
+	switch mutex.Arbitration {
+	case "round_robin":
+		mutex.generateRoundRobin(m, clk, rst)
+	case "priority":
+		if mutex.Hold || mutex.Locks != nil {
+			mutex.generatePriorityRegistered(m, clk, rst)
+		} else {
+			mutex.GeneratePriority(m)
+		}
+	case "fifo":
+		mutex.generateFIFO(m, clk, rst)
+	case "weighted_round_robin":
+		mutex.generateWeightedRoundRobin(m, clk, rst)
+	case "matrix":
+		mutex.generateMatrix(m, clk, rst)
+	default:
+		panic(fmt.Sprintf("Unknown arbitration %q for mutex %s", mutex.Arbitration, mutex.Name))
+	}
+}
+
 // Round-robin arbitration
 func (mutex *Mutex) GenerateRoundRobin(m *Module, clk *Signal) {
+	mutex.generateRoundRobin(m, clk, m.Reset)
+}
+
+// Rotating-priority round robin: the counter points at the requester with
+// the highest priority and moves past each winner, so idle requesters are
+// skipped instead of stalling the others
+func (mutex *Mutex) generateRoundRobin(m *Module, clk *Signal, rst *Signal) {
 	if len(mutex.Requests) == 0 {
 		return
 	}
 	
-	// Create round-robin counter
-	counterWidth := WidthOf(len(mutex.Requests) - 1)
-	counter := m.Reg(mutex.Name+"_counter", counterWidth)
+	counter := m.Reg(mutex.Name+"_counter", WidthOf(len(mutex.Requests)-1))
+	next := mutex.rotatingGrant(m, mutex.requestVector(m), counter)
+	arb := mutex.generateGrantRegister(m, next)
 	
-	// Generate arbitration logic
-	m.Always = append(m.Always, fmt.Sprintf("always @(posedge %s) begin", clk.Name))
+	resets := []string{fmt.Sprintf("%s <= 0;", counter.Name)}
+	updates := mutex.counterUpdates(next, arb, counter)
+	mutex.emitArbiterBlock(m, clk, rst, next, arb, resets, updates)
+}
+
+// Next grant of a rotating-priority arbiter. Requests at or above the
+// counter take precedence; if there are none, wrap around to the
+// lowest-indexed request.
+func (mutex *Mutex) rotatingGrant(m *Module, reqVec *Signal, counter *Signal) *Signal {
+	n := len(mutex.Requests)
+	maskBits := make([]string, n)
+	for i := 0; i < n; i++ {
+		maskBits[n-1-i] = fmt.Sprintf("(%s <= %d)", counter.Name, i)
+	}
+	masked := m.Wire(mutex.Name+"_masked_req", Width(n))
+	m.AssignExpr(masked, fmt.Sprintf("%s & {%s}", reqVec.Name, strings.Join(maskBits, ", ")))
 	
-	for i, grant := range mutex.Grants {
-		condition := fmt.Sprintf("(%s == %d) && %s", counter.Name, i, mutex.Requests[i].Name)
-		m.Always = append(m.Always, fmt.Sprintf("  %s <= %s;", grant.Name, condition))
+	// x & (~x + 1) isolates the lowest set bit, so the grant is one-hot
+	next := m.Wire(mutex.Name+"_next_grant", Width(n))
+	m.AssignExpr(next, fmt.Sprintf("(%s != 0) ? (%s & (~%s + %s)) : (%s & (~%s + %s))",
+		masked.Name, masked.Name, masked.Name, Lit(1, Width(n)).Name,
+		reqVec.Name, reqVec.Name, Lit(1, Width(n)).Name))
+	return next
+}
+
+// Move the round-robin counter past each new winner
+func (mutex *Mutex) counterUpdates(next *Signal, arb *Signal, counter *Signal) []string {
+	n := len(mutex.Requests)
+	var updates []string
+	for i := 0; i < n; i++ {
+		updates = append(updates, fmt.Sprintf("if (%s && %s[%d]) %s <= %d;", arb.Name, next.Name, i, counter.Name, (i+1)%n))
+	}
+	return updates
+}
+
+// Create per-requester weight inputs for weighted round robin
+func (mutex *Mutex) AddWeights(m *Module, width Width) []*Signal {
+	if mutex.Weights == nil {
+		for i := range mutex.Requests {
+			mutex.Weights = append(mutex.Weights, m.Input(fmt.Sprintf("%s_weight_%d", mutex.Name, i), width))
+		}
+	}
+	return mutex.Weights
+}
+
+// Create an output carrying the binary index of the granted requester
+// (0 when nothing is granted)
+func (mutex *Mutex) AddGrantIndex(m *Module) *Signal {
+	if mutex.GrantIdx != nil {
+		return mutex.GrantIdx
+	}
+	n := len(mutex.Requests)
+	idxWidth := WidthOf(n - 1)
+	mutex.GrantIdx = m.Output(mutex.Name+"_grant_idx", idxWidth)
+	
+	// Grants are one-hot, so each index bit is the OR of the grants whose
+	// index has that bit set
+	bits := make([]string, idxWidth)
+	for b := 0; b < int(idxWidth); b++ {
+		var terms []string
+		for i := 0; i < n; i++ {
+			if i&(1<<b) != 0 {
+				terms = append(terms, mutex.Grants[i].Name)
+			}
+		}
+		if len(terms) == 0 {
+			bits[int(idxWidth)-1-b] = "1'b0"
+		} else {
+			bits[int(idxWidth)-1-b] = "(" + strings.Join(terms, " || ") + ")"
+		}
+	}
+	m.AssignExpr(mutex.GrantIdx, "{"+strings.Join(bits, ", ")+"}")
+	return mutex.GrantIdx
+}
+
+// Weighted round robin: a winner keeps the grant for up to weight cycles
+// while it keeps requesting, then the counter rotates past it. Requesters
+// with a zero weight are never granted. Weights default to 8-bit inputs
+// if AddWeights was not called.
+func (mutex *Mutex) generateWeightedRoundRobin(m *Module, clk *Signal, rst *Signal) {
+	if len(mutex.Requests) == 0 {
+		return
+	}
+	
+	n := len(mutex.Requests)
+	weights := mutex.AddWeights(m, 8)
+	weightWidth := weights[0].Width
+	
+	active := make([]*Signal, n)
+	for i := 0; i < n; i++ {
+		active[n-1-i] = &Signal{
+			Name:  fmt.Sprintf("(%s && (%s != 0))", mutex.Requests[i].Name, weights[i].Name),
+			Width: 1,
+			Kind:  "wire",
+		}
+	}
+	reqVec := m.Wire(mutex.Name+"_req_vec", Width(n))
+	m.Assign(reqVec, Cat(active...))
+	
+	counter := m.Reg(mutex.Name+"_counter", WidthOf(n-1))
+	credit := m.Reg(mutex.Name+"_credit", weightWidth)
+	next := mutex.rotatingGrant(m, reqVec, counter)
+	
+	grantReg := mutex.Name + "_grant_r"
+	arb := mutex.generateGrantRegister(m, next,
+		fmt.Sprintf("((%s & %s) != 0 && %s != 0)", grantReg, reqVec.Name, credit.Name))
+	
+	resets := []string{
+		fmt.Sprintf("%s <= 0;", counter.Name),
+		fmt.Sprintf("%s <= 0;", credit.Name),
+	}
+	updates := mutex.counterUpdates(next, arb, counter)
+	for i := 0; i < n; i++ {
+		updates = append(updates, fmt.Sprintf("if (%s && %s[%d]) %s <= %s - 1;", arb.Name, next.Name, i, credit.Name, weights[i].Name))
+	}
+	updates = append(updates, fmt.Sprintf("if (!%s && %s != 0) %s <= %s - 1;", arb.Name, credit.Name, credit.Name, credit.Name))
+	mutex.emitArbiterBlock(m, clk, rst, next, arb, resets, updates)
+	mutex.AddGrantIndex(m)
+}
+
+// Matrix arbitration: the least recently granted requester wins. A
+// priority matrix holds one bit per pair of requesters; the winner drops
+// below every other requester.
+func (mutex *Mutex) generateMatrix(m *Module, clk *Signal, rst *Signal) {
+	if len(mutex.Requests) == 0 {
+		return
+	}
+	
+	n := len(mutex.Requests)
+	
+	// prio(i, j) for i < j; prio(j, i) is its complement
+	prio := make(map[[2]int]*Signal)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			prio[[2]int{i, j}] = m.Reg(fmt.Sprintf("%s_prio_%d_%d", mutex.Name, i, j), 1)
+		}
+	}
+	
+	grantBits := make([]string, n)
+	for i := 0; i < n; i++ {
+		terms := []string{mutex.Requests[i].Name}
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			var wins string
+			if i < j {
+				wins = prio[[2]int{i, j}].Name
+			} else {
+				wins = "!" + prio[[2]int{j, i}].Name
+			}
+			terms = append(terms, fmt.Sprintf("(!%s || %s)", mutex.Requests[j].Name, wins))
+		}
+		grantBits[n-1-i] = "(" + strings.Join(terms, " && ") + ")"
+	}
+	next := m.Wire(mutex.Name+"_next_grant", Width(n))
+	m.AssignExpr(next, "{"+strings.Join(grantBits, ", ")+"}")
+	
+	arb := mutex.generateGrantRegister(m, next)
+	
+	// Lower indices start with higher priority
+	var resets, updates []string
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			reg := prio[[2]int{i, j}]
+			resets = append(resets, fmt.Sprintf("%s <= 1;", reg.Name))
+			updates = append(updates, fmt.Sprintf("if (%s && %s[%d]) %s <= 0;", arb.Name, next.Name, i, reg.Name))
+			updates = append(updates, fmt.Sprintf("if (%s && %s[%d]) %s <= 1;", arb.Name, next.Name, j, reg.Name))
+		}
+	}
+	mutex.emitArbiterBlock(m, clk, rst, next, arb, resets, updates)
+	mutex.AddGrantIndex(m)
+}
+
+// FIFO arbitration: requests are served in the order they arrived. An age
+// matrix records, for every pair of waiting requesters, which came first;
+// simultaneous arrivals are ordered by index.
+func (mutex *Mutex) generateFIFO(m *Module, clk *Signal, rst *Signal) {
+	if len(mutex.Requests) == 0 {
+		return
+	}
+	
+	n := len(mutex.Requests)
+	var waiting []*Signal
+	for i := 0; i < n; i++ {
+		waiting = append(waiting, m.Reg(fmt.Sprintf("%s_waiting_%d", mutex.Name, i), 1))
 	}
 	
-	// Update counter
-	anyGrant := strings.Join(func() []string {
-		var grants []string
-		for _, g := range mutex.Grants {
-			grants = append(grants, g.Name)
+	// older(i, j) for i < j; older(j, i) is its complement
+	older := make(map[[2]int]*Signal)
+	var resets, updates []string
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			reg := m.Reg(fmt.Sprintf("%s_older_%d_%d", mutex.Name, i, j), 1)
+			age := m.Wire(fmt.Sprintf("%s_age_%d_%d", mutex.Name, i, j), 1)
+			m.AssignExpr(age, fmt.Sprintf("!%s || (%s && %s)", waiting[j].Name, waiting[i].Name, reg.Name))
+			older[[2]int{i, j}] = age
+			resets = append(resets, fmt.Sprintf("%s <= 0;", reg.Name))
+			updates = append(updates, fmt.Sprintf("%s <= %s;", reg.Name, age.Name))
 		}
-		return grants
-	}(), " || ")
+	}
 	
-	m.Always = append(m.Always, fmt.Sprintf("  if (%s) %s <= (%s + 1) %% %d;", 
-		anyGrant, counter.Name, counter.Name, len(mutex.Requests)))
+	// A requester wins when it is older than every other active requester
+	grantBits := make([]string, n)
+	for i := 0; i < n; i++ {
+		terms := []string{mutex.Requests[i].Name}
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			var isOlder string
+			if i < j {
+				isOlder = older[[2]int{i, j}].Name
+			} else {
+				isOlder = "!" + older[[2]int{j, i}].Name
+			}
+			terms = append(terms, fmt.Sprintf("(!%s || %s)", mutex.Requests[j].Name, isOlder))
+		}
+		grantBits[n-1-i] = "(" + strings.Join(terms, " && ") + ")"
+	}
+	next := m.Wire(mutex.Name+"_next_grant", Width(n))
+	m.AssignExpr(next, "{"+strings.Join(grantBits, ", ")+"}")
+	
+	arb := mutex.generateGrantRegister(m, next)
+	
+	for i := 0; i < n; i++ {
+		resets = append(resets, fmt.Sprintf("%s <= 0;", waiting[i].Name))
+		updates = append(updates, fmt.Sprintf("%s <= %s && !(%s && %s[%d]);",
+			waiting[i].Name, mutex.Requests[i].Name, arb.Name, next.Name, i))
+	}
+	mutex.emitArbiterBlock(m, clk, rst, next, arb, resets, updates)
+}
+
+// Fixed priority with a registered grant, used when hold or lock is requested
+func (mutex *Mutex) generatePriorityRegistered(m *Module, clk *Signal, rst *Signal) {
+	if len(mutex.Requests) == 0 {
+		return
+	}
+	
+	n := len(mutex.Requests)
+	grantBits := make([]string, n)
+	for i := 0; i < n; i++ {
+		terms := []string{mutex.Requests[i].Name}
+		for j := i + 1; j < n; j++ {
+			terms = append(terms, "!"+mutex.Requests[j].Name)
+		}
+		grantBits[n-1-i] = "(" + strings.Join(terms, " && ") + ")"
+	}
+	next := m.Wire(mutex.Name+"_next_grant", Width(n))
+	m.AssignExpr(next, "{"+strings.Join(grantBits, ", ")+"}")
+	
+	arb := mutex.generateGrantRegister(m, next)
+	mutex.emitArbiterBlock(m, clk, rst, next, arb, nil, nil)
+}
+
+// Request vector with requester 0 in bit 0
+func (mutex *Mutex) requestVector(m *Module) *Signal {
+	n := len(mutex.Requests)
+	reqs := make([]*Signal, n)
+	for i, req := range mutex.Requests {
+		reqs[n-1-i] = req
+	}
+	reqVec := m.Wire(mutex.Name+"_req_vec", Width(n))
+	m.Assign(reqVec, Cat(reqs...))
+	return reqVec
+}
+
+// Create the grant register, drive the grant outputs from it and return a
+// signal that is high in cycles where a new grant may be issued. The
+// current owner blocks re-arbitration while it holds or locks the mutex,
+// or while any of the extra keep conditions is true.
+func (mutex *Mutex) generateGrantRegister(m *Module, next *Signal, extraKeep ...string) *Signal {
+	n := len(mutex.Requests)
+	grantReg := m.Reg(mutex.Name+"_grant_r", Width(n))
+	for i, grant := range mutex.Grants {
+		m.Assign(grant, grantReg.Bits(i, i))
+	}
+	
+	arb := m.Wire(mutex.Name+"_arb", 1)
+	var keep []string
+	for i := range mutex.Requests {
+		var terms []string
+		if mutex.Hold {
+			terms = append(terms, mutex.Requests[i].Name)
+		}
+		if mutex.Locks != nil {
+			terms = append(terms, mutex.Locks[i].Name)
+		}
+		if len(terms) > 0 {
+			keep = append(keep, fmt.Sprintf("(%s[%d] && (%s))", grantReg.Name, i, strings.Join(terms, " || ")))
+		}
+	}
+	keep = append(keep, extraKeep...)
+	if len(keep) > 0 {
+		m.AssignExpr(arb, fmt.Sprintf("!(%s)", strings.Join(keep, " || ")))
+	} else {
+		m.Assign(arb, Bool(true))
+	}
+	return arb
+}
+
+// Emit the clocked block that registers the grant and updates arbiter state
+func (mutex *Mutex) emitArbiterBlock(m *Module, clk *Signal, rst *Signal, next *Signal, arb *Signal, resets []string, updates []string) {
+	grantReg := mutex.Name + "_grant_r"
+	m.Always = append(m.Always, fmt.Sprintf("always @(posedge %s) begin", clk.Name))
+	indent := "  "
+	if rst != nil {
+		m.Always = append(m.Always, fmt.Sprintf("  if (%s) begin", rst.Name))
+		m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", grantReg))
+		for _, line := range resets {
+			m.Always = append(m.Always, "    "+line)
+		}
+		m.Always = append(m.Always, "  end else begin")
+		indent = "    "
+	}
+	m.Always = append(m.Always, fmt.Sprintf("%sif (%s) %s <= %s;", indent, arb.Name, grantReg, next.Name))
+	for _, line := range updates {
+		m.Always = append(m.Always, indent+line)
+	}
+	if rst != nil {
+		m.Always = append(m.Always, "  end")
+	}
 	m.Always = append(m.Always, "end")
 }
 
@@ -833,6 +1384,7 @@ func NewModuleTemplate(name string, typeParams []string) *ModuleTemplate {
 		Name:       name,
 		TypeParams: typeParams,
 		Params:     make(map[string]interface{}),
+		Defaults:   make(map[string]interface{}),
 	}
 }
 
@@ -848,11 +1400,29 @@ func (mt *ModuleTemplate) AddConstraint(param string, constraint interface{}) *M
 	return mt
 }
 
+// Make a type parameter optional by giving it a default value
+func (mt *ModuleTemplate) AddDefault(param string, value interface{}) *ModuleTemplate {
+	if mt.Defaults == nil {
+		mt.Defaults = make(map[string]interface{})
+	}
+	mt.Defaults[param] = value
+	return mt
+}
+
 // Instantiate a polymorphic module with specific type parameters
 func (m *Module) InstantiateTemplate(template *ModuleTemplate, instanceName string, typeArgs map[string]interface{}) *Module {
+	// Fill in defaults for omitted optional parameters
+	args := make(map[string]interface{}, len(typeArgs)+len(template.Defaults))
+	for param, value := range template.Defaults {
+		args[param] = value
+	}
+	for param, value := range typeArgs {
+		args[param] = value
+	}
+	
 	// Validate type arguments against constraints
 	for param, constraint := range template.Params {
-		if arg, exists := typeArgs[param]; exists {
+		if arg, exists := args[param]; exists {
 			// Simple type checking (can be extended for more complex constraints)
 			switch constraint.(type) {
 			case Width:
@@ -863,6 +1433,10 @@ func (m *Module) InstantiateTemplate(template *ModuleTemplate, instanceName stri
 				if _, ok := arg.(int); !ok {
 					panic(fmt.Sprintf("Type parameter %s must be int, got %T", param, arg))
 				}
+			case bool:
+				if _, ok := arg.(bool); !ok {
+					panic(fmt.Sprintf("Type parameter %s must be bool, got %T", param, arg))
+				}
 			}
 		} else {
 			panic(fmt.Sprintf("Missing type argument for parameter %s", param))
@@ -874,21 +1448,39 @@ func (m *Module) InstantiateTemplate(template *ModuleTemplate, instanceName stri
 		panic(fmt.Sprintf("No generator function set for template %s", template.Name))
 	}
 	
-	instance := template.Generator(typeArgs)
+	instance := template.Generator(args)
 	instance.Name = instanceName
 	
 	return instance
 }
 
 // Generic FIFO template
+//
+// Required type parameters are DATA_WIDTH and DEPTH. The optional ones are
+// ALMOST_FULL/ALMOST_EMPTY (count thresholds, 0 disables the flag), FWFT
+// (first-word-fall-through: rd_data shows the head word while !rd_empty),
+// OUTPUT_REG (an extra output register stage) and ERROR_FLAGS (overflow and
+// underflow pulses when a write hits a full FIFO or a read an empty one).
 func FIFOTemplate() *ModuleTemplate {
-	template := NewModuleTemplate("GenericFIFO", []string{"DATA_WIDTH", "DEPTH"})
+	template := NewModuleTemplate("GenericFIFO", []string{
+		"DATA_WIDTH", "DEPTH", "ALMOST_FULL", "ALMOST_EMPTY", "FWFT", "OUTPUT_REG", "ERROR_FLAGS",
+	})
 	template.AddConstraint("DATA_WIDTH", Width(0))
 	template.AddConstraint("DEPTH", int(0))
+	template.AddConstraint("ALMOST_FULL", int(0)).AddDefault("ALMOST_FULL", 0)
+	template.AddConstraint("ALMOST_EMPTY", int(0)).AddDefault("ALMOST_EMPTY", 0)
+	template.AddConstraint("FWFT", false).AddDefault("FWFT", false)
+	template.AddConstraint("OUTPUT_REG", false).AddDefault("OUTPUT_REG", false)
+	template.AddConstraint("ERROR_FLAGS", false).AddDefault("ERROR_FLAGS", false)
 	
 	template.SetGenerator(func(params map[string]interface{}) *Module {
 		dataWidth := params["DATA_WIDTH"].(Width)
 		depth := params["DEPTH"].(int)
+		almostFull := params["ALMOST_FULL"].(int)
+		almostEmpty := params["ALMOST_EMPTY"].(int)
+		fwft := params["FWFT"].(bool)
+		outputReg := params["OUTPUT_REG"].(bool)
+		errorFlags := params["ERROR_FLAGS"].(bool)
 		
 		m := &Module{
 			Name:       "GenericFIFO",
@@ -910,30 +1502,121 @@ func FIFOTemplate() *ModuleTemplate {
 		rdData := m.Output("rd_data", dataWidth)
 		rdEn := m.Input("rd_en", 1)
 		rdEmpty := m.Output("rd_empty", 1)
+		countWidth := WidthOf(depth)
+		count := m.Output("count", countWidth)
 		
 		// Add FIFO implementation
 		mem := m.SyncMem("fifo_mem", dataWidth, depth)
 		
-		// Use the signals in comments to avoid unused variable errors
-		m.Always = append(m.Always, fmt.Sprintf("// FIFO clock: %s, reset: %s", clk.Name, rst.Name))
-		m.Always = append(m.Always, fmt.Sprintf("// Write data: %s, enable: %s, full: %s", wrData.Name, wrEn.Name, wrFull.Name))
-		m.Always = append(m.Always, fmt.Sprintf("// Read data: %s, enable: %s, empty: %s", rdData.Name, rdEn.Name, rdEmpty.Name))
-		m.Always = append(m.Always, fmt.Sprintf("// Memory: %s", mem.Name))
-		
 		// Calculate address width
 		addrWidth := WidthOf(depth - 1)
 		wrPtr := m.Reg("wr_ptr", addrWidth)
 		rdPtr := m.Reg("rd_ptr", addrWidth)
 		
-		// FIFO logic (simplified)
+		// Words held in memory; with FWFT and OUTPUT_REG the head word moves
+		// into the output register, so the visible count includes it
+		memCount := m.Reg("mem_count", countWidth)
+		push := m.Wire("push", 1)
+		pop := m.Wire("pop", 1)
+		memRead := m.Wire("mem_rd", 1)
+		
+		m.Assign(push, wrEn.LogicAnd(wrFull.LogicNot()))
+		m.Assign(pop, rdEn.LogicAnd(rdEmpty.LogicNot()))
+		
+		prefetch := fwft && outputReg
+		var doutValid *Signal
+		if prefetch {
+			doutValid = m.Reg("dout_valid", 1)
+			m.AssignExpr(memRead, fmt.Sprintf("(%s != 0) && (!%s || %s)", memCount.Name, doutValid.Name, rdEn.Name))
+			if countWidth > 1 {
+				m.AssignExpr(count, fmt.Sprintf("%s + {%d'b0, %s}", memCount.Name, countWidth-1, doutValid.Name))
+			} else {
+				m.AssignExpr(count, fmt.Sprintf("%s + %s", memCount.Name, doutValid.Name))
+			}
+			m.Assign(rdEmpty, doutValid.LogicNot())
+		} else {
+			m.Assign(memRead, pop)
+			m.Assign(count, memCount)
+			m.Assign(rdEmpty, memCount.Eq(Lit(0, countWidth)))
+		}
+		m.Assign(wrFull, count.Eq(Lit(depth, countWidth)))
+		
+		if almostFull > 0 {
+			m.Assign(m.Output("almost_full", 1), count.Gte(Lit(almostFull, countWidth)))
+			m.SetParameter("ALMOST_FULL", almostFull)
+		}
+		if almostEmpty > 0 {
+			m.Assign(m.Output("almost_empty", 1), count.Lte(Lit(almostEmpty, countWidth)))
+			m.SetParameter("ALMOST_EMPTY", almostEmpty)
+		}
+		
+		// Read data path
+		var dataRegs []*Signal
+		switch {
+		case prefetch:
+			dout := m.Reg("dout", dataWidth)
+			dataRegs = append(dataRegs, dout)
+			m.Assign(rdData, dout)
+		case fwft:
+			m.Assign(rdData, mem.Read(rdPtr))
+		case outputReg:
+			dout := m.Reg("dout", dataWidth)
+			doutQ := m.Reg("dout_q", dataWidth)
+			dataRegs = append(dataRegs, dout, doutQ)
+			m.Assign(rdData, doutQ)
+		default:
+			dout := m.Reg("dout", dataWidth)
+			dataRegs = append(dataRegs, dout)
+			m.Assign(rdData, dout)
+		}
+		
+		var overflow, underflow *Signal
+		if errorFlags {
+			overflowOut := m.Output("overflow", 1)
+			underflowOut := m.Output("underflow", 1)
+			overflow = m.Reg("overflow_r", 1)
+			underflow = m.Reg("underflow_r", 1)
+			m.Assign(overflowOut, overflow)
+			m.Assign(underflowOut, underflow)
+		}
+		
+		// Pointers and occupancy
 		m.Always = append(m.Always, fmt.Sprintf("always @(posedge %s) begin", clk.Name))
 		m.Always = append(m.Always, fmt.Sprintf("  if (%s) begin", rst.Name))
 		m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", wrPtr.Name))
 		m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", rdPtr.Name))
+		m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", memCount.Name))
+		for _, reg := range dataRegs {
+			m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", reg.Name))
+		}
+		if prefetch {
+			m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", doutValid.Name))
+		}
+		if errorFlags {
+			m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", overflow.Name))
+			m.Always = append(m.Always, fmt.Sprintf("    %s <= 0;", underflow.Name))
+		}
 		m.Always = append(m.Always, "  end else begin")
-		m.Always = append(m.Always, fmt.Sprintf("    if (%s && !%s) %s <= %s + 1;", wrEn.Name, wrFull.Name, wrPtr.Name, wrPtr.Name))
-		m.Always = append(m.Always, fmt.Sprintf("    if (%s && !%s) %s <= %s + 1;", rdEn.Name, rdEmpty.Name, rdPtr.Name, rdPtr.Name))
+		m.Always = append(m.Always, fmt.Sprintf("    if (%s) %s <= %s;", push.Name, wrPtr.Name, fifoPtrNext(wrPtr, depth)))
+		m.Always = append(m.Always, fmt.Sprintf("    if (%s) %s <= %s;", memRead.Name, rdPtr.Name, fifoPtrNext(rdPtr, depth)))
+		m.Always = append(m.Always, fmt.Sprintf("    if (%s && !%s) %s <= %s + 1;", push.Name, memRead.Name, memCount.Name, memCount.Name))
+		m.Always = append(m.Always, fmt.Sprintf("    else if (!%s && %s) %s <= %s - 1;", push.Name, memRead.Name, memCount.Name, memCount.Name))
+		if prefetch {
+			m.Always = append(m.Always, fmt.Sprintf("    if (%s) %s <= %s;", memRead.Name, dataRegs[0].Name, mem.Read(rdPtr).Name))
+			m.Always = append(m.Always, fmt.Sprintf("    if (%s) %s <= 1;", memRead.Name, doutValid.Name))
+			m.Always = append(m.Always, fmt.Sprintf("    else if (%s) %s <= 0;", rdEn.Name, doutValid.Name))
+		} else if !fwft {
+			m.Always = append(m.Always, fmt.Sprintf("    if (%s) %s <= %s;", memRead.Name, dataRegs[0].Name, mem.Read(rdPtr).Name))
+			if outputReg {
+				m.Always = append(m.Always, fmt.Sprintf("    %s <= %s;", dataRegs[1].Name, dataRegs[0].Name))
+			}
+		}
+		if errorFlags {
+			m.Always = append(m.Always, fmt.Sprintf("    %s <= %s && %s;", overflow.Name, wrEn.Name, wrFull.Name))
+			m.Always = append(m.Always, fmt.Sprintf("    %s <= %s && %s;", underflow.Name, rdEn.Name, rdEmpty.Name))
+		}
 		m.Always = append(m.Always, "  end")
+		m.Always = append(m.Always, "  "+mem.Write(wrPtr, wrData, push))
 		m.Always = append(m.Always, "end")
 		
 		// Set parameters for Verilog generation
@@ -946,6 +1629,14 @@ func FIFOTemplate() *ModuleTemplate {
 	return template
 }
 
+// Next value of a FIFO pointer, wrapping at depth
+func fifoPtrNext(ptr *Signal, depth int) string {
+	if depth == 1<<ptr.Width {
+		return fmt.Sprintf("%s + 1", ptr.Name)
+	}
+	return fmt.Sprintf("(%s == %d) ? 0 : %s + 1", ptr.Name, depth-1, ptr.Name)
+}
+
 // Generic register file template
 func RegisterFileTemplate() *ModuleTemplate {
 	template := NewModuleTemplate("GenericRegisterFile", []string{"DATA_WIDTH", "ADDR_WIDTH"})
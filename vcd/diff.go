@@ -0,0 +1,196 @@
+package vcd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How two dumps are compared
+type DiffOptions struct {
+	// Scopes the signal names are relative to in each dump, e.g. "Adder"
+	// for a simulator dump and "testbench.dut" for an Icarus run. Empty
+	// means the single top-level scope.
+	RootA, RootB string
+
+	// Signals to compare, relative to the roots. Empty compares every
+	// signal found in both dumps.
+	Signals []string
+
+	// Changes may land up to this many picoseconds apart and still match
+	Tolerance uint64
+
+	// 1-bit signal of dump A, relative to RootA, whose rising edges number
+	// the cycles in the report
+	Clock string
+}
+
+// First point where a signal differs between two dumps
+type Mismatch struct {
+	Signal string
+	Time   uint64 // picoseconds
+	Cycle  int    // rising clock edges before Time, -1 without a clock
+	A, B   Value
+}
+
+func (m *Mismatch) String() string {
+	at := fmt.Sprintf("%d ps", m.Time)
+	if m.Cycle >= 0 {
+		at = fmt.Sprintf("cycle %d (%d ps)", m.Cycle, m.Time)
+	}
+	return fmt.Sprintf("%s: %s = %s in A, %s in B", at, m.Signal, m.A, m.B)
+}
+
+// Compare two dumps signal by signal and report the first divergence of
+// each signal, earliest first. Values are compared as sequences of
+// changes, so a change that moves by at most Tolerance still matches.
+// Changes after the end of the shorter dump are ignored.
+func Diff(a, b *File, opts DiffOptions) ([]*Mismatch, error) {
+	rootA, err := a.root(opts.RootA)
+	if err != nil {
+		return nil, err
+	}
+	rootB, err := b.root(opts.RootB)
+	if err != nil {
+		return nil, err
+	}
+	names := opts.Signals
+	if len(names) == 0 {
+		for _, v := range a.Vars {
+			if name, ok := relative(v.Name, rootA); ok {
+				if _, ok := b.byName[join(rootB, name)]; ok {
+					names = append(names, name)
+				}
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("vcd: the dumps have no signals in common under %q and %q", rootA, rootB)
+		}
+	}
+
+	var rises []uint64
+	if opts.Clock != "" {
+		clk, ok := a.byName[join(rootA, opts.Clock)]
+		if !ok {
+			return nil, fmt.Errorf("vcd: no clock %s in A", opts.Clock)
+		}
+		rises = clk.Rises()
+	}
+
+	end := a.End
+	if b.End < end {
+		end = b.End
+	}
+	var mismatches []*Mismatch
+	for _, name := range names {
+		va, ok := a.byName[join(rootA, name)]
+		if !ok {
+			return nil, fmt.Errorf("vcd: no signal %s in A", name)
+		}
+		vb, ok := b.byName[join(rootB, name)]
+		if !ok {
+			return nil, fmt.Errorf("vcd: no signal %s in B", name)
+		}
+		t, diverged := firstDivergence(va, vb, end, opts.Tolerance)
+		if !diverged {
+			continue
+		}
+		m := &Mismatch{Signal: name, Time: t, Cycle: -1, A: va.At(t), B: vb.At(t)}
+		if rises != nil {
+			m.Cycle = sort.Search(len(rises), func(i int) bool { return rises[i] >= t })
+		}
+		mismatches = append(mismatches, m)
+	}
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		return mismatches[i].Time < mismatches[j].Time
+	})
+	return mismatches, nil
+}
+
+// The root scope to use, defaulting to the only top-level scope
+func (f *File) root(root string) (string, error) {
+	if root != "" {
+		return root, nil
+	}
+	tops := map[string]bool{}
+	for _, v := range f.Vars {
+		tops[strings.SplitN(v.Scope, ".", 2)[0]] = true
+	}
+	if len(tops) != 1 {
+		return "", fmt.Errorf("vcd: dump has %d top-level scopes, set the root explicitly", len(tops))
+	}
+	for top := range tops {
+		return top, nil
+	}
+	return "", nil
+}
+
+func relative(name, root string) (string, bool) {
+	if root == "" {
+		return name, true
+	}
+	if strings.HasPrefix(name, root+".") {
+		return name[len(root)+1:], true
+	}
+	return "", false
+}
+
+func join(root, name string) string {
+	if root == "" {
+		return name
+	}
+	return root + "." + name
+}
+
+// Change history without repeated values, up to end
+type history []Change
+
+func changes(v *Var, width int, end uint64) history {
+	var h history
+	for _, c := range v.Changes {
+		if c.Time > end {
+			break
+		}
+		val := c.Value
+		if !strings.HasPrefix(string(val), "r") {
+			val = extend(string(val), width)
+		}
+		if len(h) > 0 && h[len(h)-1].Value == val {
+			continue
+		}
+		h = append(h, Change{c.Time, val})
+	}
+	return h
+}
+
+// Time of the first change that has no counterpart within tolerance
+func firstDivergence(a, b *Var, end, tolerance uint64) (uint64, bool) {
+	width := a.Width
+	if b.Width > width {
+		width = b.Width
+	}
+	ha, hb := changes(a, width, end), changes(b, width, end)
+	for i := 0; i < len(ha) || i < len(hb); i++ {
+		switch {
+		case i >= len(ha):
+			// A change near the end of A may have been cut off
+			if end-hb[i].Time > tolerance {
+				return hb[i].Time, true
+			}
+			return 0, false
+		case i >= len(hb):
+			if end-ha[i].Time > tolerance {
+				return ha[i].Time, true
+			}
+			return 0, false
+		}
+		ca, cb := ha[i], hb[i]
+		if ca.Value != cb.Value {
+			return min(ca.Time, cb.Time), true
+		}
+		if ca.Time > cb.Time+tolerance || cb.Time > ca.Time+tolerance {
+			return min(ca.Time, cb.Time), true
+		}
+	}
+	return 0, false
+}
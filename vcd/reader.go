@@ -0,0 +1,377 @@
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parsed VCD file. Times are in picoseconds whatever the file's timescale.
+type File struct {
+	Date      string
+	Version   string
+	Timescale uint64 // picoseconds per time unit
+	Vars      []*Var
+	End       uint64 // last time stamp
+
+	byName map[string]*Var
+}
+
+// Dumped signal and its value changes
+type Var struct {
+	Name    string // full scope path, e.g. "testbench.dut.sum"
+	Scope   string // "testbench.dut"
+	Kind    string // "wire", "reg", ...
+	Width   int
+	Code    string
+	Changes []Change // in time order
+}
+
+// Value of a signal from a point in time
+type Change struct {
+	Time  uint64
+	Value Value
+}
+
+// Bit string, most significant bit first and Width characters long, made
+// of 0, 1, x and z. Real variables keep their text with an "r" prefix.
+type Value string
+
+// Numeric value, false if any bit is x or z
+func (v Value) Uint64() (uint64, bool) {
+	if strings.HasPrefix(string(v), "r") || strings.ContainsAny(string(v), "xXzZ") {
+		return 0, false
+	}
+	if len(v) > 64 {
+		v = v[len(v)-64:]
+	}
+	n, err := strconv.ParseUint(string(v), 2, 64)
+	return n, err == nil
+}
+
+// Whether every bit is 0 or 1
+func (v Value) Known() bool {
+	_, ok := v.Uint64()
+	return ok
+}
+
+func (v Value) String() string {
+	if n, ok := v.Uint64(); ok {
+		return fmt.Sprintf("%#x", n)
+	}
+	return string(v)
+}
+
+// Read a VCD file
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return file, nil
+}
+
+// Parse a VCD stream
+func Read(r io.Reader) (*File, error) {
+	p := &parser{
+		file:  &File{Timescale: 1, byName: map[string]*Var{}},
+		codes: map[string][]*Var{},
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		p.words = append(p.words, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+type parser struct {
+	file   *File
+	words  []string
+	pos    int
+	scopes []string
+	codes  map[string][]*Var
+	time   uint64
+}
+
+func (p *parser) next() (string, bool) {
+	if p.pos >= len(p.words) {
+		return "", false
+	}
+	w := p.words[p.pos]
+	p.pos++
+	return w, true
+}
+
+// Words up to the next $end
+func (p *parser) section(keyword string) ([]string, error) {
+	var words []string
+	for {
+		w, ok := p.next()
+		if !ok {
+			return nil, fmt.Errorf("vcd: %s without $end", keyword)
+		}
+		if w == "$end" {
+			return words, nil
+		}
+		words = append(words, w)
+	}
+}
+
+func (p *parser) parse() error {
+	for {
+		w, ok := p.next()
+		if !ok {
+			break
+		}
+		switch {
+		case w == "$date" || w == "$version" || w == "$comment":
+			words, err := p.section(w)
+			if err != nil {
+				return err
+			}
+			if w == "$date" {
+				p.file.Date = strings.Join(words, " ")
+			} else if w == "$version" {
+				p.file.Version = strings.Join(words, " ")
+			}
+		case w == "$timescale":
+			words, err := p.section(w)
+			if err != nil {
+				return err
+			}
+			if p.file.Timescale, err = timescale(strings.Join(words, "")); err != nil {
+				return err
+			}
+		case w == "$scope":
+			words, err := p.section(w)
+			if err != nil {
+				return err
+			}
+			if len(words) != 2 {
+				return fmt.Errorf("vcd: malformed $scope %v", words)
+			}
+			p.scopes = append(p.scopes, words[1])
+		case w == "$upscope":
+			if _, err := p.section(w); err != nil {
+				return err
+			}
+			if len(p.scopes) == 0 {
+				return fmt.Errorf("vcd: $upscope outside any scope")
+			}
+			p.scopes = p.scopes[:len(p.scopes)-1]
+		case w == "$var":
+			words, err := p.section(w)
+			if err != nil {
+				return err
+			}
+			if err := p.variable(words); err != nil {
+				return err
+			}
+		case w == "$enddefinitions":
+			if _, err := p.section(w); err != nil {
+				return err
+			}
+		// Value sections just group changes
+		case w == "$dumpvars" || w == "$dumpall" || w == "$dumpon" || w == "$dumpoff" || w == "$end":
+		case strings.HasPrefix(w, "#"):
+			t, err := strconv.ParseUint(w[1:], 10, 64)
+			if err != nil {
+				return fmt.Errorf("vcd: bad time stamp %s", w)
+			}
+			p.time = t * p.file.Timescale
+			if p.time > p.file.End {
+				p.file.End = p.time
+			}
+		case strings.HasPrefix(w, "$"):
+			// Unknown keyword sections are skipped
+			if _, err := p.section(w); err != nil {
+				return err
+			}
+		default:
+			if err := p.change(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Picoseconds per unit for a timescale like "1ps" or "10ns"
+func timescale(text string) (uint64, error) {
+	i := 0
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	n, err := strconv.ParseUint(text[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("vcd: bad timescale %s", text)
+	}
+	units := map[string]uint64{"ps": 1, "ns": 1000, "us": 1000000, "ms": 1000000000, "s": 1000000000000}
+	unit, ok := units[text[i:]]
+	if !ok {
+		return 0, fmt.Errorf("vcd: unsupported timescale %s", text)
+	}
+	return n * unit, nil
+}
+
+// $var kind width code reference [range]
+func (p *parser) variable(words []string) error {
+	if len(words) < 4 {
+		return fmt.Errorf("vcd: malformed $var %v", words)
+	}
+	width, err := strconv.Atoi(words[1])
+	if err != nil || width < 1 {
+		return fmt.Errorf("vcd: bad width in $var %v", words)
+	}
+	ref := words[3]
+	if i := strings.Index(ref, "["); i > 0 && len(words) == 4 {
+		ref = ref[:i]
+	}
+	scope := strings.Join(p.scopes, ".")
+	v := &Var{
+		Name:  scope + "." + ref,
+		Scope: scope,
+		Kind:  words[0],
+		Width: width,
+		Code:  words[2],
+	}
+	if scope == "" {
+		v.Name = ref
+	}
+	p.file.Vars = append(p.file.Vars, v)
+	p.file.byName[v.Name] = v
+	p.codes[v.Code] = append(p.codes[v.Code], v)
+	return nil
+}
+
+func (p *parser) change(w string) error {
+	var value, code string
+	switch w[0] {
+	case 'b', 'B', 'r', 'R':
+		c, ok := p.next()
+		if !ok {
+			return fmt.Errorf("vcd: value %s without identifier", w)
+		}
+		value, code = strings.ToLower(w[1:]), c
+		if w[0] == 'r' || w[0] == 'R' {
+			value = "r" + w[1:]
+		}
+	case '0', '1', 'x', 'X', 'z', 'Z':
+		value, code = strings.ToLower(w[:1]), w[1:]
+	default:
+		return fmt.Errorf("vcd: unexpected %s", w)
+	}
+	vars, ok := p.codes[code]
+	if !ok {
+		return fmt.Errorf("vcd: change for undeclared identifier %s", code)
+	}
+	for _, v := range vars {
+		val := Value(value)
+		if !strings.HasPrefix(value, "r") {
+			val = extend(value, v.Width)
+		}
+		n := len(v.Changes)
+		if n > 0 && v.Changes[n-1].Time == p.time {
+			v.Changes[n-1].Value = val
+			continue
+		}
+		v.Changes = append(v.Changes, Change{p.time, val})
+	}
+	return nil
+}
+
+// Extend a bit string to width the way VCD does: x and z fill from the
+// left, anything else zero-extends
+func extend(bits string, width int) Value {
+	if len(bits) >= width {
+		return Value(bits[len(bits)-width:])
+	}
+	fill := "0"
+	if bits[0] == 'x' || bits[0] == 'z' {
+		fill = bits[:1]
+	}
+	return Value(strings.Repeat(fill, width-len(bits)) + bits)
+}
+
+// Full names of all variables in declaration order
+func (f *File) Signals() []string {
+	names := make([]string, len(f.Vars))
+	for i, v := range f.Vars {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// Find a variable by full name, or by a name relative to some scope when
+// that is unambiguous ("dut.sum" finds "testbench.dut.sum")
+func (f *File) Lookup(name string) (*Var, error) {
+	if v, ok := f.byName[name]; ok {
+		return v, nil
+	}
+	var found []*Var
+	for _, v := range f.Vars {
+		if strings.HasSuffix(v.Name, "."+name) {
+			found = append(found, v)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("vcd: no signal %s", name)
+	case 1:
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, v := range found {
+		names[i] = v.Name
+	}
+	return nil, fmt.Errorf("vcd: %s is ambiguous: %s", name, strings.Join(names, ", "))
+}
+
+// Value of a signal at a time, panicking if it does not exist. Signals
+// read as all x before their first change.
+func (f *File) Value(name string, t uint64) Value {
+	v, err := f.Lookup(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return v.At(t)
+}
+
+// Value at a time
+func (v *Var) At(t uint64) Value {
+	i := sort.Search(len(v.Changes), func(i int) bool { return v.Changes[i].Time > t })
+	if i == 0 {
+		return Value(strings.Repeat("x", v.Width))
+	}
+	return v.Changes[i-1].Value
+}
+
+// Times of the rising edges of a 1-bit signal
+func (v *Var) Rises() []uint64 {
+	var times []uint64
+	last := Value("x")
+	for _, c := range v.Changes {
+		if c.Value == "1" && last == "0" {
+			times = append(times, c.Time)
+		}
+		last = c.Value
+	}
+	return times
+}
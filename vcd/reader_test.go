@@ -0,0 +1,201 @@
+package vcd
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func TestReadIcarusDump(t *testing.T) {
+	f, err := Open("../dump.vcd")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if f.Version != "Icarus Verilog" || f.Timescale != 1 || f.End != 20000 {
+		t.Errorf("Header: version %q, timescale %d, end %d", f.Version, f.Timescale, f.End)
+	}
+	if len(f.Vars) != 6 {
+		t.Fatalf("Expected 6 variables, got %v", f.Signals())
+	}
+	sum, err := f.Lookup("dut.sum")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if sum.Name != "testbench.dut.sum" || sum.Width != 8 || sum.Kind != "wire" {
+		t.Errorf("Unexpected variable %+v", sum)
+	}
+	expect := []struct {
+		name string
+		time uint64
+		want uint64
+	}{
+		{"testbench.sum", 0, 30},
+		{"testbench.sum", 9999, 30},
+		{"testbench.sum", 10000, 127},
+		{"dut.b", 15000, 27},
+		{"testbench.a", 20000, 100},
+	}
+	for _, e := range expect {
+		got, ok := f.Value(e.name, e.time).Uint64()
+		if !ok || got != e.want {
+			t.Errorf("%s at %d ps = %s, want %d", e.name, e.time, f.Value(e.name, e.time), e.want)
+		}
+	}
+	if got := sum.At(0); got != "00011110" {
+		t.Errorf("Values should be full-width bit strings, got %q", got)
+	}
+	if _, err := f.Lookup("sum"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Lookup of sum should be ambiguous, got %v", err)
+	}
+}
+
+func TestReadFourStateAndTimescale(t *testing.T) {
+	dump := `$timescale 10 ns $end
+$scope module top $end
+$var wire 4 ! bus $end
+$var wire 1 " clk $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+bx !
+z"
+$end
+#1
+b1 !
+0"
+#2
+bz0 !
+1"
+`
+	f, err := Read(strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	bus := f.Value("bus", 0)
+	if bus != "xxxx" || bus.Known() {
+		t.Errorf("bus at 0 = %q, want xxxx", bus)
+	}
+	if got := f.Value("top.bus", 10000); got != "0001" {
+		t.Errorf("bus at 10 ns = %q, want 0001", got)
+	}
+	if got := f.Value("bus", 20000); got != "zzz0" {
+		t.Errorf("bus at 20 ns = %q, want zzz0", got)
+	}
+	clk, _ := f.Lookup("clk")
+	if rises := clk.Rises(); len(rises) != 1 || rises[0] != 20000 {
+		t.Errorf("clk rises at %v, want [20000]", rises)
+	}
+
+	if _, err := Read(strings.NewReader("#0\n1?\n")); err == nil {
+		t.Errorf("A change for an undeclared identifier should fail")
+	}
+}
+
+func newAdder(expr string) *hdl.Module {
+	m := core.NewModule("Adder")
+	m.Input("a", 8)
+	m.Input("b", 8)
+	m.AssignExpr(m.Output("sum", 8), expr)
+	return m
+}
+
+// Rerun testbench.v in the simulator and dump it
+func adderDump(t *testing.T, m *hdl.Module) *File {
+	s := newSim(t, m)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, s, Options{})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	s.Poke("a", 10)
+	s.Poke("b", 20)
+	s.Run(10000)
+	s.Poke("a", 100)
+	s.Poke("b", 27)
+	s.Run(10000)
+	w.Close()
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %v\n%s", err, buf.String())
+	}
+	return f
+}
+
+func TestDiffAgainstIcarus(t *testing.T) {
+	icarus, err := Open("../dump.vcd")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	opts := DiffOptions{RootB: "testbench.dut"}
+
+	mismatches, err := Diff(adderDump(t, newAdder("a + b")), icarus, opts)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Simulator should match Icarus, got %v", mismatches)
+	}
+
+	mismatches, err = Diff(adderDump(t, newAdder("a + b + {7'h0, a > 8'd50}")), icarus, opts)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("Expected one divergent signal, got %v", mismatches)
+	}
+	want := "10000 ps: sum = 0x80 in A, 0x7f in B"
+	if got := mismatches[0].String(); got != want {
+		t.Errorf("Mismatch = %q, want %q", got, want)
+	}
+}
+
+func TestDiffTolerance(t *testing.T) {
+	dump := func(shift int, data string) *File {
+		text := `$timescale 1ps $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var wire 4 " data $end
+$upscope $end
+$enddefinitions $end
+`
+		for i := 0; i < 8; i++ {
+			text += "#" + strconv.Itoa(i*5000) + "\n" + strconv.Itoa(i%2) + "!\n"
+		}
+		for i, c := range data {
+			at := i * 10000
+			if i > 0 {
+				at += shift
+			}
+			text += "#" + strconv.Itoa(at) + "\nb" + string(c) + " \"\n"
+		}
+		text += "#40000\n"
+		f, err := Read(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		return f
+	}
+	ref := dump(0, "0110")
+	late := dump(300, "0110")
+	wrong := dump(0, "0100")
+
+	if m, _ := Diff(ref, late, DiffOptions{Tolerance: 500}); len(m) != 0 {
+		t.Errorf("A 300 ps skew should be tolerated, got %v", m)
+	}
+	m, err := Diff(ref, late, DiffOptions{Clock: "clk"})
+	if err != nil || len(m) != 1 || m[0].Time != 10000 || m[0].Cycle != 1 {
+		t.Errorf("Without tolerance the skew should diverge at cycle 1, got %v %v", m, err)
+	}
+	m, err = Diff(ref, wrong, DiffOptions{Signals: []string{"data"}, Clock: "clk", Tolerance: 500})
+	if err != nil || len(m) != 1 || m[0].String() != "cycle 2 (20000 ps): data = 0x1 in A, 0x0 in B" {
+		t.Errorf("Expected data to diverge at cycle 2, got %v %v", m, err)
+	}
+	if _, err := Diff(ref, wrong, DiffOptions{Signals: []string{"nope"}}); err == nil {
+		t.Errorf("Comparing an unknown signal should fail")
+	}
+}
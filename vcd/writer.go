@@ -0,0 +1,256 @@
+// Package vcd writes Value Change Dump waveforms from the simulator and
+// reads VCD files back for comparison.
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SoulPancake/HFT/simulator"
+)
+
+// Signals to dump. With neither field set every signal is dumped.
+type Options struct {
+	Signals []string // flat signal names, e.g. "u_fifo.count"
+	Scopes  []string // instance paths whose signals are all dumped, "" for the top
+}
+
+// VCD dump of a running simulation. Times are simulator picoseconds, so
+// the waveform follows the ClockDomain frequencies.
+type Writer struct {
+	sim    *simulator.Simulator
+	out    *bufio.Writer
+	closer io.Closer
+	vars   []*variable
+	time   uint64
+	dumped bool // whether the current time stamp has been written
+	closed bool
+	err    error
+}
+
+type variable struct {
+	name    string // flat signal name
+	code    string
+	width   int
+	last    uint64
+	unknown uint64 // x and z bits of last
+}
+
+// Start dumping the simulation to w. The header and the current values are
+// written immediately; every later change is recorded as it happens.
+func NewWriter(w io.Writer, sim *simulator.Simulator, opts Options) (*Writer, error) {
+	vw := &Writer{sim: sim, out: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		vw.closer = c
+	}
+	for _, name := range sim.Signals() {
+		if !opts.selects(name, sim.Netlist.Nets[name].Scope) {
+			continue
+		}
+		vw.vars = append(vw.vars, &variable{
+			name:  name,
+			code:  identifier(len(vw.vars)),
+			width: int(sim.Width(name)),
+		})
+	}
+	for _, name := range opts.Signals {
+		if _, ok := sim.Netlist.Nets[name]; !ok {
+			return nil, fmt.Errorf("vcd: no signal %s", name)
+		}
+	}
+	vw.header()
+	vw.dumpAll()
+	sim.Observe(vw.sample)
+	return vw, vw.err
+}
+
+// Create a VCD file for the simulation
+func Create(path string, sim *simulator.Simulator, opts Options) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, sim, opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (o Options) selects(name, scope string) bool {
+	if len(o.Signals) == 0 && len(o.Scopes) == 0 {
+		return true
+	}
+	for _, s := range o.Signals {
+		if s == name {
+			return true
+		}
+	}
+	for _, s := range o.Scopes {
+		if scope == s || s == "" && scope == "" || strings.HasPrefix(scope, s+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Short identifier codes from the printable ASCII range
+func identifier(i int) string {
+	const first, count = 33, 94
+	code := []byte{byte(first + i%count)}
+	for i /= count; i > 0; i /= count {
+		i--
+		code = append(code, byte(first+i%count))
+	}
+	return string(code)
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.out, format, args...)
+	}
+}
+
+func (w *Writer) header() {
+	w.printf("$version\n\tHFT simulator\n$end\n")
+	w.printf("$timescale\n\t1ps\n$end\n")
+
+	// Group variables by instance path so the scopes nest
+	byScope := map[string][]*variable{}
+	var scopes []string
+	for _, v := range w.vars {
+		scope := w.sim.Netlist.Nets[v.name].Scope
+		if _, ok := byScope[scope]; !ok {
+			scopes = append(scopes, scope)
+		}
+		byScope[scope] = append(byScope[scope], v)
+	}
+	sort.Strings(scopes)
+
+	w.printf("$scope module %s $end\n", w.sim.Netlist.Top.Name)
+	var open []string
+	for _, scope := range scopes {
+		path := []string{}
+		if scope != "" {
+			path = strings.Split(scope, ".")
+		}
+		common := 0
+		for common < len(open) && common < len(path) && open[common] == path[common] {
+			common++
+		}
+		for len(open) > common {
+			w.printf("$upscope $end\n")
+			open = open[:len(open)-1]
+		}
+		for _, inst := range path[common:] {
+			w.printf("$scope module %s $end\n", inst)
+			open = append(open, inst)
+		}
+		for _, v := range byScope[scope] {
+			kind := "wire"
+			if w.sim.Netlist.Nets[v.name].Kind == "reg" {
+				kind = "reg"
+			}
+			ref := reference(v.name, scope)
+			if v.width > 1 {
+				ref += fmt.Sprintf(" [%d:0]", v.width-1)
+			}
+			w.printf("$var %s %d %s %s $end\n", kind, v.width, v.code, ref)
+		}
+	}
+	for range open {
+		w.printf("$upscope $end\n")
+	}
+	w.printf("$upscope $end\n")
+	w.printf("$enddefinitions $end\n")
+}
+
+// Name of a signal inside its scope; Vec elements like v[2] become v_2 so
+// viewers don't read the index as a bit range
+func reference(name, scope string) string {
+	if scope != "" {
+		name = strings.TrimPrefix(name, scope+".")
+	}
+	return strings.NewReplacer("[", "_", "]", "").Replace(name)
+}
+
+func (w *Writer) dumpAll() {
+	w.time = w.sim.Time()
+	w.printf("#%d\n$dumpvars\n", w.time)
+	for _, v := range w.vars {
+		v.last, v.unknown = w.sim.PeekX(v.name)
+		w.value(v)
+	}
+	w.printf("$end\n")
+	w.dumped = true
+}
+
+func (w *Writer) value(v *variable) {
+	bits := fmt.Sprintf("%b", v.last)
+	if v.unknown != 0 {
+		bits = strings.TrimLeft(simulator.FormatBits(v.last, v.unknown, v.width), "0")
+		if bits == "" {
+			bits = "0"
+		}
+	}
+	if v.width == 1 {
+		w.printf("%s%s\n", bits, v.code)
+		return
+	}
+	w.printf("b%s %s\n", bits, v.code)
+}
+
+// Record the values that changed since the last sample
+func (w *Writer) sample() {
+	if w.closed {
+		return
+	}
+	if now := w.sim.Time(); now != w.time {
+		w.time = now
+		w.dumped = false
+	}
+	for _, v := range w.vars {
+		value, unknown := w.sim.PeekX(v.name)
+		if value == v.last && unknown == v.unknown {
+			continue
+		}
+		if !w.dumped {
+			w.printf("#%d\n", w.time)
+			w.dumped = true
+		}
+		v.last, v.unknown = value, unknown
+		w.value(v)
+	}
+}
+
+// Sample the current values; changes are normally recorded automatically
+func (w *Writer) Sample() {
+	w.sample()
+}
+
+// Write the final time stamp and close the underlying file, if any. The
+// writer stops recording.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.sample()
+	if !w.dumped {
+		w.printf("#%d\n", w.time)
+	}
+	w.closed = true
+	if err := w.out.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.closer != nil {
+		if err := w.closer.Close(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	return w.err
+}
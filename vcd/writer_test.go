@@ -0,0 +1,169 @@
+package vcd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+func newSim(t *testing.T, m *hdl.Module) *simulator.Simulator {
+	s, err := simulator.New(m)
+	if err != nil {
+		t.Fatalf("simulator.New: %v", err)
+	}
+	return s
+}
+
+func TestWriteCounter(t *testing.T) {
+	s := newSim(t, testdesigns.Counter())
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, s, Options{})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	s.Poke("rst", 0)
+	s.Poke("en", 1)
+	s.Cycle(3)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"$timescale\n\t1ps\n$end",
+		"$scope module Counter $end",
+		"$var wire 1 ! clk $end",
+		"$var wire 8 $ count [7:0] $end",
+		"$var reg 8 % count_r [7:0] $end",
+		"$enddefinitions $end\n#0\n$dumpvars\n0!\n",
+		// 100 MHz: the clock rises every 10 ns from 5 ns
+		"#5000\n1!\n",
+		"#10000\n0!\n",
+		"#35000\n1!\nb11 $\nb11 %\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Dump should contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "$scope") != strings.Count(out, "$upscope") {
+		t.Errorf("Unbalanced scopes:\n%s", out)
+	}
+
+	// Nothing is recorded after Close
+	s.Cycle(1)
+	if strings.Contains(buf.String(), "#45000") {
+		t.Errorf("Writer kept recording after Close")
+	}
+}
+
+func TestScopesAndSelection(t *testing.T) {
+	child := testdesigns.Counter()
+	top := core.NewModule("Top")
+	clk := top.Input("clk", 1)
+	rst := top.Input("rst", 1)
+	en := top.Input("en", 1)
+	for _, name := range []string{"u_a", "u_b"} {
+		top.InstanceOf(child, name).
+			Connect("clk", clk).
+			Connect("rst", rst).
+			Connect("en", en).
+			Connect("count", top.Wire(name+"_count", 8))
+	}
+	v := top.Vec("lane", 2, 4)
+	top.AssignName(v.Elements[0].Name, "u_a_count[3:0]")
+
+	s := newSim(t, top)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, s, Options{})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.Close()
+	out := buf.String()
+	for _, want := range []string{
+		"$scope module Top $end",
+		"$scope module u_a $end",
+		"$scope module u_b $end",
+		"count_r [7:0] $end",
+		"lane_0 [3:0] $end",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Dump should contain %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	w, err = NewWriter(&buf, newSim(t, top), Options{Signals: []string{"clk"}, Scopes: []string{"u_b"}})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.Close()
+	out = buf.String()
+	if !strings.Contains(out, " clk $end") || !strings.Contains(out, "$scope module u_b $end") {
+		t.Errorf("Selected signals missing:\n%s", out)
+	}
+	if strings.Contains(out, "u_a") || strings.Count(out, " en $end") != 1 {
+		t.Errorf("Unselected signals dumped:\n%s", out)
+	}
+
+	if _, err := NewWriter(&buf, s, Options{Signals: []string{"missing"}}); err == nil {
+		t.Errorf("Selecting an unknown signal should fail")
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 20000; i++ {
+		code := identifier(i)
+		if seen[code] {
+			t.Fatalf("identifier(%d) = %q repeats", i, code)
+		}
+		seen[code] = true
+	}
+	if identifier(0) != "!" || identifier(93) != "~" || len(identifier(94)) != 2 {
+		t.Errorf("Unexpected identifier codes %q %q %q", identifier(0), identifier(93), identifier(94))
+	}
+}
+
+func TestWriteUnknowns(t *testing.T) {
+	s, err := simulator.NewFourState(testdesigns.Counter())
+	if err != nil {
+		t.Fatalf("simulator.NewFourState: %v", err)
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, s, Options{})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	s.PokeBits("en", "x")
+	s.Poke("rst", 1)
+	s.Cycle(1)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"bxxxxxxxx $\n",
+		"$end\n1\"\nx#\n",
+		"#5000\n1!\nb0 $\nb0 %\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Dump should contain %q:\n%s", want, out)
+		}
+	}
+
+	f, err := Read(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if v := f.Value("count", 0); v.Known() {
+		t.Errorf("count at 0 ps = %v, want unknown", v)
+	}
+}
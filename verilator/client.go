@@ -0,0 +1,308 @@
+package verilator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/testbench"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Go side of the line protocol, talking to a harness binary or to Serve
+type Client struct {
+	r   *bufio.Reader
+	w   io.Writer
+	cmd *exec.Cmd
+}
+
+// Client reading answers from r and writing commands to w
+func NewClient(r io.Reader, w io.Writer) *Client {
+	return &Client{r: bufio.NewReader(r), w: w}
+}
+
+// Run a harness binary and talk to it through pipes. Args are passed to
+// the binary, e.g. the trace file.
+func Start(path string, args ...string) (*Client, error) {
+	cmd := exec.Command(path, args...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("verilator: %v", err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("verilator: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("verilator: %v", err)
+	}
+	c := NewClient(out, in)
+	c.cmd = cmd
+	return c, nil
+}
+
+// Send a command and return the words of its answer after "ok"
+func (c *Client) call(format string, args ...interface{}) ([]string, error) {
+	cmd := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintln(c.w, cmd); err != nil {
+		return nil, fmt.Errorf("verilator: %s: %v", cmd, err)
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("verilator: %s: no answer: %v", cmd, err)
+	}
+	line = strings.TrimSpace(line)
+	if msg := strings.TrimPrefix(line, "error "); msg != line {
+		return nil, fmt.Errorf("verilator: %s: %s", cmd, msg)
+	}
+	words := strings.Fields(line)
+	if len(words) == 0 || words[0] != "ok" {
+		return nil, fmt.Errorf("verilator: %s: unexpected answer %q", cmd, line)
+	}
+	return words[1:], nil
+}
+
+// <name>=<hex> words in name order
+func assignments(values map[string]uint64) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%x", name, values[name])
+	}
+	return b.String()
+}
+
+// Drive inputs
+func (c *Client) Set(values map[string]uint64) error {
+	_, err := c.call("set%s", assignments(values))
+	return err
+}
+
+// Read ports
+func (c *Client) Get(names ...string) ([]uint64, error) {
+	words, err := c.call("get %s", strings.Join(names, " "))
+	if err != nil {
+		return nil, err
+	}
+	if len(words) != len(names) {
+		return nil, fmt.Errorf("verilator: get %s: %d values for %d ports", strings.Join(names, " "), len(words), len(names))
+	}
+	values := make([]uint64, len(words))
+	for i, w := range words {
+		if values[i], err = strconv.ParseUint(w, 16, 64); err != nil {
+			return nil, fmt.Errorf("verilator: get %s: bad value %q", names[i], w)
+		}
+	}
+	return values, nil
+}
+
+// Advance by n rising edges of a clock input or domain, the primary clock
+// when clock is empty, and return the time in picoseconds
+func (c *Client) Step(clock string, n int) (uint64, error) {
+	if clock != "" {
+		clock += " "
+	}
+	words, err := c.call("step %s%d", clock, n)
+	if err != nil {
+		return 0, err
+	}
+	if len(words) != 1 {
+		return 0, fmt.Errorf("verilator: step: unexpected answer %q", words)
+	}
+	return strconv.ParseUint(words[0], 10, 64)
+}
+
+// Drive inputs, run one edge of the primary clock and return every output
+func (c *Client) Cycle(inputs map[string]uint64) (map[string]uint64, error) {
+	words, err := c.call("cycle%s", assignments(inputs))
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]uint64{}
+	for _, w := range words {
+		eq := strings.IndexByte(w, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("verilator: cycle: bad output %q", w)
+		}
+		v, err := strconv.ParseUint(w[eq+1:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("verilator: cycle: bad output %q", w)
+		}
+		outputs[w[:eq]] = v
+	}
+	return outputs, nil
+}
+
+// Run one testbench vector, failing on outputs that differ from the
+// expected values
+func (c *Client) Apply(v testbench.Vector) error {
+	outputs, err := c.Cycle(v.Inputs)
+	if err != nil {
+		return err
+	}
+	var diffs []string
+	for name, want := range v.Expect {
+		got, ok := outputs[name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s missing", name))
+		} else if got != want {
+			diffs = append(diffs, fmt.Sprintf("%s = %#x, expected %#x", name, got, want))
+		}
+	}
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return fmt.Errorf("verilator: %s", strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// Simulation time in picoseconds
+func (c *Client) Time() (uint64, error) {
+	words, err := c.call("time")
+	if err != nil {
+		return 0, err
+	}
+	if len(words) != 1 {
+		return 0, fmt.Errorf("verilator: time: unexpected answer %q", words)
+	}
+	return strconv.ParseUint(words[0], 10, 64)
+}
+
+// End the simulation, waiting for a harness process to exit
+func (c *Client) Close() error {
+	_, err := c.call("quit")
+	if c.cmd != nil {
+		if closer, ok := c.w.(io.Closer); ok {
+			closer.Close()
+		}
+		if werr := c.cmd.Wait(); err == nil && werr != nil {
+			err = fmt.Errorf("verilator: %v", werr)
+		}
+	}
+	return err
+}
+
+// Answer the line protocol from r on w with the native simulator, until
+// quit or the end of the input
+func Serve(sim *simulator.Simulator, r io.Reader, w io.Writer) error {
+	top := sim.Netlist.Top
+	inputs := map[string]bool{}
+	for _, sig := range top.Inputs {
+		inputs[sig.Name] = true
+	}
+	ports := map[string]bool{}
+	for _, sig := range append(append([]*hdl.Signal{}, top.Inputs...), top.Outputs...) {
+		ports[sig.Name] = true
+	}
+	clocks := sim.Clocks()
+	domains := map[string]*hdl.ClockDomain{}
+	for _, c := range clocks {
+		cd := sim.Netlist.ClockDomainOf(c)
+		if cd == nil {
+			cd = &hdl.ClockDomain{Name: c, Clock: &hdl.Signal{Name: c}}
+		}
+		domains[c] = cd
+		domains[cd.Name] = cd
+	}
+	for _, c := range clocks {
+		inputs[c] = false
+	}
+
+	assign := func(word string) error {
+		eq := strings.IndexByte(word, '=')
+		if eq < 0 {
+			return fmt.Errorf("expected <input>=<hex>, got %s", word)
+		}
+		name := word[:eq]
+		v, err := strconv.ParseUint(word[eq+1:], 16, 64)
+		if err != nil {
+			return fmt.Errorf("bad value %s for %s", word[eq+1:], name)
+		}
+		if !inputs[name] {
+			return fmt.Errorf("no input %s", name)
+		}
+		sim.Poke(name, v)
+		return nil
+	}
+
+	in := bufio.NewScanner(r)
+	for in.Scan() {
+		words := strings.Fields(in.Text())
+		if len(words) == 0 {
+			continue
+		}
+		var reply strings.Builder
+		var err error
+		switch cmd, args := words[0], words[1:]; cmd {
+		case "set", "cycle":
+			for _, word := range args {
+				if err = assign(word); err != nil {
+					break
+				}
+			}
+			if err == nil && cmd == "cycle" {
+				if len(clocks) > 0 {
+					sim.Cycle(1)
+				}
+				for _, sig := range top.Outputs {
+					fmt.Fprintf(&reply, " %s=%x", sig.Name, sim.Peek(sig.Name))
+				}
+			}
+		case "get":
+			for _, name := range args {
+				if !ports[name] {
+					err = fmt.Errorf("no port %s", name)
+					break
+				}
+				fmt.Fprintf(&reply, " %x", sim.Peek(name))
+			}
+		case "step":
+			clock, count := "", ""
+			switch len(args) {
+			case 1:
+				count = args[0]
+			case 2:
+				clock, count = args[0], args[1]
+			}
+			n, perr := strconv.Atoi(count)
+			switch {
+			case len(clocks) == 0:
+				err = fmt.Errorf("the design has no clock to step")
+			case clock != "" && domains[clock] == nil:
+				err = fmt.Errorf("no clock %s", clock)
+			case perr != nil || n < 0:
+				err = fmt.Errorf("bad cycle count %s", count)
+			case clock == "":
+				sim.Cycle(n)
+			default:
+				sim.CycleDomain(domains[clock], n)
+			}
+			if err == nil {
+				fmt.Fprintf(&reply, " %d", sim.Time())
+			}
+		case "time":
+			fmt.Fprintf(&reply, " %d", sim.Time())
+		case "quit":
+		default:
+			err = fmt.Errorf("unknown command %s", cmd)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "error %v\n", err)
+		} else {
+			fmt.Fprintf(w, "ok%s\n", reply.String())
+		}
+		if words[0] == "quit" {
+			return nil
+		}
+	}
+	return in.Err()
+}
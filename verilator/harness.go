@@ -0,0 +1,447 @@
+// Package verilator generates a C++ harness for running a design under
+// Verilator, for soak tests too long for the native simulator. The harness
+// wraps the Verilated model in a class with a typed port struct, drives
+// every clock input at its domain's frequency, optionally traces to VCD or
+// FST, and answers a line protocol on stdin and stdout that a Go test
+// drives through a pipe with Client:
+//
+//	set <input>=<hex> ...      drive inputs                         -> ok
+//	get <port> ...             read ports                           -> ok <hex> ...
+//	step [<clock>] <n>         n rising edges of a clock or domain  -> ok <time in ps>
+//	cycle [<input>=<hex> ...]  drive inputs, one primary clock edge -> ok <output>=<hex> ...
+//	time                                                            -> ok <time in ps>
+//	quit                                                            -> ok
+//
+// A command that fails answers "error <message>". Serve speaks the same
+// protocol over the native simulator.
+//
+//	h, err := verilator.Generate(m, verilator.Options{Trace: "fst"})
+//	core.EmitVerilog(m)
+//	h.Write(".")
+//	// verilator <h.Args...>, then obj_dir/Counter_sim [trace file]
+package verilator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/types"
+)
+
+// Harness generation options
+type Options struct {
+	Trace   string // "vcd", "fst" or empty for no tracing
+	Verilog string // design source passed to Verilator, "out.v" by default
+}
+
+// Generated harness of a module
+type Harness struct {
+	Module string
+	Files  map[string][]byte // file name to contents
+	Args   []string          // verilator arguments building the harness binary
+}
+
+// Write the harness files into a directory
+func (h *Harness) Write(dir string) error {
+	for name, data := range h.Files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name of the harness binary Verilator builds in obj_dir
+func (h *Harness) Binary() string {
+	return h.Module + "_sim"
+}
+
+// Clock input the harness drives
+type harnessClock struct {
+	name   string
+	domain string
+	half   uint64 // half period in picoseconds
+}
+
+type harnessGen struct {
+	m       *hdl.Module
+	opts    Options
+	clocks  []harnessClock
+	isClock map[string]bool
+	buf     bytes.Buffer
+}
+
+func (g *harnessGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// Generate the harness of a module: <Name>_harness.h with the port struct
+// and the harness class, and <Name>_main.cpp answering the line protocol.
+// The binary takes the trace file as its only argument when tracing is
+// enabled.
+func Generate(m *hdl.Module, opts Options) (*Harness, error) {
+	if opts.Trace != "" && opts.Trace != "vcd" && opts.Trace != "fst" {
+		return nil, fmt.Errorf("verilator: unknown trace format %q", opts.Trace)
+	}
+	if opts.Verilog == "" {
+		opts.Verilog = "out.v"
+	}
+	for _, sig := range append(append([]*hdl.Signal{}, m.Inputs...), m.Outputs...) {
+		if sig.Width > 64 {
+			return nil, fmt.Errorf("verilator: port %s is %d bits wide, the harness supports up to 64", sig.Name, sig.Width)
+		}
+	}
+	sim, err := simulator.New(m)
+	if err != nil {
+		return nil, fmt.Errorf("verilator: cannot simulate %s: %v", m.Name, err)
+	}
+	g := &harnessGen{m: m, opts: opts, isClock: map[string]bool{}}
+	for _, name := range sim.Clocks() {
+		clk := harnessClock{name: name}
+		freq := simulator.DefaultFrequency
+		if cd := sim.Netlist.ClockDomainOf(name); cd != nil {
+			clk.domain = cd.Name
+			if cd.Frequency > 0 {
+				freq = cd.Frequency
+			}
+		}
+		clk.half = uint64(1e12 / float64(freq) / 2)
+		if clk.half == 0 {
+			clk.half = 1
+		}
+		g.clocks = append(g.clocks, clk)
+		g.isClock[name] = true
+	}
+
+	h := &Harness{Module: m.Name, Files: map[string][]byte{}}
+	g.header()
+	h.Files[m.Name+"_harness.h"] = append([]byte{}, g.buf.Bytes()...)
+	g.buf.Reset()
+	g.main()
+	h.Files[m.Name+"_main.cpp"] = append([]byte{}, g.buf.Bytes()...)
+
+	h.Args = []string{"--cc", "--exe", "--build", "-Wno-fatal", "--top-module", m.Name, "-o", h.Binary()}
+	switch opts.Trace {
+	case "vcd":
+		h.Args = append(h.Args, "--trace")
+	case "fst":
+		h.Args = append(h.Args, "--trace-fst")
+	}
+	h.Args = append(h.Args, opts.Verilog, m.Name+"_main.cpp")
+	return h, nil
+}
+
+// C++ type Verilator uses for a port of the width
+func cType(width hdl.Width) string {
+	switch {
+	case width <= 8:
+		return "uint8_t"
+	case width <= 16:
+		return "uint16_t"
+	case width <= 32:
+		return "uint32_t"
+	}
+	return "uint64_t"
+}
+
+func cMask(width hdl.Width) string {
+	if width >= 64 {
+		return "0xffffffffffffffffULL"
+	}
+	if width < 1 {
+		width = 1
+	}
+	return fmt.Sprintf("%#xULL", (uint64(1)<<uint(width))-1)
+}
+
+func (g *harnessGen) tracer() string {
+	if g.opts.Trace == "fst" {
+		return "VerilatedFstC"
+	}
+	return "VerilatedVcdC"
+}
+
+func (g *harnessGen) header() {
+	name := g.m.Name
+	guard := strings.ToUpper(name) + "_HARNESS_H"
+	g.printf("// Verilator harness for %s. Generated, do not edit.\n", name)
+	g.printf("#ifndef %s\n#define %s\n\n", guard, guard)
+	g.printf("#include <cstdint>\n#include <memory>\n#include <string>\n#include <vector>\n\n")
+	g.printf("#include \"verilated.h\"\n")
+	switch g.opts.Trace {
+	case "vcd":
+		g.printf("#include \"verilated_vcd_c.h\"\n")
+	case "fst":
+		g.printf("#include \"verilated_fst_c.h\"\n")
+	}
+	g.printf("#include \"V%s.h\"\n\n", name)
+
+	g.printf("// Ports of %s\n", name)
+	g.printf("struct %sPorts {\n", name)
+	g.printf("    // Inputs\n")
+	for _, sig := range g.m.Inputs {
+		g.printf("    %s %s;\n", cType(sig.Width), sig.Name)
+	}
+	g.printf("    // Outputs\n")
+	for _, sig := range g.m.Outputs {
+		g.printf("    %s %s;\n", cType(sig.Width), sig.Name)
+	}
+	g.printf("};\n\n")
+
+	g.printf("// Clock input driven by the harness\n")
+	g.printf("struct %sClock {\n", name)
+	g.printf("    const char* name;   // input port\n")
+	g.printf("    const char* domain; // clock domain, empty when none declares it\n")
+	g.printf("    uint64_t half;      // half period in picoseconds\n")
+	g.printf("    uint64_t next;      // time of the next toggle\n")
+	g.printf("};\n\n")
+
+	g.printf("// %s with its clock inputs driven at their domains' frequencies, the\n", name)
+	g.printf("// primary clock first\n")
+	g.printf("class %sHarness {\n", name)
+	g.printf("public:\n")
+	g.printf("    std::vector<%sClock> clocks;\n\n", name)
+	g.printf("    %sHarness() : ctx(new VerilatedContext), top(new V%s(ctx.get())) {\n", name, name)
+	for _, c := range g.clocks {
+		g.printf("        clocks.push_back({%q, %q, %d, %d});\n", c.name, c.domain, c.half, c.half)
+	}
+	g.printf("        top->eval();\n")
+	g.printf("    }\n\n")
+	g.printf("    ~%sHarness() { close(); }\n\n", name)
+
+	if g.opts.Trace != "" {
+		g.printf("    // Dump a waveform to path from now on\n")
+		g.printf("    void trace(const char* path) {\n")
+		g.printf("        ctx->traceEverOn(true);\n")
+		g.printf("        tfp.reset(new %s);\n", g.tracer())
+		g.printf("        top->trace(tfp.get(), 99);\n")
+		g.printf("        tfp->open(path);\n")
+		g.printf("        tfp->dump(time);\n")
+		g.printf("    }\n\n")
+	}
+
+	g.printf("    // Finish the simulation\n")
+	g.printf("    void close() {\n")
+	g.printf("        if (closed) return;\n")
+	g.printf("        closed = true;\n")
+	g.printf("        top->final();\n")
+	if g.opts.Trace != "" {
+		g.printf("        if (tfp) tfp->close();\n")
+	}
+	g.printf("    }\n\n")
+
+	g.printf("    // Drive every input but the clocks and settle the design\n")
+	g.printf("    void poke(const %sPorts& p) {\n", name)
+	for _, sig := range g.m.Inputs {
+		if !g.isClock[sig.Name] {
+			g.printf("        top->%s = p.%s;\n", sig.Name, sig.Name)
+		}
+	}
+	g.printf("        eval();\n")
+	g.printf("    }\n\n")
+
+	g.printf("    // Values of every port\n")
+	g.printf("    %sPorts peek() {\n", name)
+	g.printf("        %sPorts p;\n", name)
+	for _, sig := range append(append([]*hdl.Signal{}, g.m.Inputs...), g.m.Outputs...) {
+		g.printf("        p.%s = top->%s;\n", sig.Name, sig.Name)
+	}
+	g.printf("        return p;\n")
+	g.printf("    }\n\n")
+
+	g.printf("    // Drive an input by name, false if there is no such input or it is a\n")
+	g.printf("    // clock. Call eval once the inputs are set.\n")
+	g.printf("    bool set(const std::string& name, uint64_t value) {\n")
+	for _, sig := range g.m.Inputs {
+		if !g.isClock[sig.Name] {
+			g.printf("        if (name == %q) { top->%s = value & %s; return true; }\n", sig.Name, sig.Name, cMask(sig.Width))
+		}
+	}
+	g.printf("        return false;\n")
+	g.printf("    }\n\n")
+
+	g.printf("    // Read a port by name, false if there is no such port\n")
+	g.printf("    bool get(const std::string& name, uint64_t& value) {\n")
+	for _, sig := range append(append([]*hdl.Signal{}, g.m.Inputs...), g.m.Outputs...) {
+		g.printf("        if (name == %q) { value = top->%s; return true; }\n", sig.Name, sig.Name)
+	}
+	g.printf("        return false;\n")
+	g.printf("    }\n\n")
+
+	g.printf("    // Settle the design after inputs changed\n")
+	g.printf("    void eval() {\n")
+	g.printf("        top->eval();\n")
+	if g.opts.Trace != "" {
+		g.printf("        if (tfp) tfp->dump(time);\n")
+	}
+	g.printf("    }\n\n")
+
+	g.printf("    // Index of a clock by input or domain name, -1 if there is none\n")
+	g.printf("    int clock(const std::string& name) const {\n")
+	g.printf("        for (size_t i = 0; i < clocks.size(); i++) {\n")
+	g.printf("            if (name == clocks[i].name || name == clocks[i].domain) return int(i);\n")
+	g.printf("        }\n")
+	g.printf("        return -1;\n")
+	g.printf("    }\n\n")
+
+	g.printf("    // Advance by n rising edges of a clock\n")
+	g.printf("    void step(int clock, int n) {\n")
+	g.printf("        for (int rises = 0; rises < n;) {\n")
+	g.printf("            bool before = level(clock);\n")
+	g.printf("            tick();\n")
+	g.printf("            if (!before && level(clock)) rises++;\n")
+	g.printf("        }\n")
+	g.printf("    }\n\n")
+
+	g.printf("    // Simulation time in picoseconds\n")
+	g.printf("    uint64_t now() const { return time; }\n\n")
+
+	g.printf("private:\n")
+	g.printf("    // Advance to the next edge of any clock\n")
+	g.printf("    void tick() {\n")
+	g.printf("        uint64_t next = clocks[0].next;\n")
+	g.printf("        for (const auto& c : clocks) {\n")
+	g.printf("            if (c.next < next) next = c.next;\n")
+	g.printf("        }\n")
+	g.printf("        time = next;\n")
+	g.printf("        ctx->time(time);\n")
+	g.printf("        for (size_t i = 0; i < clocks.size(); i++) {\n")
+	g.printf("            if (clocks[i].next != time) continue;\n")
+	g.printf("            toggle(int(i));\n")
+	g.printf("            clocks[i].next += clocks[i].half;\n")
+	g.printf("        }\n")
+	g.printf("        eval();\n")
+	g.printf("    }\n\n")
+
+	g.printf("    bool level(int clock) {\n")
+	g.printf("        switch (clock) {\n")
+	for i, c := range g.clocks {
+		g.printf("        case %d: return top->%s;\n", i, c.name)
+	}
+	g.printf("        default: return false;\n")
+	g.printf("        }\n")
+	g.printf("    }\n\n")
+
+	g.printf("    void toggle(int clock) {\n")
+	g.printf("        switch (clock) {\n")
+	for i, c := range g.clocks {
+		g.printf("        case %d: top->%s = !top->%s; break;\n", i, c.name, c.name)
+	}
+	g.printf("        default: break;\n")
+	g.printf("        }\n")
+	g.printf("    }\n\n")
+
+	g.printf("    std::unique_ptr<VerilatedContext> ctx;\n")
+	g.printf("    std::unique_ptr<V%s> top;\n", name)
+	if g.opts.Trace != "" {
+		g.printf("    std::unique_ptr<%s> tfp;\n", g.tracer())
+	}
+	g.printf("    uint64_t time = 0;\n")
+	g.printf("    bool closed = false;\n")
+	g.printf("};\n\n")
+	g.printf("#endif\n")
+}
+
+func (g *harnessGen) main() {
+	name := g.m.Name
+	g.printf("// Line protocol driving the %s harness from stdin to stdout. Generated,\n", name)
+	g.printf("// do not edit.\n")
+	g.printf("//\n")
+	g.printf("//   set <input>=<hex> ...      drive inputs\n")
+	g.printf("//   get <port> ...             answer ok <hex> ...\n")
+	g.printf("//   step [<clock>] <n>         n rising edges, answer ok <time in ps>\n")
+	g.printf("//   cycle [<input>=<hex> ...]  drive inputs and run one primary clock edge,\n")
+	g.printf("//                              answer ok <output>=<hex> ...\n")
+	g.printf("//   time                       answer ok <time in ps>\n")
+	g.printf("//   quit\n")
+	g.printf("//\n")
+	g.printf("// Other commands answer ok, failures answer error <message>.\n")
+	g.printf("#include <cstdio>\n#include <cstdlib>\n#include <iostream>\n#include <sstream>\n#include <string>\n\n")
+	g.printf("#include \"%s_harness.h\"\n\n", name)
+
+	g.printf("// Drive an input from a <name>=<hex> word\n")
+	g.printf("static bool assign(%sHarness& h, const std::string& word, std::string& err) {\n", name)
+	g.printf("    size_t eq = word.find('=');\n")
+	g.printf("    if (eq == std::string::npos) {\n")
+	g.printf("        err = \"expected <input>=<hex>, got \" + word;\n")
+	g.printf("        return false;\n")
+	g.printf("    }\n")
+	g.printf("    std::string port = word.substr(0, eq), digits = word.substr(eq + 1);\n")
+	g.printf("    char* end = nullptr;\n")
+	g.printf("    uint64_t value = std::strtoull(digits.c_str(), &end, 16);\n")
+	g.printf("    if (digits.empty() || *end != '\\0') {\n")
+	g.printf("        err = \"bad value \" + digits + \" for \" + port;\n")
+	g.printf("        return false;\n")
+	g.printf("    }\n")
+	g.printf("    if (!h.set(port, value)) {\n")
+	g.printf("        err = \"no input \" + port;\n")
+	g.printf("        return false;\n")
+	g.printf("    }\n")
+	g.printf("    return true;\n")
+	g.printf("}\n\n")
+
+	g.printf("int main(int argc, char** argv) {\n")
+	g.printf("    %sHarness h;\n", name)
+	if g.opts.Trace != "" {
+		g.printf("    if (argc > 1) h.trace(argv[1]);\n")
+	} else {
+		g.printf("    if (argc > 1) {\n")
+		g.printf("        std::fprintf(stderr, \"%%s: built without tracing, rebuild with --trace\\n\", argv[0]);\n")
+		g.printf("        return 2;\n")
+		g.printf("    }\n")
+	}
+	g.printf("    std::string line;\n")
+	g.printf("    while (std::getline(std::cin, line)) {\n")
+	g.printf("        std::istringstream in(line);\n")
+	g.printf("        std::ostringstream reply;\n")
+	g.printf("        std::string cmd, word, err;\n")
+	g.printf("        if (!(in >> cmd)) continue;\n")
+	g.printf("        reply << std::hex;\n")
+	g.printf("        if (cmd == \"set\" || cmd == \"cycle\") {\n")
+	g.printf("            while (err.empty() && in >> word) assign(h, word, err);\n")
+	g.printf("            h.eval();\n")
+	g.printf("            if (err.empty() && cmd == \"cycle\") {\n")
+	g.printf("                if (!h.clocks.empty()) h.step(0, 1);\n")
+	g.printf("                %sPorts p = h.peek();\n", name)
+	for _, sig := range g.m.Outputs {
+		g.printf("                reply << \" %s=\" << uint64_t(p.%s);\n", sig.Name, sig.Name)
+	}
+	g.printf("            }\n")
+	g.printf("        } else if (cmd == \"get\") {\n")
+	g.printf("            uint64_t value;\n")
+	g.printf("            while (err.empty() && in >> word) {\n")
+	g.printf("                if (h.get(word, value)) reply << \" \" << value;\n")
+	g.printf("                else err = \"no port \" + word;\n")
+	g.printf("            }\n")
+	g.printf("        } else if (cmd == \"step\") {\n")
+	g.printf("            std::string first, second;\n")
+	g.printf("            in >> first >> second;\n")
+	g.printf("            std::string clock = second.empty() ? \"\" : first;\n")
+	g.printf("            std::string count = second.empty() ? first : second;\n")
+	g.printf("            int index = clock.empty() ? 0 : h.clock(clock);\n")
+	g.printf("            char* end = nullptr;\n")
+	g.printf("            long n = std::strtol(count.c_str(), &end, 10);\n")
+	g.printf("            if (h.clocks.empty()) err = \"the design has no clock to step\";\n")
+	g.printf("            else if (index < 0) err = \"no clock \" + clock;\n")
+	g.printf("            else if (count.empty() || *end != '\\0' || n < 0) err = \"bad cycle count \" + count;\n")
+	g.printf("            else {\n")
+	g.printf("                h.step(index, int(n));\n")
+	g.printf("                reply << std::dec << \" \" << h.now();\n")
+	g.printf("            }\n")
+	g.printf("        } else if (cmd == \"time\") {\n")
+	g.printf("            reply << std::dec << \" \" << h.now();\n")
+	g.printf("        } else if (cmd != \"quit\") {\n")
+	g.printf("            err = \"unknown command \" + cmd;\n")
+	g.printf("        }\n")
+	g.printf("        if (err.empty()) std::cout << \"ok\" << reply.str() << std::endl;\n")
+	g.printf("        else std::cout << \"error \" << err << std::endl;\n")
+	g.printf("        if (cmd == \"quit\") break;\n")
+	g.printf("    }\n")
+	g.printf("    h.close();\n")
+	g.printf("    return 0;\n")
+	g.printf("}\n")
+}
@@ -0,0 +1,216 @@
+package verilator
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/SoulPancake/HFT/core"
+	"github.com/SoulPancake/HFT/internal/testdesigns"
+	"github.com/SoulPancake/HFT/simulator"
+	"github.com/SoulPancake/HFT/testbench"
+	"github.com/SoulPancake/HFT/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden harnesses in testdata")
+
+// Two domains with ports of every C++ width
+func newTwoClocks() *hdl.Module {
+	m := core.NewModule("TwoClocks")
+	m.NewClockDomain("fast", m.Input("fast_clk", 1), nil).SetFrequency(200000000)
+	m.NewClockDomain("slow", m.Input("slow_clk", 1), nil).SetFrequency(30000000)
+	m.Input("a", 16)
+	m.Input("b", 32)
+	m.Output("fast_sum", 32)
+	m.Output("slow_wide", 64)
+	m.Reg("fast_r", 32)
+	m.Reg("slow_r", 64)
+	m.AssignName("fast_sum", "fast_r")
+	m.AssignName("slow_wide", "slow_r")
+	m.Always = append(m.Always,
+		"always @(posedge fast_clk) fast_r <= a + b;",
+		"always @(posedge slow_clk) slow_r <= {b, 16'h0, a};")
+	return m
+}
+
+func newAdder() *hdl.Module {
+	m := core.NewModule("Adder")
+	m.Input("a", 8)
+	m.Input("b", 8)
+	m.Output("sum", 8)
+	m.AssignName("sum", "a + b")
+	return m
+}
+
+func TestGoldenHarnesses(t *testing.T) {
+	for _, tc := range []struct {
+		design func() *hdl.Module
+		opts   Options
+	}{
+		{testdesigns.Counter, Options{Trace: "vcd"}},
+		{newTwoClocks, Options{Trace: "fst", Verilog: "two_clocks.v"}},
+		{newAdder, Options{}},
+	} {
+		h, err := Generate(tc.design(), tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join("testdata", h.Module)
+		if *update {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := h.Write(dir); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var names []string
+		for name, data := range h.Files {
+			names = append(names, name)
+			have, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || !bytes.Equal(have, data) {
+				t.Errorf("%s is out of date, regenerate with go test ./verilator -run TestGoldenHarnesses -update", filepath.Join(dir, name))
+			}
+		}
+		sort.Strings(names)
+		if want := []string{h.Module + "_harness.h", h.Module + "_main.cpp"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Harness files %v, want %v", names, want)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	h, err := Generate(newTwoClocks(), Options{Trace: "fst"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--cc --exe --build -Wno-fatal --top-module TwoClocks -o TwoClocks_sim --trace-fst out.v TwoClocks_main.cpp"
+	if got := strings.Join(h.Args, " "); got != want {
+		t.Errorf("Verilator arguments %q, want %q", got, want)
+	}
+	header := string(h.Files["TwoClocks_harness.h"])
+	for _, want := range []string{
+		"    uint16_t a;\n    uint32_t b;\n",
+		"    uint64_t slow_wide;\n",
+		"        clocks.push_back({\"fast_clk\", \"fast\", 2500, 2500});\n        clocks.push_back({\"slow_clk\", \"slow\", 16666, 16666});\n",
+		"if (name == \"a\") { top->a = value & 0xffffULL; return true; }",
+		"std::unique_ptr<VerilatedFstC> tfp;",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("Header lacks %q:\n%s", want, header)
+		}
+	}
+	if strings.Contains(header, "top->fast_clk = value") {
+		t.Errorf("Clocks should not be settable:\n%s", header)
+	}
+
+	if _, err := Generate(testdesigns.Counter(), Options{Trace: "lxt"}); err == nil || !strings.Contains(err.Error(), "unknown trace format \"lxt\"") {
+		t.Errorf("Unknown trace formats should be rejected, got %v", err)
+	}
+	wide := core.NewModule("Wide")
+	wide.Input("w", 65)
+	if _, err := Generate(wide, Options{}); err == nil || !strings.Contains(err.Error(), "port w is 65 bits wide") {
+		t.Errorf("Ports over 64 bits should be rejected, got %v", err)
+	}
+}
+
+// Client talking to Serve through pipes, as it would to a harness binary
+func serve(t *testing.T, m *hdl.Module) (*Client, *simulator.Simulator) {
+	sim, err := simulator.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdR, cmdW := io.Pipe()
+	ansR, ansW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(sim, cmdR, ansW)
+		ansW.Close()
+	}()
+	t.Cleanup(func() {
+		cmdW.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return NewClient(ansR, cmdW), sim
+}
+
+func TestProtocol(t *testing.T) {
+	c, _ := serve(t, newTwoClocks())
+	if err := c.Set(map[string]uint64{"a": 0x1234, "b": 0x10}); err != nil {
+		t.Fatal(err)
+	}
+	now, err := c.Step("slow", 1)
+	if err != nil || now != 16666 {
+		t.Errorf("Step slow = %d, %v, want 16666", now, err)
+	}
+	got, err := c.Get("fast_sum", "slow_wide")
+	if want := []uint64{0x1244, 0x1000001234}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Get = %x, %v, want %x", got, err, want)
+	}
+	if now, err := c.Step("fast_clk", 2); err != nil || now != 22500 {
+		t.Errorf("Step fast_clk = %d, %v, want 22500", now, err)
+	}
+	if now, err := c.Time(); err != nil || now != 22500 {
+		t.Errorf("Time = %d, %v, want 22500", now, err)
+	}
+
+	for _, tc := range []struct {
+		err string
+		run func() error
+	}{
+		{"set fast_clk=1: no input fast_clk", func() error { return c.Set(map[string]uint64{"fast_clk": 1}) }},
+		{"get nothing: no port nothing", func() error { _, err := c.Get("nothing"); return err }},
+		{"step medium 1: no clock medium", func() error { _, err := c.Step("medium", 1); return err }},
+		{"step -1: bad cycle count -1", func() error { _, err := c.Step("", -1); return err }},
+	} {
+		if err := tc.run(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error %q, got %v", tc.err, err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayRecordedVectors(t *testing.T) {
+	m := testdesigns.Counter()
+	tb := testbench.New(t, m)
+	rec := tb.Record()
+	tb.Reset(2)
+	tb.PokePath("en", 1)
+	tb.Step(5)
+	tb.PokePath("en", 0)
+	tb.Step(2)
+
+	c, _ := serve(t, testdesigns.Counter())
+	for i, v := range rec.Vectors {
+		if err := c.Apply(v); err != nil {
+			t.Fatalf("Vector %d: %v", i, err)
+		}
+	}
+	outputs, err := c.Cycle(nil)
+	if err != nil || !reflect.DeepEqual(outputs, map[string]uint64{"count": 5}) {
+		t.Errorf("Cycle = %v, %v, want count=5", outputs, err)
+	}
+	err = c.Apply(testbench.Vector{Inputs: map[string]uint64{"en": 1}, Expect: map[string]uint64{"count": 9}})
+	if err == nil || !strings.Contains(err.Error(), "count = 0x6, expected 0x9") {
+		t.Errorf("A wrong output should fail the vector, got %v", err)
+	}
+
+	adder, _ := serve(t, newAdder())
+	if err := adder.Apply(testbench.Vector{Inputs: map[string]uint64{"a": 100, "b": 27}, Expect: map[string]uint64{"sum": 127}}); err != nil {
+		t.Errorf("A combinational design should settle without a clock: %v", err)
+	}
+	if _, err := adder.Step("", 1); err == nil || !strings.Contains(err.Error(), "no clock to step") {
+		t.Errorf("Stepping a design without clocks should fail, got %v", err)
+	}
+}
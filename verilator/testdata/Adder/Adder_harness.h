@@ -0,0 +1,141 @@
+// Verilator harness for Adder. Generated, do not edit.
+#ifndef ADDER_HARNESS_H
+#define ADDER_HARNESS_H
+
+#include <cstdint>
+#include <memory>
+#include <string>
+#include <vector>
+
+#include "verilated.h"
+#include "VAdder.h"
+
+// Ports of Adder
+struct AdderPorts {
+    // Inputs
+    uint8_t a;
+    uint8_t b;
+    // Outputs
+    uint8_t sum;
+};
+
+// Clock input driven by the harness
+struct AdderClock {
+    const char* name;   // input port
+    const char* domain; // clock domain, empty when none declares it
+    uint64_t half;      // half period in picoseconds
+    uint64_t next;      // time of the next toggle
+};
+
+// Adder with its clock inputs driven at their domains' frequencies, the
+// primary clock first
+class AdderHarness {
+public:
+    std::vector<AdderClock> clocks;
+
+    AdderHarness() : ctx(new VerilatedContext), top(new VAdder(ctx.get())) {
+        top->eval();
+    }
+
+    ~AdderHarness() { close(); }
+
+    // Finish the simulation
+    void close() {
+        if (closed) return;
+        closed = true;
+        top->final();
+    }
+
+    // Drive every input but the clocks and settle the design
+    void poke(const AdderPorts& p) {
+        top->a = p.a;
+        top->b = p.b;
+        eval();
+    }
+
+    // Values of every port
+    AdderPorts peek() {
+        AdderPorts p;
+        p.a = top->a;
+        p.b = top->b;
+        p.sum = top->sum;
+        return p;
+    }
+
+    // Drive an input by name, false if there is no such input or it is a
+    // clock. Call eval once the inputs are set.
+    bool set(const std::string& name, uint64_t value) {
+        if (name == "a") { top->a = value & 0xffULL; return true; }
+        if (name == "b") { top->b = value & 0xffULL; return true; }
+        return false;
+    }
+
+    // Read a port by name, false if there is no such port
+    bool get(const std::string& name, uint64_t& value) {
+        if (name == "a") { value = top->a; return true; }
+        if (name == "b") { value = top->b; return true; }
+        if (name == "sum") { value = top->sum; return true; }
+        return false;
+    }
+
+    // Settle the design after inputs changed
+    void eval() {
+        top->eval();
+    }
+
+    // Index of a clock by input or domain name, -1 if there is none
+    int clock(const std::string& name) const {
+        for (size_t i = 0; i < clocks.size(); i++) {
+            if (name == clocks[i].name || name == clocks[i].domain) return int(i);
+        }
+        return -1;
+    }
+
+    // Advance by n rising edges of a clock
+    void step(int clock, int n) {
+        for (int rises = 0; rises < n;) {
+            bool before = level(clock);
+            tick();
+            if (!before && level(clock)) rises++;
+        }
+    }
+
+    // Simulation time in picoseconds
+    uint64_t now() const { return time; }
+
+private:
+    // Advance to the next edge of any clock
+    void tick() {
+        uint64_t next = clocks[0].next;
+        for (const auto& c : clocks) {
+            if (c.next < next) next = c.next;
+        }
+        time = next;
+        ctx->time(time);
+        for (size_t i = 0; i < clocks.size(); i++) {
+            if (clocks[i].next != time) continue;
+            toggle(int(i));
+            clocks[i].next += clocks[i].half;
+        }
+        eval();
+    }
+
+    bool level(int clock) {
+        switch (clock) {
+        default: return false;
+        }
+    }
+
+    void toggle(int clock) {
+        switch (clock) {
+        default: break;
+        }
+    }
+
+    std::unique_ptr<VerilatedContext> ctx;
+    std::unique_ptr<VAdder> top;
+    uint64_t time = 0;
+    bool closed = false;
+};
+
+#endif
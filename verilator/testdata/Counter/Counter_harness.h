@@ -0,0 +1,160 @@
+// Verilator harness for Counter. Generated, do not edit.
+#ifndef COUNTER_HARNESS_H
+#define COUNTER_HARNESS_H
+
+#include <cstdint>
+#include <memory>
+#include <string>
+#include <vector>
+
+#include "verilated.h"
+#include "verilated_vcd_c.h"
+#include "VCounter.h"
+
+// Ports of Counter
+struct CounterPorts {
+    // Inputs
+    uint8_t clk;
+    uint8_t rst;
+    uint8_t en;
+    // Outputs
+    uint8_t count;
+};
+
+// Clock input driven by the harness
+struct CounterClock {
+    const char* name;   // input port
+    const char* domain; // clock domain, empty when none declares it
+    uint64_t half;      // half period in picoseconds
+    uint64_t next;      // time of the next toggle
+};
+
+// Counter with its clock inputs driven at their domains' frequencies, the
+// primary clock first
+class CounterHarness {
+public:
+    std::vector<CounterClock> clocks;
+
+    CounterHarness() : ctx(new VerilatedContext), top(new VCounter(ctx.get())) {
+        clocks.push_back({"clk", "sys", 5000, 5000});
+        top->eval();
+    }
+
+    ~CounterHarness() { close(); }
+
+    // Dump a waveform to path from now on
+    void trace(const char* path) {
+        ctx->traceEverOn(true);
+        tfp.reset(new VerilatedVcdC);
+        top->trace(tfp.get(), 99);
+        tfp->open(path);
+        tfp->dump(time);
+    }
+
+    // Finish the simulation
+    void close() {
+        if (closed) return;
+        closed = true;
+        top->final();
+        if (tfp) tfp->close();
+    }
+
+    // Drive every input but the clocks and settle the design
+    void poke(const CounterPorts& p) {
+        top->rst = p.rst;
+        top->en = p.en;
+        eval();
+    }
+
+    // Values of every port
+    CounterPorts peek() {
+        CounterPorts p;
+        p.clk = top->clk;
+        p.rst = top->rst;
+        p.en = top->en;
+        p.count = top->count;
+        return p;
+    }
+
+    // Drive an input by name, false if there is no such input or it is a
+    // clock. Call eval once the inputs are set.
+    bool set(const std::string& name, uint64_t value) {
+        if (name == "rst") { top->rst = value & 0x1ULL; return true; }
+        if (name == "en") { top->en = value & 0x1ULL; return true; }
+        return false;
+    }
+
+    // Read a port by name, false if there is no such port
+    bool get(const std::string& name, uint64_t& value) {
+        if (name == "clk") { value = top->clk; return true; }
+        if (name == "rst") { value = top->rst; return true; }
+        if (name == "en") { value = top->en; return true; }
+        if (name == "count") { value = top->count; return true; }
+        return false;
+    }
+
+    // Settle the design after inputs changed
+    void eval() {
+        top->eval();
+        if (tfp) tfp->dump(time);
+    }
+
+    // Index of a clock by input or domain name, -1 if there is none
+    int clock(const std::string& name) const {
+        for (size_t i = 0; i < clocks.size(); i++) {
+            if (name == clocks[i].name || name == clocks[i].domain) return int(i);
+        }
+        return -1;
+    }
+
+    // Advance by n rising edges of a clock
+    void step(int clock, int n) {
+        for (int rises = 0; rises < n;) {
+            bool before = level(clock);
+            tick();
+            if (!before && level(clock)) rises++;
+        }
+    }
+
+    // Simulation time in picoseconds
+    uint64_t now() const { return time; }
+
+private:
+    // Advance to the next edge of any clock
+    void tick() {
+        uint64_t next = clocks[0].next;
+        for (const auto& c : clocks) {
+            if (c.next < next) next = c.next;
+        }
+        time = next;
+        ctx->time(time);
+        for (size_t i = 0; i < clocks.size(); i++) {
+            if (clocks[i].next != time) continue;
+            toggle(int(i));
+            clocks[i].next += clocks[i].half;
+        }
+        eval();
+    }
+
+    bool level(int clock) {
+        switch (clock) {
+        case 0: return top->clk;
+        default: return false;
+        }
+    }
+
+    void toggle(int clock) {
+        switch (clock) {
+        case 0: top->clk = !top->clk; break;
+        default: break;
+        }
+    }
+
+    std::unique_ptr<VerilatedContext> ctx;
+    std::unique_ptr<VCounter> top;
+    std::unique_ptr<VerilatedVcdC> tfp;
+    uint64_t time = 0;
+    bool closed = false;
+};
+
+#endif
@@ -0,0 +1,92 @@
+// Line protocol driving the Counter harness from stdin to stdout. Generated,
+// do not edit.
+//
+//   set <input>=<hex> ...      drive inputs
+//   get <port> ...             answer ok <hex> ...
+//   step [<clock>] <n>         n rising edges, answer ok <time in ps>
+//   cycle [<input>=<hex> ...]  drive inputs and run one primary clock edge,
+//                              answer ok <output>=<hex> ...
+//   time                       answer ok <time in ps>
+//   quit
+//
+// Other commands answer ok, failures answer error <message>.
+#include <cstdio>
+#include <cstdlib>
+#include <iostream>
+#include <sstream>
+#include <string>
+
+#include "Counter_harness.h"
+
+// Drive an input from a <name>=<hex> word
+static bool assign(CounterHarness& h, const std::string& word, std::string& err) {
+    size_t eq = word.find('=');
+    if (eq == std::string::npos) {
+        err = "expected <input>=<hex>, got " + word;
+        return false;
+    }
+    std::string port = word.substr(0, eq), digits = word.substr(eq + 1);
+    char* end = nullptr;
+    uint64_t value = std::strtoull(digits.c_str(), &end, 16);
+    if (digits.empty() || *end != '\0') {
+        err = "bad value " + digits + " for " + port;
+        return false;
+    }
+    if (!h.set(port, value)) {
+        err = "no input " + port;
+        return false;
+    }
+    return true;
+}
+
+int main(int argc, char** argv) {
+    CounterHarness h;
+    if (argc > 1) h.trace(argv[1]);
+    std::string line;
+    while (std::getline(std::cin, line)) {
+        std::istringstream in(line);
+        std::ostringstream reply;
+        std::string cmd, word, err;
+        if (!(in >> cmd)) continue;
+        reply << std::hex;
+        if (cmd == "set" || cmd == "cycle") {
+            while (err.empty() && in >> word) assign(h, word, err);
+            h.eval();
+            if (err.empty() && cmd == "cycle") {
+                if (!h.clocks.empty()) h.step(0, 1);
+                CounterPorts p = h.peek();
+                reply << " count=" << uint64_t(p.count);
+            }
+        } else if (cmd == "get") {
+            uint64_t value;
+            while (err.empty() && in >> word) {
+                if (h.get(word, value)) reply << " " << value;
+                else err = "no port " + word;
+            }
+        } else if (cmd == "step") {
+            std::string first, second;
+            in >> first >> second;
+            std::string clock = second.empty() ? "" : first;
+            std::string count = second.empty() ? first : second;
+            int index = clock.empty() ? 0 : h.clock(clock);
+            char* end = nullptr;
+            long n = std::strtol(count.c_str(), &end, 10);
+            if (h.clocks.empty()) err = "the design has no clock to step";
+            else if (index < 0) err = "no clock " + clock;
+            else if (count.empty() || *end != '\0' || n < 0) err = "bad cycle count " + count;
+            else {
+                h.step(index, int(n));
+                reply << std::dec << " " << h.now();
+            }
+        } else if (cmd == "time") {
+            reply << std::dec << " " << h.now();
+        } else if (cmd != "quit") {
+            err = "unknown command " + cmd;
+        }
+        if (err.empty()) std::cout << "ok" << reply.str() << std::endl;
+        else std::cout << "error " << err << std::endl;
+        if (cmd == "quit") break;
+    }
+    h.close();
+    return 0;
+}
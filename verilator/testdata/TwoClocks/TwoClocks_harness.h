@@ -0,0 +1,169 @@
+// Verilator harness for TwoClocks. Generated, do not edit.
+#ifndef TWOCLOCKS_HARNESS_H
+#define TWOCLOCKS_HARNESS_H
+
+#include <cstdint>
+#include <memory>
+#include <string>
+#include <vector>
+
+#include "verilated.h"
+#include "verilated_fst_c.h"
+#include "VTwoClocks.h"
+
+// Ports of TwoClocks
+struct TwoClocksPorts {
+    // Inputs
+    uint8_t fast_clk;
+    uint8_t slow_clk;
+    uint16_t a;
+    uint32_t b;
+    // Outputs
+    uint32_t fast_sum;
+    uint64_t slow_wide;
+};
+
+// Clock input driven by the harness
+struct TwoClocksClock {
+    const char* name;   // input port
+    const char* domain; // clock domain, empty when none declares it
+    uint64_t half;      // half period in picoseconds
+    uint64_t next;      // time of the next toggle
+};
+
+// TwoClocks with its clock inputs driven at their domains' frequencies, the
+// primary clock first
+class TwoClocksHarness {
+public:
+    std::vector<TwoClocksClock> clocks;
+
+    TwoClocksHarness() : ctx(new VerilatedContext), top(new VTwoClocks(ctx.get())) {
+        clocks.push_back({"fast_clk", "fast", 2500, 2500});
+        clocks.push_back({"slow_clk", "slow", 16666, 16666});
+        top->eval();
+    }
+
+    ~TwoClocksHarness() { close(); }
+
+    // Dump a waveform to path from now on
+    void trace(const char* path) {
+        ctx->traceEverOn(true);
+        tfp.reset(new VerilatedFstC);
+        top->trace(tfp.get(), 99);
+        tfp->open(path);
+        tfp->dump(time);
+    }
+
+    // Finish the simulation
+    void close() {
+        if (closed) return;
+        closed = true;
+        top->final();
+        if (tfp) tfp->close();
+    }
+
+    // Drive every input but the clocks and settle the design
+    void poke(const TwoClocksPorts& p) {
+        top->a = p.a;
+        top->b = p.b;
+        eval();
+    }
+
+    // Values of every port
+    TwoClocksPorts peek() {
+        TwoClocksPorts p;
+        p.fast_clk = top->fast_clk;
+        p.slow_clk = top->slow_clk;
+        p.a = top->a;
+        p.b = top->b;
+        p.fast_sum = top->fast_sum;
+        p.slow_wide = top->slow_wide;
+        return p;
+    }
+
+    // Drive an input by name, false if there is no such input or it is a
+    // clock. Call eval once the inputs are set.
+    bool set(const std::string& name, uint64_t value) {
+        if (name == "a") { top->a = value & 0xffffULL; return true; }
+        if (name == "b") { top->b = value & 0xffffffffULL; return true; }
+        return false;
+    }
+
+    // Read a port by name, false if there is no such port
+    bool get(const std::string& name, uint64_t& value) {
+        if (name == "fast_clk") { value = top->fast_clk; return true; }
+        if (name == "slow_clk") { value = top->slow_clk; return true; }
+        if (name == "a") { value = top->a; return true; }
+        if (name == "b") { value = top->b; return true; }
+        if (name == "fast_sum") { value = top->fast_sum; return true; }
+        if (name == "slow_wide") { value = top->slow_wide; return true; }
+        return false;
+    }
+
+    // Settle the design after inputs changed
+    void eval() {
+        top->eval();
+        if (tfp) tfp->dump(time);
+    }
+
+    // Index of a clock by input or domain name, -1 if there is none
+    int clock(const std::string& name) const {
+        for (size_t i = 0; i < clocks.size(); i++) {
+            if (name == clocks[i].name || name == clocks[i].domain) return int(i);
+        }
+        return -1;
+    }
+
+    // Advance by n rising edges of a clock
+    void step(int clock, int n) {
+        for (int rises = 0; rises < n;) {
+            bool before = level(clock);
+            tick();
+            if (!before && level(clock)) rises++;
+        }
+    }
+
+    // Simulation time in picoseconds
+    uint64_t now() const { return time; }
+
+private:
+    // Advance to the next edge of any clock
+    void tick() {
+        uint64_t next = clocks[0].next;
+        for (const auto& c : clocks) {
+            if (c.next < next) next = c.next;
+        }
+        time = next;
+        ctx->time(time);
+        for (size_t i = 0; i < clocks.size(); i++) {
+            if (clocks[i].next != time) continue;
+            toggle(int(i));
+            clocks[i].next += clocks[i].half;
+        }
+        eval();
+    }
+
+    bool level(int clock) {
+        switch (clock) {
+        case 0: return top->fast_clk;
+        case 1: return top->slow_clk;
+        default: return false;
+        }
+    }
+
+    void toggle(int clock) {
+        switch (clock) {
+        case 0: top->fast_clk = !top->fast_clk; break;
+        case 1: top->slow_clk = !top->slow_clk; break;
+        default: break;
+        }
+    }
+
+    std::unique_ptr<VerilatedContext> ctx;
+    std::unique_ptr<VTwoClocks> top;
+    std::unique_ptr<VerilatedFstC> tfp;
+    uint64_t time = 0;
+    bool closed = false;
+};
+
+#endif